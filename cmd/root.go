@@ -10,7 +10,10 @@ import (
 	flag "github.com/spf13/pflag"
 
 	"gonc/config"
+	"gonc/internal/balance"
 	"gonc/internal/core"
+	"gonc/internal/httpproxy"
+	"gonc/internal/socks5"
 	"gonc/tunnel"
 	"gonc/util"
 )
@@ -20,18 +23,25 @@ import (
 //	go build -ldflags "-X gonc/cmd.version=2.0.0"
 var version = "1.0.0" //nolint:gochecknoglobals
 
-// Execute parses args and runs the appropriate gonc mode.
+// Execute parses args and runs the appropriate gonc mode.  A leading
+// "replay" argument selects gonc replay, which takes the same flags.
 func Execute(ctx context.Context, args []string) error {
 	cfg := &config.Config{}
 	fs := flag.NewFlagSet("gonc", flag.ContinueOnError)
 
+	replay := len(args) > 0 && args[0] == "replay"
+	if replay {
+		args = args[1:]
+	}
+
 	// ── connection ───────────────────────────────────────────────
 	fs.BoolVarP(&cfg.Listen, "listen", "l", false, "Listen mode")
 	fs.IntVarP(&cfg.LocalPort, "port", "p", 0, "Local port number")
 	fs.BoolVarP(&cfg.UDP, "udp", "u", false, "UDP mode")
 	fs.BoolVarP(&cfg.NoDNS, "no-dns", "n", false, "Numeric-only, no DNS resolution")
 	fs.BoolVarP(&cfg.KeepOpen, "keep-open", "k", false, "Accept multiple connections (with -l)")
-	fs.BoolVarP(&cfg.ZeroIO, "zero-io", "z", false, "Zero-I/O mode (port scanning)")
+	fs.BoolVarP(&cfg.ZeroIO, "zero-io", "z", false, "Zero-I/O mode (port scanning; TCP, or UDP with -u)")
+	fs.IntVar(&cfg.ScanRetries, "scan-retries", config.DefaultScanRetries, "Resend unanswered UDP scan probes N times (with -u -z)")
 
 	var timeoutSec int
 	fs.IntVarP(&timeoutSec, "timeout", "w", 0, "Timeout in seconds")
@@ -39,6 +49,23 @@ func Execute(ctx context.Context, args []string) error {
 	// ── execution ────────────────────────────────────────────────
 	fs.StringVarP(&cfg.Execute, "exec", "e", "", "Execute program after connect")
 	fs.StringVarP(&cfg.Command, "command", "c", "", "Execute shell command after connect")
+	fs.StringVar(&cfg.Forward, "forward", "", "Bridge each connection to upstream host:port, TCP or UDP (with -l)")
+	var sniRouteSpecs []string
+	fs.StringArrayVar(&sniRouteSpecs, "sni-route", nil, "Pass TLS through to an upstream by SNI: NAME=[addr:]port, NAME may be *.domain or * (repeatable, with -l)")
+
+	// ── SOCKS5 server ────────────────────────────────────────────
+	fs.BoolVar(&cfg.SOCKS, "socks", false, "Serve each connection as a SOCKS5 proxy, dialling through -T when given (with -l)")
+	var socksAuthSpecs, socksAllowSpecs, socksDenySpecs []string
+	fs.StringArrayVar(&socksAuthSpecs, "socks-auth", nil, "Require a SOCKS5 login USER:PASS (repeatable; or set GONC_SOCKS_AUTH)")
+	fs.StringArrayVar(&socksAllowSpecs, "socks-allow", nil, "Only dial destinations matching CIDR, IP, host or *.domain, with optional :port; CIDR and IP rules resolve names (repeatable)")
+	fs.StringArrayVar(&socksDenySpecs, "socks-deny", nil, "Never dial destinations matching CIDR, IP, host or *.domain, with optional :port; CIDR and IP rules resolve names (repeatable)")
+
+	// ── HTTP proxy ───────────────────────────────────────────────
+	fs.BoolVar(&cfg.HTTPProxy, "http-proxy", false, "Serve each connection as an HTTP proxy (CONNECT and http://), dialling through -T when given (with -l)")
+	var httpProxyAuthSpecs, httpProxyHostSpecs []string
+	fs.StringArrayVar(&httpProxyAuthSpecs, "http-proxy-auth", nil, "Require a proxy Basic login USER:PASS (repeatable; or set GONC_HTTP_PROXY_AUTH)")
+	fs.IntSliceVar(&cfg.HTTPProxyPorts, "http-proxy-ports", nil, "Only dial these destination ports, e.g. 80,443")
+	fs.StringArrayVar(&httpProxyHostSpecs, "http-proxy-hosts", nil, "Only dial hosts matching a name, *.domain, IP or CIDR, as --socks-allow but without :port; names are not resolved (repeatable)")
 
 	// ── SSH tunnel ───────────────────────────────────────────────
 	fs.StringVarP(&cfg.TunnelSpec, "tunnel", "T", "", "SSH tunnel via [user@]host[:port]")
@@ -57,9 +84,72 @@ func Execute(ctx context.Context, args []string) error {
 	fs.IntVar(&cfg.KeepAliveInterval, "keep-alive", 30, "SSH keepalive interval in seconds (0 to disable)")
 	fs.BoolVar(&cfg.AutoReconnect, "auto-reconnect", false, "Auto-reconnect on tunnel drop")
 
+	var routeSpecs []string
+	fs.StringArrayVar(&routeSpecs, "route", nil, "Route HTTP Host / TLS SNI to a local target: HOST=[addr:]port (repeatable, for -R)")
+
+	var allowSpecs, denySpecs []string
+	fs.StringArrayVar(&allowSpecs, "allow", nil, "Only bridge originators in CIDR (repeatable, for -R)")
+	fs.StringArrayVar(&denySpecs, "deny", nil, "Reject originators in CIDR (repeatable, for -R)")
+	fs.DurationVar(&cfg.ExposeFor, "expose-for", 0, "Cancel the remote forward after this long, e.g. 30m (for -R)")
+	fs.IntVar(&cfg.MaxConnections, "max-conns", 0, "Cancel the remote forward after N connections (for -R)")
+	fs.IntVar(&cfg.MaxConcurrent, "max-concurrent", 0, "Reject connections beyond N simultaneous (for -R)")
+	fs.StringVar(&cfg.URLFile, "url-file", "", "Write the public URL announced by the gateway to FILE (for -R)")
+	fs.BoolVar(&cfg.URLQR, "url-qr", false, "Show the public URL announced by the gateway as a QR code (for -R)")
+
+	// ── PROXY protocol ───────────────────────────────────────────
+	var proxyProtoVersion string
+	fs.StringVar(&proxyProtoVersion, "proxy-protocol", "", "Send a PROXY protocol header (v1|v2) on outbound / -R local dials")
+	fs.BoolVar(&cfg.AcceptProxyProtocol, "accept-proxy-protocol", false, "Require and strip PROXY protocol headers (with -l)")
+
+	// ── traffic shaping ──────────────────────────────────────────
+	var rateLimit, globalRateLimit, maxBytes string
+	fs.StringVar(&rateLimit, "rate-limit", "", "Limit each session to RATE per direction, e.g. 1MiB/s or 10Mbit/s")
+	fs.StringVar(&globalRateLimit, "global-rate-limit", "", "Limit all sessions together to RATE per direction")
+	fs.StringVar(&maxBytes, "max-bytes", "", "Close a session after it moves SIZE bytes, e.g. 500MB")
+
+	// ── fault-injection proxy ────────────────────────────────────
+	fs.StringVar(&cfg.ProxyUpstream, "proxy", "", "Bridge each connection to upstream host:port (with -l)")
+	var faultSpecs []string
+	fs.StringArrayVar(&faultSpecs, "fault", nil, "Inject faults, e.g. up:latency=100ms,jitter=20ms or down:reset=1% (repeatable, for --proxy)")
+	fs.Uint64Var(&cfg.FaultSeed, "fault-seed", 0, "Seed for reproducible --fault randomness (0 = random)")
+
+	// ── load balancing ───────────────────────────────────────────
+	var lbStrategy string
+	fs.StringArrayVar(&cfg.Backends, "backend", nil, "Balance over another upstream host:port (repeatable, for --forward, --proxy, -R)")
+	fs.StringVar(&lbStrategy, "lb", "round-robin", "Backend selection: round-robin, least-conn or random")
+	fs.DurationVar(&cfg.HealthInterval, "health-interval", config.DefaultHealthInterval, "Dial each backend this often to check it is up (0 = passive only)")
+
+	// ── traffic mirroring ────────────────────────────────────────
+	var mirrorBuffer string
+	fs.StringVar(&cfg.Mirror, "mirror", "", "Copy client → server traffic to a shadow host:port, discarding its replies (for --proxy, -R)")
+	fs.StringVar(&mirrorBuffer, "mirror-buffer", "", "Drop a --mirror target once it lags SIZE bytes behind (default 4MiB)")
+
+	// ── TLS ──────────────────────────────────────────────────────
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "Terminate TLS with this PEM certificate, reloaded on SIGHUP (with -l)")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "PEM private key for --tls-cert")
+	fs.StringVar(&cfg.TLSClientCA, "tls-client-ca", "", "Require client certificates signed by this PEM CA bundle")
+	fs.StringVar(&cfg.TLSClientInfo, "tls-client-info", "", "Pass the client identity upstream: proxy (PROXY v2 TLVs) or headers (X-Client-Cert-*)")
+	fs.BoolVar(&cfg.TLSUpstream, "tls-upstream", false, "Originate TLS to the upstream (connect mode, --forward, --sni-route, --proxy)")
+	fs.StringVar(&cfg.TLSCA, "tls-ca", "", "Verify the upstream against this PEM CA bundle instead of the system roots")
+	fs.StringVar(&cfg.TLSUpstreamCert, "tls-upstream-cert", "", "Client certificate to present to mTLS upstreams")
+	fs.StringVar(&cfg.TLSUpstreamKey, "tls-upstream-key", "", "PEM private key for --tls-upstream-cert")
+	fs.StringVar(&cfg.TLSServerName, "tls-server-name", "", "Name to verify on the upstream certificate (default: the dialled host)")
+
 	// ── output / diagnostics ─────────────────────────────────────
 	fs.CountVarP(&cfg.Verbose, "verbose", "v", "Increase verbosity (repeatable)")
+	fs.StringVar(&cfg.LogFormat, "log-format", "text", "Log format: text, json or logfmt")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "Write logs to this file instead of stderr")
+	fs.IntVar(&cfg.LogMaxSize, "log-max-size", config.DefaultLogMaxSize, "Rotate --log-file after this many MB (0 = never)")
+	fs.IntVar(&cfg.LogMaxBackups, "log-max-backups", config.DefaultLogMaxBackups, "Rotated log files to keep")
 	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Validate config and exit without executing")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "Serve Prometheus /metrics and /healthz on host:port")
+	fs.StringVar(&cfg.ControlAddr, "control", "", "Serve the admin API on unix:PATH or loopback host:port (-R, -l)")
+	fs.StringVar(&cfg.AuditLog, "audit-log", "", "Append a JSON line per connection to this file")
+	fs.StringVarP(&cfg.HexDump, "hex-dump", "o", "", "Hex dump session traffic to FILE (- for stderr)")
+	fs.StringVar(&cfg.Tee, "tee", "", "Copy raw session traffic to PREFIX.N.in / PREFIX.N.out")
+	fs.StringVar(&cfg.Pcap, "pcap", "", "Write session traffic to FILE as a synthetic pcap for Wireshark")
+	fs.StringVar(&cfg.Record, "record", "", "Record session traffic with timestamps to FILE for gonc replay")
+	fs.Float64Var(&cfg.ReplaySpeed, "speed", config.DefaultReplaySpeed, "Replay timing multiplier: 2 = twice as fast, 0 = no delays (replay)")
 
 	var showVersion, showHelp bool
 	fs.BoolVar(&showVersion, "version", false, "Print version and exit")
@@ -88,6 +178,109 @@ func Execute(ctx context.Context, args []string) error {
 		cfg.Timeout = time.Duration(timeoutSec) * time.Second
 	}
 
+	if proxyProtoVersion != "" {
+		v, err := config.ParseProxyProtocolVersion(proxyProtoVersion)
+		if err != nil {
+			return err
+		}
+		cfg.ProxyProtocol = v
+	}
+
+	if err := parseShaping(cfg, rateLimit, globalRateLimit, maxBytes); err != nil {
+		return err
+	}
+
+	strategy, err := balance.ParseStrategy(lbStrategy)
+	if err != nil {
+		return fmt.Errorf("lb: %w", err)
+	}
+	cfg.LBStrategy = strategy
+
+	if mirrorBuffer != "" {
+		if cfg.MirrorBuffer, err = config.ParseByteSize(mirrorBuffer); err != nil {
+			return fmt.Errorf("mirror-buffer: %w", err)
+		}
+	}
+
+	for _, spec := range faultSpecs {
+		if err := config.ApplyFaultSpec(&cfg.Faults, spec); err != nil {
+			return err
+		}
+	}
+
+	for _, spec := range routeSpecs {
+		r, err := config.ParseRouteSpec(spec)
+		if err != nil {
+			return fmt.Errorf("route: %w", err)
+		}
+		cfg.Routes = append(cfg.Routes, r)
+	}
+
+	for _, spec := range sniRouteSpecs {
+		r, err := config.ParseRouteSpec(spec)
+		if err != nil {
+			return fmt.Errorf("sni-route: %w", err)
+		}
+		cfg.SNIRoutes = append(cfg.SNIRoutes, r)
+	}
+
+	for _, spec := range allowSpecs {
+		n, err := config.ParseCIDR(spec)
+		if err != nil {
+			return fmt.Errorf("allow: %w", err)
+		}
+		cfg.AllowCIDRs = append(cfg.AllowCIDRs, n)
+	}
+	for _, spec := range denySpecs {
+		n, err := config.ParseCIDR(spec)
+		if err != nil {
+			return fmt.Errorf("deny: %w", err)
+		}
+		cfg.DenyCIDRs = append(cfg.DenyCIDRs, n)
+	}
+
+	for _, spec := range socksAuthSpecs {
+		user, pass, err := config.ParseLogin(spec)
+		if err != nil {
+			return fmt.Errorf("socks-auth: %w", err)
+		}
+		if cfg.SOCKSUsers == nil {
+			cfg.SOCKSUsers = make(map[string]string)
+		}
+		cfg.SOCKSUsers[user] = pass
+	}
+	for _, spec := range socksAllowSpecs {
+		r, err := socks5.ParseRule(spec)
+		if err != nil {
+			return fmt.Errorf("socks-allow: %w", err)
+		}
+		cfg.SOCKSAllow = append(cfg.SOCKSAllow, r)
+	}
+	for _, spec := range socksDenySpecs {
+		r, err := socks5.ParseRule(spec)
+		if err != nil {
+			return fmt.Errorf("socks-deny: %w", err)
+		}
+		cfg.SOCKSDeny = append(cfg.SOCKSDeny, r)
+	}
+	for _, spec := range httpProxyAuthSpecs {
+		user, pass, err := config.ParseLogin(spec)
+		if err != nil {
+			return fmt.Errorf("http-proxy-auth: %w", err)
+		}
+		if cfg.HTTPProxyUsers == nil {
+			cfg.HTTPProxyUsers = make(map[string]string)
+		}
+		cfg.HTTPProxyUsers[user] = pass
+	}
+	for _, spec := range httpProxyHostSpecs {
+		r, err := httpproxy.ParseHost(spec)
+		if err != nil {
+			return fmt.Errorf("http-proxy-hosts: %w", err)
+		}
+		cfg.HTTPProxyHosts = append(cfg.HTTPProxyHosts, r)
+	}
+
 	// ── reverse tunnel spec (before positional parsing so that ────
 	// ── -R can imply listen mode and skip hostname requirement) ───
 	if cfg.ReverseTunnelSpec != "" {
@@ -116,7 +309,11 @@ func Execute(ctx context.Context, args []string) error {
 	}
 
 	// ── positional arguments ─────────────────────────────────────
-	if err := parsePositional(cfg, fs.Args()); err != nil {
+	if replay {
+		if err := parseReplayPositional(cfg, fs.Args()); err != nil {
+			return err
+		}
+	} else if err := parsePositional(cfg, fs.Args()); err != nil {
 		return err
 	}
 
@@ -147,7 +344,11 @@ func Execute(ctx context.Context, args []string) error {
 	}
 
 	// ── build and run ────────────────────────────────────────────
-	logger := util.NewLogger(cfg.Verbose)
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
 
 	mode, err := core.Build(cfg, logger)
 	if err != nil {
@@ -158,6 +359,26 @@ func Execute(ctx context.Context, args []string) error {
 
 // ── helpers ──────────────────────────────────────────────────────────
 
+// newLogger builds the logger described by the --log-* flags.  The
+// returned func closes the log file, if any.
+func newLogger(cfg *config.Config) (*util.Logger, func(), error) {
+	logger := util.NewLogger(cfg.Verbose)
+	format, _ := util.ParseLogFormat(cfg.LogFormat) // checked by Validate
+
+	closeLog := func() {}
+	if cfg.LogFile != "" {
+		f, err := util.OpenRotatingFile(cfg.LogFile, int64(cfg.LogMaxSize)<<20, cfg.LogMaxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("log file: %w", err)
+		}
+		logger.SetOutput(f)
+		logger.SetTimestamps(true) // no terminal to watch the lines arrive
+		closeLog = func() { f.Close() }
+	}
+	logger.SetFormat(format)
+	return logger, closeLog, nil
+}
+
 func parsePositional(cfg *config.Config, remaining []string) error {
 	if cfg.Listen {
 		switch len(remaining) {
@@ -200,6 +421,47 @@ func parsePositional(cfg *config.Config, remaining []string) error {
 	return nil
 }
 
+// parseShaping converts the --rate-limit, --global-rate-limit and
+// --max-bytes strings into byte counts.
+func parseShaping(cfg *config.Config, rate, globalRate, maxBytes string) error {
+	var err error
+	if rate != "" {
+		if cfg.RateLimit, err = config.ParseRate(rate); err != nil {
+			return fmt.Errorf("rate-limit: %w", err)
+		}
+	}
+	if globalRate != "" {
+		if cfg.GlobalRateLimit, err = config.ParseRate(globalRate); err != nil {
+			return fmt.Errorf("global-rate-limit: %w", err)
+		}
+	}
+	if maxBytes != "" {
+		if cfg.MaxBytes, err = config.ParseByteSize(maxBytes); err != nil {
+			return fmt.Errorf("max-bytes: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseReplayPositional handles gonc replay <recording> [host port].
+func parseReplayPositional(cfg *config.Config, remaining []string) error {
+	switch len(remaining) {
+	case 1, 3:
+		cfg.Replay = remaining[0]
+	default:
+		return fmt.Errorf("usage: gonc replay [options] <recording> [host port]")
+	}
+	if len(remaining) == 3 {
+		cfg.Host = remaining[1]
+		pr, err := config.ParsePortSpec(remaining[2])
+		if err != nil {
+			return fmt.Errorf("port: %w", err)
+		}
+		cfg.Port = pr.Start
+	}
+	return nil
+}
+
 func printUsage(fs *flag.FlagSet) {
 	fmt.Fprintf(os.Stderr, `GoNC - Network Connectivity Tool v%s
 
@@ -209,9 +471,11 @@ Single static binary. Zero configuration files required.
 Usage:
   gonc [options] <host> <port> [ports...]             Connect
   gonc -l -p <port> [options]                         Listen
+  gonc -l -p <port> --proxy <host:port> [options]     Fault-injection proxy
   gonc -z [options] <host> <ports...>                 Scan
   gonc -T user@gateway <host> <port>                  SSH tunnel (forward)
   gonc -p <port> -R [user@]host --remote-port <port>  Reverse tunnel
+  gonc replay [options] <recording> [host port]       Replay a --record file
 
 Options:
 `, version)
@@ -221,6 +485,8 @@ Environment Variables:
   GONC_HOST, GONC_PORT, GONC_LISTEN, GONC_UDP, GONC_VERBOSE
   GONC_TUNNEL, GONC_SSH_KEY, GONC_SSH_AGENT, GONC_STRICT_HOSTKEY
   GONC_REVERSE_TUNNEL, GONC_REMOTE_PORT, GONC_AUTO_RECONNECT
+  GONC_LOG_FORMAT, GONC_LOG_FILE, GONC_METRICS_ADDR
+  GONC_CONTROL, GONC_AUDIT_LOG
 
   Precedence: CLI flags > Environment > Defaults
 
@@ -228,6 +494,7 @@ Examples:
   gonc example.com 80                         TCP connect
   gonc -l -p 8080                             Listen on 8080
   gonc -vz host.example.com 20-25 80 443      Port scan
+  gonc -vzu host.example.com 53 123 161       UDP port scan
   gonc -T admin@bastion db-internal 5432      SSH forward tunnel
   echo "hello" | gonc host.example.com 9000   Pipe data
 
@@ -237,6 +504,64 @@ Examples:
   # Expose local port 3000 via serveo.net (developer tunnel)
   gonc -p 3000 -R serveo.net --remote-port 80
 
+  # Expose tunnel health for monitoring (GET /metrics, /healthz)
+  gonc -p 8080 -R user@gateway --remote-port 9000 --auto-reconnect --metrics-addr 127.0.0.1:9100
+
+  # Structured logs for a supervisor, rotated at 10 MB
+  gonc -p 8080 -R user@gateway --remote-port 9000 --log-format json --log-file /var/log/gonc.log
+
+  # Inspect and steer a running tunnel (curl --unix-socket /tmp/gonc.sock http://gonc/connections)
+  gonc -p 8080 -R user@gateway --remote-port 9000 --control unix:/tmp/gonc.sock
+
+  # Debug a binary protocol through a tunnel: hex dump plus raw copies
+  gonc -p 8080 -R user@gateway --remote-port 9000 -o /tmp/dump.txt --tee /tmp/session
+
+  # Open traffic from inside an SSH tunnel in Wireshark
+  gonc -T admin@bastion db-internal 5432 --pcap /tmp/db.pcap
+
+  # Capture a flaky exchange, then replay it against staging twice as fast
+  gonc --record bug.rec redis-prod 6379
+  gonc replay --speed 2 bug.rec redis-staging 6379
+
+  # Give contractors staging access without saturating the uplink
+  gonc -p 8080 -R user@gateway --remote-port 9000 --rate-limit 1MiB/s --global-rate-limit 4MiB/s --max-bytes 2GB
+
+  # Multi-client port forwarder to a database behind a bastion
+  gonc -l -k -p 15432 --forward db-internal:5432 -T admin@bastion
+
+  # One port in front of several TLS services, keys stay on the backends
+  gonc -l -k -p 443 --sni-route git.lab=10.0.0.5:443 --sni-route '*.k8s.lab=10.0.0.6:443' --forward 10.0.0.2:443
+
+  # Put TLS with client certificates in front of a legacy HTTP service
+  gonc -l -k -p 443 --tls-cert srv.crt --tls-key srv.key --tls-client-ca clients.pem --tls-client-info headers --forward 127.0.0.1:8080
+
+  # Talk to an mTLS-only service from a plaintext tool
+  gonc -l -k -p 6380 --forward redis.prod:6380 --tls-upstream --tls-ca ca.pem --tls-upstream-cert me.crt --tls-upstream-key me.key
+
+  # SOCKS5 proxy into the corporate domain behind a bastion, with logins
+  GONC_SOCKS_AUTH=alice:s3cret gonc -l -k -p 1080 --socks -T admin@bastion --socks-allow '*.corp.example' --audit-log socks.jsonl
+
+  # Corporate HTTP proxy through a bastion for tools that only honour HTTP_PROXY
+  GONC_HTTP_PROXY_AUTH=alice:s3cret gonc -l -k -p 3128 --http-proxy -T admin@bastion --http-proxy-ports 80,443 --audit-log proxy.jsonl
+
+  # Stand in for a flaky network between a test suite and its database
+  gonc -l -p 15432 --proxy localhost:5432 --fault latency=50ms,jitter=20ms --fault down:reset=0.5%% --control unix:/tmp/gonc.sock
+
+  # Keep an append-only record of every session for later review
+  gonc -l -k -p 2222 -e /bin/sh --audit-log /var/log/gonc-audit.jsonl
+
+  # Save the generated public URL for a CI job to pick up
+  gonc -p 3000 -R serveo.net --remote-port 80 --url-file preview-url.txt
+
+  # Serve two virtual hosts through one reverse tunnel
+  gonc -p 3000 -R serveo.net --remote-port 80 --route api.example=8080
+
+  # Tell the local service who the real client is
+  gonc -p 8080 -R user@gateway --remote-port 9000 --proxy-protocol v2
+
+  # Share a dev server with one office network for half an hour
+  gonc -p 3000 -R user@gateway --remote-port 80 --allow 203.0.113.0/24 --expose-for 30m
+
   # Validate configuration without executing
   gonc --dry-run -p 3000 -R serveo.net --remote-port 80
 `)
@@ -71,3 +71,81 @@ func TestExecute_ConflictingFlags(t *testing.T) {
 		t.Errorf("error should mention mutually exclusive: %v", err)
 	}
 }
+
+// TestExecute_ReplayDryRun verifies the replay subcommand's arguments.
+func TestExecute_ReplayDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"recorded target", []string{"replay", "--dry-run", "bug.rec"}, false},
+		{"explicit target", []string{"replay", "--speed", "2", "--dry-run", "bug.rec", "localhost", "6379"}, false},
+		{"host without port", []string{"replay", "--dry-run", "bug.rec", "localhost"}, true},
+		{"negative speed", []string{"replay", "--speed", "-1", "--dry-run", "bug.rec"}, true},
+		{"with listen", []string{"replay", "-l", "-p", "80", "--dry-run", "bug.rec"}, true},
+		{"bad log format", []string{"replay", "--log-format", "xml", "--dry-run", "bug.rec"}, true},
+		{"negative log size", []string{"replay", "--log-max-size", "-1", "--dry-run", "bug.rec"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Execute(context.Background(), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestExecute_ProxyDryRun verifies --proxy, --fault, --forward,
+// --sni-route, --backend, --mirror and --tls-* parsing.
+func TestExecute_ProxyDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"plain proxy", []string{"-l", "-p", "15432", "--proxy", "localhost:5432", "--dry-run"}, false},
+		{"with faults", []string{"-l", "-p", "15432", "--proxy", "localhost:5432",
+			"--fault", "latency=50ms,jitter=10ms", "--fault", "down:reset=1%", "--dry-run"}, false},
+		{"bad fault", []string{"-l", "-p", "15432", "--proxy", "localhost:5432", "--fault", "up:lag=1s", "--dry-run"}, true},
+		{"fault without proxy", []string{"-l", "-p", "15432", "--fault", "latency=1s", "--dry-run"}, true},
+		{"proxy without listen", []string{"--proxy", "localhost:5432", "--dry-run", "localhost", "80"}, true},
+		{"forward", []string{"-l", "-k", "-p", "8080", "--forward", "localhost:5432", "--dry-run"}, false},
+		{"forward udp", []string{"-l", "-k", "-u", "-p", "5353", "--forward", "localhost:53", "--dry-run"}, false},
+		{"forward with backends", []string{"-l", "-k", "-p", "8080", "--forward", "app1:80", "--backend", "app2:80", "--lb", "least-conn", "--dry-run"}, false},
+		{"unknown lb strategy", []string{"-l", "-p", "8080", "--forward", "app1:80", "--backend", "app2:80", "--lb", "weighted", "--dry-run"}, true},
+		{"proxy with mirror", []string{"-l", "-p", "8080", "--proxy", "app:80", "--mirror", "canary:80", "--mirror-buffer", "1MiB", "--dry-run"}, false},
+		{"bad mirror buffer", []string{"-l", "-p", "8080", "--proxy", "app:80", "--mirror", "canary:80", "--mirror-buffer", "lots", "--dry-run"}, true},
+		{"sni routes", []string{"-l", "-k", "-p", "443", "--sni-route", "git.lab=10.0.0.5:443", "--sni-route", "*.lab=8443", "--dry-run"}, false},
+		{"bad sni route", []string{"-l", "-k", "-p", "443", "--sni-route", "git.lab", "--dry-run"}, true},
+		{"forward with exec", []string{"-l", "-p", "8080", "--forward", "localhost:5432", "-e", "/bin/cat", "--dry-run"}, true},
+		{"tls termination", []string{"-l", "-k", "-p", "443", "--tls-cert", "s.crt", "--tls-key", "s.key", "--tls-client-ca", "ca.pem",
+			"--tls-client-info", "proxy", "--proxy-protocol", "v2", "--forward", "app:80", "--dry-run"}, false},
+		{"tls origination", []string{"--tls-upstream", "--tls-ca", "ca.pem", "--tls-server-name", "api.internal", "--dry-run", "10.0.0.9", "443"}, false},
+		{"tls cert without key", []string{"-l", "-p", "443", "--tls-cert", "s.crt", "--proxy", "app:80", "--dry-run"}, true},
+		{"tls client info headers", []string{"-l", "-p", "443", "--tls-cert", "s.crt", "--tls-key", "s.key", "--tls-client-info", "header", "--proxy", "app:80", "--dry-run"}, true},
+		{"socks", []string{"-l", "-k", "-p", "1080", "--socks", "--socks-auth", "alice:s3:cret", "--socks-deny", "169.254.0.0/16", "--socks-allow", "*.corp.example:443", "--dry-run"}, false},
+		{"socks through tunnel", []string{"-l", "-k", "-p", "1080", "--socks", "-T", "admin@bastion", "--dry-run"}, false},
+		{"bad socks login", []string{"-l", "-p", "1080", "--socks", "--socks-auth", "alice", "--dry-run"}, true},
+		{"bad socks rule", []string{"-l", "-p", "1080", "--socks", "--socks-deny", "10.0.0.0/40", "--dry-run"}, true},
+		{"socks rule without socks", []string{"-l", "-p", "1080", "--socks-allow", "10.0.0.0/8", "--dry-run"}, true},
+		{"socks with forward", []string{"-l", "-p", "1080", "--socks", "--forward", "app:80", "--dry-run"}, true},
+		{"http proxy", []string{"-l", "-k", "-p", "3128", "--http-proxy", "--http-proxy-auth", "alice:s3cret", "--http-proxy-ports", "80,443", "--http-proxy-hosts", "*.corp.example", "--dry-run"}, false},
+		{"http proxy through tunnel", []string{"-l", "-k", "-p", "3128", "--http-proxy", "-T", "admin@bastion", "--dry-run"}, false},
+		{"bad http proxy login", []string{"-l", "-p", "3128", "--http-proxy", "--http-proxy-auth", "alice", "--dry-run"}, true},
+		{"bad http proxy host", []string{"-l", "-p", "3128", "--http-proxy", "--http-proxy-hosts", "example.com:443", "--dry-run"}, true},
+		{"bad http proxy port", []string{"-l", "-p", "3128", "--http-proxy", "--http-proxy-ports", "70000", "--dry-run"}, true},
+		{"udp scan", []string{"-u", "-z", "--scan-retries", "2", "--dry-run", "10.0.0.1", "53", "123", "161"}, false},
+		{"negative scan retries", []string{"-u", "-z", "--scan-retries", "-1", "--dry-run", "10.0.0.1", "53"}, true},
+		{"http proxy with socks", []string{"-l", "-p", "3128", "--http-proxy", "--socks", "--dry-run"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Execute(context.Background(), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,12 +4,18 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"gonc/internal/balance"
+	"gonc/internal/control"
 	ncerr "gonc/internal/errors"
+	"gonc/internal/fault"
+	"gonc/internal/socks5"
+	"gonc/util"
 )
 
 // Config holds every tuneable for a single gonc session.
@@ -49,17 +55,93 @@ type Config struct {
 	CheckGatewayPorts    bool
 	KeepAliveInterval    int // seconds (0 = disable)
 	AutoReconnect        bool
+	Routes               []Route // --route: per-host local targets
+
+	// ── Reverse tunnel exposure policy ───────────────────────────────
+	AllowCIDRs     []*net.IPNet  // --allow: admit only these originators
+	DenyCIDRs      []*net.IPNet  // --deny: reject these originators
+	ExposeFor      time.Duration // cancel the forward after this long (0 = never)
+	MaxConnections int           // cancel the forward after N connections (0 = unlimited)
+	MaxConcurrent  int           // reject beyond N simultaneous connections (0 = unlimited)
+
+	// ── Public URL capture ───────────────────────────────────────────
+	URLFile string // write gateway-announced URLs to this file
+	URLQR   bool   // render gateway-announced URLs as terminal QR codes
+
+	// ── PROXY protocol ───────────────────────────────────────────────
+	ProxyProtocol       int  // 1 or 2: emit headers on outbound dials (0 = off)
+	AcceptProxyProtocol bool // strip incoming headers in listen mode
+
+	// ── Traffic shaping ──────────────────────────────────────────────
+	RateLimit       int64 // bytes/s per session and direction (0 = unlimited)
+	GlobalRateLimit int64 // bytes/s per direction across all sessions
+	MaxBytes        int64 // per-session quota, both directions combined
+
+	// ── Fault-injection proxy ────────────────────────────────────────
+	ProxyUpstream string         // --proxy: bridge listen-mode connections to host:port
+	Faults        fault.Settings // --fault: injected per direction
+	FaultSeed     uint64         // --fault-seed: reproducible faults (0 = random)
+
+	// ── Load balancing ───────────────────────────────────────────────
+	Backends       []string         // --backend: more upstreams for --forward, --proxy or -R
+	LBStrategy     balance.Strategy // --lb: backend selection order
+	HealthInterval time.Duration    // --health-interval: active check period (0 = passive only)
+
+	// ── Traffic mirroring ────────────────────────────────────────────
+	Mirror       string // --mirror: copy client → server bytes to this shadow host:port
+	MirrorBuffer int64  // --mirror-buffer: bytes a slow shadow may lag before it is dropped (0 = default)
+
+	// ── TLS ──────────────────────────────────────────────────────────
+	TLSCert         string // --tls-cert: terminate TLS on accepted connections with this certificate
+	TLSKey          string // --tls-key: private key for TLSCert
+	TLSClientCA     string // --tls-client-ca: require client certificates signed by this CA
+	TLSClientInfo   string // --tls-client-info: pass the client identity upstream as "proxy" TLVs or "headers"
+	TLSUpstream     bool   // --tls-upstream: originate TLS on outbound connections
+	TLSCA           string // --tls-ca: verify the upstream against this CA instead of the system roots
+	TLSUpstreamCert string // --tls-upstream-cert: client certificate for mTLS upstreams
+	TLSUpstreamKey  string // --tls-upstream-key: private key for TLSUpstreamCert
+	TLSServerName   string // --tls-server-name: name to verify instead of the dialled host
+
+	// ── SOCKS5 server ────────────────────────────────────────────────
+	SOCKS      bool              // --socks: serve each listen-mode connection as a SOCKS5 proxy
+	SOCKSUsers map[string]string // --socks-auth: required logins, user → password (empty = no auth)
+	SOCKSAllow []socks5.Rule     // --socks-allow: only dial matching destinations
+	SOCKSDeny  []socks5.Rule     // --socks-deny: never dial matching destinations
+
+	// ── HTTP proxy ───────────────────────────────────────────────────
+	HTTPProxy      bool              // --http-proxy: serve each listen-mode connection as an HTTP forward proxy
+	HTTPProxyUsers map[string]string // --http-proxy-auth: required Basic logins, user → password (empty = no auth)
+	HTTPProxyPorts []int             // --http-proxy-ports: only dial these destination ports (empty = any)
+	HTTPProxyHosts []socks5.Rule     // --http-proxy-hosts: only dial matching hosts (empty = any)
 
 	// ── Execution ────────────────────────────────────────────────────
-	Execute string // -e: program path
-	Command string // -c: shell command
+	Execute   string  // -e: program path
+	Command   string  // -c: shell command
+	Forward   string  // --forward: bridge each listen-mode session to host:port
+	SNIRoutes []Route // --sni-route: pick the listen-mode upstream by TLS SNI / HTTP Host
 
 	// ── Output ───────────────────────────────────────────────────────
-	Verbose int
-	ZeroIO  bool
+	Verbose       int
+	ZeroIO        bool
+	ScanRetries   int    // --scan-retries: resend a silent UDP probe this many times
+	LogFormat     string // text, json or logfmt
+	LogFile       string // write logs here instead of stderr
+	LogMaxSize    int    // rotate LogFile past this many MB (0 = never)
+	LogMaxBackups int    // rotated files to keep
 
 	// ── Diagnostics ──────────────────────────────────────────────────
-	DryRun bool // validate config and exit without executing
+	DryRun      bool   // validate config and exit without executing
+	MetricsAddr string // serve /metrics and /healthz on host:port
+	ControlAddr string // admin API on "unix:/path" or loopback host:port
+	AuditLog    string // append a JSON line per session to this file
+	HexDump     string // -o: hex dump of session traffic ("-" = stderr)
+	Tee         string // raw per-direction traffic files PREFIX.N.in / .out
+	Pcap        string // synthetic libpcap capture of session traffic
+	Record      string // timestamped session recording for gonc replay
+
+	// ── Replay ───────────────────────────────────────────────────────
+	Replay      string  // gonc replay: recording to re-send
+	ReplaySpeed float64 // timing multiplier (0 = no delays)
 }
 
 // ── Port helpers ─────────────────────────────────────────────────────
@@ -116,6 +198,252 @@ func ParsePortSpec(spec string) (PortRange, error) {
 	return PortRange{Start: port, End: port}, nil
 }
 
+// ── Route helpers ────────────────────────────────────────────────────
+
+// Route sends connections for a virtual host (HTTP Host header or TLS
+// SNI) to a specific local target.  Host may be an exact name, a
+// leading wildcard such as "*.example.com", or "*" for the default.
+type Route struct {
+	Host   string
+	Target string // host:port
+}
+
+// ParseRouteSpec parses "HOST=TARGET" where TARGET is host:port or a
+// bare port on [DefaultLocalAddress], e.g. "api.example=8080".
+func ParseRouteSpec(spec string) (Route, error) {
+	host, target, ok := strings.Cut(spec, "=")
+	host = strings.TrimSpace(host)
+	target = strings.TrimSpace(target)
+	if !ok || host == "" || target == "" {
+		return Route{}, fmt.Errorf("invalid route %q - expected HOST=[addr:]port", spec)
+	}
+
+	if !strings.Contains(target, ":") {
+		target = net.JoinHostPort(DefaultLocalAddress, target)
+	}
+	h, p, err := net.SplitHostPort(target)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid route target %q: %w", target, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return Route{}, fmt.Errorf("invalid route port %q", p)
+	}
+	if h == "" {
+		h = DefaultLocalAddress
+	}
+	return Route{Host: host, Target: net.JoinHostPort(h, p)}, nil
+}
+
+// ParseLogin parses a --socks-auth or --http-proxy-auth "USER:PASS"
+// login.  The password may itself contain colons.  Both parts are
+// limited to 255 bytes, the most SOCKS5 can carry.
+func ParseLogin(spec string) (user, pass string, err error) {
+	user, pass, ok := strings.Cut(spec, ":")
+	if !ok || user == "" || pass == "" {
+		return "", "", fmt.Errorf("invalid login %q - expected USER:PASS", spec)
+	}
+	if len(user) > 255 || len(pass) > 255 {
+		return "", "", fmt.Errorf("invalid login for %q - user and password are limited to 255 bytes", user)
+	}
+	return user, pass, nil
+}
+
+// ParseCIDR parses a network such as "10.0.0.0/8".  A bare IP address
+// is accepted as a single-host network (/32 or /128).
+func ParseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q", s)
+	}
+	return n, nil
+}
+
+// ParseProxyProtocolVersion accepts "v1", "v2", "1" or "2".
+func ParseProxyProtocolVersion(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "v1":
+		return 1, nil
+	case "2", "v2":
+		return 2, nil
+	default:
+		return 0, fmt.Errorf("invalid PROXY protocol version %q - expected v1 or v2", s)
+	}
+}
+
+// ── Size and rate parsers ────────────────────────────────────────────
+
+// byteUnits maps size suffixes to bytes.  Bit units are for rates
+// quoted the way links are sold ("10Mbit/s").
+var byteUnits = map[string]float64{
+	"":     1,
+	"b":    1,
+	"k":    1 << 10,
+	"kb":   1e3,
+	"kib":  1 << 10,
+	"m":    1 << 20,
+	"mb":   1e6,
+	"mib":  1 << 20,
+	"g":    1 << 30,
+	"gb":   1e9,
+	"gib":  1 << 30,
+	"kbit": 1e3 / 8,
+	"mbit": 1e6 / 8,
+	"gbit": 1e9 / 8,
+}
+
+var sizeRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)$`)
+
+// ParseByteSize parses a size such as "512", "100MB" or "1.5GiB".
+// Decimal units (KB, MB, GB) are powers of 1000; binary units (KiB,
+// MiB, GiB) and bare K, M, G are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	m := sizeRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q - expected e.g. 100MB or 1GiB", s)
+	}
+	unit, ok := byteUnits[m[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q - unknown unit %q", s, m[2])
+	}
+	n, _ := strconv.ParseFloat(m[1], 64)
+	if n*unit < 1 {
+		return 0, fmt.Errorf("invalid size %q - must be at least one byte", s)
+	}
+	return int64(n * unit), nil
+}
+
+// ParseRate parses a bandwidth such as "1MiB/s", "500KB" or
+// "10Mbit/s" into bytes per second.  The "/s" suffix is optional.
+func ParseRate(s string) (int64, error) {
+	trimmed := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s")
+	n, err := ParseByteSize(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q - expected e.g. 1MiB/s or 10Mbit/s", s)
+	}
+	return n, nil
+}
+
+// ── Fault-spec parser ────────────────────────────────────────────────
+
+// ApplyFaultSpec parses one --fault value and merges it into s.  The
+// form is [up:|down:]key=value[,key=value...]; without a direction the
+// faults apply both ways.  Keys:
+//
+//	latency=100ms  jitter=20ms  rate=1MiB/s  chunk=512
+//	reset=0.01  stall=2s  stall-prob=0.05  corrupt=0.001
+//
+// Probabilities may also be written as percentages, e.g. reset=1%.
+func ApplyFaultSpec(s *fault.Settings, spec string) error {
+	dirs := []*fault.Faults{&s.Up, &s.Down}
+	body := spec
+	if dir, rest, ok := strings.Cut(spec, ":"); ok && !strings.Contains(dir, "=") {
+		switch strings.ToLower(dir) {
+		case "up":
+			dirs = dirs[:1]
+		case "down":
+			dirs = dirs[1:]
+		case "both":
+		default:
+			return fmt.Errorf("invalid fault direction %q - expected up, down or both", dir)
+		}
+		body = rest
+	}
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("invalid fault spec %q - expected e.g. up:latency=100ms,jitter=20ms", spec)
+	}
+
+	for _, kv := range strings.Split(body, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return fmt.Errorf("invalid fault %q - expected key=value", kv)
+		}
+		key = strings.ToLower(key)
+		set, err := faultSetter(key, val)
+		if err != nil {
+			return fmt.Errorf("fault %s: %w", key, err)
+		}
+		for _, f := range dirs {
+			set(f)
+		}
+	}
+	return nil
+}
+
+// faultSetter parses val for key and returns a func storing it.
+func faultSetter(key, val string) (func(*fault.Faults), error) {
+	switch key {
+	case "latency", "jitter", "stall":
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration %q - expected e.g. 100ms", val)
+		}
+		return func(f *fault.Faults) {
+			switch key {
+			case "latency":
+				f.Latency = d
+			case "jitter":
+				f.Jitter = d
+			default:
+				f.Stall = d
+			}
+		}, nil
+	case "rate":
+		n, err := ParseRate(val)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *fault.Faults) { f.Rate = n }, nil
+	case "chunk":
+		n, err := ParseByteSize(val)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *fault.Faults) { f.Chunk = int(n) }, nil
+	case "reset", "stall-prob", "corrupt":
+		p, err := parseProbability(val)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *fault.Faults) {
+			switch key {
+			case "reset":
+				f.Reset = p
+			case "stall-prob":
+				f.StallProb = p
+			default:
+				f.Corrupt = p
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown fault - expected latency, jitter, rate, chunk, reset, stall, stall-prob or corrupt")
+}
+
+// parseProbability parses "0.05" or "5%".
+func parseProbability(s string) (float64, error) {
+	pct := strings.HasSuffix(s, "%")
+	p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if pct {
+		p /= 100
+	}
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("invalid probability %q - expected 0-1 or 0-100%%", s)
+	}
+	return p, nil
+}
+
 // ── Tunnel-spec parser ───────────────────────────────────────────────
 
 // tunnelRe matches [user@]host[:port].
@@ -148,6 +476,10 @@ func ParseTunnelSpec(spec string) (user, host string, port int, err error) {
 // Validate checks that the configuration is internally consistent.
 // Errors returned are [ncerr.ConfigError] when the field is known.
 func (c *Config) Validate() error {
+	if c.Replay != "" {
+		return c.validateReplay()
+	}
+
 	if c.Listen {
 		if c.LocalPort == 0 {
 			return &ncerr.ConfigError{
@@ -163,11 +495,11 @@ func (c *Config) Validate() error {
 				Hint:    "use -z without -l for port scanning",
 			}
 		}
-		if c.TunnelEnabled {
+		if c.TunnelEnabled && c.ProxyUpstream == "" && c.Forward == "" && len(c.SNIRoutes) == 0 && !c.SOCKS && !c.HTTPProxy {
 			return &ncerr.ConfigError{
 				Field:   "tunnel",
 				Message: "listen mode through a forward SSH tunnel (-T) is not supported",
-				Hint:    "use -R for reverse tunnels instead",
+				Hint:    "use -R for reverse tunnels, or --forward / --proxy / --socks / --http-proxy to reach upstreams through -T",
 			}
 		}
 	} else {
@@ -232,6 +564,153 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if len(c.Routes) > 0 && !c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "route",
+			Message: "host routing requires a reverse tunnel",
+			Hint:    "e.g.: gonc -p 8080 -R serveo.net --remote-port 80 --route api.example=8081",
+		}
+	}
+
+	exposure := len(c.AllowCIDRs) > 0 || len(c.DenyCIDRs) > 0 ||
+		c.ExposeFor != 0 || c.MaxConnections != 0 || c.MaxConcurrent != 0
+	if exposure && !c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "expose",
+			Message: "--allow, --deny, --expose-for, --max-conns and --max-concurrent require a reverse tunnel",
+			Hint:    "e.g.: gonc -p 3000 -R user@gateway --remote-port 80 --expose-for 30m",
+		}
+	}
+	if (c.URLFile != "" || c.URLQR) && !c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "url-file",
+			Message: "public URL capture requires a reverse tunnel",
+			Hint:    "e.g.: gonc -p 3000 -R serveo.net --remote-port 80 --url-file url.txt",
+		}
+	}
+
+	if c.ExposeFor < 0 {
+		return &ncerr.ConfigError{
+			Field:   "expose-for",
+			Value:   c.ExposeFor,
+			Message: "must not be negative",
+		}
+	}
+	if c.MaxConnections < 0 {
+		return &ncerr.ConfigError{
+			Field:   "max-conns",
+			Value:   c.MaxConnections,
+			Message: "must not be negative",
+		}
+	}
+	if c.MaxConcurrent < 0 {
+		return &ncerr.ConfigError{
+			Field:   "max-concurrent",
+			Value:   c.MaxConcurrent,
+			Message: "must not be negative",
+		}
+	}
+
+	if c.ScanRetries < 0 {
+		return &ncerr.ConfigError{
+			Field:   "scan-retries",
+			Value:   c.ScanRetries,
+			Message: "must not be negative",
+		}
+	}
+
+	if err := c.validateSOCKS(); err != nil {
+		return err
+	}
+	if err := c.validateHTTPProxy(); err != nil {
+		return err
+	}
+
+	if c.ProxyProtocol != 0 {
+		if c.ProxyProtocol != 1 && c.ProxyProtocol != 2 {
+			return &ncerr.ConfigError{
+				Field:   "proxy-protocol",
+				Value:   c.ProxyProtocol,
+				Message: "must be v1 or v2",
+			}
+		}
+		if c.Listen && !c.ReverseTunnelEnabled && c.Forward == "" && len(c.SNIRoutes) == 0 && c.ProxyUpstream == "" {
+			return &ncerr.ConfigError{
+				Field:   "proxy-protocol",
+				Message: "listen mode has no outbound connection to prepend a header to",
+				Hint:    "use --accept-proxy-protocol to strip incoming headers, or --forward / --proxy to an upstream",
+			}
+		}
+		if c.UDP {
+			return &ncerr.ConfigError{
+				Field:   "proxy-protocol",
+				Message: "PROXY headers are only supported over TCP",
+			}
+		}
+	}
+
+	if c.AcceptProxyProtocol && (!c.Listen || c.ReverseTunnelEnabled || c.UDP) {
+		return &ncerr.ConfigError{
+			Field:   "accept-proxy-protocol",
+			Message: "only supported in TCP listen mode",
+			Hint:    "e.g.: gonc -l -k -p 8080 --accept-proxy-protocol",
+		}
+	}
+
+	if err := c.validateProxy(); err != nil {
+		return err
+	}
+	if err := c.validateBackends(); err != nil {
+		return err
+	}
+	if err := c.validateMirror(); err != nil {
+		return err
+	}
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if c.MetricsAddr != "" {
+		if _, port, err := net.SplitHostPort(c.MetricsAddr); err != nil || port == "" {
+			return &ncerr.ConfigError{
+				Field:   "metrics-addr",
+				Value:   c.MetricsAddr,
+				Message: "must be host:port",
+				Hint:    "e.g.: --metrics-addr 127.0.0.1:9100",
+			}
+		}
+	}
+
+	if err := c.validateLogging(); err != nil {
+		return err
+	}
+
+	if c.ControlAddr != "" {
+		if !c.ReverseTunnelEnabled && !c.Listen {
+			return &ncerr.ConfigError{
+				Field:   "control",
+				Message: "requires a reverse tunnel (-R) or listen mode (-l)",
+				Hint:    "the admin API controls long-running modes only",
+			}
+		}
+		if _, _, err := control.ParseAddress(c.ControlAddr); err != nil {
+			return &ncerr.ConfigError{
+				Field:   "control",
+				Value:   c.ControlAddr,
+				Message: err.Error(),
+				Hint:    "e.g.: --control unix:/tmp/gonc.sock or --control 127.0.0.1:9300",
+			}
+		}
+	}
+
+	if (c.HexDump != "" || c.Tee != "" || c.Pcap != "" || c.Record != "") && c.ZeroIO {
+		return &ncerr.ConfigError{
+			Field:   "hex-dump",
+			Message: "traffic capture is not supported in scan mode (-z)",
+			Hint:    "scan probes carry no data; drop -o / --tee / --pcap / --record",
+		}
+	}
+
 	if c.Execute != "" && c.Command != "" {
 		return &ncerr.ConfigError{
 			Field:   "exec",
@@ -240,6 +719,46 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.Forward != "" {
+		if !c.Listen || c.ReverseTunnelEnabled || c.ProxyUpstream != "" {
+			return &ncerr.ConfigError{
+				Field:   "forward",
+				Message: "only supported in listen mode without -R or --proxy",
+				Hint:    "e.g.: gonc -l -k -p 8080 --forward db:5432",
+			}
+		}
+		if c.Execute != "" || c.Command != "" {
+			return &ncerr.ConfigError{
+				Field:   "forward",
+				Message: "--forward, -e and -c are mutually exclusive",
+			}
+		}
+		if host, port, err := net.SplitHostPort(c.Forward); err != nil || host == "" || port == "" {
+			return &ncerr.ConfigError{
+				Field:   "forward",
+				Value:   c.Forward,
+				Message: "must be host:port",
+				Hint:    "e.g.: --forward db.internal:5432",
+			}
+		}
+	}
+
+	if len(c.SNIRoutes) > 0 {
+		if !c.Listen || c.ReverseTunnelEnabled || c.ProxyUpstream != "" || c.UDP {
+			return &ncerr.ConfigError{
+				Field:   "sni-route",
+				Message: "only supported in TCP listen mode without -R or --proxy",
+				Hint:    "e.g.: gonc -l -k -p 443 --sni-route git.lab=10.0.0.5:443 --forward 10.0.0.2:443",
+			}
+		}
+		if c.Execute != "" || c.Command != "" {
+			return &ncerr.ConfigError{
+				Field:   "sni-route",
+				Message: "--sni-route, -e and -c are mutually exclusive",
+			}
+		}
+	}
+
 	if c.UDP && c.TunnelEnabled {
 		return &ncerr.ConfigError{
 			Field:   "udp",
@@ -257,3 +776,326 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// validateSOCKS checks --socks and the options that only apply to it.
+func (c *Config) validateSOCKS() error {
+	if !c.SOCKS {
+		if len(c.SOCKSUsers) > 0 || len(c.SOCKSAllow) > 0 || len(c.SOCKSDeny) > 0 {
+			return &ncerr.ConfigError{
+				Field:   "socks-auth",
+				Message: "--socks-auth, --socks-allow and --socks-deny require --socks",
+				Hint:    "e.g.: gonc -l -k -p 1080 --socks --socks-auth alice:s3cret",
+			}
+		}
+		return nil
+	}
+	if !c.Listen || c.ReverseTunnelEnabled || c.UDP {
+		return &ncerr.ConfigError{
+			Field:   "socks",
+			Message: "only supported in TCP listen mode",
+			Hint:    "e.g.: gonc -l -k -p 1080 --socks",
+		}
+	}
+	if c.Forward != "" || len(c.SNIRoutes) > 0 || c.ProxyUpstream != "" || c.Execute != "" || c.Command != "" {
+		return &ncerr.ConfigError{
+			Field:   "socks",
+			Message: "--socks, --forward, --sni-route, --proxy, -e and -c are mutually exclusive",
+			Hint:    "SOCKS clients choose their own destination",
+		}
+	}
+	if c.ProxyProtocol != 0 || c.TLSUpstream {
+		return &ncerr.ConfigError{
+			Field:   "socks",
+			Message: "--proxy-protocol and --tls-upstream are not supported with --socks",
+			Hint:    "SOCKS destinations are arbitrary services that expect neither",
+		}
+	}
+	return nil
+}
+
+// validateHTTPProxy checks --http-proxy and the options that only
+// apply to it.
+func (c *Config) validateHTTPProxy() error {
+	if !c.HTTPProxy {
+		if len(c.HTTPProxyUsers) > 0 || len(c.HTTPProxyPorts) > 0 || len(c.HTTPProxyHosts) > 0 {
+			return &ncerr.ConfigError{
+				Field:   "http-proxy-auth",
+				Message: "--http-proxy-auth, --http-proxy-ports and --http-proxy-hosts require --http-proxy",
+				Hint:    "e.g.: gonc -l -k -p 3128 --http-proxy --http-proxy-auth alice:s3cret",
+			}
+		}
+		return nil
+	}
+	if !c.Listen || c.ReverseTunnelEnabled || c.UDP {
+		return &ncerr.ConfigError{
+			Field:   "http-proxy",
+			Message: "only supported in TCP listen mode",
+			Hint:    "e.g.: gonc -l -k -p 3128 --http-proxy",
+		}
+	}
+	if c.SOCKS || c.Forward != "" || len(c.SNIRoutes) > 0 || c.ProxyUpstream != "" || c.Execute != "" || c.Command != "" {
+		return &ncerr.ConfigError{
+			Field:   "http-proxy",
+			Message: "--http-proxy, --socks, --forward, --sni-route, --proxy, -e and -c are mutually exclusive",
+			Hint:    "HTTP proxy clients choose their own destination",
+		}
+	}
+	if c.ProxyProtocol != 0 || c.TLSUpstream {
+		return &ncerr.ConfigError{
+			Field:   "http-proxy",
+			Message: "--proxy-protocol and --tls-upstream are not supported with --http-proxy",
+			Hint:    "clients send https:// through CONNECT and do their own TLS",
+		}
+	}
+	for _, p := range c.HTTPProxyPorts {
+		if p < 1 || p > 65535 {
+			return &ncerr.ConfigError{
+				Field:   "http-proxy-ports",
+				Value:   p,
+				Message: "must be between 1 and 65535",
+			}
+		}
+	}
+	return nil
+}
+
+// validateProxy checks --proxy and the --fault settings it applies.
+func (c *Config) validateProxy() error {
+	if c.ProxyUpstream == "" {
+		if !c.Faults.Up.IsZero() || !c.Faults.Down.IsZero() {
+			return &ncerr.ConfigError{
+				Field:   "fault",
+				Message: "fault injection requires --proxy",
+				Hint:    "e.g.: gonc -l -p 8080 --proxy db:5432 --fault up:latency=100ms",
+			}
+		}
+		return nil
+	}
+
+	if !c.Listen || c.ReverseTunnelEnabled || c.UDP {
+		return &ncerr.ConfigError{
+			Field:   "proxy",
+			Message: "only supported in TCP listen mode",
+			Hint:    "e.g.: gonc -l -p 8080 --proxy db:5432",
+		}
+	}
+	if c.Execute != "" || c.Command != "" {
+		return &ncerr.ConfigError{
+			Field:   "proxy",
+			Message: "--proxy bridges to the upstream and cannot run -e or -c",
+		}
+	}
+	if host, port, err := net.SplitHostPort(c.ProxyUpstream); err != nil || host == "" || port == "" {
+		return &ncerr.ConfigError{
+			Field:   "proxy",
+			Value:   c.ProxyUpstream,
+			Message: "must be host:port",
+			Hint:    "e.g.: --proxy db.internal:5432",
+		}
+	}
+	if err := c.Faults.Validate(); err != nil {
+		return &ncerr.ConfigError{
+			Field:   "fault",
+			Message: err.Error(),
+			Hint:    "e.g.: --fault down:stall=2s,stall-prob=5%",
+		}
+	}
+	return nil
+}
+
+// validateBackends checks --backend and --health-interval.
+func (c *Config) validateBackends() error {
+	if c.HealthInterval < 0 {
+		return &ncerr.ConfigError{
+			Field:   "health-interval",
+			Value:   c.HealthInterval.String(),
+			Message: "must not be negative",
+		}
+	}
+	if len(c.Backends) == 0 {
+		return nil
+	}
+	if c.Forward == "" && c.ProxyUpstream == "" && !c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "backend",
+			Message: "requires --forward, --proxy or -R",
+			Hint:    "e.g.: gonc -l -k -p 8080 --forward app1:80 --backend app2:80",
+		}
+	}
+	for _, b := range c.Backends {
+		if host, port, err := net.SplitHostPort(b); err != nil || host == "" || port == "" {
+			return &ncerr.ConfigError{
+				Field:   "backend",
+				Value:   b,
+				Message: "must be host:port",
+				Hint:    "e.g.: --backend 10.0.0.2:8080",
+			}
+		}
+	}
+	return nil
+}
+
+// validateMirror checks --mirror and --mirror-buffer.
+func (c *Config) validateMirror() error {
+	if c.MirrorBuffer < 0 {
+		return &ncerr.ConfigError{
+			Field:   "mirror-buffer",
+			Value:   strconv.FormatInt(c.MirrorBuffer, 10),
+			Message: "must not be negative",
+		}
+	}
+	if c.Mirror == "" {
+		return nil
+	}
+	if c.ProxyUpstream == "" && !c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "mirror",
+			Message: "requires --proxy or -R",
+			Hint:    "e.g.: gonc -l -p 8080 --proxy app:80 --mirror app-canary:80",
+		}
+	}
+	if host, port, err := net.SplitHostPort(c.Mirror); err != nil || host == "" || port == "" {
+		return &ncerr.ConfigError{
+			Field:   "mirror",
+			Value:   c.Mirror,
+			Message: "must be host:port",
+			Hint:    "e.g.: --mirror 127.0.0.1:3001",
+		}
+	}
+	return nil
+}
+
+// validateTLS checks the --tls-* termination and origination options.
+func (c *Config) validateTLS() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return &ncerr.ConfigError{
+			Field:   "tls-cert",
+			Message: "--tls-cert and --tls-key must be given together",
+			Hint:    "e.g.: --tls-cert server.crt --tls-key server.key",
+		}
+	}
+	if c.TLSCert != "" && (!c.Listen || c.ReverseTunnelEnabled || c.UDP) {
+		return &ncerr.ConfigError{
+			Field:   "tls-cert",
+			Message: "TLS termination is only supported in TCP listen mode",
+			Hint:    "e.g.: gonc -l -k -p 443 --tls-cert server.crt --tls-key server.key --forward 127.0.0.1:8080",
+		}
+	}
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		return &ncerr.ConfigError{
+			Field:   "tls-client-ca",
+			Message: "client certificates can only be verified when terminating TLS",
+			Hint:    "add --tls-cert and --tls-key",
+		}
+	}
+	switch c.TLSClientInfo {
+	case "":
+	case "proxy", "headers":
+		if c.TLSCert == "" {
+			return &ncerr.ConfigError{
+				Field:   "tls-client-info",
+				Message: "requires TLS termination with --tls-cert",
+			}
+		}
+		if c.Forward == "" && len(c.SNIRoutes) == 0 && c.ProxyUpstream == "" {
+			return &ncerr.ConfigError{
+				Field:   "tls-client-info",
+				Message: "requires an upstream to pass the client identity to",
+				Hint:    "use --forward, --sni-route or --proxy",
+			}
+		}
+		if c.TLSClientInfo == "proxy" && c.ProxyProtocol != 2 {
+			return &ncerr.ConfigError{
+				Field:   "tls-client-info",
+				Value:   c.TLSClientInfo,
+				Message: "TLVs are only carried by PROXY protocol v2",
+				Hint:    "add --proxy-protocol v2",
+			}
+		}
+	default:
+		return &ncerr.ConfigError{
+			Field:   "tls-client-info",
+			Value:   c.TLSClientInfo,
+			Message: "must be proxy or headers",
+		}
+	}
+
+	if !c.TLSUpstream {
+		if c.TLSCA != "" || c.TLSUpstreamCert != "" || c.TLSUpstreamKey != "" || c.TLSServerName != "" {
+			return &ncerr.ConfigError{
+				Field:   "tls-upstream",
+				Message: "--tls-ca, --tls-upstream-cert, --tls-upstream-key and --tls-server-name require --tls-upstream",
+			}
+		}
+		return nil
+	}
+	if (c.TLSUpstreamCert == "") != (c.TLSUpstreamKey == "") {
+		return &ncerr.ConfigError{
+			Field:   "tls-upstream-cert",
+			Message: "--tls-upstream-cert and --tls-upstream-key must be given together",
+		}
+	}
+	if c.UDP || c.ZeroIO || c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "tls-upstream",
+			Message: "TLS origination is only supported for TCP connect mode, --forward, --sni-route and --proxy",
+		}
+	}
+	if c.Listen && c.Forward == "" && len(c.SNIRoutes) == 0 && c.ProxyUpstream == "" {
+		return &ncerr.ConfigError{
+			Field:   "tls-upstream",
+			Message: "listen mode has no outbound connection to originate TLS on",
+			Hint:    "e.g.: gonc -l -k -p 8080 --forward api.internal:443 --tls-upstream",
+		}
+	}
+	return nil
+}
+
+// validateLogging checks --log-format and the --log-file rotation
+// settings, which every mode shares.
+func (c *Config) validateLogging() error {
+	if _, err := util.ParseLogFormat(c.LogFormat); err != nil {
+		return &ncerr.ConfigError{
+			Field:   "log-format",
+			Value:   c.LogFormat,
+			Message: "must be text, json or logfmt",
+			Hint:    "e.g.: --log-format json",
+		}
+	}
+	if c.LogMaxSize < 0 || c.LogMaxBackups < 0 {
+		return &ncerr.ConfigError{
+			Field:   "log-max-size",
+			Value:   fmt.Sprintf("%d/%d", c.LogMaxSize, c.LogMaxBackups),
+			Message: "log size and backup count must not be negative",
+		}
+	}
+	return nil
+}
+
+// validateReplay checks the options of gonc replay, which runs as a
+// client against the recorded or given target.
+func (c *Config) validateReplay() error {
+	if c.Listen || c.ZeroIO || c.ReverseTunnelEnabled {
+		return &ncerr.ConfigError{
+			Field:   "replay",
+			Message: "replay cannot be combined with -l, -z or -R",
+			Hint:    "usage: gonc replay [options] <recording> [host port]",
+		}
+	}
+	if c.ReplaySpeed < 0 {
+		return &ncerr.ConfigError{
+			Field:   "speed",
+			Value:   fmt.Sprintf("%g", c.ReplaySpeed),
+			Message: "must not be negative",
+			Hint:    "1 replays at the recorded pace, 2 twice as fast, 0 without delays",
+		}
+	}
+	if c.Host != "" && c.Port == 0 {
+		return &ncerr.ConfigError{
+			Field:   "port",
+			Message: "destination port is required with a replay host",
+			Hint:    "usage: gonc replay session.rec example.com 6379",
+		}
+	}
+	return c.validateLogging()
+}
@@ -2,6 +2,10 @@ package config
 
 import (
 	"testing"
+	"time"
+
+	"gonc/internal/fault"
+	"gonc/internal/socks5"
 )
 
 // ── ParseTunnelSpec ──────────────────────────────────────────────────
@@ -77,8 +81,197 @@ func TestParsePortSpec(t *testing.T) {
 	}
 }
 
+// ── ParseRouteSpec ───────────────────────────────────────────────────
+
+func TestParseRouteSpec(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantHost   string
+		wantTarget string
+		wantErr    bool
+	}{
+		{"api.example=127.0.0.1:8080", "api.example", "127.0.0.1:8080", false},
+		{"web.example=3000", "web.example", "127.0.0.1:3000", false},
+		{"*.example=10.0.0.2:80", "*.example", "10.0.0.2:80", false},
+		{"v6.example=[::1]:80", "v6.example", "[::1]:80", false},
+		{"a.example=:81", "a.example", "127.0.0.1:81", false},
+		{"api.example", "", "", true},
+		{"=8080", "", "", true},
+		{"api.example=", "", "", true},
+		{"api.example=70000", "", "", true},
+		{"api.example=host:http", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := ParseRouteSpec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRouteSpec(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.Host != tt.wantHost || r.Target != tt.wantTarget {
+				t.Errorf("got {%q, %q}, want {%q, %q}", r.Host, r.Target, tt.wantHost, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestParseLogin(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantUser string
+		wantPass string
+		wantErr  bool
+	}{
+		{"alice:s3cret", "alice", "s3cret", false},
+		{"bob:pa:ss", "bob", "pa:ss", false},
+		{"alice", "", "", true},
+		{":s3cret", "", "", true},
+		{"alice:", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			user, pass, err := ParseLogin(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLogin(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("got (%q, %q), want (%q, %q)", user, pass, tt.wantUser, tt.wantPass)
+			}
+		})
+	}
+}
+
 // ── PortRange.Expand ─────────────────────────────────────────────────
 
+func TestParseCIDR(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"192.0.2.7/24", "192.0.2.0/24", false},
+		{"203.0.113.9", "203.0.113.9/32", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"::1", "::1/128", false},
+		{"10.0.0.0/33", "", true},
+		{"example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			n, err := ParseCIDR(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCIDR(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && n.String() != tt.want {
+				t.Errorf("ParseCIDR(%q) = %s, want %s", tt.input, n, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"100MB", 100_000_000, false},
+		{"1.5GiB", 3 << 29, false},
+		{"64k", 64 << 10, false},
+		{"2 KiB", 2048, false},
+		{"0", 0, true},
+		{"10XB", 0, true},
+		{"-5MB", 0, true},
+		{"MB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteSize(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"1MiB/s", 1 << 20, false},
+		{"500KB", 500_000, false},
+		{"10Mbit/s", 1_250_000, false},
+		{"8kbit/s", 1000, false},
+		{"fast", 0, true},
+		{"/s", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRate(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFaultSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    fault.Settings
+		wantErr bool
+	}{
+		{"latency=100ms", fault.Settings{
+			Up:   fault.Faults{Latency: 100 * time.Millisecond},
+			Down: fault.Faults{Latency: 100 * time.Millisecond},
+		}, false},
+		{"up:jitter=20ms,chunk=1KiB", fault.Settings{
+			Up: fault.Faults{Jitter: 20 * time.Millisecond, Chunk: 1024},
+		}, false},
+		{"down:rate=8kbit/s,reset=1%,corrupt=0.001", fault.Settings{
+			Down: fault.Faults{Rate: 1000, Reset: 0.01, Corrupt: 0.001},
+		}, false},
+		{"DOWN:stall=2s,stall-prob=0.05", fault.Settings{
+			Down: fault.Faults{Stall: 2 * time.Second, StallProb: 0.05},
+		}, false},
+		{"sideways:latency=1s", fault.Settings{}, true},
+		{"up:", fault.Settings{}, true},
+		{"latency", fault.Settings{}, true},
+		{"latency=soon", fault.Settings{}, true},
+		{"reset=2", fault.Settings{}, true},
+		{"teleport=1", fault.Settings{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var got fault.Settings
+			err := ApplyFaultSpec(&got, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyFaultSpec(%q) error = %v, wantErr = %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ApplyFaultSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestPortRangeExpand(t *testing.T) {
 	pr := PortRange{Start: 20, End: 25}
 	got := pr.Expand()
@@ -173,6 +366,361 @@ func TestValidate(t *testing.T) {
 			cfg:     Config{Listen: true, LocalPort: 8080, ReverseTunnelEnabled: true, RemotePort: 9000},
 			wantErr: true,
 		},
+		{
+			name:    "reverse tunnel with routes",
+			cfg:     Config{Listen: true, LocalPort: 8080, ReverseTunnelEnabled: true, ReverseTunnelHost: "gw", RemotePort: 9000, Routes: []Route{{Host: "a", Target: "127.0.0.1:1"}}},
+			wantErr: false,
+		},
+		{
+			name:    "expose-for with reverse tunnel",
+			cfg:     Config{Listen: true, LocalPort: 3000, ReverseTunnelEnabled: true, ReverseTunnelHost: "gw", RemotePort: 80, ExposeFor: 30 * time.Minute},
+			wantErr: false,
+		},
+		{
+			name:    "metrics addr",
+			cfg:     Config{Host: "x", Port: 80, MetricsAddr: "127.0.0.1:9100"},
+			wantErr: false,
+		},
+		{
+			name:    "control socket with listen",
+			cfg:     Config{Listen: true, LocalPort: 80, ControlAddr: "unix:/tmp/gonc.sock"},
+			wantErr: false,
+		},
+		{
+			name:    "control without long-running mode",
+			cfg:     Config{Host: "x", Port: 80, ControlAddr: "127.0.0.1:9300"},
+			wantErr: true,
+		},
+		{
+			name:    "control on non-loopback address",
+			cfg:     Config{Listen: true, LocalPort: 80, ControlAddr: "0.0.0.0:9300"},
+			wantErr: true,
+		},
+		{
+			name:    "hex dump in connect mode",
+			cfg:     Config{Host: "x", Port: 80, HexDump: "-", Tee: "/tmp/session"},
+			wantErr: false,
+		},
+		{
+			name:    "hex dump in scan mode",
+			cfg:     Config{Host: "x", Port: 80, ZeroIO: true, HexDump: "dump.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "pcap in scan mode",
+			cfg:     Config{Host: "x", Port: 80, ZeroIO: true, Pcap: "scan.pcap"},
+			wantErr: true,
+		},
+		{
+			name:    "json log format",
+			cfg:     Config{Host: "x", Port: 80, LogFormat: "json"},
+			wantErr: false,
+		},
+		{
+			name:    "unknown log format",
+			cfg:     Config{Host: "x", Port: 80, LogFormat: "xml"},
+			wantErr: true,
+		},
+		{
+			name:    "metrics addr without port",
+			cfg:     Config{Host: "x", Port: 80, MetricsAddr: "localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "url-file without reverse tunnel",
+			cfg:     Config{Host: "x", Port: 80, URLFile: "url.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "max-conns without reverse tunnel",
+			cfg:     Config{Listen: true, LocalPort: 8080, MaxConnections: 5},
+			wantErr: true,
+		},
+		{
+			name:    "max-concurrent without reverse tunnel",
+			cfg:     Config{Listen: true, LocalPort: 8080, MaxConcurrent: 5},
+			wantErr: true,
+		},
+		{
+			name:    "negative scan retries",
+			cfg:     Config{Host: "x", Port: 53, ZeroIO: true, UDP: true, ScanRetries: -1},
+			wantErr: true,
+		},
+		{
+			name:    "negative max-concurrent",
+			cfg:     Config{Listen: true, LocalPort: 3000, ReverseTunnelEnabled: true, ReverseTunnelHost: "gw", RemotePort: 80, MaxConcurrent: -1},
+			wantErr: true,
+		},
+		{
+			name:    "proxy protocol connect",
+			cfg:     Config{Host: "x", Port: 80, ProxyProtocol: 2},
+			wantErr: false,
+		},
+		{
+			name:    "proxy protocol plain listen",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyProtocol: 1},
+			wantErr: true,
+		},
+		{
+			name:    "proxy protocol bad version",
+			cfg:     Config{Host: "x", Port: 80, ProxyProtocol: 3},
+			wantErr: true,
+		},
+		{
+			name:    "accept proxy protocol listen",
+			cfg:     Config{Listen: true, LocalPort: 8080, AcceptProxyProtocol: true},
+			wantErr: false,
+		},
+		{
+			name:    "accept proxy protocol connect",
+			cfg:     Config{Host: "x", Port: 80, AcceptProxyProtocol: true},
+			wantErr: true,
+		},
+		{
+			name:    "routes without reverse tunnel",
+			cfg:     Config{Host: "x", Port: 80, Routes: []Route{{Host: "a", Target: "127.0.0.1:1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "proxy with faults",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "db:5432", Faults: fault.Settings{Up: fault.Faults{Latency: time.Second}}},
+			wantErr: false,
+		},
+		{
+			name:    "proxy through forward tunnel",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "db:5432", TunnelEnabled: true, TunnelHost: "bastion"},
+			wantErr: false,
+		},
+		{
+			name:    "proxy in connect mode",
+			cfg:     Config{Host: "x", Port: 80, ProxyUpstream: "db:5432"},
+			wantErr: true,
+		},
+		{
+			name:    "proxy upstream without port",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "db"},
+			wantErr: true,
+		},
+		{
+			name:    "proxy with exec",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "db:5432", Execute: "/bin/cat"},
+			wantErr: true,
+		},
+		{
+			name:    "faults without proxy",
+			cfg:     Config{Listen: true, LocalPort: 8080, Faults: fault.Settings{Down: fault.Faults{Reset: 0.1}}},
+			wantErr: true,
+		},
+		{
+			name:    "backends with forward",
+			cfg:     Config{Listen: true, LocalPort: 8080, Forward: "app1:80", Backends: []string{"app2:80"}},
+			wantErr: false,
+		},
+		{
+			name:    "backends with reverse tunnel",
+			cfg:     Config{Listen: true, LocalPort: 3000, ReverseTunnelEnabled: true, ReverseTunnelHost: "gw", ReverseTunnelUser: "u", RemotePort: 9000, Backends: []string{"127.0.0.1:3001"}},
+			wantErr: false,
+		},
+		{
+			name:    "backends without an upstream",
+			cfg:     Config{Host: "x", Port: 80, Backends: []string{"app2:80"}},
+			wantErr: true,
+		},
+		{
+			name:    "backend without port",
+			cfg:     Config{Listen: true, LocalPort: 8080, Forward: "app1:80", Backends: []string{"app2"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative health interval",
+			cfg:     Config{Host: "x", Port: 80, HealthInterval: -time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "mirror with proxy",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "app:80", Mirror: "canary:80"},
+			wantErr: false,
+		},
+		{
+			name:    "mirror without proxy or reverse tunnel",
+			cfg:     Config{Listen: true, LocalPort: 8080, Mirror: "canary:80"},
+			wantErr: true,
+		},
+		{
+			name:    "mirror without port",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "app:80", Mirror: "canary"},
+			wantErr: true,
+		},
+		{
+			name:    "negative mirror buffer",
+			cfg:     Config{Host: "x", Port: 80, MirrorBuffer: -1},
+			wantErr: true,
+		},
+		{
+			name:    "tls termination with forward",
+			cfg:     Config{Listen: true, LocalPort: 443, Forward: "app:80", TLSCert: "s.crt", TLSKey: "s.key", TLSClientCA: "ca.pem", TLSClientInfo: "headers"},
+			wantErr: false,
+		},
+		{
+			name:    "tls termination with exec",
+			cfg:     Config{Listen: true, LocalPort: 443, Execute: "/bin/cat", TLSCert: "s.crt", TLSKey: "s.key"},
+			wantErr: false,
+		},
+		{
+			name:    "tls cert without key",
+			cfg:     Config{Listen: true, LocalPort: 443, Forward: "app:80", TLSCert: "s.crt"},
+			wantErr: true,
+		},
+		{
+			name:    "tls termination in connect mode",
+			cfg:     Config{Host: "x", Port: 443, TLSCert: "s.crt", TLSKey: "s.key"},
+			wantErr: true,
+		},
+		{
+			name:    "tls client ca without cert",
+			cfg:     Config{Listen: true, LocalPort: 443, Forward: "app:80", TLSClientCA: "ca.pem"},
+			wantErr: true,
+		},
+		{
+			name:    "tls client info as proxy TLVs needs v2",
+			cfg:     Config{Listen: true, LocalPort: 443, ProxyUpstream: "app:80", TLSCert: "s.crt", TLSKey: "s.key", TLSClientInfo: "proxy", ProxyProtocol: 1},
+			wantErr: true,
+		},
+		{
+			name:    "tls client info as proxy TLVs",
+			cfg:     Config{Listen: true, LocalPort: 443, ProxyUpstream: "app:80", TLSCert: "s.crt", TLSKey: "s.key", TLSClientInfo: "proxy", ProxyProtocol: 2},
+			wantErr: false,
+		},
+		{
+			name:    "tls client info without upstream",
+			cfg:     Config{Listen: true, LocalPort: 443, TLSCert: "s.crt", TLSKey: "s.key", TLSClientInfo: "headers"},
+			wantErr: true,
+		},
+		{
+			name:    "tls upstream in connect mode",
+			cfg:     Config{Host: "x", Port: 443, TLSUpstream: true, TLSCA: "ca.pem", TLSUpstreamCert: "me.crt", TLSUpstreamKey: "me.key"},
+			wantErr: false,
+		},
+		{
+			name:    "tls upstream options without tls upstream",
+			cfg:     Config{Host: "x", Port: 443, TLSCA: "ca.pem"},
+			wantErr: true,
+		},
+		{
+			name:    "tls upstream in plain listen mode",
+			cfg:     Config{Listen: true, LocalPort: 8080, TLSUpstream: true},
+			wantErr: true,
+		},
+		{
+			name:    "tls upstream over udp",
+			cfg:     Config{Host: "x", Port: 443, UDP: true, TLSUpstream: true},
+			wantErr: true,
+		},
+		{
+			name:    "sni routes in listen mode",
+			cfg:     Config{Listen: true, KeepOpen: true, LocalPort: 443, SNIRoutes: []Route{{Host: "git.lab", Target: "10.0.0.5:443"}}},
+			wantErr: false,
+		},
+		{
+			name:    "sni routes over udp",
+			cfg:     Config{Listen: true, UDP: true, LocalPort: 443, SNIRoutes: []Route{{Host: "git.lab", Target: "10.0.0.5:443"}}},
+			wantErr: true,
+		},
+		{
+			name:    "sni routes in connect mode",
+			cfg:     Config{Host: "x", Port: 443, SNIRoutes: []Route{{Host: "git.lab", Target: "10.0.0.5:443"}}},
+			wantErr: true,
+		},
+		{
+			name:    "socks in listen mode",
+			cfg:     Config{Listen: true, KeepOpen: true, LocalPort: 1080, SOCKS: true, SOCKSUsers: map[string]string{"alice": "s3cret"}},
+			wantErr: false,
+		},
+		{
+			name:    "socks through tunnel",
+			cfg:     Config{Listen: true, KeepOpen: true, LocalPort: 1080, SOCKS: true, TunnelEnabled: true, TunnelHost: "bastion"},
+			wantErr: false,
+		},
+		{
+			name:    "socks over udp",
+			cfg:     Config{Listen: true, UDP: true, LocalPort: 1080, SOCKS: true},
+			wantErr: true,
+		},
+		{
+			name:    "socks with exec",
+			cfg:     Config{Listen: true, LocalPort: 1080, SOCKS: true, Execute: "/bin/cat"},
+			wantErr: true,
+		},
+		{
+			name:    "socks with tls upstream",
+			cfg:     Config{Listen: true, LocalPort: 1080, SOCKS: true, TLSUpstream: true},
+			wantErr: true,
+		},
+		{
+			name:    "socks rules without socks",
+			cfg:     Config{Listen: true, LocalPort: 1080, SOCKSDeny: []socks5.Rule{{Host: "*"}}},
+			wantErr: true,
+		},
+		{
+			name:    "http proxy through tunnel",
+			cfg:     Config{Listen: true, KeepOpen: true, LocalPort: 3128, HTTPProxy: true, TunnelEnabled: true, TunnelHost: "bastion", HTTPProxyPorts: []int{80, 443}, HTTPProxyHosts: []socks5.Rule{{Host: "*.corp.internal"}}},
+			wantErr: false,
+		},
+		{
+			name:    "http proxy in connect mode",
+			cfg:     Config{Host: "x", Port: 3128, HTTPProxy: true},
+			wantErr: true,
+		},
+		{
+			name:    "http proxy with socks",
+			cfg:     Config{Listen: true, LocalPort: 3128, HTTPProxy: true, SOCKS: true},
+			wantErr: true,
+		},
+		{
+			name:    "http proxy with proxy protocol",
+			cfg:     Config{Listen: true, LocalPort: 3128, HTTPProxy: true, ProxyProtocol: 1},
+			wantErr: true,
+		},
+		{
+			name:    "http proxy bad port",
+			cfg:     Config{Listen: true, LocalPort: 3128, HTTPProxy: true, HTTPProxyPorts: []int{0}},
+			wantErr: true,
+		},
+		{
+			name:    "http proxy lists without http proxy",
+			cfg:     Config{Listen: true, LocalPort: 3128, HTTPProxyPorts: []int{443}},
+			wantErr: true,
+		},
+		{
+			name:    "forward in listen mode",
+			cfg:     Config{Listen: true, LocalPort: 8080, KeepOpen: true, Forward: "db:5432"},
+			wantErr: false,
+		},
+		{
+			name:    "forward through tunnel with proxy protocol",
+			cfg:     Config{Listen: true, LocalPort: 8080, Forward: "db:5432", TunnelEnabled: true, TunnelHost: "bastion", ProxyProtocol: 2},
+			wantErr: false,
+		},
+		{
+			name:    "forward in connect mode",
+			cfg:     Config{Host: "x", Port: 80, Forward: "db:5432"},
+			wantErr: true,
+		},
+		{
+			name:    "forward without port",
+			cfg:     Config{Listen: true, LocalPort: 8080, Forward: "db"},
+			wantErr: true,
+		},
+		{
+			name:    "forward with command",
+			cfg:     Config{Listen: true, LocalPort: 8080, Forward: "db:5432", Command: "cat"},
+			wantErr: true,
+		},
+		{
+			name:    "stall without probability",
+			cfg:     Config{Listen: true, LocalPort: 8080, ProxyUpstream: "db:5432", Faults: fault.Settings{Down: fault.Faults{Stall: time.Second}}},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
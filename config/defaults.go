@@ -21,6 +21,11 @@ const (
 	// DefaultScanTimeout is the per-port timeout for port scanning.
 	DefaultScanTimeout = 3 * time.Second
 
+	// DefaultScanRetries is how many times a UDP scan resends a probe
+	// that got neither a reply nor an ICMP error before reporting the
+	// port open|filtered.
+	DefaultScanRetries = 1
+
 	// DefaultMaxConcurrentScans limits the number of simultaneous scan
 	// goroutines to prevent resource exhaustion.
 	DefaultMaxConcurrentScans = 100
@@ -38,4 +43,42 @@ const (
 
 	// DefaultGracePeriod is how long Close waits for handlers to finish.
 	DefaultGracePeriod = 5 * time.Second
+
+	// DefaultProxyHeaderTimeout bounds how long listen mode waits for
+	// an incoming PROXY protocol header when no -w timeout is set.
+	DefaultProxyHeaderTimeout = 5 * time.Second
+
+	// DefaultLogMaxSize is the --log-file size, in MB, that triggers
+	// rotation.
+	DefaultLogMaxSize = 10
+
+	// DefaultLogMaxBackups is how many rotated log files are kept.
+	DefaultLogMaxBackups = 3
+
+	// DefaultReplaySpeed replays recordings at their original pace.
+	DefaultReplaySpeed = 1.0
+
+	// DefaultReplayTimeout is how long gonc replay waits for a
+	// response to stop arriving when no -w timeout is set.
+	DefaultReplayTimeout = 5 * time.Second
+
+	// DefaultTLSHandshakeTimeout bounds TLS handshakes, on accept and
+	// on dial, when no -w timeout is set.
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+
+	// DefaultLocalDialTimeout bounds -R dials to the local service.
+	DefaultLocalDialTimeout = 5 * time.Second
+
+	// DefaultHealthInterval is how often --backend targets are dialled
+	// to check they are up.
+	DefaultHealthInterval = 10 * time.Second
+
+	// DefaultMirrorBuffer is how many bytes a slow --mirror target may
+	// fall behind before it is dropped for the session.
+	DefaultMirrorBuffer = 4 << 20
+
+	// DefaultUDPSessionIdle is how long a UDP client of -k or --forward
+	// may stay silent before its session (and any upstream socket) is
+	// released, when no -w timeout is set.
+	DefaultUDPSessionIdle = 60 * time.Second
 )
@@ -86,6 +86,32 @@ func LoadFromEnv(cfg *Config) {
 	if v := envInt("GONC_VERBOSE"); v > 0 {
 		cfg.Verbose = v
 	}
+	if v := os.Getenv("GONC_LOG_FORMAT"); v != "" {
+		cfg.LogFormat = v
+	}
+	if v := os.Getenv("GONC_LOG_FILE"); v != "" {
+		cfg.LogFile = v
+	}
+	if v := os.Getenv("GONC_METRICS_ADDR"); v != "" {
+		cfg.MetricsAddr = v
+	}
+	if v := os.Getenv("GONC_CONTROL"); v != "" {
+		cfg.ControlAddr = v
+	}
+	if v := os.Getenv("GONC_AUDIT_LOG"); v != "" {
+		cfg.AuditLog = v
+	}
+	if v := os.Getenv("GONC_SOCKS_AUTH"); v != "" {
+		// Keeps the password out of the process list.
+		if user, pass, err := ParseLogin(v); err == nil {
+			cfg.SOCKSUsers = map[string]string{user: pass}
+		}
+	}
+	if v := os.Getenv("GONC_HTTP_PROXY_AUTH"); v != "" {
+		if user, pass, err := ParseLogin(v); err == nil {
+			cfg.HTTPProxyUsers = map[string]string{user: pass}
+		}
+	}
 }
 
 // ── helpers ──────────────────────────────────────────────────────────
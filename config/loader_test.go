@@ -164,3 +164,28 @@ func TestLoadFromEnv_Verbose(t *testing.T) {
 		t.Errorf("Verbose = %d, want 3", cfg.Verbose)
 	}
 }
+
+func TestLoadFromEnv_SOCKSAuth(t *testing.T) {
+	t.Setenv("GONC_SOCKS_AUTH", "alice:s3:cret")
+	cfg := &Config{}
+	LoadFromEnv(cfg)
+	if cfg.SOCKSUsers["alice"] != "s3:cret" {
+		t.Errorf("SOCKSUsers = %v, want alice → s3:cret", cfg.SOCKSUsers)
+	}
+
+	t.Setenv("GONC_SOCKS_AUTH", "no-password")
+	cfg = &Config{}
+	LoadFromEnv(cfg)
+	if cfg.SOCKSUsers != nil {
+		t.Errorf("SOCKSUsers = %v for invalid input, want nil", cfg.SOCKSUsers)
+	}
+}
+
+func TestLoadFromEnv_HTTPProxyAuth(t *testing.T) {
+	t.Setenv("GONC_HTTP_PROXY_AUTH", "alice:s3cret")
+	cfg := &Config{}
+	LoadFromEnv(cfg)
+	if cfg.HTTPProxyUsers["alice"] != "s3cret" {
+		t.Errorf("HTTPProxyUsers = %v, want alice → s3cret", cfg.HTTPProxyUsers)
+	}
+}
@@ -0,0 +1,219 @@
+// Package audit writes a durable JSON Lines record of every
+// connection gonc handles, for --audit-log.
+//
+// Each closed session produces one line, written with a single
+// append-mode write so concurrent sessions never interleave.  A nil
+// *Log is a valid no-op receiver, like metrics.Collector.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/util"
+)
+
+// Record is one audited session.
+type Record struct {
+	Time       time.Time `json:"time"`  // when the session closed
+	Start      time.Time `json:"start"` // when it was accepted or dialled
+	Mode       string    `json:"mode"`  // connect, listen, proxy, reverse or scan
+	Local      string    `json:"local,omitempty"`
+	Remote     string    `json:"remote,omitempty"`
+	Origin     string    `json:"origin,omitempty"`  // client address from a PROXY header
+	Target     string    `json:"target,omitempty"`  // service a reverse, --forward, --socks or --http-proxy session was bridged to
+	User       string    `json:"user,omitempty"`    // --socks-auth or --http-proxy-auth user
+	Gateway    string    `json:"gateway,omitempty"` // SSH gateway host:port, when tunnelled
+	Capability string    `json:"capability,omitempty"`
+	Command    string    `json:"command,omitempty"` // program or shell command for exec
+	Method     string    `json:"method,omitempty"`  // --http-proxy request method
+	URL        string    `json:"url,omitempty"`     // --http-proxy request URI
+	Status     int       `json:"status,omitempty"`  // --http-proxy response status
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitStatus *int      `json:"exit_status,omitempty"` // exec only
+	Error      string    `json:"error,omitempty"`
+}
+
+// Log appends records to a file.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// Open opens path for appending, creating it readable by its owner
+// only.  Existing records are never truncated.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Path returns the file the log appends to.
+func (l *Log) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Write appends r as one JSON line.  A zero Time is set to now.
+func (l *Log) Write(r Record) error {
+	if l == nil {
+		return nil
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	_, err = l.f.Write(data)
+	return err
+}
+
+// Close closes the file.  Later writes fail with os.ErrClosed.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// ── Sessions ─────────────────────────────────────────────────────────
+
+// Entry is an audit record in progress for one connection.
+type Entry struct {
+	log    *Log
+	rec    Record
+	in     atomic.Int64
+	out    atomic.Int64
+	finish sync.Once
+}
+
+// Begin starts a record for conn and returns a wrapper that counts the
+// bytes read from and written to it.  Local and Remote default to the
+// connection's addresses.  With a nil log conn is returned unchanged
+// along with a nil Entry, whose methods are no-ops.
+func (l *Log) Begin(conn net.Conn, r Record) (net.Conn, *Entry) {
+	if l == nil {
+		return conn, nil
+	}
+	r.Start = time.Now()
+	if r.Local == "" && conn.LocalAddr() != nil {
+		r.Local = conn.LocalAddr().String()
+	}
+	if r.Remote == "" && conn.RemoteAddr() != nil {
+		r.Remote = conn.RemoteAddr().String()
+	}
+	e := &Entry{log: l, rec: r}
+	return &countingConn{Conn: conn, e: e}, e
+}
+
+// SetOrigin records the client address reported by a PROXY header.
+func (e *Entry) SetOrigin(addr net.Addr) {
+	if e == nil || addr == nil {
+		return
+	}
+	e.rec.Origin = addr.String()
+}
+
+// SetTarget records the local service the session was bridged to.
+func (e *Entry) SetTarget(target string) {
+	if e == nil {
+		return
+	}
+	e.rec.Target = target
+}
+
+// SetUser records the user the client authenticated as.
+func (e *Entry) SetUser(user string) {
+	if e == nil {
+		return
+	}
+	e.rec.User = user
+}
+
+// Finish completes the record with the session's outcome and writes
+// it.  Only the first call has any effect.  For exec sessions the exit
+// status is taken from err (0 when err is nil).
+func (e *Entry) Finish(err error) error {
+	if e == nil {
+		return nil
+	}
+	var werr error
+	e.finish.Do(func() {
+		r := e.rec
+		r.Time = time.Now()
+		r.DurationMs = r.Time.Sub(r.Start).Milliseconds()
+		r.BytesIn, r.BytesOut = e.in.Load(), e.out.Load()
+		if err != nil {
+			r.Error = err.Error()
+		}
+		if r.Capability == "exec" {
+			r.ExitStatus = exitStatus(err)
+		}
+		werr = e.log.Write(r)
+	})
+	return werr
+}
+
+// exitStatus extracts a child's exit code from err: 0 for success,
+// the code for an *exec.ExitError, nil when the child never ran.
+func exitStatus(err error) *int {
+	code := 0
+	if err != nil {
+		var ee *exec.ExitError
+		if !errors.As(err, &ee) {
+			return nil
+		}
+		code = ee.ExitCode()
+	}
+	return &code
+}
+
+// countingConn feeds an Entry's byte counters.
+type countingConn struct {
+	net.Conn
+	e *Entry
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.e.in.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.e.out.Add(int64(n))
+	return n, err
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *countingConn) CloseWrite() error { return util.CloseWrite(c.Conn) }
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// readRecords parses every line of the audit file at path.
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var recs []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	conn, e := l.Begin(a, Record{Mode: "listen"})
+	if conn != a {
+		t.Error("nil log should return the connection unchanged")
+	}
+	e.SetOrigin(a.RemoteAddr())
+	e.SetTarget("x")
+	e.SetUser("alice")
+	if err := e.Finish(nil); err != nil {
+		t.Errorf("Finish: %v", err)
+	}
+	if err := l.Write(Record{}); err != nil {
+		t.Errorf("Write: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if l.Path() != "" {
+		t.Errorf("Path = %q", l.Path())
+	}
+}
+
+func TestBeginFinish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	defer b.Close()
+	conn, e := l.Begin(a, Record{Mode: "listen", Capability: "relay"})
+	e.SetTarget("127.0.0.1:8080")
+	e.SetUser("alice")
+
+	go func() {
+		b.Write([]byte("hello"))        //nolint:errcheck
+		io.ReadFull(b, make([]byte, 3)) //nolint:errcheck
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if err := e.Finish(errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	e.Finish(nil) //nolint:errcheck // second call is ignored
+	l.Close()
+
+	recs := readRecords(t, path)
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	r := recs[0]
+	if r.Mode != "listen" || r.Capability != "relay" || r.Target != "127.0.0.1:8080" || r.User != "alice" {
+		t.Errorf("record = %+v", r)
+	}
+	if r.BytesIn != 5 || r.BytesOut != 3 {
+		t.Errorf("bytes in/out = %d/%d, want 5/3", r.BytesIn, r.BytesOut)
+	}
+	if r.Error != "boom" {
+		t.Errorf("Error = %q, want boom", r.Error)
+	}
+	if r.Start.IsZero() || r.Time.Before(r.Start) {
+		t.Errorf("start %v, time %v", r.Start, r.Time)
+	}
+	if r.ExitStatus != nil {
+		t.Errorf("relay should not report an exit status, got %d", *r.ExitStatus)
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Write(Record{Mode: "scan"}); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+	if recs := readRecords(t, path); len(recs) != 2 {
+		t.Errorf("got %d records after reopening, want 2", len(recs))
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode().Perm(); perm != 0o600 {
+			t.Errorf("mode = %o, want 600", perm)
+		}
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if err := l.Write(Record{}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+
+	tests := []struct {
+		name string
+		err  error
+		want *int
+	}{
+		{"success", nil, intPtr(0)},
+		{"exit code", exitErr, intPtr(3)},
+		{"never ran", errors.New("no command"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exitStatus(tt.err)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("exitStatus(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int { return &n }
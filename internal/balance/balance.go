@@ -0,0 +1,335 @@
+// Package balance spreads connections over several backends.
+//
+// A Pool picks a backend per dial by round-robin, least-connections or
+// random selection.  Two independent signals keep traffic off broken
+// backends: an optional active health check that dials every backend
+// periodically, and a passive retry.CircuitBreaker per backend that
+// opens after consecutive dial failures.  When a dial fails the Pool
+// moves on to the next candidate, so one dead backend costs a client
+// nothing but the failed attempt.
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/internal/retry"
+	"gonc/util"
+)
+
+// ErrNoBackend is returned by Dial when every backend failed or was
+// rejected by its circuit breaker.
+var ErrNoBackend = errors.New("no backend available")
+
+// ── Strategy ─────────────────────────────────────────────────────────
+
+// Strategy selects the order in which backends are tried.
+type Strategy int
+
+const (
+	// RoundRobin rotates through the backends.
+	RoundRobin Strategy = iota
+	// LeastConn prefers the backend with the fewest open connections.
+	LeastConn
+	// Random picks backends in random order.
+	Random
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round-robin"
+	case LeastConn:
+		return "least-conn"
+	case Random:
+		return "random"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseStrategy parses a --lb value.  The empty string is RoundRobin.
+func ParseStrategy(s string) (Strategy, error) {
+	switch s {
+	case "", "round-robin", "rr":
+		return RoundRobin, nil
+	case "least-conn", "leastconn":
+		return LeastConn, nil
+	case "random":
+		return Random, nil
+	}
+	return 0, fmt.Errorf("unknown strategy %q (want round-robin, least-conn or random)", s)
+}
+
+// ── Configuration ────────────────────────────────────────────────────
+
+// DialFunc opens a connection to one backend.  transport.Dialer.Dial
+// has this signature.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Config configures a [Pool].
+type Config struct {
+	Strategy Strategy
+	// HealthInterval is how often every backend is dialled to check
+	// it is up.  0 disables active checks; the breakers still apply.
+	HealthInterval time.Duration
+	// HealthTimeout bounds each health-check dial (default 2s).
+	HealthTimeout time.Duration
+	// Breaker configures the per-backend circuit breakers (default
+	// 3 failures, 10s open, 1 success to close).
+	Breaker *retry.CircuitBreakerConfig
+	// Logger receives backend state changes (optional).
+	Logger *util.Logger
+}
+
+// ── Backend ──────────────────────────────────────────────────────────
+
+// Backend is one target address and its health state.
+type Backend struct {
+	address string
+	breaker *retry.CircuitBreaker
+	active  atomic.Int64
+	down    atomic.Bool // failed its last active health check
+}
+
+// Address returns the backend's host:port.
+func (b *Backend) Address() string { return b.address }
+
+// Active returns the number of open connections to the backend.
+func (b *Backend) Active() int64 { return b.active.Load() }
+
+// Healthy reports whether the backend passed its last health check
+// and its circuit breaker is not open.
+func (b *Backend) Healthy() bool {
+	return !b.down.Load() && b.breaker.CurrentState() != retry.StateOpen
+}
+
+// ── Pool ─────────────────────────────────────────────────────────────
+
+// Pool dials one of several backends.
+type Pool struct {
+	backends []*Backend
+	network  string
+	dial     DialFunc
+	strategy Strategy
+	timeout  time.Duration
+	logger   *util.Logger
+
+	next atomic.Uint64 // rotation for RoundRobin and LeastConn ties
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a pool over addrs, dialled with dial over network.  If
+// cfg.HealthInterval is set it starts checking the backends at once;
+// Close stops the checks.
+func New(addrs []string, network string, dial DialFunc, cfg Config) *Pool {
+	bc := cfg.Breaker
+	if bc == nil {
+		bc = &retry.CircuitBreakerConfig{MaxFailures: 3, ResetTimeout: 10 * time.Second, HalfOpenMax: 1}
+	}
+	timeout := cfg.HealthTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = util.NewLogger(0)
+	}
+
+	p := &Pool{
+		network:  network,
+		dial:     dial,
+		strategy: cfg.Strategy,
+		timeout:  timeout,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		b := &Backend{address: addr}
+		c := *bc
+		c.OnStateChange = func(from, to retry.State) {
+			logger.With("backend", addr, "from", from.String(), "to", to.String()).
+				Warn("backend %s: circuit %s → %s", addr, from, to)
+		}
+		b.breaker = retry.NewCircuitBreaker(&c)
+		p.backends = append(p.backends, b)
+	}
+
+	if cfg.HealthInterval > 0 {
+		go p.healthLoop(cfg.HealthInterval)
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+// Backends returns the pool's backends in configuration order.
+func (p *Pool) Backends() []*Backend { return p.backends }
+
+// Dial connects to a backend chosen by the pool's strategy, trying the
+// others in turn if it fails.  It returns the connection and the
+// address it reached.  Closing the connection releases the backend's
+// slot for LeastConn.
+func (p *Pool) Dial(ctx context.Context) (net.Conn, string, error) {
+	var lastErr error
+	for _, b := range p.order() {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		var conn net.Conn
+		err := b.breaker.Execute(func() error {
+			var err error
+			conn, err = p.dial(ctx, p.network, b.address)
+			return err
+		})
+		if err != nil {
+			p.logger.With("backend", b.address).Debug("backend %s: %v", b.address, err)
+			lastErr = fmt.Errorf("%s: %w", b.address, err)
+			continue
+		}
+		b.active.Add(1)
+		return &trackedConn{Conn: conn, b: b}, b.address, nil
+	}
+	if lastErr == nil {
+		return nil, "", ErrNoBackend
+	}
+	return nil, "", fmt.Errorf("%w: %w", ErrNoBackend, lastErr)
+}
+
+// Close stops the health checks and waits for a running one to end.
+// It is safe on a nil Pool.
+func (p *Pool) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.closeOnce.Do(func() { close(p.stop) })
+	<-p.done
+	return nil
+}
+
+// order returns the backends in the order Dial should try them.
+// Healthy backends come first; the rest follow as a last resort, since
+// a health check may lag behind a recovery.
+func (p *Pool) order() []*Backend {
+	n := len(p.backends)
+	if n == 0 {
+		return nil
+	}
+	start := int(p.next.Add(1)-1) % n
+	bs := make([]*Backend, 0, n)
+	for i := range n {
+		bs = append(bs, p.backends[(start+i)%n])
+	}
+
+	switch p.strategy {
+	case LeastConn:
+		slices.SortStableFunc(bs, func(a, b *Backend) int {
+			return int(a.Active() - b.Active())
+		})
+	case Random:
+		rand.Shuffle(n, func(i, j int) { bs[i], bs[j] = bs[j], bs[i] })
+	}
+
+	slices.SortStableFunc(bs, func(a, b *Backend) int {
+		switch ah, bh := a.Healthy(), b.Healthy(); {
+		case ah == bh:
+			return 0
+		case ah:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return bs
+}
+
+// ── Health checks ────────────────────────────────────────────────────
+
+func (p *Pool) healthLoop(interval time.Duration) {
+	defer close(p.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		p.checkAll(ctx)
+		select {
+		case <-p.stop:
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// checkAll dials every backend concurrently and records the result.
+func (p *Pool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.check(ctx, b)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(ctx context.Context, b *Backend) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	conn, err := p.dial(ctx, p.network, b.address)
+	if err == nil {
+		conn.Close()
+	}
+	select {
+	case <-p.stop:
+		return // shutting down
+	default:
+	}
+
+	if err != nil {
+		if !b.down.Swap(true) {
+			p.logger.With("backend", b.address).
+				Warn("backend %s: health check failed: %v", b.address, err)
+		}
+		return
+	}
+	if b.down.Swap(false) {
+		p.logger.With("backend", b.address).Info("backend %s: healthy again", b.address)
+		b.breaker.Reset()
+	}
+}
+
+// ── Conn ─────────────────────────────────────────────────────────────
+
+// trackedConn counts an open connection against its backend until
+// Close.
+type trackedConn struct {
+	net.Conn
+	b    *Backend
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.b.active.Add(-1) })
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *trackedConn) CloseWrite() error { return util.CloseWrite(c.Conn) }
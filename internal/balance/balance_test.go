@@ -0,0 +1,170 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gonc/internal/retry"
+)
+
+// fakeDialer records dials and fails for addresses marked down.
+type fakeDialer struct {
+	mu    sync.Mutex
+	down  map[string]bool
+	dials []string
+}
+
+func (d *fakeDialer) setDown(addr string, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down[addr] = down
+}
+
+func (d *fakeDialer) dial(_ context.Context, _, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials = append(d.dials, addr)
+	if d.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	a, b := net.Pipe()
+	b.Close()
+	return a, nil
+}
+
+func newFake() *fakeDialer { return &fakeDialer{down: map[string]bool{}} }
+
+func TestParseStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Strategy
+		wantErr bool
+	}{
+		{"", RoundRobin, false},
+		{"round-robin", RoundRobin, false},
+		{"least-conn", LeastConn, false},
+		{"random", Random, false},
+		{"weighted", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStrategy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStrategy(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	d := newFake()
+	p := New([]string{"a:1", "b:1", "c:1"}, "tcp", d.dial, Config{})
+	defer p.Close()
+
+	var got []string
+	for range 4 {
+		conn, addr, err := p.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		got = append(got, addr)
+	}
+	if want := []string{"a:1", "b:1", "c:1", "a:1"}; !slices.Equal(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	d := newFake()
+	p := New([]string{"a:1", "b:1"}, "tcp", d.dial, Config{Strategy: LeastConn})
+	defer p.Close()
+
+	held, first, _ := p.Dial(context.Background())
+	for range 3 {
+		conn, addr, err := p.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == first {
+			t.Errorf("picked busy backend %s", addr)
+		}
+		conn.Close()
+	}
+	held.Close()
+	for _, b := range p.Backends() {
+		if b.Active() != 0 {
+			t.Errorf("%s: Active = %d after Close", b.Address(), b.Active())
+		}
+	}
+}
+
+func TestDialFailover(t *testing.T) {
+	d := newFake()
+	d.setDown("a:1", true)
+	p := New([]string{"a:1", "b:1"}, "tcp", d.dial, Config{
+		Breaker: &retry.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Hour},
+	})
+	defer p.Close()
+
+	for range 4 {
+		conn, addr, err := p.Dial(context.Background())
+		if err != nil || addr != "b:1" {
+			t.Fatalf("Dial = %s, %v; want b:1", addr, err)
+		}
+		conn.Close()
+	}
+	// Two failures open a's breaker, after which it is not dialled.
+	n := 0
+	for _, a := range d.dials {
+		if a == "a:1" {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("a:1 dialled %d times, want 2 before its breaker opened", n)
+	}
+	if p.Backends()[0].Healthy() {
+		t.Error("a:1 should be unhealthy with its breaker open")
+	}
+
+	d.setDown("b:1", true)
+	if _, _, err := p.Dial(context.Background()); !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Dial with every backend down = %v, want ErrNoBackend", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	d := newFake()
+	d.setDown("a:1", true)
+	p := New([]string{"a:1", "b:1"}, "tcp", d.dial, Config{HealthInterval: 10 * time.Millisecond})
+	defer p.Close()
+
+	a := p.Backends()[0]
+	waitFor(t, func() bool { return !a.Healthy() }, "a:1 marked down")
+	for range 3 {
+		conn, addr, err := p.Dial(context.Background())
+		if err != nil || addr != "b:1" {
+			t.Fatalf("Dial = %s, %v; want b:1 while a:1 is down", addr, err)
+		}
+		conn.Close()
+	}
+
+	d.setDown("a:1", false)
+	waitFor(t, a.Healthy, "a:1 healthy again")
+}
+
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
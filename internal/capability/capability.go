@@ -12,11 +12,34 @@ import (
 )
 
 // Capability handles a single connection according to a specific
-// behaviour.  Implementations include relaying stdin/stdout (Relay)
-// and executing a child process (Exec).
+// behaviour.  Implementations include relaying stdin/stdout (Relay),
+// executing a child process (Exec), bridging to an upstream
+// address (Forward) and serving SOCKS5 (SOCKS) and HTTP proxy
+// (HTTPProxy) clients.
 type Capability interface {
 	// Handle runs the capability against the given session.
 	// It blocks until the connection is done or the context is
 	// cancelled.
 	Handle(ctx context.Context, sess *session.Session) error
 }
+
+// Describe names a capability for logs and audit records: "relay",
+// "forward", "socks", "http-proxy", or "exec" with the program or shell command it runs.
+func Describe(c Capability) (name, command string) {
+	switch c := c.(type) {
+	case *Relay:
+		return "relay", ""
+	case *Forward:
+		return "forward", ""
+	case *SOCKS:
+		return "socks", ""
+	case *HTTPProxy:
+		return "http-proxy", ""
+	case *Exec:
+		if c.Command != "" {
+			return "exec", c.Command
+		}
+		return "exec", c.Program
+	}
+	return "", ""
+}
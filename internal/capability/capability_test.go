@@ -3,12 +3,26 @@ package capability
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"gonc/internal/audit"
+	"gonc/internal/httpproxy"
+	"gonc/internal/metrics"
 	"gonc/internal/session"
+	"gonc/internal/sniff"
+	"gonc/internal/socks5"
+	"gonc/internal/transport"
 	"gonc/util"
 )
 
@@ -55,3 +69,471 @@ func TestRelay_BidirectionalCopy(t *testing.T) {
 		t.Errorf("output = %q, want %q", got, "hello relay\n")
 	}
 }
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name        string
+		c           Capability
+		wantName    string
+		wantCommand string
+	}{
+		{"relay", &Relay{}, "relay", ""},
+		{"forward", &Forward{Address: "db:5432"}, "forward", ""},
+		{"socks", &SOCKS{}, "socks", ""},
+		{"http proxy", &HTTPProxy{}, "http-proxy", ""},
+		{"program", &Exec{Program: "/bin/cat"}, "exec", "/bin/cat"},
+		{"shell command", &Exec{Command: "echo hi"}, "exec", "echo hi"},
+		{"unknown", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, command := Describe(tt.c)
+			if name != tt.wantName || command != tt.wantCommand {
+				t.Errorf("Describe = (%q, %q), want (%q, %q)",
+					name, command, tt.wantName, tt.wantCommand)
+			}
+		})
+	}
+}
+
+// TestForward_Bridge verifies Forward dials the upstream and bridges
+// the session to it.
+func TestForward_Bridge(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn) // echo
+	}()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	fwd := &Forward{
+		Dialer:  &transport.TCPDialer{Timeout: time.Second},
+		Network: "tcp",
+		Address: ln.Addr().String(),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fwd.Handle(ctx, session.New(server, nil, nil, util.NewLogger(0)))
+	}()
+
+	client.Write([]byte("ping")) //nolint:errcheck
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo through forward = %q, %v", buf, err)
+	}
+	client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Handle = %v", err)
+	}
+}
+
+// TestForward_DialError verifies a failed upstream dial is reported.
+func TestForward_DialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	a, b := net.Pipe()
+	defer a.Close()
+	fwd := &Forward{Dialer: &transport.TCPDialer{Timeout: time.Second}, Network: "tcp", Address: addr}
+	if err := fwd.Handle(context.Background(), session.New(b, nil, nil, util.NewLogger(0))); err == nil {
+		t.Error("expected an error for an unreachable upstream")
+	}
+}
+
+// clientHello returns the first TLS record a client sends for name.
+func clientHello(t *testing.T, name string) []byte {
+	t.Helper()
+	a, b := net.Pipe()
+	defer b.Close()
+	go tls.Client(a, &tls.Config{ServerName: name, InsecureSkipVerify: true}).Handshake() //nolint:errcheck
+	defer a.Close()
+
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(b, hdr); err != nil {
+		t.Fatal(err)
+	}
+	rec := make([]byte, int(hdr[3])<<8|int(hdr[4]))
+	if _, err := io.ReadFull(b, rec); err != nil {
+		t.Fatal(err)
+	}
+	return append(hdr, rec...)
+}
+
+// TestForward_SNIRoute verifies that the upstream is picked from the
+// ClientHello's server name and that the hello reaches it untouched.
+func TestForward_SNIRoute(t *testing.T) {
+	serve := func(name string) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				hdr := make([]byte, 5)
+				if _, err := io.ReadFull(conn, hdr); err == nil && hdr[0] == 0x16 {
+					conn.Write([]byte(name)) //nolint:errcheck
+				}
+				conn.Close()
+			}
+		}()
+		return ln.Addr().String()
+	}
+	router := sniff.NewTable(serve("default"))
+	router.Add("git.lab", serve("git"))   //nolint:errcheck
+	router.Add("*.k8s.lab", serve("k8s")) //nolint:errcheck
+
+	fwd := &Forward{
+		Dialer:  &transport.TCPDialer{Timeout: time.Second},
+		Network: "tcp",
+		Address: router.Default(),
+		Router:  router,
+	}
+	for sni, want := range map[string]string{"git.lab": "git", "api.k8s.lab": "k8s", "other.lab": "default"} {
+		client, server := net.Pipe()
+		sess := session.New(server, nil, nil, util.NewLogger(0))
+		done := make(chan error, 1)
+		go func() { done <- fwd.Handle(context.Background(), sess) }()
+
+		client.Write(clientHello(t, sni)) //nolint:errcheck
+		got, _ := io.ReadAll(client)
+		client.Close()
+		<-done
+		if string(got) != want {
+			t.Errorf("SNI %q routed to %q, want %q", sni, got, want)
+		}
+		if sess.Target == "" {
+			t.Errorf("SNI %q: session target not set", sni)
+		}
+	}
+
+	// Without a default, unmatched names are refused.
+	fwd.Router = sniff.NewTable("")
+	fwd.Address = ""
+	client, server := net.Pipe()
+	defer client.Close()
+	go client.Write(clientHello(t, "other.lab")) //nolint:errcheck
+	if err := fwd.Handle(context.Background(), session.New(server, nil, nil, util.NewLogger(0))); err == nil {
+		t.Error("unrouted name should fail")
+	}
+}
+
+// ── SOCKS ────────────────────────────────────────────────────────────
+
+// socksSession serves one SOCKS connection over real TCP, so the
+// session has IP addresses for UDP ASSOCIATE, and returns the client
+// side and the Handle result.
+func socksSession(t *testing.T, s *SOCKS) (net.Conn, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- s.Handle(context.Background(), session.New(conn, nil, nil, util.NewLogger(0)))
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	return client, done
+}
+
+// socksRequest logs in as alice and sends cmd for 127.0.0.1:port,
+// returning the reply code and bound address.
+func socksRequest(t *testing.T, c net.Conn, pass string, cmd byte, port int) (byte, *net.UDPAddr) {
+	t.Helper()
+	msg := []byte{5, 1, 2, 1, 5}
+	msg = append(msg, "alice"...)
+	msg = append(msg, byte(len(pass)))
+	msg = append(msg, pass...)
+	msg = append(msg, 5, cmd, 0, 1, 127, 0, 0, 1, byte(port>>8), byte(port))
+	c.Write(msg) //nolint:errcheck
+
+	resp := make([]byte, 4)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[3] != 0 {
+		return 0xff, nil // login refused; the server hangs up
+	}
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply[1], &net.UDPAddr{IP: net.IP(reply[4:8]), Port: int(reply[8])<<8 | int(reply[9])}
+}
+
+func TestSOCKS_Connect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn) // echo
+			}()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	newSOCKS := func(deny string) *SOCKS {
+		s := &SOCKS{
+			Dialer: &transport.TCPDialer{Timeout: time.Second},
+			Users:  map[string]string{"alice": "s3cret"},
+		}
+		if deny != "" {
+			rule, _ := socks5.ParseRule(deny)
+			s.Rules = &socks5.Rules{Deny: []socks5.Rule{rule}}
+		}
+		return s
+	}
+
+	t.Run("bridge", func(t *testing.T) {
+		client, done := socksSession(t, newSOCKS(""))
+		if code, _ := socksRequest(t, client, "s3cret", socks5.CmdConnect, port); code != socks5.ReplySucceeded {
+			t.Fatalf("reply = %d", code)
+		}
+		client.Write([]byte("ping")) //nolint:errcheck
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("echo through socks = %q, %v", buf, err)
+		}
+		client.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Handle = %v", err)
+		}
+	})
+
+	t.Run("bad password", func(t *testing.T) {
+		client, done := socksSession(t, newSOCKS(""))
+		if code, _ := socksRequest(t, client, "guess", socks5.CmdConnect, port); code != 0xff {
+			t.Errorf("reply = %d, want login refused", code)
+		}
+		if err := <-done; !errors.Is(err, socks5.ErrAuth) {
+			t.Errorf("Handle = %v, want ErrAuth", err)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		client, done := socksSession(t, newSOCKS("127.0.0.0/8"))
+		if code, _ := socksRequest(t, client, "s3cret", socks5.CmdConnect, port); code != socks5.ReplyNotAllowed {
+			t.Errorf("reply = %d, want not allowed", code)
+		}
+		if err := <-done; !errors.Is(err, socks5.ErrNotAllowed) {
+			t.Errorf("Handle = %v, want ErrNotAllowed", err)
+		}
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		client, done := socksSession(t, newSOCKS(""))
+		if code, _ := socksRequest(t, client, "s3cret", socks5.CmdBind, port); code != socks5.ReplyCommandUnsupported {
+			t.Errorf("reply = %d, want command unsupported", code)
+		}
+		if err := <-done; err == nil {
+			t.Error("BIND should fail")
+		}
+	})
+}
+
+func TestSOCKS_UDPAssociate(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(buf[:n], from) //nolint:errcheck
+		}
+	}()
+	target := echo.LocalAddr().(*net.UDPAddr)
+
+	s := &SOCKS{
+		Dialer: &transport.UDPDialer{Timeout: time.Second},
+		Users:  map[string]string{"alice": "s3cret"},
+	}
+	client, done := socksSession(t, s)
+	code, relay := socksRequest(t, client, "s3cret", socks5.CmdUDPAssociate, 0)
+	if code != socks5.ReplySucceeded {
+		t.Fatalf("reply = %d", code)
+	}
+
+	uc, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+	uc.Write(socks5.AppendDatagram(nil, "127.0.0.1", target.Port, []byte("dns?"))) //nolint:errcheck
+	uc.SetReadDeadline(time.Now().Add(2 * time.Second))                            //nolint:errcheck
+	buf := make([]byte, 1500)
+	n, err := uc.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, port, payload, err := socks5.ParseDatagram(buf[:n]); err != nil || port != target.Port || string(payload) != "dns?" {
+		t.Errorf("reply datagram = %d %q, %v", port, payload, err)
+	}
+
+	// Closing the control connection ends the association.
+	client.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Handle = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("association outlived its TCP connection")
+	}
+}
+
+// httpProxyServer runs p on a local listener, one Handle per
+// connection, and returns its URL with alice's credentials.
+func httpProxyServer(t *testing.T, p *HTTPProxy) *url.URL {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				p.Handle(context.Background(), session.New(conn, nil, nil, util.NewLogger(0))) //nolint:errcheck
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: ln.Addr().String(), User: url.UserPassword("alice", "s3cret")}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Error("Proxy-Authorization was forwarded upstream")
+		}
+		io.WriteString(w, "hello "+r.URL.Path) //nolint:errcheck
+	}))
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure") //nolint:errcheck
+	}))
+	defer tlsBackend.Close()
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	al, err := audit.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	m := metrics.New()
+	loopback, _ := httpproxy.ParseHost("127.0.0.1")
+	proxyURL := httpProxyServer(t, &HTTPProxy{
+		Dialer:  &transport.TCPDialer{Timeout: time.Second},
+		Users:   map[string]string{"alice": "s3cret"},
+		Policy:  &httpproxy.Policy{Hosts: []socks5.Rule{loopback}},
+		Audit:   al,
+		Metrics: m,
+	})
+
+	get := func(t *testing.T, proxy *url.URL, target string) (int, string) {
+		t.Helper()
+		tr := tlsBackend.Client().Transport.(*http.Transport).Clone()
+		tr.Proxy = http.ProxyURL(proxy)
+		defer tr.CloseIdleConnections() // ends a CONNECT tunnel
+		resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get(target)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		if code, body := get(t, proxyURL, backend.URL+"/x"); code != 200 || body != "hello /x" {
+			t.Errorf("GET = %d %q", code, body)
+		}
+	})
+	t.Run("connect", func(t *testing.T) {
+		if code, body := get(t, proxyURL, tlsBackend.URL); code != 200 || body != "secure" {
+			t.Errorf("GET over CONNECT = %d %q", code, body)
+		}
+	})
+	t.Run("bad password", func(t *testing.T) {
+		bad := *proxyURL
+		bad.User = url.UserPassword("alice", "guess")
+		if code, _ := get(t, &bad, backend.URL); code != http.StatusProxyAuthRequired {
+			t.Errorf("status = %d, want 407", code)
+		}
+	})
+	t.Run("host not allowed", func(t *testing.T) {
+		target := strings.Replace(backend.URL, "127.0.0.1", "localhost", 1)
+		if code, _ := get(t, proxyURL, target); code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", code)
+		}
+	})
+
+	// The tunnel's record is written once the proxy sees it close.
+	var data []byte
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, err = os.ReadFile(auditPath); err == nil && strings.Count(string(data), "\n") == 4 {
+			break
+		}
+	}
+	if got := m.HTTPRequests(); got["2xx"] != 2 || got["4xx"] != 2 {
+		t.Errorf("HTTPRequests = %v, want 2xx=2 4xx=2", got)
+	}
+	for _, want := range []string{`"method":"GET"`, `"method":"CONNECT"`, `"status":407`, `"user":"alice"`, `"capability":"http-proxy"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("audit log lacks %s:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package capability
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"gonc/internal/balance"
+	"gonc/internal/proxyproto"
+	"gonc/internal/session"
+	"gonc/internal/sniff"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// sniffTimeout bounds how long Forward waits for a ClientHello or
+// request head to route by.
+const sniffTimeout = 5 * time.Second
+
+// Forward bridges the connection to an upstream address dialled
+// through Dialer — direct, SSH-tunnelled or PROXY-header-prepending,
+// whichever the mode was built with.  One upstream connection is
+// opened per session, so a multi-client listener becomes a port
+// forwarder.  With a Pool, each session for Address goes to one of
+// several backends instead.
+//
+// With a Router, the upstream is chosen per session from the TLS SNI
+// (or HTTP Host) the client sends first.  The handshake is only
+// peeked at, never terminated: the bytes are replayed to the chosen
+// upstream, which holds the keys.
+type Forward struct {
+	Dialer      transport.Dialer
+	Network     string        // "tcp" or "udp"
+	Address     string        // upstream host:port; the Router's default
+	Pool        *balance.Pool // optional; balances Address over --backend targets dialled through Dialer
+	Router      *sniff.Table  // optional; per-name upstreams for --sni-route
+	IdleTimeout time.Duration // close both sides after this long without data (0 = never)
+}
+
+// Handle dials the upstream and copies data both ways until either
+// side closes, the session idles out, or ctx is cancelled.
+func (f *Forward) Handle(ctx context.Context, sess *session.Session) error {
+	// A ProxyProtoDialer reports the client, not gonc, as the source.
+	src := sess.Origin
+	if src == nil {
+		src = sess.Conn.RemoteAddr()
+	}
+	if src != nil {
+		ctx = proxyproto.WithSource(ctx, src)
+	}
+
+	conn, target, err := f.route(sess)
+	if err != nil {
+		return err
+	}
+
+	upstream, target, err := f.dial(ctx, target)
+	if err != nil {
+		return fmt.Errorf("forward to %s: %w", target, err)
+	}
+	defer upstream.Close()
+	sess.Target = target
+
+	sess.Logger.Verbose("forwarding to %s (%s)", target, f.Network)
+	in, out, reason := util.BridgeReason(ctx, conn, upstream, f.IdleTimeout)
+	sess.Logger.With("bytes_in", in, "bytes_out", out, "reason", reason).
+		Debug("forward to %s closed (in=%d out=%d reason=%s)", target, in, out, reason)
+	if reason == util.BridgeError {
+		return fmt.Errorf("forward to %s: bridge error", target)
+	}
+	return nil
+}
+
+// route picks the upstream for sess.  Without a Router it is Address.
+// With one, it peeks at the server name and returns a conn that
+// replays the peeked bytes.
+func (f *Forward) route(sess *session.Session) (net.Conn, string, error) {
+	if f.Router == nil {
+		return sess.Conn, f.Address, nil
+	}
+
+	sc := sniff.NewConn(sess.Conn)
+	host, proto, err := sniff.ServerName(sc, sniffTimeout)
+	if err != nil {
+		sess.Logger.Debug("sniff: %v", err)
+	}
+	target, matched := f.Router.Lookup(host)
+	log := sess.Logger.With("proto", proto, "host", host, "target", target)
+	switch {
+	case target == "":
+		return nil, "", fmt.Errorf("no route for %s host %q", proto, host)
+	case matched:
+		log.Verbose("%s host %q → %s", proto, host, target)
+	default:
+		log.Debug("no route for %s host %q, using %s", proto, host, target)
+	}
+	return sc, target, nil
+}
+
+// dial connects to target, or to a backend chosen by Pool when target
+// is Address, and returns the connection and the address it reached.
+func (f *Forward) dial(ctx context.Context, target string) (net.Conn, string, error) {
+	if f.Pool == nil || target != f.Address {
+		conn, err := f.Dialer.Dial(ctx, f.Network, target)
+		return conn, target, err
+	}
+	conn, target, err := f.Pool.Dial(ctx)
+	if err != nil {
+		return nil, "backends", err
+	}
+	return conn, target, nil
+}
+
+// Close stops the Pool's health checks and releases the dialer, e.g.
+// the SSH connection of -T.
+func (f *Forward) Close() error {
+	f.Pool.Close() //nolint:errcheck
+	return f.Dialer.Close()
+}
@@ -0,0 +1,272 @@
+package capability
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"gonc/internal/audit"
+	"gonc/internal/httpproxy"
+	"gonc/internal/metrics"
+	"gonc/internal/session"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// httpProxyKeepAlive bounds the wait for the next request on a client
+// connection when no -w timeout is set.
+const httpProxyKeepAlive = 2 * time.Minute
+
+// HTTPProxy serves each connection as an HTTP/1.1 forward proxy
+// (--http-proxy): CONNECT host:port becomes a raw tunnel and plain
+// http:// requests are forwarded, with every destination dialled
+// through Dialer so -T turns the listener into an SSH-backed proxy for
+// tools that only understand HTTP_PROXY.
+//
+// Each request is written to Audit and counted in Metrics on its own;
+// the listener's per-connection record still covers the connection.
+type HTTPProxy struct {
+	Dialer      transport.Dialer
+	Users       map[string]string // --http-proxy-auth user → password; empty allows anyone
+	Policy      *httpproxy.Policy // optional; --http-proxy-ports / --http-proxy-hosts
+	IdleTimeout time.Duration     // close a tunnel or idle client after this long (0 = defaults)
+	Audit       *audit.Log        // optional per-request access log
+	Metrics     *metrics.Collector
+}
+
+// exchange is the outcome of one proxied request, for the access log.
+type exchange struct {
+	start    time.Time
+	user     string
+	target   string
+	status   int
+	in, out  int64
+	err      error
+	finished bool // the client connection is done after this request
+}
+
+// Handle reads requests from the client until it closes the
+// connection, a CONNECT tunnel ends, or a response cannot be framed
+// for reuse.
+func (p *HTTPProxy) Handle(ctx context.Context, sess *session.Session) error {
+	br := bufio.NewReader(sess.Conn)
+	wait := p.IdleTimeout
+	if wait == 0 {
+		wait = httpProxyKeepAlive
+	}
+	for ctx.Err() == nil {
+		sess.Conn.SetReadDeadline(time.Now().Add(wait)) //nolint:errcheck
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) || isTimeout(err) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			httpproxy.WriteError(sess.Conn, http.StatusBadRequest, "malformed request", true) //nolint:errcheck
+			p.Metrics.RecordHTTPRequest(http.StatusBadRequest)
+			return fmt.Errorf("http-proxy: %w", err)
+		}
+		sess.Conn.SetReadDeadline(time.Time{}) //nolint:errcheck
+
+		x := p.serve(ctx, sess, br, req)
+		p.record(sess, req, x)
+		if x.finished {
+			return x.err
+		}
+	}
+	return nil
+}
+
+// serve answers one request.
+func (p *HTTPProxy) serve(ctx context.Context, sess *session.Session, br *bufio.Reader, req *http.Request) *exchange {
+	x := &exchange{start: time.Now()}
+	defer req.Body.Close()
+
+	user, ok := httpproxy.Authenticate(req, p.Users)
+	x.user = user
+	if !ok {
+		// A body we did not read would be parsed as the next request.
+		bodyless := req.ContentLength == 0 && len(req.TransferEncoding) == 0
+		p.fail(sess, x, http.StatusProxyAuthRequired, "proxy authentication required", !bodyless)
+		return x
+	}
+	if user != "" {
+		sess.User = user
+	}
+
+	target, err := httpproxy.Target(req)
+	if err == nil {
+		x.target = target
+		err = p.Policy.Allow(target)
+	}
+	if err != nil {
+		x.err = err
+		p.fail(sess, x, httpproxy.ErrorStatus(err), err.Error(), req.Method == http.MethodConnect)
+		return x
+	}
+	sess.Target = target
+
+	dialStart := time.Now()
+	upstream, err := p.Dialer.Dial(ctx, "tcp", target)
+	if err != nil {
+		x.err = fmt.Errorf("dial %s: %w", target, err)
+		p.fail(sess, x, httpproxy.ErrorStatus(err), "cannot reach "+target, req.Method == http.MethodConnect)
+		return x
+	}
+	p.Metrics.ObserveDialLatency(time.Since(dialStart))
+	defer upstream.Close()
+
+	if req.Method == http.MethodConnect {
+		p.tunnel(ctx, sess, br, upstream, x)
+	} else {
+		p.forward(sess, req, upstream, x)
+	}
+	return x
+}
+
+// tunnel answers a CONNECT and bridges the client to upstream.  Bytes
+// the client sent after the request are already in br.
+func (p *HTTPProxy) tunnel(ctx context.Context, sess *session.Session, br *bufio.Reader, upstream net.Conn, x *exchange) {
+	x.status = http.StatusOK
+	x.finished = true
+	if _, err := io.WriteString(sess.Conn, httpproxy.Established); err != nil {
+		x.err = fmt.Errorf("reply: %w", err)
+		return
+	}
+	client := &bufferedConn{Conn: sess.Conn, r: br}
+	in, out, reason := util.BridgeReason(ctx, client, upstream, p.IdleTimeout)
+	x.in, x.out = in, out
+	if reason == util.BridgeError {
+		x.err = errors.New("bridge error")
+	}
+}
+
+// forward relays one plain request to upstream and its response back.
+// The upstream connection is used once; the client connection is kept
+// when both it and the response allow.
+func (p *HTTPProxy) forward(sess *session.Session, req *http.Request, upstream net.Conn, x *exchange) {
+	clientClose := req.Close
+	httpproxy.RemoveHopHeaders(req.Header)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "") // stop Request.Write adding Go's
+	}
+	req.Close = true
+
+	up := &countingWriter{w: upstream}
+	if err := req.Write(up); err != nil {
+		x.in = up.n
+		x.err = fmt.Errorf("write request: %w", err)
+		p.fail(sess, x, http.StatusBadGateway, "upstream write failed", true)
+		return
+	}
+	x.in = up.n
+
+	resp, err := http.ReadResponse(bufio.NewReader(upstream), req)
+	if err != nil {
+		x.err = fmt.Errorf("read response: %w", err)
+		p.fail(sess, x, httpproxy.ErrorStatus(err), "bad upstream response", true)
+		return
+	}
+	defer resp.Body.Close()
+	x.status = resp.StatusCode
+
+	httpproxy.RemoveHopHeaders(resp.Header)
+	// Without a length the body can only be delimited by closing.
+	unframed := resp.ContentLength < 0 && len(resp.TransferEncoding) == 0
+	resp.Close = clientClose || unframed
+	down := &countingWriter{w: sess.Conn}
+	err = resp.Write(down)
+	x.out = down.n
+	x.finished = resp.Close
+	if err != nil {
+		x.err = fmt.Errorf("write response: %w", err)
+		x.finished = true
+	}
+}
+
+// fail answers with the proxy's own error response.
+func (p *HTTPProxy) fail(sess *session.Session, x *exchange, status int, msg string, close bool) {
+	x.status = status
+	x.finished = close
+	if err := httpproxy.WriteError(sess.Conn, status, msg, close); err != nil {
+		x.finished = true
+	}
+}
+
+// record writes the access log line, audit record and metrics for one
+// request.
+func (p *HTTPProxy) record(sess *session.Session, req *http.Request, x *exchange) {
+	d := time.Since(x.start)
+	log := sess.Logger.With("method", req.Method, "url", req.RequestURI, "status", x.status)
+	if x.user != "" {
+		log = log.With("user", x.user)
+	}
+	log.Verbose("http-proxy: %s %s %d (in=%d out=%d %s)",
+		req.Method, req.RequestURI, x.status, x.in, x.out, d.Round(time.Millisecond))
+	if x.err != nil {
+		log.Debug("http-proxy: %s %s: %v", req.Method, req.RequestURI, x.err)
+		p.Metrics.RecordError(fmt.Sprintf("http-proxy: %s %s: %v", req.Method, req.RequestURI, x.err))
+	}
+	p.Metrics.RecordHTTPRequest(x.status)
+
+	rec := audit.Record{
+		Time:       time.Now(),
+		Start:      x.start,
+		Mode:       "listen",
+		Local:      sess.Conn.LocalAddr().String(),
+		Remote:     sess.Conn.RemoteAddr().String(),
+		Target:     x.target,
+		User:       x.user,
+		Capability: "http-proxy",
+		Method:     req.Method,
+		URL:        req.RequestURI,
+		Status:     x.status,
+		BytesIn:    x.in,
+		BytesOut:   x.out,
+		DurationMs: d.Milliseconds(),
+	}
+	if sess.Origin != nil {
+		rec.Origin = sess.Origin.String()
+	}
+	if x.err != nil {
+		rec.Error = x.err.Error()
+	}
+	p.Audit.Write(rec) //nolint:errcheck
+}
+
+// Close releases the dialer, e.g. the SSH connection of -T.
+func (p *HTTPProxy) Close() error { return p.Dialer.Close() }
+
+// bufferedConn reads through r, which holds bytes already read from
+// Conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// CloseWrite keeps the half-close of the underlying connection
+// reachable through the wrapper.
+func (c *bufferedConn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,130 @@
+package capability
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"gonc/internal/session"
+	"gonc/internal/socks5"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// socksHandshakeTimeout bounds authentication and the request, so a
+// silent client cannot hold a connection open.
+const socksHandshakeTimeout = 10 * time.Second
+
+// SOCKS serves each connection as a SOCKS5 proxy (--socks): the client
+// names a destination and SOCKS dials it through Dialer, so -T turns
+// the listener into a SOCKS front for the SSH gateway's network.
+// CONNECT and UDP ASSOCIATE are supported; BIND is refused.
+type SOCKS struct {
+	Dialer      transport.Dialer
+	Users       map[string]string // --socks-auth user → password; empty allows anyone
+	Rules       *socks5.Rules     // optional; --socks-allow / --socks-deny
+	IdleTimeout time.Duration     // close both sides after this long without data (0 = never)
+}
+
+// Handle negotiates with the client and serves its request.
+func (s *SOCKS) Handle(ctx context.Context, sess *session.Session) error {
+	conn := sess.Conn
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout)) //nolint:errcheck
+	req, err := socks5.Handshake(conn, s.Users)
+	if err != nil {
+		return fmt.Errorf("socks: %w", err)
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+	sess.User = req.User
+	if req.User != "" {
+		sess.Logger = sess.Logger.With("user", req.User)
+	}
+
+	switch req.Command {
+	case socks5.CmdConnect:
+		return s.connect(ctx, sess, req)
+	case socks5.CmdUDPAssociate:
+		return s.associate(ctx, sess)
+	}
+	socks5.Reply(conn, socks5.ReplyCommandUnsupported, nil) //nolint:errcheck
+	return fmt.Errorf("socks: unsupported command %d", req.Command)
+}
+
+// connect dials the destination and bridges the client to it.
+func (s *SOCKS) connect(ctx context.Context, sess *session.Session, req *socks5.Request) error {
+	target := req.Address()
+	sess.Target = target
+
+	addr, err := s.Rules.Check(ctx, req.Host, req.Port)
+	var upstream net.Conn
+	if err == nil {
+		upstream, err = s.Dialer.Dial(ctx, "tcp", addr)
+	}
+	if err != nil {
+		socks5.Reply(sess.Conn, socks5.ReplyCode(err), nil) //nolint:errcheck
+		return fmt.Errorf("socks: connect %s: %w", target, err)
+	}
+	defer upstream.Close()
+	if err := socks5.Reply(sess.Conn, socks5.ReplySucceeded, upstream.LocalAddr()); err != nil {
+		return fmt.Errorf("socks: reply: %w", err)
+	}
+
+	sess.Logger.With("target", target).Verbose("socks: connected to %s", target)
+	in, out, reason := util.BridgeReason(ctx, sess.Conn, upstream, s.IdleTimeout)
+	sess.Logger.With("bytes_in", in, "bytes_out", out, "reason", reason).
+		Debug("socks: %s closed (in=%d out=%d reason=%s)", target, in, out, reason)
+	if reason == util.BridgeError {
+		return fmt.Errorf("socks: connect %s: bridge error", target)
+	}
+	return nil
+}
+
+// associate opens a UDP relay on the address the client reached us
+// on and serves it until the client closes the TCP connection.
+func (s *SOCKS) associate(ctx context.Context, sess *session.Session) error {
+	conn := sess.Conn
+	local, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	client := net.ParseIP(remote)
+	if client == nil {
+		socks5.Reply(conn, socks5.ReplyFailure, nil) //nolint:errcheck
+		return fmt.Errorf("socks: udp associate: client address %s is not an IP", conn.RemoteAddr())
+	}
+
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(local)})
+	if err != nil {
+		socks5.Reply(conn, socks5.ReplyFailure, nil) //nolint:errcheck
+		return fmt.Errorf("socks: udp associate: %w", err)
+	}
+	defer pc.Close()
+	if err := socks5.Reply(conn, socks5.ReplySucceeded, pc.LocalAddr()); err != nil {
+		return fmt.Errorf("socks: reply: %w", err)
+	}
+	sess.Target = "udp " + pc.LocalAddr().String()
+	sess.Logger.Verbose("socks: udp relay on %s", pc.LocalAddr())
+
+	// The association lasts as long as the TCP connection.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, conn) //nolint:errcheck
+		cancel()
+	}()
+
+	relay := &socks5.UDPRelay{
+		Conn:   pc,
+		Client: client,
+		Dial:   s.Dialer.Dial,
+		Rules:  s.Rules,
+		Logger: sess.Logger,
+	}
+	if err := relay.Serve(ctx); err != nil {
+		return fmt.Errorf("socks: udp relay: %w", err)
+	}
+	return nil
+}
+
+// Close releases the dialer, e.g. the SSH connection of -T.
+func (s *SOCKS) Close() error { return s.Dialer.Close() }
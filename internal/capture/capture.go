@@ -0,0 +1,207 @@
+// Package capture records the bytes crossing a session, for -o /
+// --hex-dump, --tee, --pcap and --record.
+//
+// A Capture wraps each session's network connection so every Read and
+// Write is handed to its sinks along with the direction, the offset
+// within that direction's stream, and the time.  Because it sits on
+// the connection rather than inside a capability, the same wrapper
+// covers Relay, Exec and reverse-tunnel bridges.  A nil *Capture is a
+// valid no-op receiver, like audit.Log.
+package capture
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/util"
+)
+
+// Direction says which way a chunk of data crossed a session,
+// relative to the network peer.
+type Direction int
+
+const (
+	Received Direction = iota // read from the peer
+	Sent                      // written to the peer
+)
+
+// Marker returns the netcat-style direction marker: "<" for received
+// data and ">" for sent data.
+func (d Direction) Marker() string {
+	if d == Sent {
+		return ">"
+	}
+	return "<"
+}
+
+// Options selects where captured data goes.  Empty fields are off.
+type Options struct {
+	HexDump string // hex dump of both directions to this file ("-" = stderr)
+	Tee     string // raw per-direction files PREFIX.N.in and PREFIX.N.out
+	Pcap    string // synthetic libpcap capture of every session
+	Record  string // timestamped recording for gonc replay
+}
+
+// Session describes one captured connection.
+type Session struct {
+	ID     uint64 // 1, 2, ... in the order sessions were wrapped
+	Mode   string // connect, listen or reverse
+	Local  net.Addr
+	Remote net.Addr
+	Start  time.Time
+}
+
+// outbound reports whether gonc opened the connection, which decides
+// the direction of the synthetic TCP handshake in a pcap.
+func (s *Session) outbound() bool { return s.Mode == "connect" }
+
+// sink receives the data of every captured session.  Calls for one
+// session are serialised; calls for different sessions may overlap.
+type sink interface {
+	open(s *Session) error
+	record(s *Session, dir Direction, off int64, p []byte, at time.Time)
+	finish(s *Session, in, out int64)
+	Close() error
+}
+
+// Capture fans session data out to its sinks.
+type Capture struct {
+	sinks  []sink
+	nextID atomic.Uint64
+}
+
+// Open creates the sinks named in opts.  It returns nil, nil when no
+// capture was requested.
+func Open(opts Options) (*Capture, error) {
+	c := &Capture{}
+	if opts.HexDump != "" {
+		s, err := openHexDump(opts.HexDump)
+		if err != nil {
+			return nil, err
+		}
+		c.sinks = append(c.sinks, s)
+	}
+	if opts.Tee != "" {
+		c.sinks = append(c.sinks, &teeSink{prefix: opts.Tee})
+	}
+	if opts.Pcap != "" {
+		s, err := openPcap(opts.Pcap)
+		if err != nil {
+			c.Close() //nolint:errcheck
+			return nil, err
+		}
+		c.sinks = append(c.sinks, s)
+	}
+	if opts.Record != "" {
+		s, err := openRecording(opts.Record)
+		if err != nil {
+			c.Close() //nolint:errcheck
+			return nil, err
+		}
+		c.sinks = append(c.sinks, s)
+	}
+	if len(c.sinks) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// Wrap returns conn wrapped so its traffic is captured, labelled with
+// mode.  With a nil Capture conn is returned unchanged.
+func (c *Capture) Wrap(conn net.Conn, mode string) (net.Conn, error) {
+	if c == nil {
+		return conn, nil
+	}
+	s := &Session{
+		ID:     c.nextID.Add(1),
+		Mode:   mode,
+		Local:  conn.LocalAddr(),
+		Remote: conn.RemoteAddr(),
+		Start:  time.Now(),
+	}
+	for i, sk := range c.sinks {
+		if err := sk.open(s); err != nil {
+			for _, opened := range c.sinks[:i] {
+				opened.finish(s, 0, 0)
+			}
+			return nil, err
+		}
+	}
+	return &tapConn{Conn: conn, c: c, s: s}, nil
+}
+
+// Close flushes and closes every sink.
+func (c *Capture) Close() error {
+	if c == nil {
+		return nil
+	}
+	var errs []error
+	for _, sk := range c.sinks {
+		errs = append(errs, sk.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// tapConn hands every chunk read or written to the capture's sinks.
+type tapConn struct {
+	net.Conn
+	c *Capture
+	s *Session
+
+	mu      sync.Mutex // serialises sink calls for this session
+	in, out int64
+	closed  bool
+}
+
+func (t *tapConn) Read(p []byte) (int, error) {
+	n, err := t.Conn.Read(p)
+	if n > 0 {
+		t.record(Received, p[:n])
+	}
+	return n, err
+}
+
+func (t *tapConn) Write(p []byte) (int, error) {
+	n, err := t.Conn.Write(p)
+	if n > 0 {
+		t.record(Sent, p[:n])
+	}
+	return n, err
+}
+
+func (t *tapConn) record(dir Direction, p []byte) {
+	at := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	off := &t.in
+	if dir == Sent {
+		off = &t.out
+	}
+	for _, sk := range t.c.sinks {
+		sk.record(t.s, dir, *off, p, at)
+	}
+	*off += int64(len(p))
+}
+
+// CloseWrite half-closes the connection when supported.
+func (t *tapConn) CloseWrite() error { return util.CloseWrite(t.Conn) }
+
+// Close closes the connection and ends the session in every sink.
+func (t *tapConn) Close() error {
+	err := t.Conn.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		for _, sk := range t.c.sinks {
+			sk.finish(t.s, t.in, t.out)
+		}
+	}
+	return err
+}
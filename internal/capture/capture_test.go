@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  Direction
+		off  int64
+		in   string
+		want string
+	}{
+		{
+			name: "short received",
+			dir:  Received,
+			in:   "hello",
+			want: "< 00000000  68 65 6c 6c 6f                                    |hello|\n",
+		},
+		{
+			name: "sent with offset and control bytes",
+			dir:  Sent,
+			off:  0x20,
+			in:   "a\r\nb",
+			want: "> 00000020  61 0d 0a 62                                       |a..b|\n",
+		},
+		{
+			name: "two lines",
+			dir:  Received,
+			in:   "0123456789abcdefXY",
+			want: "< 00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+				"< 00000010  58 59                                             |XY|\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			Dump(&b, tt.dir, tt.off, []byte(tt.in))
+			if b.String() != tt.want {
+				t.Errorf("Dump =\n%q\nwant\n%q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenNothing(t *testing.T) {
+	c, err := Open(Options{})
+	if err != nil || c != nil {
+		t.Fatalf("Open(empty) = %v, %v; want nil, nil", c, err)
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	conn, err := c.Wrap(a, "connect")
+	if err != nil || conn != a {
+		t.Errorf("nil Wrap = %v, %v; want the conn unchanged", conn, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("nil Close: %v", err)
+	}
+}
+
+func TestWrapHexDumpAndTee(t *testing.T) {
+	dir := t.TempDir()
+	dumpPath := filepath.Join(dir, "dump.txt")
+	prefix := filepath.Join(dir, "session")
+
+	c, err := Open(Options{HexDump: dumpPath, Tee: prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	conn, err := c.Wrap(a, "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		b.Write([]byte("ping"))         //nolint:errcheck
+		io.ReadFull(b, make([]byte, 4)) //nolint:errcheck
+		b.Close()
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := os.ReadFile(dumpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# [1] ",
+		" listen ",
+		"< 00000000  70 69 6e 67",
+		"> 00000000  70 6f 6e 67",
+		"closed: received 4, sent 4 bytes",
+	} {
+		if !strings.Contains(string(dump), want) {
+			t.Errorf("hex dump missing %q:\n%s", want, dump)
+		}
+	}
+
+	for suffix, want := range map[string]string{".1.in": "ping", ".1.out": "pong"} {
+		got, err := os.ReadFile(prefix + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", suffix, got, want)
+		}
+	}
+}
+
+func TestWrapTeeOpenFailure(t *testing.T) {
+	c, err := Open(Options{Tee: filepath.Join(t.TempDir(), "missing", "session")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, err := c.Wrap(a, "connect"); err == nil {
+		t.Error("expected an error creating tee files in a missing directory")
+	}
+}
@@ -0,0 +1,123 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// hexSink writes every session to one file as a hexdump -C style
+// listing.  Each chunk gets a header with its session, direction and
+// time; each line is prefixed with the direction marker and the
+// offset within that direction's stream:
+//
+//	# [1] 2026-10-18T12:34:56.789012Z listen 127.0.0.1:8080 <-> 10.0.0.5:50000 opened
+//	< [1] 12:34:56.790123 5 bytes
+//	< 00000000  68 65 6c 6c 6f                                    |hello|
+//	# [1] 12:34:57.000001 closed: received 5, sent 0 bytes
+type hexSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil for stderr
+	err    error     // first write error, reported by Close
+}
+
+// openHexDump creates (or truncates) path, or writes to stderr for "-".
+func openHexDump(path string) (*hexSink, error) {
+	if path == "-" {
+		return &hexSink{w: os.Stderr}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &hexSink{w: f, closer: f}, nil
+}
+
+func (h *hexSink) open(s *Session) error {
+	h.write(fmt.Sprintf("# [%d] %s %s %s <-> %s opened\n",
+		s.ID, s.Start.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.Mode, addrString(s.Local), addrString(s.Remote)))
+	return nil
+}
+
+func (h *hexSink) record(s *Session, dir Direction, off int64, p []byte, at time.Time) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s [%d] %s %d bytes\n",
+		dir.Marker(), s.ID, at.UTC().Format("15:04:05.000000"), len(p))
+	Dump(&b, dir, off, p)
+	h.write(b.String())
+}
+
+func (h *hexSink) finish(s *Session, in, out int64) {
+	h.write(fmt.Sprintf("# [%d] %s closed: received %d, sent %d bytes\n",
+		s.ID, time.Now().UTC().Format("15:04:05.000000"), in, out))
+}
+
+// write emits text with a single Write so concurrent sessions never
+// split each other's chunks.
+func (h *hexSink) write(text string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := io.WriteString(h.w, text); err != nil && h.err == nil {
+		h.err = err
+	}
+}
+
+func (h *hexSink) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err := h.err
+	if h.closer != nil {
+		if cerr := h.closer.Close(); err == nil {
+			err = cerr
+		}
+		h.closer = nil
+	}
+	return err
+}
+
+// Dump writes p to w as hexdump -C style lines of 16 bytes, each
+// prefixed with dir's marker and numbered from off.
+func Dump(w io.Writer, dir Direction, off int64, p []byte) {
+	var line bytes.Buffer
+	for len(p) > 0 {
+		n := min(len(p), 16)
+		line.Reset()
+		fmt.Fprintf(&line, "%s %08x  ", dir.Marker(), off)
+		for i := 0; i < 16; i++ {
+			switch {
+			case i < n:
+				fmt.Fprintf(&line, "%02x ", p[i])
+			default:
+				line.WriteString("   ")
+			}
+			if i == 7 {
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteString(" |")
+		for _, c := range p[:n] {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			line.WriteByte(c)
+		}
+		line.WriteString("|\n")
+		w.Write(line.Bytes()) //nolint:errcheck
+
+		p = p[n:]
+		off += int64(n)
+	}
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return "-"
+	}
+	return a.String()
+}
@@ -0,0 +1,331 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapSink writes sessions as a synthetic libpcap capture that
+// Wireshark can dissect.  Every chunk becomes a packet with fabricated
+// Ethernet, IP and TCP (or UDP) headers addressed with the session's
+// real endpoints.  TCP sessions get a three-way handshake when opened,
+// sequence and acknowledgement numbers that follow the byte offsets,
+// and a FIN exchange when closed.
+//
+// Endpoints that are not IP addresses (pipes, SSH channels without
+// one) are replaced with 127.0.0.1 for the local side and 127.0.0.2
+// for the remote side.
+type pcapSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	err    error
+	sent   map[uint64]*[2]int64 // session ID → bytes seen [Received, Sent]
+}
+
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapSnapLen    = 262144
+	linkTypeEther  = 1
+	maxSegment     = 32 * 1024 // payload bytes per synthetic packet
+	etherTypeIPv4  = 0x0800
+	etherTypeIPv6  = 0x86dd
+	protoTCP       = 6
+	protoUDP       = 17
+	tcpFlagFIN     = 0x01
+	tcpFlagSYN     = 0x02
+	tcpFlagPSH     = 0x08
+	tcpFlagACK     = 0x10
+	fallbackPortLo = 40000
+)
+
+var (
+	localMAC  = []byte{0x02, 0, 0, 0, 0, 0x01}
+	remoteMAC = []byte{0x02, 0, 0, 0, 0, 0x02}
+)
+
+// openPcap creates (or truncates) path and writes the file header.
+func openPcap(path string) (*pcapSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	p := &pcapSink{w: f, closer: f, sent: make(map[uint64]*[2]int64)}
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], 2) // version 2.4
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeEther)
+	if _, err := f.Write(hdr[:]); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pcapSink) open(s *Session) error {
+	p.mu.Lock()
+	p.sent[s.ID] = &[2]int64{}
+	p.mu.Unlock()
+
+	if isUDP(s) {
+		return nil
+	}
+	// Handshake from whichever side initiated the connection.
+	client, server := Received, Sent // a remote peer connected to us
+	if s.outbound() {
+		client, server = Sent, Received
+	}
+	p.tcp(s, client, s.Start, tcpFlagSYN, 0, 0, nil)
+	p.tcp(s, server, s.Start, tcpFlagSYN|tcpFlagACK, 0, 1, nil)
+	p.tcp(s, client, s.Start, tcpFlagACK, 1, 1, nil)
+	return nil
+}
+
+func (p *pcapSink) record(s *Session, dir Direction, off int64, data []byte, at time.Time) {
+	p.mu.Lock()
+	counts := p.sent[s.ID]
+	p.mu.Unlock()
+	if counts == nil {
+		return
+	}
+
+	for len(data) > 0 {
+		n := min(len(data), maxSegment)
+		if isUDP(s) {
+			p.udp(s, dir, at, data[:n])
+		} else {
+			p.tcp(s, dir, at, tcpFlagPSH|tcpFlagACK, 1+off, 1+counts[1-dir], data[:n])
+		}
+		data = data[n:]
+		off += int64(n)
+	}
+	counts[dir] = off
+}
+
+func (p *pcapSink) finish(s *Session, in, out int64) {
+	p.mu.Lock()
+	delete(p.sent, s.ID)
+	p.mu.Unlock()
+
+	if isUDP(s) {
+		return
+	}
+	at := time.Now()
+	seq := [2]int64{1 + in, 1 + out}
+	p.tcp(s, Sent, at, tcpFlagFIN|tcpFlagACK, seq[Sent], seq[Received], nil)
+	p.tcp(s, Received, at, tcpFlagFIN|tcpFlagACK, seq[Received], seq[Sent]+1, nil)
+	p.tcp(s, Sent, at, tcpFlagACK, seq[Sent]+1, seq[Received]+1, nil)
+}
+
+func (p *pcapSink) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.err
+	if p.closer != nil {
+		if cerr := p.closer.Close(); err == nil {
+			err = cerr
+		}
+		p.closer = nil
+	}
+	return err
+}
+
+// ── packet construction ──────────────────────────────────────────────
+
+// endpoints returns the source and destination of a packet travelling
+// in dir: received data flows remote → local, sent data local → remote.
+func endpoints(s *Session, dir Direction) (src, dst endpoint) {
+	local, remote := sessionEndpoints(s)
+	if dir == Received {
+		return remote, local
+	}
+	return local, remote
+}
+
+type endpoint struct {
+	ip   net.IP
+	port int
+	mac  []byte
+}
+
+// sessionEndpoints resolves the local and remote endpoints, falling
+// back to loopback addresses for non-IP transports and mapping both
+// to IPv6 when the families differ.
+func sessionEndpoints(s *Session) (local, remote endpoint) {
+	local = endpoint{ip: net.IPv4(127, 0, 0, 1), mac: localMAC}
+	remote = endpoint{ip: net.IPv4(127, 0, 0, 2), port: fallbackPortLo + int(s.ID%20000), mac: remoteMAC}
+	if ip, port, ok := ipPort(s.Local); ok {
+		local.ip, local.port = ip, port
+	}
+	if ip, port, ok := ipPort(s.Remote); ok {
+		remote.ip, remote.port = ip, port
+	}
+
+	if (local.ip.To4() == nil) != (remote.ip.To4() == nil) {
+		local.ip, remote.ip = local.ip.To16(), remote.ip.To16()
+	} else if local.ip.To4() != nil {
+		local.ip, remote.ip = local.ip.To4(), remote.ip.To4()
+	}
+	return local, remote
+}
+
+func ipPort(a net.Addr) (net.IP, int, bool) {
+	switch a := a.(type) {
+	case *net.TCPAddr:
+		if a != nil && a.IP != nil {
+			return a.IP, a.Port, true
+		}
+	case *net.UDPAddr:
+		if a != nil && a.IP != nil {
+			return a.IP, a.Port, true
+		}
+	}
+	return nil, 0, false
+}
+
+func isUDP(s *Session) bool {
+	_, l := s.Local.(*net.UDPAddr)
+	_, r := s.Remote.(*net.UDPAddr)
+	return l || r
+}
+
+// isn returns the initial sequence number for the side sending in dir.
+// It is derived from the session ID so captures are reproducible.
+func isn(s *Session, dir Direction) uint32 {
+	return uint32(s.ID)*0x01000193 + uint32(dir)*0x40000000
+}
+
+// tcp writes one TCP segment.  seq and ack are relative to the
+// sender's and receiver's initial sequence numbers.
+func (p *pcapSink) tcp(s *Session, dir Direction, at time.Time, flags byte, seq, ack int64, payload []byte) {
+	src, dst := endpoints(s, dir)
+
+	seg := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(seg[0:], uint16(src.port))
+	binary.BigEndian.PutUint16(seg[2:], uint16(dst.port))
+	binary.BigEndian.PutUint32(seg[4:], isn(s, dir)+uint32(seq))
+	if flags&tcpFlagACK != 0 {
+		binary.BigEndian.PutUint32(seg[8:], isn(s, 1-dir)+uint32(ack))
+	}
+	seg[12] = 5 << 4 // data offset: 20-byte header
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], 65535) // window
+	copy(seg[20:], payload)
+	binary.BigEndian.PutUint16(seg[16:], transportChecksum(src.ip, dst.ip, protoTCP, seg))
+
+	p.packet(at, src, dst, protoTCP, seg)
+}
+
+// udp writes one UDP datagram.
+func (p *pcapSink) udp(s *Session, dir Direction, at time.Time, payload []byte) {
+	src, dst := endpoints(s, dir)
+
+	dg := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(dg[0:], uint16(src.port))
+	binary.BigEndian.PutUint16(dg[2:], uint16(dst.port))
+	binary.BigEndian.PutUint16(dg[4:], uint16(len(dg)))
+	copy(dg[8:], payload)
+	sum := transportChecksum(src.ip, dst.ip, protoUDP, dg)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(dg[6:], sum)
+
+	p.packet(at, src, dst, protoUDP, dg)
+}
+
+// packet wraps a transport segment in IP and Ethernet headers and
+// appends it to the capture with a single write.
+func (p *pcapSink) packet(at time.Time, src, dst endpoint, proto byte, seg []byte) {
+	var frame bytes.Buffer
+	frame.Write(dst.mac)
+	frame.Write(src.mac)
+
+	if v4 := src.ip.To4(); v4 != nil && len(src.ip) == net.IPv4len {
+		binary.Write(&frame, binary.BigEndian, uint16(etherTypeIPv4)) //nolint:errcheck
+		ip := make([]byte, 20)
+		ip[0] = 0x45 // version 4, 20-byte header
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(seg)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+		ip[8] = 64                                 // TTL
+		ip[9] = proto
+		copy(ip[12:], v4)
+		copy(ip[16:], dst.ip.To4())
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+		frame.Write(ip)
+	} else {
+		binary.Write(&frame, binary.BigEndian, uint16(etherTypeIPv6)) //nolint:errcheck
+		ip := make([]byte, 40)
+		ip[0] = 0x60 // version 6
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(seg)))
+		ip[6] = proto
+		ip[7] = 64 // hop limit
+		copy(ip[8:], src.ip.To16())
+		copy(ip[24:], dst.ip.To16())
+		frame.Write(ip)
+	}
+	frame.Write(seg)
+
+	var rec bytes.Buffer
+	var hdr [16]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(frame.Len()))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(frame.Len()))
+	rec.Write(hdr[:])
+	rec.Write(frame.Bytes())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closer == nil {
+		return
+	}
+	if _, err := p.w.Write(rec.Bytes()); err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+// transportChecksum computes a TCP or UDP checksum over the IP
+// pseudo-header and seg, whose checksum field must be zero.
+func transportChecksum(src, dst net.IP, proto byte, seg []byte) uint16 {
+	var pseudo []byte
+	if s4, d4 := src.To4(), dst.To4(); s4 != nil && d4 != nil && len(src) == net.IPv4len {
+		pseudo = append(pseudo, s4...)
+		pseudo = append(pseudo, d4...)
+		pseudo = append(pseudo, 0, proto)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(seg)))
+	} else {
+		pseudo = append(pseudo, src.To16()...)
+		pseudo = append(pseudo, dst.To16()...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(seg)))
+		pseudo = append(pseudo, 0, 0, 0, proto)
+	}
+	return checksum(seg, sum(pseudo, 0))
+}
+
+// checksum returns the Internet checksum of b, continuing from a
+// partial sum.
+func checksum(b []byte, partial uint32) uint16 {
+	s := sum(b, partial)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
+
+func sum(b []byte, s uint32) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	return s
+}
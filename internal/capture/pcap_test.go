@@ -0,0 +1,155 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pcapPacket is a decoded synthetic packet.
+type pcapPacket struct {
+	src, dst   net.IP
+	sport      int
+	dport      int
+	seq, ack   uint32
+	flags      byte
+	payload    string
+	ipSumOK    bool
+	tcpSumOK   bool
+	etherProto uint16
+}
+
+// readPcap decodes a capture written by pcapSink (IPv4/TCP only).
+func readPcap(t *testing.T, path string) []pcapPacket {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != pcapMagic {
+		t.Fatalf("bad pcap header % x", data[:min(len(data), 24)])
+	}
+	if lt := binary.LittleEndian.Uint32(data[20:]); lt != linkTypeEther {
+		t.Fatalf("link type = %d, want Ethernet", lt)
+	}
+
+	var pkts []pcapPacket
+	for rest := data[24:]; len(rest) > 0; {
+		n := int(binary.LittleEndian.Uint32(rest[8:]))
+		frame := rest[16 : 16+n]
+		rest = rest[16+n:]
+
+		p := pcapPacket{etherProto: binary.BigEndian.Uint16(frame[12:])}
+		ip := frame[14:34]
+		seg := frame[34:]
+		p.src, p.dst = net.IP(ip[12:16]), net.IP(ip[16:20])
+		p.ipSumOK = checksum(ip, 0) == 0
+		p.tcpSumOK = checksum(seg, sum(append(append(append([]byte{}, ip[12:20]...), 0, ip[9]),
+			byte(len(seg)>>8), byte(len(seg))), 0)) == 0
+		p.sport = int(binary.BigEndian.Uint16(seg[0:]))
+		p.dport = int(binary.BigEndian.Uint16(seg[2:]))
+		p.seq = binary.BigEndian.Uint32(seg[4:])
+		p.ack = binary.BigEndian.Uint32(seg[8:])
+		p.flags = seg[13]
+		p.payload = string(seg[20:])
+		pkts = append(pkts, p)
+	}
+	return pkts
+}
+
+func TestPcapTCPSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte("hello"))        //nolint:errcheck
+		io.ReadFull(c, make([]byte, 3)) //nolint:errcheck
+		c.Close()
+	}()
+
+	path := filepath.Join(t.TempDir(), "s.pcap")
+	c, err := Open(Options{Pcap: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := net.DialTimeout("tcp", ln.Addr().String(), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := c.Wrap(raw, "connect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("bye")) //nolint:errcheck
+	conn.Close()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pkts := readPcap(t, path)
+	if len(pkts) != 8 {
+		t.Fatalf("got %d packets, want 3 handshake + 2 data + 3 teardown", len(pkts))
+	}
+	for i, p := range pkts {
+		if p.etherProto != etherTypeIPv4 || !p.ipSumOK || !p.tcpSumOK {
+			t.Errorf("packet %d: ether %#x, ip checksum ok %v, tcp checksum ok %v",
+				i, p.etherProto, p.ipSumOK, p.tcpSumOK)
+		}
+	}
+
+	local := raw.LocalAddr().(*net.TCPAddr)
+	server := ln.Addr().(*net.TCPAddr)
+	syn, synAck, data1, data2 := pkts[0], pkts[1], pkts[3], pkts[4]
+
+	// Outbound session: the handshake starts from the local side.
+	if syn.flags != tcpFlagSYN || syn.sport != local.Port || syn.dport != server.Port {
+		t.Errorf("SYN = %+v", syn)
+	}
+	if synAck.flags != tcpFlagSYN|tcpFlagACK || synAck.ack != syn.seq+1 {
+		t.Errorf("SYN-ACK = %+v", synAck)
+	}
+	if data1.payload != "hello" || data1.sport != server.Port || data1.seq != synAck.seq+1 {
+		t.Errorf("received data = %+v", data1)
+	}
+	if data2.payload != "bye" || data2.seq != syn.seq+1 || data2.ack != data1.seq+5 {
+		t.Errorf("sent data = %+v", data2)
+	}
+	if fin := pkts[5]; fin.flags&tcpFlagFIN == 0 || fin.seq != data2.seq+3 {
+		t.Errorf("FIN = %+v", fin)
+	}
+}
+
+func TestSessionEndpointsFallback(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	s := &Session{ID: 7, Local: a.LocalAddr(), Remote: a.RemoteAddr()}
+	local, remote := sessionEndpoints(s)
+	if !local.ip.Equal(net.IPv4(127, 0, 0, 1)) || !remote.ip.Equal(net.IPv4(127, 0, 0, 2)) {
+		t.Errorf("fallback endpoints = %v, %v", local.ip, remote.ip)
+	}
+
+	s = &Session{
+		ID:     1,
+		Local:  &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 80},
+		Remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000},
+	}
+	local, remote = sessionEndpoints(s)
+	if len(local.ip) != net.IPv6len || len(remote.ip) != net.IPv6len {
+		t.Errorf("mixed families should both map to IPv6, got %v, %v", local.ip, remote.ip)
+	}
+}
@@ -0,0 +1,245 @@
+package capture
+
+// recording.go - the --record session format and its reader.
+//
+// A recording is a JSON Lines file.  Every line is one event object
+// with a "type" field:
+//
+//	{"type":"recording","version":1,"time":"2026-10-18T12:00:00Z"}
+//	{"type":"open","session":1,"time":"...","mode":"connect","client":"10.0.0.5:50000","server":"10.0.0.9:6379"}
+//	{"type":"data","session":1,"t":0.0012,"from":"client","data":"UElORw0K"}
+//	{"type":"data","session":1,"t":0.0031,"from":"server","data":"K1BPTkcNCg=="}
+//	{"type":"close","session":1,"t":0.0042}
+//
+// The first line identifies the file and its format version.  Each
+// session starts with an "open" event naming its mode and endpoints,
+// and ends with a "close" event.  "data" events carry the bytes of
+// one read or write, base64-encoded, with "t" in seconds since the
+// session opened.  "from" is "client" for the side that initiated the
+// connection (gonc itself in connect mode, the peer when listening)
+// and "server" for the other.  Events of concurrent sessions may be
+// interleaved; the session number tells them apart.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordingVersion is the format version written by --record.
+const RecordingVersion = 1
+
+// Event types in a recording.
+const (
+	EventRecording = "recording"
+	EventOpen      = "open"
+	EventData      = "data"
+	EventClose     = "close"
+)
+
+// Senders named by a data event's From field.
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// Event is one line of a recording.
+type Event struct {
+	Type    string     `json:"type"`
+	Version int        `json:"version,omitempty"`
+	Session uint64     `json:"session,omitempty"`
+	Time    *time.Time `json:"time,omitempty"` // recording and open events
+	Mode    string     `json:"mode,omitempty"`
+	Client  string     `json:"client,omitempty"`
+	Server  string     `json:"server,omitempty"`
+	T       float64    `json:"t,omitempty"` // seconds since the session opened
+	From    string     `json:"from,omitempty"`
+	Data    []byte     `json:"data,omitempty"`
+}
+
+// Chunk is one recorded read or write.
+type Chunk struct {
+	At         time.Duration // since the session opened
+	FromClient bool
+	Data       []byte
+}
+
+// Recording is one session read back from a recording file.
+type Recording struct {
+	Session uint64
+	Mode    string
+	Client  string
+	Server  string
+	Start   time.Time
+	Chunks  []Chunk
+}
+
+// ClientBytes and ServerBytes return everything each side sent.
+func (r *Recording) ClientBytes() []byte { return r.bytes(true) }
+func (r *Recording) ServerBytes() []byte { return r.bytes(false) }
+
+func (r *Recording) bytes(fromClient bool) []byte {
+	var out []byte
+	for _, c := range r.Chunks {
+		if c.FromClient == fromClient {
+			out = append(out, c.Data...)
+		}
+	}
+	return out
+}
+
+// ReadRecording parses a recording, returning its sessions in the
+// order they were opened.
+func ReadRecording(r io.Reader) ([]*Recording, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+
+	var recs []*Recording
+	byID := make(map[uint64]*Recording)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if line == 1 {
+			if ev.Type != EventRecording {
+				return nil, fmt.Errorf("not a gonc recording (first event is %q)", ev.Type)
+			}
+			if ev.Version > RecordingVersion {
+				return nil, fmt.Errorf("recording version %d is newer than supported version %d",
+					ev.Version, RecordingVersion)
+			}
+			continue
+		}
+
+		switch ev.Type {
+		case EventOpen:
+			rec := &Recording{Session: ev.Session, Mode: ev.Mode, Client: ev.Client, Server: ev.Server}
+			if ev.Time != nil {
+				rec.Start = *ev.Time
+			}
+			byID[ev.Session] = rec
+			recs = append(recs, rec)
+		case EventData:
+			rec := byID[ev.Session]
+			if rec == nil {
+				return nil, fmt.Errorf("line %d: data for unopened session %d", line, ev.Session)
+			}
+			rec.Chunks = append(rec.Chunks, Chunk{
+				At:         time.Duration(ev.T * float64(time.Second)),
+				FromClient: ev.From == FromClient,
+				Data:       ev.Data,
+			})
+		case EventClose:
+		default:
+			return nil, fmt.Errorf("line %d: unknown event type %q", line, ev.Type)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("recording contains no sessions")
+	}
+	return recs, nil
+}
+
+// ── sink ─────────────────────────────────────────────────────────────
+
+// recordSink writes sessions in the recording format.
+type recordSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	err error
+}
+
+// openRecording creates (or truncates) path and writes the file event.
+func openRecording(path string) (*recordSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &recordSink{f: f}
+	now := time.Now().UTC()
+	r.write(Event{Type: EventRecording, Version: RecordingVersion, Time: &now})
+	if r.err != nil {
+		f.Close()
+		return nil, r.err
+	}
+	return r, nil
+}
+
+func (r *recordSink) open(s *Session) error {
+	client, server := addrString(s.Remote), addrString(s.Local)
+	if s.outbound() {
+		client, server = server, client
+	}
+	start := s.Start.UTC()
+	r.write(Event{
+		Type:    EventOpen,
+		Session: s.ID,
+		Time:    &start,
+		Mode:    s.Mode,
+		Client:  client,
+		Server:  server,
+	})
+	return nil
+}
+
+func (r *recordSink) record(s *Session, dir Direction, _ int64, p []byte, at time.Time) {
+	// Received data comes from the peer, which is the client unless
+	// gonc opened the connection.
+	from := FromClient
+	if (dir == Received) == s.outbound() {
+		from = FromServer
+	}
+	r.write(Event{
+		Type:    EventData,
+		Session: s.ID,
+		T:       at.Sub(s.Start).Seconds(),
+		From:    from,
+		Data:    p,
+	})
+}
+
+func (r *recordSink) finish(s *Session, _, _ int64) {
+	r.write(Event{Type: EventClose, Session: s.ID, T: time.Since(s.Start).Seconds()})
+}
+
+// write appends ev as one line with a single Write.
+func (r *recordSink) write(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	if _, err := r.f.Write(data); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *recordSink) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.err
+	if r.f != nil {
+		if cerr := r.f.Close(); err == nil {
+			err = cerr
+		}
+		r.f = nil
+	}
+	return err
+}
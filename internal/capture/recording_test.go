@@ -0,0 +1,88 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordingRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.rec")
+	c, err := Open(Options{Record: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A listen-mode session: the peer is the client.
+	a, b := net.Pipe()
+	conn, err := c.Wrap(a, "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		b.Write([]byte("GET"))          //nolint:errcheck
+		io.ReadFull(b, make([]byte, 2)) //nolint:errcheck
+		b.Close()
+	}()
+	io.ReadFull(conn, make([]byte, 3)) //nolint:errcheck
+	conn.Write([]byte("OK"))           //nolint:errcheck
+	conn.Close()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	recs, err := ReadRecording(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(recs))
+	}
+	r := recs[0]
+	if r.Session != 1 || r.Mode != "listen" || r.Start.IsZero() {
+		t.Errorf("recording = %+v", r)
+	}
+	if got := string(r.ClientBytes()); got != "GET" {
+		t.Errorf("client bytes = %q, want GET", got)
+	}
+	if got := string(r.ServerBytes()); got != "OK" {
+		t.Errorf("server bytes = %q, want OK", got)
+	}
+	if len(r.Chunks) != 2 || r.Chunks[1].At < r.Chunks[0].At {
+		t.Errorf("chunks out of order: %+v", r.Chunks)
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	header := `{"type":"recording","version":1}` + "\n"
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", "no sessions"},
+		{"not a recording", `{"type":"open","session":1}` + "\n", "not a gonc recording"},
+		{"newer version", `{"type":"recording","version":99}` + "\n", "newer"},
+		{"bad json", header + "{\n", "line 2"},
+		{"data before open", header + `{"type":"data","session":3,"from":"client","data":"eA=="}` + "\n", "unopened session 3"},
+		{"unknown event", header + `{"type":"bogus"}` + "\n", "unknown event"},
+		{"header only", header, "no sessions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadRecording(bytes.NewBufferString(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadRecording error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
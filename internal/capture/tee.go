@@ -0,0 +1,76 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// teeSink writes each session's raw bytes to a pair of files:
+// PREFIX.N.in holds what the peer sent and PREFIX.N.out what was sent
+// to it, where N is the session number.  Offsets in the hex dump are
+// byte positions in these files.
+type teeSink struct {
+	prefix string
+
+	mu    sync.Mutex
+	files map[uint64][2]*os.File // session ID → [in, out]
+}
+
+func (t *teeSink) open(s *Session) error {
+	base := fmt.Sprintf("%s.%d", t.prefix, s.ID)
+	in, err := createTee(base + ".in")
+	if err != nil {
+		return err
+	}
+	out, err := createTee(base + ".out")
+	if err != nil {
+		in.Close()
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		t.files = make(map[uint64][2]*os.File)
+	}
+	t.files[s.ID] = [2]*os.File{in, out}
+	return nil
+}
+
+func createTee(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+}
+
+func (t *teeSink) record(s *Session, dir Direction, _ int64, p []byte, _ time.Time) {
+	t.mu.Lock()
+	f := t.files[s.ID][dir]
+	t.mu.Unlock()
+	if f != nil {
+		f.Write(p) //nolint:errcheck
+	}
+}
+
+func (t *teeSink) finish(s *Session, _, _ int64) {
+	t.mu.Lock()
+	files, ok := t.files[s.ID]
+	delete(t.files, s.ID)
+	t.mu.Unlock()
+	if ok {
+		files[Received].Close()
+		files[Sent].Close()
+	}
+}
+
+// Close closes the files of any sessions still open.
+func (t *teeSink) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, files := range t.files {
+		files[Received].Close()
+		files[Sent].Close()
+		delete(t.files, id)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gonc/internal/fault"
+	"gonc/internal/metrics"
+)
+
+// Handler serves the control API:
+//
+//	GET    /connections       tracked connections (peer, age, bytes)
+//	DELETE /connections/{id}  close one connection
+//	GET    /stats             metrics Snapshot
+//	GET    /forwards          remote forwards of the reverse tunnel
+//	POST   /forwards          add a forward: {"remote_port":8081,"local":"127.0.0.1:3001"}
+//	DELETE /forwards/{port}   cancel a forward
+//	POST   /reconnect         drop and re-establish the SSH connection
+//	GET    /faults            fault injection settings of --proxy
+//	PUT    /faults            replace them: {"up":{"latency":"100ms"},"down":{"reset":0.01}}
+//
+// The tunnel endpoints answer 404 in modes without a reverse tunnel,
+// and the fault endpoints without a fault injector.
+//
+// The API is unauthenticated, so requests a browser could be tricked
+// into sending are refused; see [guard].  hosts lists the Host header
+// values accepted on a TCP listener (the configured address and the
+// one actually bound); a Unix socket server passes none.
+func Handler(r *Registry, m *metrics.Collector, hosts ...string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /connections", func(w http.ResponseWriter, _ *http.Request) {
+		conns := r.Connections()
+		if conns == nil {
+			conns = []ConnInfo{}
+		}
+		writeJSON(w, http.StatusOK, conns)
+	})
+	mux.HandleFunc("DELETE /connections/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseUint(req.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "connection id must be a number")
+			return
+		}
+		if err := r.CloseConnection(id); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrNoConnection) {
+				code = http.StatusNotFound
+			}
+			writeError(w, code, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, m.Snapshot())
+	})
+
+	mux.HandleFunc("GET /forwards", withTunnel(r, func(w http.ResponseWriter, _ *http.Request, t Tunnel) {
+		writeJSON(w, http.StatusOK, t.Forwards())
+	}))
+	mux.HandleFunc("POST /forwards", withTunnel(r, func(w http.ResponseWriter, req *http.Request, t Tunnel) {
+		var f Forward
+		if err := json.NewDecoder(req.Body).Decode(&f); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid forward: "+err.Error())
+			return
+		}
+		if err := t.AddForward(f); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, f)
+	}))
+	mux.HandleFunc("DELETE /forwards/{port}", withTunnel(r, func(w http.ResponseWriter, req *http.Request, t Tunnel) {
+		port, err := strconv.Atoi(req.PathValue("port"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "port must be a number")
+			return
+		}
+		if err := t.RemoveForward(port); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /reconnect", withTunnel(r, func(w http.ResponseWriter, _ *http.Request, t Tunnel) {
+		if err := t.Reconnect(); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	mux.HandleFunc("GET /faults", withFaults(r, func(w http.ResponseWriter, _ *http.Request, f Faults) {
+		writeJSON(w, http.StatusOK, f.Settings())
+	}))
+	mux.HandleFunc("PUT /faults", withFaults(r, func(w http.ResponseWriter, req *http.Request, f Faults) {
+		var s fault.Settings
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid faults: "+err.Error())
+			return
+		}
+		if err := f.Set(s); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, f.Settings())
+	}))
+
+	return guard(mux, hosts)
+}
+
+// guard keeps web pages from driving the API through the user's
+// browser.  A Host outside hosts means DNS rebinding, an Origin header
+// means a cross-site fetch, and requiring application/json on requests
+// that change state rules out the form and text/plain POSTs that need
+// no CORS preflight.
+func guard(h http.Handler, hosts []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(hosts) > 0 && !hostAllowed(req.Host, hosts) {
+			writeError(w, http.StatusForbidden, "unexpected host "+strconv.Quote(req.Host))
+			return
+		}
+		if req.Header.Get("Origin") != "" {
+			writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return
+		}
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || mt != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func hostAllowed(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTunnel adapts a handler that needs the registered tunnel.
+func withTunnel(r *Registry, h func(http.ResponseWriter, *http.Request, Tunnel)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		t := r.Tunnel()
+		if t == nil {
+			writeError(w, http.StatusNotFound, "no reverse tunnel in this mode")
+			return
+		}
+		h(w, req, t)
+	}
+}
+
+// withFaults adapts a handler that needs the registered fault injector.
+func withFaults(r *Registry, h func(http.ResponseWriter, *http.Request, Faults)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		f := r.Faults()
+		if f == nil {
+			writeError(w, http.StatusNotFound, "no fault injection in this mode")
+			return
+		}
+		h(w, req, f)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v) //nolint:errcheck
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,302 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gonc/internal/fault"
+	"gonc/internal/metrics"
+)
+
+func TestRegistry_TrackAndClose(t *testing.T) {
+	r := NewRegistry()
+	a, b := net.Pipe()
+	defer b.Close()
+
+	conn := r.Track(a, "listen", "127.0.0.1:80")
+	go b.Write([]byte("hi"))           //nolint:errcheck
+	io.ReadFull(conn, make([]byte, 2)) //nolint:errcheck
+
+	conns := r.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("got %d connections, want 1", len(conns))
+	}
+	c := conns[0]
+	if c.Mode != "listen" || c.Target != "127.0.0.1:80" || c.Peer != "pipe" || c.BytesIn != 2 {
+		t.Errorf("conn info = %+v", c)
+	}
+
+	if err := r.CloseConnection(c.ID); err != nil {
+		t.Fatalf("CloseConnection: %v", err)
+	}
+	if _, err := b.Write([]byte("x")); err == nil {
+		t.Error("peer write should fail once the tracked conn is closed")
+	}
+	if len(r.Connections()) != 0 {
+		t.Error("closed connection still listed")
+	}
+	if err := r.CloseConnection(c.ID); !errors.Is(err, ErrNoConnection) {
+		t.Errorf("second close = %v, want ErrNoConnection", err)
+	}
+}
+
+func TestNilRegistry_NoOps(t *testing.T) {
+	var r *Registry
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	if r.Track(a, "listen", "") != a {
+		t.Error("nil registry should return conn unchanged")
+	}
+	r.SetTunnel(&fakeTunnel{})
+	if r.Tunnel() != nil || r.Connections() != nil {
+		t.Error("nil registry should be empty")
+	}
+	if err := r.CloseConnection(1); !errors.Is(err, ErrNoConnection) {
+		t.Errorf("err = %v, want ErrNoConnection", err)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		wantErr bool
+	}{
+		{"unix:/tmp/gonc.sock", "unix", false},
+		{"unix:", "", true},
+		{"127.0.0.1:9300", "tcp", false},
+		{"[::1]:9300", "tcp", false},
+		{"localhost:9300", "tcp", false},
+		{"0.0.0.0:9300", "", true},
+		{"192.0.2.1:9300", "", true},
+		{"9300", "", true},
+	}
+	for _, tt := range tests {
+		network, _, err := ParseAddress(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAddress(%q) err = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+		if network != tt.network {
+			t.Errorf("ParseAddress(%q) network = %q, want %q", tt.addr, network, tt.network)
+		}
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket file permissions are Unix-specific")
+	}
+	path := filepath.Join(t.TempDir(), "gonc.sock")
+
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Error("second Listen on a live socket should fail")
+	}
+	ln.Close()
+
+	// Closing removes the socket; listening again works.
+	ln, err = Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("relisten: %v", err)
+	}
+	ln.Close()
+}
+
+// ── Handler ──────────────────────────────────────────────────────────
+
+type fakeTunnel struct {
+	forwards   []Forward
+	reconnects int
+}
+
+func (f *fakeTunnel) Forwards() []Forward { return f.forwards }
+
+func (f *fakeTunnel) AddForward(fw Forward) error {
+	if fw.RemotePort == 0 {
+		return errors.New("remote port 0 out of range")
+	}
+	f.forwards = append(f.forwards, fw)
+	return nil
+}
+
+func (f *fakeTunnel) RemoveForward(port int) error {
+	for i, fw := range f.forwards {
+		if fw.RemotePort == port {
+			f.forwards = append(f.forwards[:i], f.forwards[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no forward")
+}
+
+func (f *fakeTunnel) Reconnect() error {
+	f.reconnects++
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	m := metrics.New()
+	m.ConnectionOpened()
+	srv := httptest.NewServer(Handler(r, m))
+	defer srv.Close()
+
+	do := func(method, path, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if method != "GET" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	a, b := net.Pipe()
+	defer b.Close()
+	r.Track(a, "reverse", "127.0.0.1:3000")
+
+	code, body := do("GET", "/connections", "")
+	var conns []ConnInfo
+	if code != 200 || json.Unmarshal([]byte(body), &conns) != nil || len(conns) != 1 {
+		t.Fatalf("GET /connections = %d %s", code, body)
+	}
+	if code, _ := do("DELETE", "/connections/999", ""); code != 404 {
+		t.Errorf("DELETE unknown connection = %d, want 404", code)
+	}
+	if code, _ := do("DELETE", "/connections/abc", ""); code != 400 {
+		t.Errorf("DELETE bad id = %d, want 400", code)
+	}
+	if code, _ := do("DELETE", "/connections/"+strconv.FormatUint(conns[0].ID, 10), ""); code != 204 {
+		t.Errorf("DELETE connection = %d, want 204", code)
+	}
+	if code, body := do("GET", "/connections", ""); code != 200 || strings.TrimSpace(body) != "[]" {
+		t.Errorf("after close: %d %s", code, body)
+	}
+
+	if code, body := do("GET", "/stats", ""); code != 200 || !strings.Contains(body, `"connections_total": 1`) {
+		t.Errorf("GET /stats = %d %s", code, body)
+	}
+
+	// Without a tunnel the tunnel endpoints are absent.
+	if code, _ := do("GET", "/forwards", ""); code != 404 {
+		t.Errorf("GET /forwards without tunnel = %d, want 404", code)
+	}
+
+	ft := &fakeTunnel{forwards: []Forward{{RemotePort: 80, Local: "127.0.0.1:3000", Primary: true}}}
+	r.SetTunnel(ft)
+
+	if code, _ := do("POST", "/forwards", `{"remote_port":8081,"local":"127.0.0.1:3001"}`); code != 201 {
+		t.Errorf("POST /forwards = %d, want 201", code)
+	}
+	if code, _ := do("POST", "/forwards", `{"local":"x"}`); code != 400 {
+		t.Errorf("POST invalid forward = %d, want 400", code)
+	}
+	if code, _ := do("POST", "/forwards", `not json`); code != 400 {
+		t.Errorf("POST malformed body = %d, want 400", code)
+	}
+	code, body = do("GET", "/forwards", "")
+	var fws []Forward
+	if code != 200 || json.Unmarshal([]byte(body), &fws) != nil || len(fws) != 2 || fws[1].RemotePort != 8081 {
+		t.Errorf("GET /forwards = %d %s", code, body)
+	}
+	if code, _ := do("DELETE", "/forwards/8081", ""); code != 204 {
+		t.Errorf("DELETE /forwards/8081 = %d, want 204", code)
+	}
+	if code, _ := do("DELETE", "/forwards/8081", ""); code != 404 {
+		t.Errorf("second DELETE = %d, want 404", code)
+	}
+	if code, _ := do("POST", "/reconnect", ""); code != 202 || ft.reconnects != 1 {
+		t.Errorf("POST /reconnect = %d (reconnects %d)", code, ft.reconnects)
+	}
+
+	// Fault endpoints need a registered injector.
+	if code, _ := do("GET", "/faults", ""); code != 404 {
+		t.Errorf("GET /faults without injector = %d, want 404", code)
+	}
+	inj := fault.New(fault.Settings{}, 1)
+	r.SetFaults(inj)
+	if code, body := do("PUT", "/faults", `{"up":{"latency":"150ms"},"down":{"reset":0.5}}`); code != 200 {
+		t.Errorf("PUT /faults = %d %s", code, body)
+	}
+	if s := inj.Settings(); s.Up.Latency != 150*time.Millisecond || s.Down.Reset != 0.5 {
+		t.Errorf("settings after PUT = %+v", s)
+	}
+	if code, _ := do("PUT", "/faults", `{"down":{"corrupt":2}}`); code != 400 {
+		t.Errorf("PUT out-of-range faults = %d, want 400", code)
+	}
+	if code, body := do("GET", "/faults", ""); code != 200 || !strings.Contains(body, `"latency": "150ms"`) {
+		t.Errorf("GET /faults = %d %s", code, body)
+	}
+}
+
+func TestHandler_RefusesBrowserRequests(t *testing.T) {
+	r := NewRegistry()
+	ft := &fakeTunnel{}
+	r.SetTunnel(ft)
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = Handler(r, metrics.New(), srv.Listener.Addr().String())
+	srv.Start()
+	defer srv.Close()
+
+	forward := `{"remote_port":8081,"local":"127.0.0.1:3001"}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{"json POST", "POST", "/forwards", forward, map[string]string{"Content-Type": "application/json"}, 201},
+		{"text/plain POST", "POST", "/forwards", forward, map[string]string{"Content-Type": "text/plain"}, 415},
+		{"form POST", "POST", "/reconnect", "", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, 415},
+		{"no content type", "DELETE", "/forwards/8081", "", nil, 415},
+		{"foreign host", "GET", "/connections", "", map[string]string{"Host": "attacker.example:80"}, 403},
+		{"foreign host POST", "POST", "/reconnect", "", map[string]string{"Host": "attacker.example", "Content-Type": "application/json"}, 403},
+		{"origin", "POST", "/reconnect", "", map[string]string{"Origin": "http://attacker.example", "Content-Type": "application/json"}, 403},
+		{"GET", "GET", "/connections", "", nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				if k == "Host" {
+					req.Host = v
+				} else {
+					req.Header.Set(k, v)
+				}
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+	if ft.reconnects != 0 || len(ft.forwards) != 1 {
+		t.Errorf("refused requests reached the tunnel: reconnects %d, forwards %v", ft.reconnects, ft.forwards)
+	}
+}
@@ -0,0 +1,64 @@
+package control
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks a control address as a Unix socket path.
+const unixPrefix = "unix:"
+
+// ParseAddress splits a control address into a network and address
+// for net.Listen: "unix:/path/to/sock" is a Unix socket, anything
+// else a TCP host:port that must be a loopback address, since the API
+// is unauthenticated.
+func ParseAddress(addr string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("empty socket path")
+		}
+		return "unix", path, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("host %q is not a loopback address", host)
+		}
+	}
+	return "tcp", addr, nil
+}
+
+// Listen opens the control address.  A stale Unix socket left behind
+// by an earlier run is removed first (one that still answers is left
+// alone), and the new one is made accessible to its owner only.
+func Listen(addr string) (net.Listener, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if fi, err := os.Lstat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if c, err := net.Dial("unix", address); err == nil {
+				c.Close()
+				return nil, fmt.Errorf("%s is in use by another process", address)
+			}
+			os.Remove(address)
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		os.Chmod(address, 0o600) //nolint:errcheck
+	}
+	return ln, nil
+}
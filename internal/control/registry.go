@@ -0,0 +1,230 @@
+// Package control implements the local admin API for long-running
+// modes.  A Registry records the connections a mode is serving and,
+// for reverse tunnels, the tunnel itself, and for --proxy, its fault
+// injector; Handler exposes them over HTTP on a Unix socket or
+// loopback address.
+//
+// A nil *Registry is a valid no-op receiver, like metrics.Collector.
+package control
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/internal/fault"
+	"gonc/util"
+)
+
+// ErrNoConnection is returned by CloseConnection for an unknown ID.
+var ErrNoConnection = errors.New("no such connection")
+
+// Tunnel is the runtime control surface of a reverse tunnel.
+type Tunnel interface {
+	// Forwards lists the remote forwards currently requested.
+	Forwards() []Forward
+	// AddForward requests an additional remote forward.
+	AddForward(f Forward) error
+	// RemoveForward cancels the forward bound to remotePort.
+	RemoveForward(remotePort int) error
+	// Reconnect drops the SSH connection and re-establishes it.
+	Reconnect() error
+}
+
+// Forward is one remote port forward: connections to RemoteAddr:
+// RemotePort on the gateway are bridged to Local.
+type Forward struct {
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	RemotePort int    `json:"remote_port"`
+	Local      string `json:"local"`             // host:port of the local service
+	Primary    bool   `json:"primary,omitempty"` // the -R forward; cannot be removed
+}
+
+// Faults is the runtime control surface of a fault-injection proxy.
+// *fault.Injector implements it.
+type Faults interface {
+	// Settings returns the faults currently applied.
+	Settings() fault.Settings
+	// Set replaces them, for open connections too.
+	Set(s fault.Settings) error
+}
+
+// Registry tracks the live connections of a mode.
+type Registry struct {
+	nextID atomic.Uint64
+
+	mu     sync.Mutex
+	conns  map[uint64]*Conn
+	tunnel Tunnel
+	faults Faults
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{conns: make(map[uint64]*Conn)}
+}
+
+// Track registers conn under a new ID until it is closed and counts
+// the bytes read from and written to it.  mode names the owner
+// ("listen", "reverse") and target the local address the connection
+// is bridged to, if any.  With a nil registry conn is returned
+// unchanged.
+func (r *Registry) Track(conn net.Conn, mode, target string) net.Conn {
+	if r == nil {
+		return conn
+	}
+	c := &Conn{
+		Conn:    conn,
+		id:      r.nextID.Add(1),
+		mode:    mode,
+		target:  target,
+		started: time.Now(),
+		reg:     r,
+	}
+	r.mu.Lock()
+	r.conns[c.id] = c
+	r.mu.Unlock()
+	return c
+}
+
+// Connections returns the tracked connections ordered by ID.
+func (r *Registry) Connections() []ConnInfo {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	out := make([]ConnInfo, 0, len(r.conns))
+	for _, c := range r.conns {
+		out = append(out, c.info())
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// CloseConnection closes the tracked connection with the given ID.
+func (r *Registry) CloseConnection(id uint64) error {
+	if r == nil {
+		return ErrNoConnection
+	}
+	r.mu.Lock()
+	c := r.conns[id]
+	r.mu.Unlock()
+	if c == nil {
+		return ErrNoConnection
+	}
+	return c.Close()
+}
+
+// SetTunnel makes t available to the control API.  Reverse tunnel
+// modes call it once the tunnel exists.
+func (r *Registry) SetTunnel(t Tunnel) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.tunnel = t
+	r.mu.Unlock()
+}
+
+// Tunnel returns the registered tunnel, or nil in modes without one.
+func (r *Registry) Tunnel() Tunnel {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tunnel
+}
+
+// SetFaults makes f available to the control API.  The proxy mode
+// calls it when fault injection is configured.
+func (r *Registry) SetFaults(f Faults) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.faults = f
+	r.mu.Unlock()
+}
+
+// Faults returns the registered fault injector, or nil.
+func (r *Registry) Faults() Faults {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults
+}
+
+func (r *Registry) remove(id uint64) {
+	r.mu.Lock()
+	delete(r.conns, id)
+	r.mu.Unlock()
+}
+
+// ── Conn ─────────────────────────────────────────────────────────────
+
+// Conn is a tracked connection.  Closing it removes it from the
+// registry.
+type Conn struct {
+	net.Conn
+	id       uint64
+	mode     string
+	target   string
+	started  time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	reg      *Registry
+	once     sync.Once
+}
+
+// ConnInfo describes a tracked connection.
+type ConnInfo struct {
+	ID       uint64    `json:"id"`
+	Mode     string    `json:"mode"`
+	Peer     string    `json:"peer"`
+	Target   string    `json:"target,omitempty"`
+	Started  time.Time `json:"started"`
+	Age      string    `json:"age"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
+
+func (c *Conn) info() ConnInfo {
+	return ConnInfo{
+		ID:       c.id,
+		Mode:     c.mode,
+		Peer:     c.RemoteAddr().String(),
+		Target:   c.target,
+		Started:  c.started,
+		Age:      time.Since(c.started).Truncate(time.Second).String(),
+		BytesIn:  c.bytesIn.Load(),
+		BytesOut: c.bytesOut.Load(),
+	}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(int64(n))
+	return n, err
+}
+
+// CloseWrite half-closes the underlying connection when it supports it.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// Close closes the connection and removes it from the registry.
+func (c *Conn) Close() error {
+	c.once.Do(func() { c.reg.remove(c.id) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,23 @@
+package core
+
+import (
+	"context"
+
+	"gonc/internal/audit"
+	"gonc/util"
+)
+
+// AuditLogMode runs another mode that appends to an audit log and
+// closes the log once the wrapped mode returns.
+type AuditLogMode struct {
+	Mode   Mode
+	Log    *audit.Log
+	Logger *util.Logger
+}
+
+// Run runs the wrapped mode, then closes the log.
+func (m *AuditLogMode) Run(ctx context.Context) error {
+	defer m.Log.Close() //nolint:errcheck
+	m.Logger.Verbose("audit log: %s", m.Log.Path())
+	return m.Mode.Run(ctx)
+}
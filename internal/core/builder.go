@@ -3,10 +3,23 @@ package core
 import (
 	"fmt"
 	"net"
+	"os"
 	"time"
 
 	"gonc/config"
+	"gonc/internal/audit"
+	"gonc/internal/balance"
 	"gonc/internal/capability"
+	"gonc/internal/capture"
+	"gonc/internal/control"
+	"gonc/internal/fault"
+	"gonc/internal/httpproxy"
+	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/ratelimit"
+	"gonc/internal/sniff"
+	"gonc/internal/socks5"
+	"gonc/internal/tlsconf"
 	"gonc/internal/transport"
 	"gonc/tunnel"
 	"gonc/util"
@@ -15,22 +28,92 @@ import (
 // Build constructs the appropriate Mode from the given configuration.
 // This is the single dispatch point that replaces the scattered
 // switch/if trees in the old architecture.
+//
+// Every mode feeds a single metrics collector; with --metrics-addr the
+// mode is wrapped in a MetricsServerMode that serves it over HTTP.
+// With --control, long-running modes register their connections and
+// are wrapped in a ControlServerMode serving the admin API.  With
+// --audit-log, every mode appends a record per session to the file,
+// which an AuditLogMode closes when the mode returns.  -o, --tee and
+// --pcap and --record likewise share one capture.Capture, closed by a
+// CaptureMode.  --proxy builds a ProxyMode, whose --fault settings
+// the admin API can change while it runs.
 func Build(cfg *config.Config, logger *util.Logger) (Mode, error) {
+	m := metrics.New()
+	var reg *control.Registry
+	if cfg.ControlAddr != "" {
+		reg = control.NewRegistry()
+	}
+	var al *audit.Log
+	if cfg.AuditLog != "" {
+		var err error
+		if al, err = audit.Open(cfg.AuditLog); err != nil {
+			return nil, fmt.Errorf("audit log: %w", err)
+		}
+	}
+	cp, err := capture.Open(capture.Options{
+		HexDump: cfg.HexDump,
+		Tee:     cfg.Tee,
+		Pcap:    cfg.Pcap,
+		Record:  cfg.Record,
+	})
+	if err != nil {
+		al.Close() //nolint:errcheck
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+
+	var mode Mode
 	switch {
+	case cfg.Replay != "":
+		mode, err = buildReplay(cfg, logger.With("mode", "replay"), m)
 	case cfg.ReverseTunnelEnabled:
-		return buildReverseTunnel(cfg, logger)
+		mode, err = buildReverseTunnel(cfg, logger.With("mode", "reverse"), m, reg, al, cp)
+	case cfg.ProxyUpstream != "":
+		mode, err = buildProxy(cfg, logger.With("mode", "proxy"), m, reg, al, cp)
 	case cfg.Listen:
-		return buildListen(cfg, logger)
+		mode, err = buildListen(cfg, logger.With("mode", "listen"), m, reg, al, cp)
 	case cfg.ZeroIO:
-		return buildScan(cfg, logger)
+		mode, err = buildScan(cfg, logger.With("mode", "scan"), m, al)
 	default:
-		return buildConnect(cfg, logger)
+		mode, err = buildConnect(cfg, logger.With("mode", "connect"), m, al, cp)
+	}
+	if err != nil {
+		al.Close() //nolint:errcheck
+		cp.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	if cp != nil {
+		mode = &CaptureMode{Mode: mode, Capture: cp, Logger: logger}
+	}
+
+	if al != nil {
+		mode = &AuditLogMode{Mode: mode, Log: al, Logger: logger}
+	}
+
+	if reg != nil {
+		mode = &ControlServerMode{
+			Mode:     mode,
+			Address:  cfg.ControlAddr,
+			Registry: reg,
+			Metrics:  m,
+			Logger:   logger,
+		}
+	}
+	if cfg.MetricsAddr != "" {
+		mode = &MetricsServerMode{
+			Mode:    mode,
+			Address: cfg.MetricsAddr,
+			Metrics: m,
+			Logger:  logger,
+		}
 	}
+	return mode, nil
 }
 
 // ── mode builders ────────────────────────────────────────────────────
 
-func buildConnect(cfg *config.Config, logger *util.Logger) (Mode, error) {
+func buildConnect(cfg *config.Config, logger *util.Logger, m *metrics.Collector, al *audit.Log, cp *capture.Capture) (Mode, error) {
 	if cfg.NoDNS && net.ParseIP(cfg.Host) == nil {
 		return nil, fmt.Errorf(
 			"cannot parse %q as an IP address (DNS disabled with -n)",
@@ -42,34 +125,111 @@ func buildConnect(cfg *config.Config, logger *util.Logger) (Mode, error) {
 	if cfg.UDP {
 		network = "udp"
 	}
+	capab, err := buildCapability(cfg, logger, m, al)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := upstreamDialer(cfg, buildDialer(cfg, logger, m))
+	if err != nil {
+		return nil, err
+	}
 
 	return &ConnectMode{
-		Dialer:     buildDialer(cfg, logger),
-		Capability: buildCapability(cfg),
+		Dialer:     dialer,
+		Capability: capab,
 		Network:    network,
 		Address:    address,
+		Gateway:    tunnelGateway(cfg),
+		Metrics:    m,
+		Audit:      al,
+		Capture:    cp,
+		Limiter:    buildLimiter(cfg),
 		Logger:     logger,
 	}, nil
 }
 
-func buildListen(cfg *config.Config, logger *util.Logger) (Mode, error) {
+func buildListen(cfg *config.Config, logger *util.Logger, m *metrics.Collector, reg *control.Registry, al *audit.Log, cp *capture.Capture) (Mode, error) {
 	address := fmt.Sprintf(":%d", cfg.LocalPort)
 	network := "tcp"
 	if cfg.UDP {
 		network = "udp"
 	}
+	udpIdle := cfg.Timeout
+	if udpIdle == 0 {
+		udpIdle = config.DefaultUDPSessionIdle
+	}
+	capab, err := buildCapability(cfg, logger, m, al)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := buildTLSServer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ListenMode{
-		Address:    address,
-		Network:    network,
-		KeepOpen:   cfg.KeepOpen,
-		Timeout:    cfg.Timeout,
-		Capability: buildCapability(cfg),
-		Logger:     logger,
+		Address:             address,
+		Network:             network,
+		KeepOpen:            cfg.KeepOpen,
+		Timeout:             cfg.Timeout,
+		Capability:          capab,
+		AcceptProxyProtocol: cfg.AcceptProxyProtocol,
+		TLS:                 srv,
+		TLSClientInfo:       cfg.TLSClientInfo,
+		UDPIdle:             udpIdle,
+		Metrics:             m,
+		Control:             reg,
+		Audit:               al,
+		Capture:             cp,
+		Limiter:             buildLimiter(cfg),
+		Logger:              logger,
 	}, nil
 }
 
-func buildScan(cfg *config.Config, logger *util.Logger) (Mode, error) {
+func buildProxy(cfg *config.Config, logger *util.Logger, m *metrics.Collector, reg *control.Registry, al *audit.Log, cp *capture.Capture) (Mode, error) {
+	var inj *fault.Injector
+	if !cfg.Faults.Up.IsZero() || !cfg.Faults.Down.IsZero() || reg != nil {
+		// With --control, faults can be added later even if none
+		// were given on the command line.
+		inj = fault.New(cfg.Faults, cfg.FaultSeed)
+	}
+
+	srv, err := buildTLSServer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	base := buildDialer(cfg, logger, m)
+	dialer, err := upstreamDialer(cfg, base)
+	if err != nil {
+		return nil, err
+	}
+	// The shadow speaks the upstream's protocol, TLS included, but is
+	// not sent PROXY headers.
+	shadow, err := withTLS(cfg, base)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyMode{
+		Address:     fmt.Sprintf(":%d", cfg.LocalPort),
+		Upstream:    cfg.ProxyUpstream,
+		Dialer:      dialer,
+		Pool:        buildPool(cfg, cfg.ProxyUpstream, "tcp", dialer.Dial, logger),
+		Mirror:      buildMirror(cfg, shadow.Dial, logger),
+		TLS:         srv,
+		TLSInfo:     cfg.TLSClientInfo,
+		IdleTimeout: cfg.Timeout,
+		Faults:      inj,
+		Gateway:     tunnelGateway(cfg),
+		Metrics:     m,
+		Control:     reg,
+		Audit:       al,
+		Capture:     cp,
+		Limiter:     buildLimiter(cfg),
+		Logger:      logger,
+	}, nil
+}
+
+func buildScan(cfg *config.Config, logger *util.Logger, m *metrics.Collector, al *audit.Log) (Mode, error) {
 	if cfg.NoDNS && net.ParseIP(cfg.Host) == nil {
 		return nil, fmt.Errorf(
 			"cannot parse %q as an IP address (DNS disabled with -n)",
@@ -86,17 +246,58 @@ func buildScan(cfg *config.Config, logger *util.Logger) (Mode, error) {
 		timeout = config.DefaultScanTimeout
 	}
 
+	network := "tcp"
+	if cfg.UDP {
+		network = "udp"
+	}
+
 	return &ScanMode{
-		Dialer:  buildDialer(cfg, logger),
+		Dialer:  buildDialer(cfg, logger, m),
+		Network: network,
 		Host:    cfg.Host,
 		Ports:   ports,
 		Timeout: timeout,
+		Retries: cfg.ScanRetries,
+		Gateway: tunnelGateway(cfg),
+		Metrics: m,
+		Audit:   al,
 		Logger:  logger,
 		Verbose: cfg.Verbose,
 	}, nil
 }
 
-func buildReverseTunnel(cfg *config.Config, logger *util.Logger) (Mode, error) {
+func buildReplay(cfg *config.Config, logger *util.Logger, m *metrics.Collector) (Mode, error) {
+	f, err := os.Open(cfg.Replay)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	defer f.Close()
+	sessions, err := capture.ReadRecording(f)
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", cfg.Replay, err)
+	}
+
+	var target string
+	if cfg.Host != "" {
+		target = util.FormatAddr(cfg.Host, cfg.Port)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultReplayTimeout
+	}
+
+	return &ReplayMode{
+		Dialer:   buildDialer(cfg, logger, m),
+		Sessions: sessions,
+		Target:   target,
+		Speed:    cfg.ReplaySpeed,
+		Timeout:  timeout,
+		Metrics:  m,
+		Logger:   logger,
+	}, nil
+}
+
+func buildReverseTunnel(cfg *config.Config, logger *util.Logger, m *metrics.Collector, reg *control.Registry, al *audit.Log, cp *capture.Capture) (Mode, error) {
 	sshCfg := &tunnel.SSHConfig{
 		User:                     cfg.ReverseTunnelUser,
 		Host:                     cfg.ReverseTunnelHost,
@@ -114,6 +315,13 @@ func buildReverseTunnel(cfg *config.Config, logger *util.Logger) (Mode, error) {
 		keepAlive = time.Duration(cfg.KeepAliveInterval) * time.Second
 	}
 
+	router, err := buildRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	local := util.FormatAddr(config.DefaultLocalAddress, cfg.LocalPort)
+	localDialer := &net.Dialer{Timeout: config.DefaultLocalDialTimeout}
+
 	return &ReverseTunnelMode{
 		SSHConfig:         sshCfg,
 		RemoteBindAddress: cfg.RemoteBindAddress,
@@ -123,14 +331,33 @@ func buildReverseTunnel(cfg *config.Config, logger *util.Logger) (Mode, error) {
 		CheckGatewayPorts: cfg.CheckGatewayPorts,
 		KeepAliveInterval: keepAlive,
 		AutoReconnect:     cfg.AutoReconnect,
-		Logger:            logger,
+		IdleTimeout:       cfg.Timeout,
+		Router:            router,
+		Backends:          buildPool(cfg, local, "tcp", localDialer.DialContext, logger),
+		Mirror:            buildMirror(cfg, localDialer.DialContext, logger),
+		ProxyProtocol:     cfg.ProxyProtocol,
+		Policy: tunnel.ExposurePolicy{
+			Allow:          cfg.AllowCIDRs,
+			Deny:           cfg.DenyCIDRs,
+			ExposeFor:      cfg.ExposeFor,
+			MaxConnections: cfg.MaxConnections,
+			MaxConcurrent:  cfg.MaxConcurrent,
+		},
+		URLFile: cfg.URLFile,
+		URLQR:   cfg.URLQR,
+		Metrics: m,
+		Control: reg,
+		Audit:   al,
+		Capture: cp,
+		Limiter: buildLimiter(cfg),
+		Logger:  logger,
 	}, nil
 }
 
 // ── shared helpers ───────────────────────────────────────────────────
 
 // buildDialer creates the right transport.Dialer for the given config.
-func buildDialer(cfg *config.Config, logger *util.Logger) transport.Dialer {
+func buildDialer(cfg *config.Config, logger *util.Logger, m *metrics.Collector) transport.Dialer {
 	if cfg.TunnelEnabled {
 		return transport.NewSSHDialer(&tunnel.SSHConfig{
 			User:          cfg.TunnelUser,
@@ -141,7 +368,7 @@ func buildDialer(cfg *config.Config, logger *util.Logger) transport.Dialer {
 			UseAgent:      cfg.UseSSHAgent,
 			StrictHostKey: cfg.StrictHostKey,
 			KnownHosts:    cfg.KnownHostsPath,
-		}, logger)
+		}, logger, m)
 	}
 
 	if cfg.UDP {
@@ -157,15 +384,181 @@ func buildDialer(cfg *config.Config, logger *util.Logger) transport.Dialer {
 	}
 }
 
-// buildCapability selects the per-connection behaviour.
-func buildCapability(cfg *config.Config) capability.Capability {
+// tunnelGateway returns the -T gateway as host:port for audit records,
+// or "" when connections are dialled directly.
+func tunnelGateway(cfg *config.Config) string {
+	if !cfg.TunnelEnabled {
+		return ""
+	}
+	return util.FormatAddr(cfg.TunnelHost, cfg.TunnelPort)
+}
+
+// withProxyProtocol wraps d so outbound connections start with a
+// PROXY protocol header when --proxy-protocol is set.
+func withProxyProtocol(cfg *config.Config, d transport.Dialer) transport.Dialer {
+	if cfg.ProxyProtocol == 0 {
+		return d
+	}
+	return &transport.ProxyProtoDialer{Inner: d, Version: cfg.ProxyProtocol}
+}
+
+// upstreamDialer wraps d with --proxy-protocol and then --tls-upstream:
+// the PROXY header has to precede the TLS handshake.
+func upstreamDialer(cfg *config.Config, d transport.Dialer) (transport.Dialer, error) {
+	return withTLS(cfg, withProxyProtocol(cfg, d))
+}
+
+// withTLS wraps d so outbound connections originate TLS when
+// --tls-upstream is set.
+func withTLS(cfg *config.Config, d transport.Dialer) (transport.Dialer, error) {
+	if !cfg.TLSUpstream {
+		return d, nil
+	}
+	tc, err := tlsconf.ClientConfig(cfg.TLSCA, cfg.TLSUpstreamCert, cfg.TLSUpstreamKey, cfg.TLSServerName)
+	if err != nil {
+		return nil, fmt.Errorf("tls-upstream: %w", err)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultTLSHandshakeTimeout
+	}
+	return &transport.TLSDialer{Inner: d, Config: tc, Timeout: timeout}, nil
+}
+
+// buildTLSServer loads the --tls-cert termination certificate, or
+// returns nil when none is set.
+func buildTLSServer(cfg *config.Config, logger *util.Logger) (*tlsconf.Server, error) {
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+	srv, err := tlsconf.NewServer(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA, logger)
+	if err != nil {
+		return nil, fmt.Errorf("tls-cert: %w", err)
+	}
+	return srv, nil
+}
+
+// buildCapability selects the per-connection behaviour.  --forward
+// and --sni-route dial their upstreams through the same transports as
+// connect mode, including -T, --proxy-protocol and --tls-upstream.
+// --http-proxy also writes one audit record per request to al.
+func buildCapability(cfg *config.Config, logger *util.Logger, m *metrics.Collector, al *audit.Log) (capability.Capability, error) {
+	if cfg.Forward != "" || len(cfg.SNIRoutes) > 0 {
+		network := "tcp"
+		if cfg.UDP {
+			network = "udp"
+		}
+		var router *sniff.Table
+		if len(cfg.SNIRoutes) > 0 {
+			var err error
+			if router, err = routeTable(cfg.Forward, cfg.SNIRoutes); err != nil {
+				return nil, err
+			}
+		}
+		dialer, err := upstreamDialer(cfg, buildDialer(cfg, logger, m))
+		if err != nil {
+			return nil, err
+		}
+		return &capability.Forward{
+			Dialer:      dialer,
+			Network:     network,
+			Address:     cfg.Forward,
+			Pool:        buildPool(cfg, cfg.Forward, network, dialer.Dial, logger),
+			Router:      router,
+			IdleTimeout: cfg.Timeout,
+		}, nil
+	}
+	if cfg.SOCKS {
+		var rules *socks5.Rules
+		if len(cfg.SOCKSAllow) > 0 || len(cfg.SOCKSDeny) > 0 {
+			rules = &socks5.Rules{Allow: cfg.SOCKSAllow, Deny: cfg.SOCKSDeny, RemoteNames: cfg.TunnelEnabled}
+		}
+		return &capability.SOCKS{
+			Dialer:      buildDialer(cfg, logger, m),
+			Users:       cfg.SOCKSUsers,
+			Rules:       rules,
+			IdleTimeout: cfg.Timeout,
+		}, nil
+	}
+	if cfg.HTTPProxy {
+		var policy *httpproxy.Policy
+		if len(cfg.HTTPProxyPorts) > 0 || len(cfg.HTTPProxyHosts) > 0 {
+			policy = &httpproxy.Policy{Ports: cfg.HTTPProxyPorts, Hosts: cfg.HTTPProxyHosts}
+		}
+		return &capability.HTTPProxy{
+			Dialer:      buildDialer(cfg, logger, m),
+			Users:       cfg.HTTPProxyUsers,
+			Policy:      policy,
+			IdleTimeout: cfg.Timeout,
+			Audit:       al,
+			Metrics:     m,
+		}, nil
+	}
 	if cfg.Execute != "" || cfg.Command != "" {
 		return &capability.Exec{
 			Program: cfg.Execute,
 			Command: cfg.Command,
+		}, nil
+	}
+	return &capability.Relay{}, nil
+}
+
+// buildPool returns a pool balancing over primary and the --backend
+// targets, or nil when no backends were given.  UDP backends are not
+// health-checked: a UDP dial succeeds whether or not anything listens.
+func buildPool(cfg *config.Config, primary, network string, dial balance.DialFunc, logger *util.Logger) *balance.Pool {
+	if len(cfg.Backends) == 0 {
+		return nil
+	}
+	interval := cfg.HealthInterval
+	if network == "udp" {
+		interval = 0
+	}
+	addrs := append([]string{primary}, cfg.Backends...)
+	return balance.New(addrs, network, dial, balance.Config{
+		Strategy:       cfg.LBStrategy,
+		HealthInterval: interval,
+		Logger:         logger,
+	})
+}
+
+// buildMirror returns the --mirror shadow, or nil when none is set.
+func buildMirror(cfg *config.Config, dial mirror.DialFunc, logger *util.Logger) *mirror.Mirror {
+	if cfg.Mirror == "" {
+		return nil
+	}
+	buffer := cfg.MirrorBuffer
+	if buffer == 0 {
+		buffer = config.DefaultMirrorBuffer
+	}
+	return mirror.New(cfg.Mirror, dial, buffer, logger)
+}
+
+// buildLimiter returns the --rate-limit / --global-rate-limit /
+// --max-bytes shaper, or nil when none is set.
+func buildLimiter(cfg *config.Config) *ratelimit.Limiter {
+	return ratelimit.New(cfg.RateLimit, cfg.GlobalRateLimit, cfg.MaxBytes)
+}
+
+// buildRouter converts --route entries into a host routing table whose
+// default is the -p local port.  It returns nil when no routes are set.
+func buildRouter(cfg *config.Config) (*sniff.Table, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, nil
+	}
+	return routeTable(util.FormatAddr(config.DefaultLocalAddress, cfg.LocalPort), cfg.Routes)
+}
+
+// routeTable builds a host routing table from routes, falling back to
+// def (which may be empty for "no route").
+func routeTable(def string, routes []config.Route) (*sniff.Table, error) {
+	table := sniff.NewTable(def)
+	for _, r := range routes {
+		if err := table.Add(r.Host, r.Target); err != nil {
+			return nil, err
 		}
 	}
-	return &capability.Relay{}
+	return table, nil
 }
 
 // localPortForConnect returns the source-port binding for connect mode,
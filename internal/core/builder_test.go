@@ -1,9 +1,15 @@
 package core
 
 import (
+	"path/filepath"
 	"testing"
 
 	"gonc/config"
+	"gonc/internal/balance"
+	"gonc/internal/capability"
+	"gonc/internal/fault"
+	"gonc/internal/socks5"
+	"gonc/internal/transport"
 	"gonc/util"
 )
 
@@ -52,6 +58,15 @@ func TestBuild_Scan(t *testing.T) {
 	if _, ok := mode.(*ScanMode); !ok {
 		t.Errorf("expected *ScanMode, got %T", mode)
 	}
+
+	cfg = &config.Config{Host: "example.com", Port: 53, ZeroIO: true, UDP: true, ScanRetries: 2}
+	mode, err = Build(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm := mode.(*ScanMode); sm.Network != "udp" || sm.Retries != 2 {
+		t.Errorf("UDP scan = %s with %d retries, want udp with 2", sm.Network, sm.Retries)
+	}
 }
 
 // TestBuild_ReverseTunnel verifies Build produces a ReverseTunnelMode.
@@ -76,6 +91,368 @@ func TestBuild_ReverseTunnel(t *testing.T) {
 	}
 }
 
+// TestBuild_MetricsAddr verifies --metrics-addr wraps the mode in a
+// MetricsServerMode sharing the mode's collector.
+func TestBuild_MetricsAddr(t *testing.T) {
+	cfg := &config.Config{
+		Listen:      true,
+		LocalPort:   8080,
+		MetricsAddr: "127.0.0.1:0",
+	}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, ok := mode.(*MetricsServerMode)
+	if !ok {
+		t.Fatalf("expected *MetricsServerMode, got %T", mode)
+	}
+	lm, ok := ms.Mode.(*ListenMode)
+	if !ok {
+		t.Fatalf("expected wrapped *ListenMode, got %T", ms.Mode)
+	}
+	if lm.Metrics == nil || lm.Metrics != ms.Metrics {
+		t.Error("listen mode and metrics server should share a collector")
+	}
+}
+
+// TestBuild_Control verifies --control wraps the mode in a
+// ControlServerMode whose registry the mode also uses.
+func TestBuild_Control(t *testing.T) {
+	cfg := &config.Config{
+		Listen:      true,
+		LocalPort:   8080,
+		ControlAddr: "127.0.0.1:0",
+		MetricsAddr: "127.0.0.1:0",
+	}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, ok := mode.(*MetricsServerMode)
+	if !ok {
+		t.Fatalf("expected *MetricsServerMode outermost, got %T", mode)
+	}
+	cs, ok := ms.Mode.(*ControlServerMode)
+	if !ok {
+		t.Fatalf("expected *ControlServerMode, got %T", ms.Mode)
+	}
+	lm, ok := cs.Mode.(*ListenMode)
+	if !ok {
+		t.Fatalf("expected wrapped *ListenMode, got %T", cs.Mode)
+	}
+	if lm.Control == nil || lm.Control != cs.Registry {
+		t.Error("listen mode and control server should share a registry")
+	}
+}
+
+// TestBuild_AuditLog verifies --audit-log opens the file and wraps the
+// mode in an AuditLogMode sharing the log.
+func TestBuild_AuditLog(t *testing.T) {
+	cfg := &config.Config{
+		Host:          "example.com",
+		Port:          80,
+		TunnelEnabled: true,
+		TunnelUser:    "admin",
+		TunnelHost:    "bastion",
+		TunnelPort:    22,
+		AuditLog:      filepath.Join(t.TempDir(), "audit.jsonl"),
+	}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, ok := mode.(*AuditLogMode)
+	if !ok {
+		t.Fatalf("expected *AuditLogMode, got %T", mode)
+	}
+	defer am.Log.Close()
+	cm, ok := am.Mode.(*ConnectMode)
+	if !ok {
+		t.Fatalf("expected wrapped *ConnectMode, got %T", am.Mode)
+	}
+	if cm.Audit == nil || cm.Audit != am.Log {
+		t.Error("connect mode and wrapper should share the audit log")
+	}
+	if cm.Gateway != "bastion:22" {
+		t.Errorf("Gateway = %q, want bastion:22", cm.Gateway)
+	}
+}
+
+// TestBuild_Capture verifies -o wraps the mode in a CaptureMode whose
+// capture the mode also uses.
+func TestBuild_Capture(t *testing.T) {
+	cfg := &config.Config{
+		Listen:    true,
+		LocalPort: 8080,
+		HexDump:   filepath.Join(t.TempDir(), "dump.txt"),
+	}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, ok := mode.(*CaptureMode)
+	if !ok {
+		t.Fatalf("expected *CaptureMode, got %T", mode)
+	}
+	defer cm.Capture.Close()
+	lm, ok := cm.Mode.(*ListenMode)
+	if !ok {
+		t.Fatalf("expected wrapped *ListenMode, got %T", cm.Mode)
+	}
+	if lm.Capture == nil || lm.Capture != cm.Capture {
+		t.Error("listen mode and wrapper should share the capture")
+	}
+}
+
+// TestBuild_Proxy verifies that --proxy builds a ProxyMode carrying
+// the --fault settings.
+func TestBuild_Proxy(t *testing.T) {
+	cfg := &config.Config{
+		Listen:        true,
+		LocalPort:     15432,
+		ProxyUpstream: "localhost:5432",
+		Faults:        fault.Settings{Down: fault.Faults{Reset: 0.5}},
+	}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, ok := mode.(*ProxyMode)
+	if !ok {
+		t.Fatalf("expected *ProxyMode, got %T", mode)
+	}
+	if pm.Upstream != "localhost:5432" || pm.Address != ":15432" {
+		t.Errorf("proxy %s → %s", pm.Address, pm.Upstream)
+	}
+	if pm.Faults.Settings().Down.Reset != 0.5 {
+		t.Errorf("faults = %+v", pm.Faults.Settings())
+	}
+
+	// Without faults or --control there is nothing to inject.
+	cfg.Faults = fault.Settings{}
+	mode, err = Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode.(*ProxyMode).Faults != nil {
+		t.Error("proxy without faults should not build an injector")
+	}
+}
+
+// TestBuild_Forward verifies that --forward gives listen mode a Forward
+// capability and a UDP session idle timeout.
+func TestBuild_Forward(t *testing.T) {
+	cfg := &config.Config{Listen: true, KeepOpen: true, UDP: true, LocalPort: 5353, Forward: "localhost:53"}
+
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm, ok := mode.(*ListenMode)
+	if !ok {
+		t.Fatalf("expected *ListenMode, got %T", mode)
+	}
+	fwd, ok := lm.Capability.(*capability.Forward)
+	if !ok {
+		t.Fatalf("expected *capability.Forward, got %T", lm.Capability)
+	}
+	if fwd.Network != "udp" || fwd.Address != "localhost:53" {
+		t.Errorf("forward = %s %s", fwd.Network, fwd.Address)
+	}
+	if lm.UDPIdle != config.DefaultUDPSessionIdle {
+		t.Errorf("UDPIdle = %v, want %v", lm.UDPIdle, config.DefaultUDPSessionIdle)
+	}
+}
+
+// TestBuild_Backends verifies that --backend gives --forward and
+// --proxy a balancing pool over the primary upstream and the backends.
+func TestBuild_Backends(t *testing.T) {
+	cfg := &config.Config{
+		Listen: true, KeepOpen: true, LocalPort: 8080,
+		Forward: "app1:80", Backends: []string{"app2:80", "app3:80"},
+		LBStrategy: balance.LeastConn,
+	}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := mode.(*ListenMode).Capability.(*capability.Forward)
+	defer fwd.Close()
+	if fwd.Pool == nil || len(fwd.Pool.Backends()) != 3 {
+		t.Fatalf("forward pool = %+v, want 3 backends", fwd.Pool)
+	}
+	if got := fwd.Pool.Backends()[0].Address(); got != "app1:80" {
+		t.Errorf("first backend = %s, want the --forward target", got)
+	}
+
+	cfg = &config.Config{Listen: true, LocalPort: 8080, ProxyUpstream: "app1:80", Backends: []string{"app2:80"}}
+	mode, err = Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm := mode.(*ProxyMode); pm.Pool == nil {
+		t.Error("proxy mode has no pool")
+	} else {
+		pm.Pool.Close() //nolint:errcheck
+	}
+}
+
+// TestBuild_Mirror verifies that --mirror reaches the proxy with the
+// default buffer.
+func TestBuild_Mirror(t *testing.T) {
+	cfg := &config.Config{Listen: true, LocalPort: 8080, ProxyUpstream: "app:80", Mirror: "canary:80"}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mode.(*ProxyMode).Mirror.Address(); got != "canary:80" {
+		t.Errorf("mirror = %q, want canary:80", got)
+	}
+}
+
+// TestBuild_SNIRoutes verifies that --sni-route gives the Forward
+// capability a router defaulting to --forward, and that a malformed
+// pattern fails the build.
+func TestBuild_SNIRoutes(t *testing.T) {
+	cfg := &config.Config{
+		Listen: true, KeepOpen: true, LocalPort: 443, Forward: "10.0.0.2:443",
+		SNIRoutes: []config.Route{{Host: "*.k8s.lab", Target: "10.0.0.6:443"}},
+	}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := mode.(*ListenMode).Capability.(*capability.Forward)
+	if fwd.Router == nil {
+		t.Fatal("no router")
+	}
+	if target, _ := fwd.Router.Lookup("api.k8s.lab"); target != "10.0.0.6:443" {
+		t.Errorf("api.k8s.lab → %q", target)
+	}
+	if target, _ := fwd.Router.Lookup("other"); target != "10.0.0.2:443" {
+		t.Errorf("default → %q, want the --forward target", target)
+	}
+
+	cfg.SNIRoutes = []config.Route{{Host: "a*b.lab", Target: "10.0.0.6:443"}}
+	if _, err := Build(cfg, util.NewLogger(0)); err == nil {
+		t.Error("malformed wildcard should fail")
+	}
+}
+
+// TestBuild_TLS verifies that --tls-cert loads a termination
+// certificate, that --tls-upstream wraps the upstream dialer outside
+// the PROXY protocol one, and that a missing certificate fails.
+func TestBuild_TLS(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t, "localhost")
+	cfg := &config.Config{
+		Listen: true, KeepOpen: true, LocalPort: 443, Forward: "app:443",
+		TLSCert: certFile, TLSKey: keyFile, TLSClientCA: certFile, TLSClientInfo: "proxy",
+		ProxyProtocol: 2, TLSUpstream: true, TLSCA: certFile, TLSServerName: "app.internal",
+	}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := mode.(*ListenMode)
+	if lm.TLS == nil || lm.TLSClientInfo != "proxy" {
+		t.Errorf("listen TLS = %v, %q", lm.TLS, lm.TLSClientInfo)
+	}
+	td, ok := lm.Capability.(*capability.Forward).Dialer.(*transport.TLSDialer)
+	if !ok {
+		t.Fatalf("forward dialer = %T, want *transport.TLSDialer", lm.Capability.(*capability.Forward).Dialer)
+	}
+	if _, ok := td.Inner.(*transport.ProxyProtoDialer); !ok {
+		t.Errorf("TLS dialer wraps %T, want the PROXY protocol dialer", td.Inner)
+	}
+	if td.Config.ServerName != "app.internal" || td.Config.RootCAs == nil {
+		t.Errorf("client config = %+v", td.Config)
+	}
+
+	cfg = &config.Config{Listen: true, LocalPort: 443, ProxyUpstream: "app:80", TLSCert: certFile, TLSKey: keyFile}
+	mode, err = Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode.(*ProxyMode).TLS == nil {
+		t.Error("proxy mode has no TLS server")
+	}
+
+	cfg.TLSCert = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := Build(cfg, util.NewLogger(0)); err == nil {
+		t.Error("missing certificate should fail the build")
+	}
+}
+
+// TestBuild_SOCKS verifies that --socks builds the SOCKS capability
+// with its logins and rules, dialling through -T when given.
+func TestBuild_SOCKS(t *testing.T) {
+	deny, _ := socks5.ParseRule("169.254.0.0/16")
+	cfg := &config.Config{
+		Listen: true, KeepOpen: true, LocalPort: 1080, SOCKS: true,
+		SOCKSUsers:    map[string]string{"alice": "s3cret"},
+		SOCKSDeny:     []socks5.Rule{deny},
+		TunnelEnabled: true, TunnelUser: "admin", TunnelHost: "bastion", TunnelPort: 22,
+	}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := mode.(*ListenMode).Capability.(*capability.SOCKS)
+	if !ok {
+		t.Fatalf("capability = %T, want *capability.SOCKS", mode.(*ListenMode).Capability)
+	}
+	if _, ok := s.Dialer.(*transport.SSHDialer); !ok {
+		t.Errorf("dialer = %T, want *transport.SSHDialer", s.Dialer)
+	}
+	if s.Users["alice"] != "s3cret" || s.Rules == nil || len(s.Rules.Deny) != 1 || !s.Rules.RemoteNames {
+		t.Errorf("SOCKS = %+v", s)
+	}
+
+	cfg = &config.Config{Listen: true, LocalPort: 1080, SOCKS: true}
+	mode, err = Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := mode.(*ListenMode).Capability.(*capability.SOCKS); s.Rules != nil {
+		t.Errorf("rules = %+v, want nil without --socks-allow / --socks-deny", s.Rules)
+	}
+}
+
+func TestBuild_HTTPProxy(t *testing.T) {
+	cfg := &config.Config{
+		Listen: true, KeepOpen: true, LocalPort: 3128, HTTPProxy: true,
+		HTTPProxyUsers: map[string]string{"alice": "s3cret"},
+		HTTPProxyPorts: []int{443},
+		TunnelEnabled:  true, TunnelUser: "admin", TunnelHost: "bastion", TunnelPort: 22,
+		AuditLog: filepath.Join(t.TempDir(), "audit.jsonl"),
+	}
+	mode, err := Build(cfg, util.NewLogger(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, ok := mode.(*AuditLogMode)
+	if !ok {
+		t.Fatalf("expected *AuditLogMode, got %T", mode)
+	}
+	defer am.Log.Close()
+	p, ok := am.Mode.(*ListenMode).Capability.(*capability.HTTPProxy)
+	if !ok {
+		t.Fatalf("capability = %T, want *capability.HTTPProxy", am.Mode.(*ListenMode).Capability)
+	}
+	if _, ok := p.Dialer.(*transport.SSHDialer); !ok {
+		t.Errorf("dialer = %T, want *transport.SSHDialer", p.Dialer)
+	}
+	if p.Users["alice"] != "s3cret" || p.Policy == nil || p.Audit == nil || p.Audit != am.Log {
+		t.Errorf("HTTPProxy = %+v", p)
+	}
+}
+
 // TestBuild_NoDNS_Error verifies that a hostname with -n is rejected.
 func TestBuild_NoDNS_Error(t *testing.T) {
 	cfg := &config.Config{
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"context"
+
+	"gonc/internal/capture"
+	"gonc/util"
+)
+
+// CaptureMode runs another mode whose sessions are captured and
+// closes the capture files once the wrapped mode returns.
+type CaptureMode struct {
+	Mode    Mode
+	Capture *capture.Capture
+	Logger  *util.Logger
+}
+
+// Run runs the wrapped mode, then closes the capture.
+func (m *CaptureMode) Run(ctx context.Context) error {
+	defer func() {
+		if err := m.Capture.Close(); err != nil {
+			m.Logger.Error("capture: %v", err)
+		}
+	}()
+	return m.Mode.Run(ctx)
+}
@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
+	"gonc/internal/audit"
 	"gonc/internal/capability"
+	"gonc/internal/capture"
+	"gonc/internal/metrics"
+	"gonc/internal/ratelimit"
 	"gonc/internal/session"
 	"gonc/internal/transport"
 	"gonc/util"
@@ -19,6 +24,11 @@ type ConnectMode struct {
 	Capability capability.Capability
 	Network    string
 	Address    string
+	Gateway    string             // SSH gateway host:port when tunnelled; for audit records
+	Metrics    *metrics.Collector // optional; nil-safe
+	Audit      *audit.Log         // optional; records the session for --audit-log
+	Capture    *capture.Capture   // optional; -o / --tee traffic capture
+	Limiter    *ratelimit.Limiter // optional; --rate-limit / --max-bytes
 	Logger     *util.Logger
 
 	// Stdin/Stdout default to os.Stdin/os.Stdout when nil.
@@ -43,19 +53,40 @@ func (m *ConnectMode) stdout() io.Writer {
 
 // Run dials the remote address, creates a session, and hands it to
 // the capability.  The transport is closed when Run returns.
-func (m *ConnectMode) Run(ctx context.Context) error {
+func (m *ConnectMode) Run(ctx context.Context) (err error) {
 	defer m.Dialer.Close()
 
-	m.Logger.Verbose("connecting to %s (%s)", m.Address, m.Network)
+	log := m.Logger.With("address", m.Address, "network", m.Network)
+	log.Verbose("connecting to %s (%s)", m.Address, m.Network)
 
+	name, command := capability.Describe(m.Capability)
+	rec := audit.Record{Mode: "connect", Gateway: m.Gateway, Capability: name, Command: command}
+
+	start := time.Now()
 	conn, err := m.Dialer.Dial(ctx, m.Network, m.Address)
 	if err != nil {
-		return fmt.Errorf("connect to %s: %w", m.Address, err)
+		log.Debug("connect to %s failed: %v", m.Address, err)
+		m.Metrics.RecordError(fmt.Sprintf("connect to %s: %v", m.Address, err))
+		err = fmt.Errorf("connect to %s: %w", m.Address, err)
+		rec.Start, rec.Remote, rec.Error = start, m.Address, err.Error()
+		rec.DurationMs = time.Since(start).Milliseconds()
+		m.Audit.Write(rec) //nolint:errcheck
+		return err
+	}
+	conn = metrics.TrackConn(conn, m.Metrics)
+	defer conn.Close()
+
+	conn, entry := m.Audit.Begin(conn, rec)
+	defer func() { entry.Finish(err) }() //nolint:errcheck
+
+	if conn, err = m.Capture.Wrap(conn, "connect"); err != nil {
+		return fmt.Errorf("capture: %w", err)
 	}
+	conn = m.Limiter.Wrap(conn)
 	defer conn.Close()
 
-	m.Logger.Verbose("connected to %s", conn.RemoteAddr())
+	log.Verbose("connected to %s", conn.RemoteAddr())
 
-	sess := session.New(conn, m.stdin(), m.stdout(), m.Logger)
+	sess := session.New(conn, m.stdin(), m.stdout(), log)
 	return m.Capability.Handle(ctx, sess)
 }
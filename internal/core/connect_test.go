@@ -3,13 +3,19 @@ package core
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"gonc/internal/audit"
 	"gonc/internal/capability"
+	"gonc/internal/metrics"
 	"gonc/internal/transport"
 	"gonc/util"
 )
@@ -110,3 +116,161 @@ func TestConnectMode_SendData(t *testing.T) {
 		t.Fatal("timeout waiting for data")
 	}
 }
+
+// TestConnectMode_UDP verifies a UDP round trip through the connection
+// wrappers: stdin reaching EOF must not close the socket before the
+// reply arrives.
+func TestConnectMode_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// Server: echo one datagram back after a short delay, so the reply
+	// lands well after the client has sent everything it has.
+	go func() {
+		buf := make([]byte, 1500)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		pc.WriteTo(buf[:n], from) //nolint:errcheck
+	}()
+
+	output := &bytes.Buffer{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	mode := &ConnectMode{
+		Dialer:     &transport.UDPDialer{Timeout: 2 * time.Second},
+		Capability: &capability.Relay{},
+		Network:    "udp",
+		Address:    pc.LocalAddr().String(),
+		Logger:     util.NewLogger(0),
+		Metrics:    metrics.New(), // wraps the conn, as the CLI does
+		Stdin:      bytes.NewBufferString("hello\n"),
+		Stdout:     output,
+	}
+
+	if err := mode.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got := output.String(); got != "hello\n" {
+		t.Errorf("output = %q, want %q", got, "hello\n")
+	}
+}
+
+// TestConnectMode_Audit verifies a successful session and a failed dial
+// each append one audit record.
+func TestConnectMode_Audit(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello")) //nolint:errcheck
+	}()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	al, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	run := func(addr string) error {
+		mode := &ConnectMode{
+			Dialer:     &transport.TCPDialer{Timeout: 2 * time.Second},
+			Capability: &capability.Relay{},
+			Network:    "tcp",
+			Address:    addr,
+			Audit:      al,
+			Logger:     util.NewLogger(0),
+			Stdin:      bytes.NewBufferString("hi"),
+			Stdout:     &bytes.Buffer{},
+		}
+		return mode.Run(ctx)
+	}
+
+	if err := run(ln.Addr().String()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	ln.Close()
+	if err := run(ln.Addr().String()); err == nil {
+		t.Fatal("expected dial to a closed listener to fail")
+	}
+	al.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit lines, want 2:\n%s", len(lines), data)
+	}
+
+	var ok, failed audit.Record
+	json.Unmarshal([]byte(lines[0]), &ok)     //nolint:errcheck
+	json.Unmarshal([]byte(lines[1]), &failed) //nolint:errcheck
+	if ok.Mode != "connect" || ok.Capability != "relay" || ok.Remote != ln.Addr().String() ||
+		ok.BytesIn != 5 || ok.BytesOut != 2 || ok.Error != "" {
+		t.Errorf("session record = %+v", ok)
+	}
+	if failed.Remote != ln.Addr().String() || failed.Error == "" {
+		t.Errorf("failed dial record = %+v", failed)
+	}
+}
+
+// TestConnectMode_DialErrorAttrs verifies a failed dial is logged with
+// the address and error as attributes.
+func TestConnectMode_DialErrorAttrs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var buf bytes.Buffer
+	logger := util.NewLogger(3)
+	logger.SetOutput(&buf)
+	logger.SetFormat(util.LogFormatJSON)
+	mode := &ConnectMode{
+		Dialer:     &transport.TCPDialer{Timeout: 2 * time.Second},
+		Capability: &capability.Relay{},
+		Network:    "tcp",
+		Address:    addr,
+		Logger:     logger,
+		Stdin:      &bytes.Buffer{},
+		Stdout:     &bytes.Buffer{},
+	}
+	if err := mode.Run(context.Background()); err == nil {
+		t.Fatal("expected dial to a closed listener to fail")
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("not JSON: %q", line)
+		}
+		if rec["error"] != nil {
+			if rec["address"] != addr || rec["network"] != "tcp" {
+				t.Errorf("dial error record = %v", rec)
+			}
+			return
+		}
+	}
+	t.Errorf("no record carries the dial error:\n%s", buf.String())
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gonc/internal/control"
+	"gonc/internal/metrics"
+	"gonc/util"
+)
+
+// ControlServerMode runs another mode while serving the admin API for
+// it on a Unix socket or loopback address.  The server stops when the
+// wrapped mode returns.
+type ControlServerMode struct {
+	Mode     Mode
+	Address  string // "unix:/path" or loopback "host:port"
+	Registry *control.Registry
+	Metrics  *metrics.Collector
+	Logger   *util.Logger
+}
+
+// Run starts the control server, then runs the wrapped mode.
+func (m *ControlServerMode) Run(ctx context.Context) error {
+	ln, err := control.Listen(m.Address)
+	if err != nil {
+		return fmt.Errorf("control listen on %s: %w", m.Address, err)
+	}
+
+	// On TCP only the address itself is a valid Host; a Unix socket is
+	// out of a browser's reach.
+	var hosts []string
+	if ln.Addr().Network() == "tcp" {
+		hosts = []string{m.Address, ln.Addr().String()}
+	}
+	srv := &http.Server{
+		Handler:           control.Handler(m.Registry, m.Metrics, hosts...),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.Logger.Error("control server: %v", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
+
+	m.Logger.Verbose("control API on %s", m.Address)
+	return m.Mode.Run(ctx)
+}
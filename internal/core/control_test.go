@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gonc/internal/control"
+	"gonc/internal/metrics"
+	"gonc/util"
+)
+
+// TestControlServerMode verifies the admin API is reachable over a
+// Unix socket while the wrapped mode runs.
+func TestControlServerMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a Unix socket path")
+	}
+	sock := filepath.Join(t.TempDir(), "gonc.sock")
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	var body string
+	inner := modeFunc(func(ctx context.Context) error {
+		resp, err := client.Get("http://gonc/connections")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body = string(b)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mode := &ControlServerMode{
+		Mode:     inner,
+		Address:  "unix:" + sock,
+		Registry: control.NewRegistry(),
+		Metrics:  metrics.New(),
+		Logger:   util.NewLogger(0),
+	}
+	if err := mode.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.TrimSpace(body) != "[]" {
+		t.Errorf("GET /connections = %q, want []", body)
+	}
+}
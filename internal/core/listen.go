@@ -5,25 +5,60 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"gonc/config"
+	"gonc/internal/audit"
 	"gonc/internal/capability"
+	"gonc/internal/capture"
+	"gonc/internal/control"
+	"gonc/internal/metrics"
+	"gonc/internal/proxyproto"
+	"gonc/internal/ratelimit"
 	"gonc/internal/session"
+	"gonc/internal/tlsconf"
+	"gonc/internal/udpmux"
 	"gonc/util"
 )
 
 // ListenMode accepts inbound connections and runs a capability on
 // each one.  With KeepOpen=true it spawns a goroutine per connection;
-// otherwise it handles one connection and returns.
+// otherwise it handles one connection and returns.  UDP clients are
+// told apart by source address: with KeepOpen or the Forward
+// capability every client gets its own session, otherwise the first
+// client is served alone, as nc -u -l does.
 type ListenMode struct {
 	Address    string // ":port"
 	Network    string // "tcp" or "udp"
 	KeepOpen   bool
 	Timeout    time.Duration
 	Capability capability.Capability
+	Metrics    *metrics.Collector // optional; nil-safe
+	Control    *control.Registry  // optional; lists connections for --control
+	Audit      *audit.Log         // optional; records each session for --audit-log
+	Capture    *capture.Capture   // optional; -o / --tee traffic capture
+	Limiter    *ratelimit.Limiter // optional; --rate-limit / --max-bytes
 	Logger     *util.Logger
 
+	// AcceptProxyProtocol requires every TCP connection to start with
+	// a PROXY v1/v2 header, which is stripped before the capability
+	// runs.  The original client address becomes the session Origin.
+	AcceptProxyProtocol bool
+
+	// TLS terminates TLS on every TCP connection, after any PROXY
+	// header, so capture and the capability see plaintext.
+	// TLSClientInfo ("proxy" or "headers") passes the client's
+	// certificate details on to a --forward upstream.
+	TLS           *tlsconf.Server
+	TLSClientInfo string
+
+	// UDPIdle expires a UDP client's session after this long without
+	// datagrams either way (KeepOpen or Forward; 0 = never).
+	UDPIdle time.Duration
+
 	// Stdin/Stdout default to os.Stdin/os.Stdout when nil.
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -46,9 +81,13 @@ func (m *ListenMode) stdout() io.Writer {
 // Run starts listening and dispatches accepted connections to the
 // capability.
 func (m *ListenMode) Run(ctx context.Context) error {
+	if c, ok := m.Capability.(io.Closer); ok {
+		defer c.Close()
+	}
 	if m.Network == "udp" {
 		return m.listenUDP(ctx)
 	}
+	go m.TLS.WatchReload(ctx)
 	return m.listenTCP(ctx)
 }
 
@@ -76,11 +115,14 @@ func (m *ListenMode) listenTCP(ctx context.Context) error {
 			case <-ctx.Done():
 				return nil
 			default:
+				m.Metrics.RecordError(fmt.Sprintf("accept: %v", err))
 				return fmt.Errorf("accept: %w", err)
 			}
 		}
 
-		m.Logger.Verbose("connection from %s", conn.RemoteAddr())
+		m.Logger.With("peer", conn.RemoteAddr().String()).Verbose("connection from %s", conn.RemoteAddr())
+		conn = metrics.TrackConn(conn, m.Metrics)
+		conn = m.Control.Track(conn, "listen", m.forwardTarget())
 
 		if m.KeepOpen {
 			go m.serveConn(ctx, conn) //nolint:errcheck
@@ -105,23 +147,162 @@ func (m *ListenMode) listenUDP(ctx context.Context) error {
 
 	m.Logger.Verbose("listening on %s (udp)", conn.LocalAddr())
 
-	if m.Timeout > 0 {
-		conn.SetDeadline(time.Now().Add(m.Timeout)) //nolint:errcheck
+	if _, ok := m.Capability.(*capability.Forward); ok || m.KeepOpen {
+		return m.servePeers(ctx, conn)
+	}
+	return m.serveFirstPeer(ctx, conn)
+}
+
+// serveFirstPeer waits for the first datagram and serves its sender
+// alone; datagrams from other addresses are dropped.  The session has
+// no idle expiry, only the -w deadline serveConn sets.
+func (m *ListenMode) serveFirstPeer(ctx context.Context, conn *net.UDPConn) error {
+	ln := udpmux.New(conn, 0)
+	defer ln.Close()
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	peer, err := ln.Accept()
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			m.Metrics.RecordError(fmt.Sprintf("udp read: %v", err))
+			return fmt.Errorf("udp read: %w", err)
+		}
 	}
+	ln.Pin()
 
-	sess := session.New(conn, m.stdin(), m.stdout(), m.Logger)
-	return m.Capability.Handle(ctx, sess)
+	m.Logger.With("peer", peer.RemoteAddr().String()).Verbose("datagrams from %s", peer.RemoteAddr())
+	peer = metrics.TrackConn(peer, m.Metrics)
+	peer = m.Control.Track(peer, "listen", m.forwardTarget())
+	return m.serveConn(ctx, peer)
+}
+
+// servePeers runs a session per UDP client address until ctx is
+// cancelled.  Sessions expire after UDPIdle without traffic.
+func (m *ListenMode) servePeers(ctx context.Context, conn *net.UDPConn) error {
+	ln := udpmux.New(conn, m.UDPIdle)
+	defer ln.Close()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		peer, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+				m.Metrics.RecordError(fmt.Sprintf("udp read: %v", err))
+				return fmt.Errorf("udp read: %w", err)
+			}
+		}
+
+		m.Logger.With("peer", peer.RemoteAddr().String()).Verbose("datagrams from %s", peer.RemoteAddr())
+		peer = metrics.TrackConn(peer, m.Metrics)
+		peer = m.Control.Track(peer, "listen", m.forwardTarget())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.serveConn(ctx, peer) //nolint:errcheck
+		}()
+	}
 }
 
 // ── Shared ───────────────────────────────────────────────────────────
 
-func (m *ListenMode) serveConn(ctx context.Context, conn net.Conn) error {
+// forwardTarget returns the --forward upstream, or "" for other
+// capabilities.
+func (m *ListenMode) forwardTarget() string {
+	if f, ok := m.Capability.(*capability.Forward); ok {
+		return f.Address
+	}
+	return ""
+}
+
+func (m *ListenMode) serveConn(ctx context.Context, conn net.Conn) (err error) {
 	defer conn.Close()
 
+	name, command := capability.Describe(m.Capability)
+	conn, entry := m.Audit.Begin(conn, audit.Record{
+		Mode:       "listen",
+		Target:     m.forwardTarget(),
+		Capability: name,
+		Command:    command,
+	})
+	defer func() { entry.Finish(err) }() //nolint:errcheck
+
+	var origin net.Addr
+	if m.AcceptProxyProtocol {
+		timeout := m.Timeout
+		if timeout == 0 {
+			timeout = config.DefaultProxyHeaderTimeout
+		}
+		pc, err := proxyproto.Accept(conn, timeout)
+		if err != nil {
+			m.Logger.With("peer", conn.RemoteAddr().String()).
+				Error("PROXY header from %s: %v", conn.RemoteAddr(), err)
+			m.Metrics.RecordError(fmt.Sprintf("PROXY header from %s: %v", conn.RemoteAddr(), err))
+			return fmt.Errorf("PROXY header from %s: %w", conn.RemoteAddr(), err)
+		}
+		if !pc.Header().IsLocal() {
+			origin = pc.RemoteAddr()
+			entry.SetOrigin(origin)
+			m.Logger.With("origin", origin.String(), "peer", pc.ProxyAddr().String()).
+				Verbose("connection from %s via proxy %s", origin, pc.ProxyAddr())
+		}
+		conn = pc
+	}
+
+	var clientHeaders http.Header
+	if m.TLS != nil {
+		timeout := m.Timeout
+		if timeout == 0 {
+			timeout = config.DefaultTLSHandshakeTimeout
+		}
+		tc, err := m.TLS.Handshake(ctx, conn, timeout)
+		if err != nil {
+			m.Logger.With("peer", conn.RemoteAddr().String()).Error("%s: %v", conn.RemoteAddr(), err)
+			m.Metrics.RecordError(fmt.Sprintf("%s: %v", conn.RemoteAddr(), err))
+			return fmt.Errorf("%s: %w", conn.RemoteAddr(), err)
+		}
+		conn = tc
+		switch cs := tc.ConnectionState(); m.TLSClientInfo {
+		case tlsconf.InfoProxy:
+			ctx = proxyproto.WithTLVs(ctx, tlsconf.ClientTLV(cs))
+		case tlsconf.InfoHeaders:
+			clientHeaders = tlsconf.ClientHeaders(cs)
+		}
+	}
+
+	if conn, err = m.Capture.Wrap(conn, "listen"); err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	conn = m.Limiter.Wrap(conn)
+	defer conn.Close()
+	if clientHeaders != nil {
+		conn = tlsconf.InjectHeaders(conn, clientHeaders)
+	}
+
 	if m.Timeout > 0 {
 		conn.SetDeadline(time.Now().Add(m.Timeout)) //nolint:errcheck
 	}
 
 	sess := session.New(conn, m.stdin(), m.stdout(), m.Logger)
-	return m.Capability.Handle(ctx, sess)
+	if origin != nil {
+		sess.Origin = origin
+		sess.Logger = sess.Logger.With("origin", origin.String())
+	}
+	err = m.Capability.Handle(ctx, sess)
+	if sess.Target != "" {
+		entry.SetTarget(sess.Target)
+	}
+	entry.SetUser(sess.User)
+	return err
 }
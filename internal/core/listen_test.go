@@ -2,13 +2,29 @@ package core
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"gonc/internal/capability"
+	"gonc/internal/proxyproto"
+	"gonc/internal/session"
+	"gonc/internal/tlsconf"
+	"gonc/internal/transport"
 	"gonc/util"
 )
 
@@ -91,3 +107,376 @@ func TestListenMode_KeepOpen(t *testing.T) {
 		conn.Close()
 	}
 }
+
+// originCapability records the session origin and echoes nothing.
+type originCapability struct{ origin chan net.Addr }
+
+func (c *originCapability) Handle(_ context.Context, sess *session.Session) error {
+	c.origin <- sess.Origin
+	return nil
+}
+
+// TestListenMode_AcceptProxyProtocol verifies the PROXY header is
+// stripped and its source exposed as the session origin.
+func TestListenMode_AcceptProxyProtocol(t *testing.T) {
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	capab := &originCapability{origin: make(chan net.Addr, 1)}
+	mode := &ListenMode{
+		Address:             fmt.Sprintf(":%d", port),
+		Network:             "tcp",
+		Capability:          capab,
+		AcceptProxyProtocol: true,
+		Logger:              util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.20"), Port: 5555}
+	proxyproto.NewHeader(1, src, conn.RemoteAddr()).WriteTo(conn) //nolint:errcheck
+
+	select {
+	case got := <-capab.origin:
+		if got == nil || got.String() != src.String() {
+			t.Errorf("origin = %v, want %v", got, src)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("capability not invoked")
+	}
+}
+
+// TestListenMode_ForwardTCP verifies that -k with --forward serves
+// several clients at once, each bridged to its own upstream connection.
+func TestListenMode_ForwardTCP(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c) //nolint:errcheck
+			}()
+		}
+	}()
+
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	mode := &ListenMode{
+		Address:  fmt.Sprintf("127.0.0.1:%d", port),
+		Network:  "tcp",
+		KeepOpen: true,
+		Capability: &capability.Forward{
+			Dialer:  &transport.TCPDialer{Timeout: time.Second},
+			Network: "tcp",
+			Address: echo.Addr().String(),
+		},
+		Logger: util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.DialTimeout("tcp", mode.Address, 2*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		clients = append(clients, c)
+	}
+	for i, c := range clients {
+		msg := fmt.Sprintf("client %d", i)
+		c.Write([]byte(msg)) //nolint:errcheck
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(c, buf); err != nil || string(buf) != msg {
+			t.Errorf("client %d got %q, %v", i, buf, err)
+		}
+	}
+}
+
+// TestListenMode_ForwardUDP verifies that UDP --forward keeps a
+// session per client address and routes replies back to each client.
+func TestListenMode_ForwardUDP(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], addr) //nolint:errcheck
+		}
+	}()
+
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	mode := &ListenMode{
+		Address: fmt.Sprintf("127.0.0.1:%d", port),
+		Network: "udp",
+		Capability: &capability.Forward{
+			Dialer:  &transport.UDPDialer{Timeout: time.Second},
+			Network: "udp",
+			Address: echo.LocalAddr().String(),
+		},
+		UDPIdle: time.Second,
+		Logger:  util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("udp", mode.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+
+		msg := fmt.Sprintf("datagram %d", i)
+		c.Write([]byte(msg)) //nolint:errcheck
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		if err != nil || string(buf[:n]) != msg {
+			t.Errorf("client %d got %q, %v", i, buf[:n], err)
+		}
+	}
+}
+
+// TestListenMode_UDPRelay verifies that without -k a UDP listener
+// locks onto its first client: Relay output reaches that client, and
+// datagrams from anyone else are dropped.
+func TestListenMode_UDPRelay(t *testing.T) {
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	stdin, stdinW := io.Pipe()
+	defer stdinW.Close()
+	stdout, stdoutW := io.Pipe()
+	mode := &ListenMode{
+		Address:    fmt.Sprintf("127.0.0.1:%d", port),
+		Network:    "udp",
+		Capability: &capability.Relay{},
+		Stdin:      stdin,
+		Stdout:     stdoutW,
+		Logger:     util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	dial := func() net.Conn {
+		c, err := net.Dial("udp", mode.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		return c
+	}
+	first, other := dial(), dial()
+	defer first.Close()
+	defer other.Close()
+
+	buf := make([]byte, 64)
+	first.Write([]byte("hello")) //nolint:errcheck
+	if n, err := stdout.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("stdout got %q, %v", buf[:n], err)
+	}
+	other.Write([]byte("intruder")) //nolint:errcheck
+	first.Write([]byte("again"))    //nolint:errcheck
+	if n, err := stdout.Read(buf); err != nil || string(buf[:n]) != "again" {
+		t.Errorf("stdout got %q, %v; want the locked peer's datagram", buf[:n], err)
+	}
+
+	stdinW.Write([]byte("reply")) //nolint:errcheck
+	if n, err := first.Read(buf); err != nil || string(buf[:n]) != "reply" {
+		t.Errorf("client got %q, %v", buf[:n], err)
+	}
+}
+
+// echoCapability writes every datagram or chunk back to its sender.
+type echoCapability struct{}
+
+func (echoCapability) Handle(_ context.Context, sess *session.Session) error {
+	_, err := io.Copy(sess.Conn, sess.Conn)
+	return err
+}
+
+// TestListenMode_UDPKeepOpen verifies that with -k every UDP client
+// gets its own session and replies go back to the right client.
+func TestListenMode_UDPKeepOpen(t *testing.T) {
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	mode := &ListenMode{
+		Address:    fmt.Sprintf("127.0.0.1:%d", port),
+		Network:    "udp",
+		KeepOpen:   true,
+		Capability: echoCapability{},
+		UDPIdle:    time.Second,
+		Logger:     util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("udp", mode.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+
+		msg := fmt.Sprintf("client %d", i)
+		c.Write([]byte(msg)) //nolint:errcheck
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		if err != nil || string(buf[:n]) != msg {
+			t.Errorf("client %d got %q, %v", i, buf[:n], err)
+		}
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost with
+// common name cn, usable as server, client and CA certificate, and
+// returns its files and a pool trusting it.
+func writeTestCert(t *testing.T, cn string) (certFile, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)      //nolint:errcheck
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600) //nolint:errcheck
+	cert, _ := x509.ParseCertificate(der)
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+
+// TestListenMode_TLSHeaders verifies that --tls-cert with
+// --tls-client-info headers terminates TLS and hands a plaintext
+// upstream the verified client subject, replacing a forged one.
+func TestListenMode_TLSHeaders(t *testing.T) {
+	certFile, keyFile, roots := writeTestCert(t, "gonc-client")
+	srv, err := tlsconf.NewServer(certFile, keyFile, certFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A plaintext HTTP upstream that echoes the subject header.
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Client-Cert-Subject")) //nolint:errcheck
+	}))
+	defer upstream.Close()
+
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	mode := &ListenMode{
+		Address:  fmt.Sprintf("127.0.0.1:%d", port),
+		Network:  "tcp",
+		KeepOpen: true,
+		Capability: &capability.Forward{
+			Dialer:  &transport.TCPDialer{Timeout: time.Second},
+			Network: "tcp",
+			Address: upstream.Listener.Addr().String(),
+		},
+		TLS:           srv,
+		TLSClientInfo: tlsconf.InfoHeaders,
+		Logger:        util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{cert},
+	}}}
+	req, _ := http.NewRequest("GET", "https://"+mode.Address+"/", nil)
+	req.Header.Set("X-Client-Cert-Subject", "CN=mallory")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "CN=gonc-client" {
+		t.Errorf("upstream saw subject %q, want CN=gonc-client", body)
+	}
+
+	// Without a client certificate the handshake is refused.
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	if resp, err := anon.Get("https://" + mode.Address + "/"); err == nil {
+		resp.Body.Close()
+		t.Error("request without a client certificate should fail")
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"gonc/internal/metrics"
+	"gonc/util"
+)
+
+// MetricsServerMode runs another mode while serving its metrics
+// collector over HTTP (/metrics and /healthz).  The server stops when
+// the wrapped mode returns.
+type MetricsServerMode struct {
+	Mode    Mode
+	Address string // e.g. "127.0.0.1:9100"
+	Metrics *metrics.Collector
+	Logger  *util.Logger
+}
+
+// Run starts the HTTP server, then runs the wrapped mode.
+func (m *MetricsServerMode) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", m.Address)
+	if err != nil {
+		return fmt.Errorf("metrics listen on %s: %w", m.Address, err)
+	}
+
+	srv := &http.Server{
+		Handler:           metrics.Handler(m.Metrics),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.Logger.Error("metrics server: %v", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
+
+	m.Logger.Verbose("metrics on http://%s/metrics", ln.Addr())
+	return m.Mode.Run(ctx)
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gonc/internal/metrics"
+	"gonc/util"
+)
+
+// modeFunc adapts a function to the Mode interface.
+type modeFunc func(ctx context.Context) error
+
+func (f modeFunc) Run(ctx context.Context) error { return f(ctx) }
+
+// TestMetricsServerMode verifies /metrics is served while the wrapped
+// mode runs and reflects what the mode records.
+func TestMetricsServerMode(t *testing.T) {
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	c := metrics.New()
+
+	var body string
+	inner := modeFunc(func(ctx context.Context) error {
+		c.ConnectionOpened()
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body = string(b)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mode := &MetricsServerMode{Mode: inner, Address: addr, Metrics: c, Logger: util.NewLogger(0)}
+	if err := mode.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(body, "gonc_connections_total 1") {
+		t.Errorf("metrics body missing connection count:\n%s", body)
+	}
+
+	// The server is gone once the mode returns.
+	if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		t.Error("metrics server still running after Run returned")
+	}
+}
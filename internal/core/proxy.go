@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gonc/config"
+	"gonc/internal/audit"
+	"gonc/internal/balance"
+	"gonc/internal/capture"
+	"gonc/internal/control"
+	"gonc/internal/fault"
+	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/proxyproto"
+	"gonc/internal/ratelimit"
+	"gonc/internal/session"
+	"gonc/internal/tlsconf"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// ProxyMode listens on a local TCP port and bridges every accepted
+// connection to an upstream address, injecting the faults configured
+// with --fault on the way.  It always serves connections concurrently.
+type ProxyMode struct {
+	Address     string // ":port"
+	Upstream    string // host:port dialled for each connection
+	Dialer      transport.Dialer
+	Pool        *balance.Pool // optional; balances over Upstream and --backend targets
+	IdleTimeout time.Duration
+	Faults      *fault.Injector    // optional; nil proxies cleanly
+	Mirror      *mirror.Mirror     // optional; --mirror shadow of client → upstream bytes
+	TLS         *tlsconf.Server    // optional; --tls-cert terminates TLS from clients
+	TLSInfo     string             // --tls-client-info: "proxy" or "headers" to pass client cert details upstream
+	Gateway     string             // SSH gateway host:port when tunnelled; for audit records
+	Metrics     *metrics.Collector // optional; nil-safe
+	Control     *control.Registry  // optional; lists connections and faults for --control
+	Audit       *audit.Log         // optional; records each session for --audit-log
+	Capture     *capture.Capture   // optional; -o / --tee traffic capture
+	Limiter     *ratelimit.Limiter // optional; --rate-limit / --max-bytes
+	Logger      *util.Logger
+}
+
+// Run accepts connections until ctx is cancelled, then waits for the
+// open ones to finish.
+func (m *ProxyMode) Run(ctx context.Context) error {
+	defer m.Dialer.Close()
+	defer m.Pool.Close() //nolint:errcheck
+
+	ln, err := net.Listen("tcp", m.Address)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", m.Address, err)
+	}
+	defer ln.Close()
+
+	if m.Faults != nil {
+		m.Control.SetFaults(m.Faults)
+	}
+	go m.TLS.WatchReload(ctx)
+	m.Logger.Verbose("proxying %s → %s", ln.Addr(), m.Upstream)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+				m.Metrics.RecordError(fmt.Sprintf("accept: %v", err))
+				return fmt.Errorf("accept: %w", err)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.serveConn(ctx, conn) //nolint:errcheck
+		}()
+	}
+}
+
+// serveConn bridges one client connection to the upstream.  Faults
+// wrap the raw connection so an injected reset reaches the client as
+// a TCP RST, and capture sees the bytes as they were delivered, after
+// any TLS termination.
+func (m *ProxyMode) serveConn(ctx context.Context, conn net.Conn) (err error) {
+	start := time.Now()
+	peer := conn.RemoteAddr().String()
+	log := m.Logger.With("session", session.NextID(), "peer", peer, "upstream", m.Upstream)
+	record := metrics.ConnRecord{Peer: peer, Target: m.Upstream, Start: start}
+	defer func() {
+		record.Duration = time.Since(start)
+		m.Metrics.RecordConnection(record)
+	}()
+
+	conn = m.Faults.Wrap(conn)
+	faulty := conn
+	conn = metrics.TrackConn(conn, m.Metrics)
+	conn = m.Control.Track(conn, "proxy", m.Upstream)
+	defer conn.Close()
+
+	conn, entry := m.Audit.Begin(conn, audit.Record{Mode: "proxy", Target: m.Upstream, Gateway: m.Gateway})
+	defer func() { entry.Finish(err) }() //nolint:errcheck
+
+	ctx = proxyproto.WithSource(ctx, conn.RemoteAddr())
+	var clientHeaders http.Header
+	if m.TLS != nil {
+		timeout := m.IdleTimeout
+		if timeout == 0 {
+			timeout = config.DefaultTLSHandshakeTimeout
+		}
+		tc, err := m.TLS.Handshake(ctx, conn, timeout)
+		if err != nil {
+			log.Error("proxy: %v", err)
+			m.Metrics.RecordError(fmt.Sprintf("%s: %v", peer, err))
+			record.CloseReason = "TLS handshake failed"
+			return fmt.Errorf("%s: %w", peer, err)
+		}
+		conn = tc
+		switch cs := tc.ConnectionState(); m.TLSInfo {
+		case tlsconf.InfoProxy:
+			ctx = proxyproto.WithTLVs(ctx, tlsconf.ClientTLV(cs))
+		case tlsconf.InfoHeaders:
+			clientHeaders = tlsconf.ClientHeaders(cs)
+		}
+	}
+
+	if conn, err = m.Capture.Wrap(conn, "proxy"); err != nil {
+		record.CloseReason = "capture failed"
+		return fmt.Errorf("capture: %w", err)
+	}
+	conn = m.Limiter.Wrap(conn)
+	limited := conn
+	if clientHeaders != nil {
+		conn = tlsconf.InjectHeaders(conn, clientHeaders)
+	}
+	conn = m.Mirror.Wrap(ctx, conn)
+	defer conn.Close()
+
+	dialStart := time.Now()
+	upstream, target, err := m.dial(ctx)
+	m.Metrics.ObserveDialLatency(time.Since(dialStart))
+	if err != nil {
+		log.With("target", target).Error("proxy: dial %s failed: %v", target, err)
+		m.Metrics.RecordError(fmt.Sprintf("upstream dial %s: %v", target, err))
+		record.CloseReason = "upstream dial failed"
+		return fmt.Errorf("upstream dial %s: %w", target, err)
+	}
+	defer upstream.Close()
+	if target != m.Upstream {
+		record.Target = target
+		entry.SetTarget(target)
+		log = log.With("backend", target)
+	}
+
+	log.Verbose("proxy: bridging %s ↔ %s", peer, target)
+	in, out, reason := util.BridgeReason(ctx, conn, upstream, m.IdleTimeout)
+	switch {
+	case fault.WasReset(faulty):
+		reason = "fault reset"
+	case ratelimit.Exceeded(limited):
+		reason = "quota"
+	}
+	record.BytesIn, record.BytesOut, record.CloseReason = in, out, reason
+	switch reason {
+	case util.BridgeError:
+		err = errors.New("bridge: error")
+	case "fault reset":
+		err = fault.ErrInjectedReset
+	case "quota":
+		err = ratelimit.ErrQuotaExceeded
+	}
+
+	elapsed := time.Since(start)
+	log.With("bytes_in", in, "bytes_out", out, "duration_ms", elapsed.Milliseconds(), "reason", reason).
+		Verbose("proxy: %s closed after %v (in=%d out=%d reason=%s)",
+			peer, elapsed.Truncate(time.Millisecond), in, out, reason)
+	return err
+}
+
+// dial connects to Upstream, or to a backend chosen by Pool, and
+// returns the connection and the address it reached.
+func (m *ProxyMode) dial(ctx context.Context) (net.Conn, string, error) {
+	if m.Pool == nil {
+		conn, err := m.Dialer.Dial(ctx, "tcp", m.Upstream)
+		return conn, m.Upstream, err
+	}
+	conn, target, err := m.Pool.Dial(ctx)
+	if err != nil {
+		return nil, "backends", err
+	}
+	return conn, target, nil
+}
@@ -0,0 +1,335 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"gonc/internal/balance"
+	"gonc/internal/fault"
+	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/proxyproto"
+	"gonc/internal/tlsconf"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// startProxy runs a ProxyMode in front of an echo server and returns
+// its address.
+func startProxy(t *testing.T, inj *fault.Injector, m *metrics.Collector) string {
+	return startProxyMode(t, &ProxyMode{Faults: inj, Metrics: m})
+}
+
+// startProxyMode completes mode with a free local port and, unless
+// already set, an echo upstream and a plain TCP dialer.  It runs the
+// mode and returns its address.
+func startProxyMode(t *testing.T, mode *ProxyMode) string {
+	t.Helper()
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { echo.Close() })
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c) //nolint:errcheck
+			}()
+		}
+	}()
+
+	port, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() { cancel(); <-done })
+
+	mode.Address = fmt.Sprintf("127.0.0.1:%d", port)
+	if mode.Upstream == "" {
+		mode.Upstream = echo.Addr().String()
+	}
+	if mode.Dialer == nil {
+		mode.Dialer = &transport.TCPDialer{Timeout: 2 * time.Second}
+	}
+	mode.Logger = util.NewLogger(0)
+	go func() {
+		defer close(done)
+		mode.Run(ctx) //nolint:errcheck
+	}()
+	time.Sleep(100 * time.Millisecond)
+	return mode.Address
+}
+
+// TestProxyMode_Faults verifies that the proxy bridges to its upstream
+// with faults applied, and that changed faults take effect at once.
+func TestProxyMode_Faults(t *testing.T) {
+	inj := fault.New(fault.Settings{Down: fault.Faults{Latency: 100 * time.Millisecond}}, 1)
+	m := metrics.New()
+	addr := startProxy(t, inj, m)
+
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second)) //nolint:errcheck
+
+	start := time.Now()
+	conn.Write([]byte("ping")) //nolint:errcheck
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("round trip with 100ms downstream latency took %v", elapsed)
+	}
+
+	// Every upstream chunk now resets the connection.
+	if err := inj.Set(fault.Settings{Up: fault.Faults{Reset: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("again")) //nolint:errcheck
+	if _, err := conn.Read(buf); err == nil {
+		t.Fatal("expected the connection to be reset")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if recs := m.Snapshot().RecentConnections; len(recs) == 1 {
+			if recs[0].CloseReason != "fault reset" {
+				t.Errorf("close reason = %q, want fault reset", recs[0].CloseReason)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("no connection record after the reset")
+}
+
+// TestProxyMode_UpstreamDown verifies that a failed upstream dial
+// closes the client connection.
+func TestProxyMode_UpstreamDown(t *testing.T) {
+	// Hold the upstream port while picking the proxy's so they differ.
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := util.FindFreePort()
+	dead.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	mode := &ProxyMode{
+		Address:  fmt.Sprintf("127.0.0.1:%d", port),
+		Upstream: dead.Addr().String(),
+		Dialer:   &transport.TCPDialer{Timeout: time.Second},
+		Logger:   util.NewLogger(0),
+	}
+	go mode.Run(ctx) //nolint:errcheck
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.DialTimeout("tcp", mode.Address, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read = %v, want EOF after upstream dial failure", err)
+	}
+}
+
+// TestProxyMode_Backends verifies that a dead backend is skipped and
+// the connection record names the backend that was reached.
+func TestProxyMode_Backends(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c) //nolint:errcheck
+			}()
+		}
+	}()
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := util.FindFreePort()
+	dead.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := &transport.TCPDialer{Timeout: time.Second}
+	m := metrics.New()
+	mode := &ProxyMode{
+		Address:  fmt.Sprintf("127.0.0.1:%d", port),
+		Upstream: dead.Addr().String(),
+		Dialer:   dialer,
+		Pool:     balance.New([]string{dead.Addr().String(), echo.Addr().String()}, "tcp", dialer.Dial, balance.Config{}),
+		Metrics:  m,
+		Logger:   util.NewLogger(0),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mode.Run(ctx) //nolint:errcheck
+	}()
+	defer func() { cancel(); <-done }()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.DialTimeout("tcp", mode.Address, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(3 * time.Second)) //nolint:errcheck
+	conn.Write([]byte("ping"))                        //nolint:errcheck
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if recs := m.Snapshot().RecentConnections; len(recs) == 1 {
+			if recs[0].Target != echo.Addr().String() {
+				t.Errorf("target = %q, want %s", recs[0].Target, echo.Addr())
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("no connection record")
+}
+
+// TestProxyMode_Mirror verifies that --mirror sends the client's bytes
+// to the shadow while the client still talks to the upstream.
+func TestProxyMode_Mirror(t *testing.T) {
+	shadow, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shadow.Close()
+	got := make(chan string, 1)
+	go func() {
+		c, err := shadow.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("ignored")) //nolint:errcheck
+		data, _ := io.ReadAll(c)
+		got <- string(data)
+	}()
+
+	dialer := &transport.TCPDialer{Timeout: time.Second}
+	addr := startProxyMode(t, &ProxyMode{
+		Mirror: mirror.New(shadow.Addr().String(), dialer.Dial, 1<<20, util.NewLogger(0)),
+	})
+
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(3 * time.Second)) //nolint:errcheck
+	conn.Write([]byte("ping"))                        //nolint:errcheck
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+	conn.Close()
+
+	select {
+	case data := <-got:
+		if data != "ping" {
+			t.Errorf("shadow received %q, want ping", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow received nothing")
+	}
+}
+
+// TestProxyMode_TLS verifies that --tls-cert terminates TLS before
+// the upstream and --tls-client-info proxy passes the client
+// certificate on as a PROXY v2 SSL TLV.
+func TestProxyMode_TLS(t *testing.T) {
+	certFile, keyFile, roots := writeTestCert(t, "gonc-client")
+	srv, err := tlsconf.NewServer(certFile, keyFile, certFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream reports the CN it was told about, then echoes.
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		c, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		h, err := proxyproto.Read(br)
+		if err != nil {
+			return
+		}
+		v, _ := h.TLV(proxyproto.TypeSSL)
+		ssl, _ := proxyproto.ParseSSL(v)
+		fmt.Fprintf(c, "%s;", ssl.CN)
+		io.Copy(c, br) //nolint:errcheck
+	}()
+
+	addr := startProxyMode(t, &ProxyMode{
+		Upstream: upstream.Addr().String(),
+		Dialer:   &transport.ProxyProtoDialer{Inner: &transport.TCPDialer{Timeout: time.Second}, Version: 2},
+		TLS:      srv,
+		TLSInfo:  tlsconf.InfoProxy,
+	})
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second)) //nolint:errcheck
+	conn.Write([]byte("ping"))                        //nolint:errcheck
+	want := "gonc-client;ping"
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != want {
+		t.Errorf("got %q, %v; want %q", buf, err, want)
+	}
+}
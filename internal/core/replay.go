@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gonc/internal/capture"
+	"gonc/internal/metrics"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// ReplayMode re-sends the client side of recorded sessions to a
+// target and compares what comes back with the recorded server side.
+// Sessions are replayed one after another; Run fails if any differs.
+type ReplayMode struct {
+	Dialer   transport.Dialer
+	Sessions []*capture.Recording
+	Target   string        // host:port; "" replays to each session's recorded server
+	Speed    float64       // 1 = original timing, 2 = twice as fast, 0 = no delays
+	Timeout  time.Duration // give up waiting for a response after this long idle
+	Metrics  *metrics.Collector
+	Logger   *util.Logger
+
+	// Stdout receives the comparison report; defaults to os.Stdout.
+	Stdout io.Writer
+}
+
+func (m *ReplayMode) stdout() io.Writer {
+	if m.Stdout != nil {
+		return m.Stdout
+	}
+	return os.Stdout
+}
+
+// Run replays every session and reports whether its responses match.
+func (m *ReplayMode) Run(ctx context.Context) error {
+	defer m.Dialer.Close()
+
+	differ := 0
+	for _, rec := range m.Sessions {
+		if ctx.Err() != nil {
+			return nil
+		}
+		target := m.Target
+		if target == "" {
+			target = rec.Server
+		}
+		fmt.Fprintf(m.stdout(), "session %d (%s, recorded %s → %s) replayed to %s: ",
+			rec.Session, rec.Mode, rec.Client, rec.Server, target)
+
+		got, err := m.replay(ctx, rec, target)
+		if err != nil {
+			differ++
+			fmt.Fprintf(m.stdout(), "FAILED: %v\n", err)
+			continue
+		}
+		want := rec.ServerBytes()
+		if !reportDiff(m.stdout(), want, got) {
+			differ++
+		}
+	}
+
+	if differ > 0 {
+		return fmt.Errorf("replay: %d of %d session(s) differ from the recording", differ, len(m.Sessions))
+	}
+	return nil
+}
+
+// replay sends one session's client chunks to target and returns
+// everything the target sent back.  Before each client chunk it waits
+// for the server bytes that preceded it in the recording, so
+// request/response protocols keep their order at any speed.
+func (m *ReplayMode) replay(ctx context.Context, rec *capture.Recording, target string) ([]byte, error) {
+	conn, err := m.Dialer.Dial(ctx, "tcp", target)
+	if err != nil {
+		m.Metrics.RecordError(fmt.Sprintf("replay connect to %s: %v", target, err))
+		return nil, fmt.Errorf("connect to %s: %w", target, err)
+	}
+	conn = metrics.TrackConn(conn, m.Metrics)
+	defer conn.Close()
+
+	resp := newResponseBuffer()
+	go func() {
+		io.Copy(resp, conn) //nolint:errcheck
+		resp.finish()
+	}()
+
+	log := m.Logger.With("session", rec.Session, "target", target)
+	start := time.Now()
+	expected := 0 // recorded server bytes before the current chunk
+	for _, c := range rec.Chunks {
+		if !c.FromClient {
+			expected += len(c.Data)
+			continue
+		}
+		if got := resp.waitFor(ctx, expected, m.Timeout); got < expected {
+			log.Verbose("replay: got %d of %d response bytes before sending more", got, expected)
+		}
+		if m.Speed > 0 {
+			sleepCtxUntil(ctx, start.Add(time.Duration(float64(c.At)/m.Speed)))
+		}
+		if _, err := conn.Write(c.Data); err != nil {
+			return resp.bytes(), fmt.Errorf("send: %w", err)
+		}
+	}
+
+	resp.waitFor(ctx, expected, m.Timeout)
+	return resp.bytes(), nil
+}
+
+// reportDiff writes "match" or the first difference between want and
+// got, with a hex dump of the surrounding bytes.  It reports whether
+// they matched.
+func reportDiff(w io.Writer, want, got []byte) bool {
+	if bytes.Equal(want, got) {
+		fmt.Fprintf(w, "match (%d bytes)\n", len(got))
+		return true
+	}
+
+	at := 0
+	for at < len(want) && at < len(got) && want[at] == got[at] {
+		at++
+	}
+	fmt.Fprintf(w, "DIFFERS at byte %d (expected %d bytes, got %d)\n", at, len(want), len(got))
+
+	from := at &^ 15
+	window := func(b []byte) []byte {
+		return b[min(from, len(b)):min(from+32, len(b))]
+	}
+	fmt.Fprintln(w, "  expected:")
+	capture.Dump(w, capture.Received, int64(from), window(want))
+	fmt.Fprintln(w, "  got:")
+	capture.Dump(w, capture.Received, int64(from), window(got))
+	return false
+}
+
+// sleepCtxUntil sleeps until t or until ctx is cancelled.
+func sleepCtxUntil(ctx context.Context, t time.Time) {
+	d := time.Until(t)
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// responseBuffer collects a target's responses and lets the sender
+// wait for a given amount of them.
+type responseBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	eof     bool
+	changed chan struct{} // closed and replaced on every change
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{changed: make(chan struct{})}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// finish marks the end of the response stream.
+func (b *responseBuffer) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.eof = true
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *responseBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
+
+// waitFor blocks until at least n bytes have arrived, the stream
+// ends, ctx is cancelled, or nothing arrives for idle.  It returns the
+// number of bytes received so far.
+func (b *responseBuffer) waitFor(ctx context.Context, n int, idle time.Duration) int {
+	for {
+		b.mu.Lock()
+		got, eof, changed := len(b.buf), b.eof, b.changed
+		b.mu.Unlock()
+		if got >= n || eof {
+			return got
+		}
+
+		timer := time.NewTimer(idle)
+		select {
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			return got
+		case <-ctx.Done():
+			timer.Stop()
+			return got
+		}
+	}
+}
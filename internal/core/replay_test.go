@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gonc/internal/capture"
+	"gonc/internal/transport"
+	"gonc/util"
+)
+
+// serve answers every line read on each accepted connection with
+// respond(line).
+func serve(t *testing.T, respond func(string) string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 64)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					io.WriteString(conn, respond(string(buf[:n]))) //nolint:errcheck
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// pingRecording is a two-round request/response session.
+func pingRecording() *capture.Recording {
+	return &capture.Recording{
+		Session: 1,
+		Mode:    "connect",
+		Chunks: []capture.Chunk{
+			{At: 0, FromClient: true, Data: []byte("PING\n")},
+			{At: 10 * time.Millisecond, Data: []byte("+PONG\n")},
+			{At: 20 * time.Millisecond, FromClient: true, Data: []byte("PING\n")},
+			{At: 30 * time.Millisecond, Data: []byte("+PONG\n")},
+		},
+	}
+}
+
+func TestReplayMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(string) string
+		wantErr bool
+		report  string
+	}{
+		{"match", func(string) string { return "+PONG\n" }, false, "match (12 bytes)"},
+		{"differs", func(string) string { return "-ERR\n" }, true, "DIFFERS at byte 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln := serve(t, tt.respond)
+			defer ln.Close()
+
+			var out bytes.Buffer
+			mode := &ReplayMode{
+				Dialer:   &transport.TCPDialer{Timeout: 2 * time.Second},
+				Sessions: []*capture.Recording{pingRecording()},
+				Target:   ln.Addr().String(),
+				Speed:    2,
+				Timeout:  200 * time.Millisecond,
+				Logger:   util.NewLogger(0),
+				Stdout:   &out,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := mode.Run(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.report) {
+				t.Errorf("report %q does not contain %q", out.String(), tt.report)
+			}
+		})
+	}
+}
+
+func TestReportDiff(t *testing.T) {
+	var out bytes.Buffer
+	if reportDiff(&out, []byte("0123456789abcdefXYZ"), []byte("0123456789abcdefXyZ")) {
+		t.Fatal("reportDiff reported a match")
+	}
+	for _, want := range []string{"DIFFERS at byte 17", "< 00000010  58 59 5a", "< 00000010  58 79 5a"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
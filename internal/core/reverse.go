@@ -3,9 +3,21 @@ package core
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"gonc/internal/audit"
+	"gonc/internal/balance"
+	"gonc/internal/capture"
+	"gonc/internal/control"
 	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/qrcode"
+	"gonc/internal/ratelimit"
+	"gonc/internal/sniff"
 	"gonc/tunnel"
 	"gonc/util"
 )
@@ -21,7 +33,30 @@ type ReverseTunnelMode struct {
 	CheckGatewayPorts bool
 	KeepAliveInterval time.Duration
 	AutoReconnect     bool
+	IdleTimeout       time.Duration // -w: close bridged connections idle this long
+	Router            *sniff.Table  // optional Host/SNI routing
+	Backends          *balance.Pool // optional; balances the default target over --backend
+	ProxyProtocol     int           // PROXY header version on local dials (0 = off)
+	Policy            tunnel.ExposurePolicy
+	URLFile           string             // write announced public URLs here, one per line
+	URLQR             bool               // render announced public URLs as QR codes
+	Metrics           *metrics.Collector // optional; nil-safe
+	Control           *control.Registry  // optional; admin API registry
+	Audit             *audit.Log         // optional; records each session for --audit-log
+	Capture           *capture.Capture   // optional; -o / --tee traffic capture
+	Limiter           *ratelimit.Limiter // optional; --rate-limit / --max-bytes
+	Mirror            *mirror.Mirror     // optional; --mirror shadow target
 	Logger            *util.Logger
+
+	// Stderr receives QR codes; defaults to os.Stderr when nil.
+	Stderr io.Writer
+}
+
+func (m *ReverseTunnelMode) stderr() io.Writer {
+	if m.Stderr != nil {
+		return m.Stderr
+	}
+	return os.Stderr
 }
 
 // Run connects to the SSH gateway, requests a remote listener, and
@@ -36,6 +71,17 @@ func (m *ReverseTunnelMode) Run(ctx context.Context) error {
 		CheckGatewayPorts: m.CheckGatewayPorts,
 		KeepAliveInterval: m.KeepAliveInterval,
 		AutoReconnect:     m.AutoReconnect,
+		IdleTimeout:       m.IdleTimeout,
+		Router:            m.Router,
+		Backends:          m.Backends,
+		ProxyProtocol:     m.ProxyProtocol,
+		Policy:            m.Policy,
+		Registry:          m.Control,
+		Audit:             m.Audit,
+		Capture:           m.Capture,
+		Limiter:           m.Limiter,
+		Mirror:            m.Mirror,
+		OnURL:             m.urlHandler(),
 	}
 
 	m.Logger.Verbose("establishing reverse tunnel: "+
@@ -43,14 +89,61 @@ func (m *ReverseTunnelMode) Run(ctx context.Context) error {
 		m.SSHConfig.User, m.SSHConfig.Host, m.SSHConfig.Port,
 		m.RemotePort, m.LocalPort)
 
-	rt := tunnel.NewReverseTunnel(rtCfg, m.Logger, metrics.New())
+	rt := tunnel.NewReverseTunnel(rtCfg, m.Logger, m.Metrics)
+	defer m.Backends.Close() //nolint:errcheck
 
 	if err := rt.Start(ctx); err != nil {
 		return fmt.Errorf("reverse tunnel: %w", err)
 	}
 	defer rt.Close()
+	m.Control.SetTunnel(rt)
+	defer m.Control.SetTunnel(nil)
 
 	// Block until the context is cancelled or the tunnel shuts down.
 	rt.Wait()
 	return nil
 }
+
+// urlHandler returns the hook that publishes gateway-announced URLs to
+// --url-file and the terminal, or nil when neither is requested.
+func (m *ReverseTunnelMode) urlHandler() func(tunnel.PublicURL) {
+	if m.URLFile == "" && !m.URLQR {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var urls []string
+	return func(u tunnel.PublicURL) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if m.URLFile != "" {
+			urls = append(urls, u.URL)
+			if err := writeURLFile(m.URLFile, urls); err != nil {
+				m.Logger.Error("url-file: %v", err)
+			}
+		}
+
+		if m.URLQR {
+			code, err := qrcode.Encode([]byte(u.URL))
+			if err != nil {
+				m.Logger.Warn("QR code for %s: %v", u.URL, err)
+				return
+			}
+			fmt.Fprintf(m.stderr(), "\n%s\n", u.URL)
+			code.WriteHalfBlocks(m.stderr()) //nolint:errcheck
+		}
+	}
+}
+
+// writeURLFile replaces path with urls, one per line.  The file is
+// written beside path and renamed into place so a concurrent reader
+// never sees a partial URL.
+func writeURLFile(path string, urls []string) error {
+	tmp := path + ".tmp"
+	data := []byte(strings.Join(urls, "\n") + "\n")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
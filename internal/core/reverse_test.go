@@ -0,0 +1,47 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonc/tunnel"
+	"gonc/util"
+)
+
+// TestReverseTunnelMode_URLHandler verifies announced URLs are written
+// to --url-file and rendered as QR codes.
+func TestReverseTunnelMode_URLHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "url.txt")
+	var stderr bytes.Buffer
+	m := &ReverseTunnelMode{
+		URLFile: path,
+		URLQR:   true,
+		Logger:  util.NewLogger(0),
+		Stderr:  &stderr,
+	}
+
+	h := m.urlHandler()
+	if h == nil {
+		t.Fatal("expected a URL handler")
+	}
+	h(tunnel.PublicURL{URL: "https://abc.lhr.life"})
+	h(tunnel.PublicURL{URL: "https://abc.serveo.net"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "https://abc.lhr.life\nhttps://abc.serveo.net\n"; got != want {
+		t.Errorf("url-file = %q, want %q", got, want)
+	}
+	if !strings.Contains(stderr.String(), "https://abc.serveo.net") || !strings.Contains(stderr.String(), "█") {
+		t.Errorf("QR output missing: %q", stderr.String())
+	}
+
+	if (&ReverseTunnelMode{}).urlHandler() != nil {
+		t.Error("handler should be nil without --url-file or --url-qr")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"gonc/config"
+	"gonc/internal/audit"
+	"gonc/internal/metrics"
 	"gonc/internal/transport"
 	"gonc/util"
 )
@@ -15,20 +17,47 @@ import (
 // DialFunc establishes a network connection.
 type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
 
+// PortState is a scan's verdict on one port.
+type PortState int
+
+const (
+	PortClosed PortState = iota
+	PortOpen
+	// PortOpenFiltered is a UDP port that neither replied nor drew an
+	// ICMP port unreachable: open and silent, or firewalled.
+	PortOpenFiltered
+)
+
+func (s PortState) String() string {
+	switch s {
+	case PortOpen:
+		return "open"
+	case PortOpenFiltered:
+		return "open|filtered"
+	}
+	return "closed"
+}
+
 // ScanResult records whether a single port is open.
 type ScanResult struct {
-	Port int
-	Open bool
-	Err  error
+	Port  int
+	Open  bool // State == PortOpen
+	State PortState
+	Err   error
 }
 
-// ScanMode probes a set of TCP ports on a target host and reports
-// which are open.
+// ScanMode probes a set of TCP or UDP ports on a target host and
+// reports which are open.
 type ScanMode struct {
 	Dialer  transport.Dialer
+	Network string // "tcp" or "udp"; empty means tcp
 	Host    string
 	Ports   []int
 	Timeout time.Duration
+	Retries int                // UDP probes resent after a silent timeout
+	Gateway string             // SSH gateway host:port when tunnelled; for audit records
+	Metrics *metrics.Collector // optional; nil-safe
+	Audit   *audit.Log         // optional; records every probe for --audit-log
 	Logger  *util.Logger
 	Verbose int
 }
@@ -47,17 +76,29 @@ func (m *ScanMode) Run(ctx context.Context) error {
 		timeout = config.DefaultScanTimeout
 	}
 
-	m.Logger.Verbose("scanning %s - %d port(s)", m.Host, len(m.Ports))
+	network := m.Network
+	if network == "" {
+		network = "tcp"
+	}
+	m.Logger.Verbose("scanning %s - %d %s port(s)", m.Host, len(m.Ports), network)
 
-	results := ScanPorts(ctx, m.Host, m.Ports, timeout, m.Dialer.Dial)
+	var results []ScanResult
+	if network == "udp" {
+		results = ScanUDPPorts(ctx, m.Host, m.Ports, timeout, m.Retries, m.dial)
+	} else {
+		results = ScanPorts(ctx, m.Host, m.Ports, timeout, m.dial)
+	}
 
 	open := 0
 	for _, r := range results {
-		if r.Open {
+		switch {
+		case r.State == PortOpen:
 			open++
-			m.Logger.Info("%s %d/tcp open", m.Host, r.Port)
-		} else if m.Verbose >= 2 {
-			m.Logger.Verbose("%s %d/tcp closed - %v", m.Host, r.Port, r.Err)
+			m.Logger.Info("%s %d/%s open", m.Host, r.Port, network)
+		case r.State == PortOpenFiltered && m.Verbose >= 1:
+			m.Logger.Info("%s %d/%s open|filtered", m.Host, r.Port, network)
+		case r.State == PortClosed && m.Verbose >= 2:
+			m.Logger.Verbose("%s %d/%s closed - %v", m.Host, r.Port, network, r.Err)
 		}
 	}
 
@@ -67,9 +108,51 @@ func (m *ScanMode) Run(ctx context.Context) error {
 	return nil
 }
 
-// ScanPorts probes every port concurrently and returns results in the
-// same order as the input slice.
+// dial opens a probe connection, counting successful probes as
+// connections in the metrics collector and auditing every probe.
+func (m *ScanMode) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := m.Dialer.Dial(ctx, network, address)
+	rec := audit.Record{
+		Start:      start,
+		Mode:       "scan",
+		Remote:     address,
+		Gateway:    m.Gateway,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		m.Audit.Write(rec) //nolint:errcheck
+		return nil, err
+	}
+	if conn.LocalAddr() != nil {
+		rec.Local = conn.LocalAddr().String()
+	}
+	m.Audit.Write(rec) //nolint:errcheck
+	return metrics.TrackConn(conn, m.Metrics), nil
+}
+
+// ScanPorts probes every TCP port concurrently and returns results in
+// the same order as the input slice.  A port is open when it accepts a
+// connection.
 func ScanPorts(ctx context.Context, host string, ports []int, timeout time.Duration, dial DialFunc) []ScanResult {
+	return scanAll(ports, func(p int) ScanResult {
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		conn, err := dial(scanCtx, "tcp", util.FormatAddr(host, p))
+		if err != nil {
+			return ScanResult{Port: p, State: PortClosed, Err: err}
+		}
+		conn.Close()
+		return ScanResult{Port: p, Open: true, State: PortOpen}
+	})
+}
+
+// scanAll runs probe for every port, at most
+// DefaultMaxConcurrentScans at a time, and returns results in the
+// same order as ports.
+func scanAll(ports []int, probe func(port int) ScanResult) []ScanResult {
 	results := make([]ScanResult, len(ports))
 	sem := make(chan struct{}, config.DefaultMaxConcurrentScans)
 	var wg sync.WaitGroup
@@ -80,18 +163,7 @@ func ScanPorts(ctx context.Context, host string, ports []int, timeout time.Durat
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
-
-			addr := util.FormatAddr(host, p)
-			scanCtx, cancel := context.WithTimeout(ctx, timeout)
-			defer cancel()
-
-			conn, err := dial(scanCtx, "tcp", addr)
-			if err != nil {
-				results[idx] = ScanResult{Port: p, Open: false, Err: err}
-				return
-			}
-			conn.Close()
-			results[idx] = ScanResult{Port: p, Open: true}
+			results[idx] = probe(p)
 		}(i, port)
 	}
 
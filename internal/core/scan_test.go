@@ -1,8 +1,11 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"net"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -73,3 +76,98 @@ func TestScanPortsTimeout(t *testing.T) {
 		t.Errorf("scan took %v, expected < 3s", elapsed)
 	}
 }
+
+// TestScanUDPPorts verifies open, closed and open|filtered UDP ports
+// are told apart, and that silent ports are probed 1+retries times.
+func TestScanUDPPorts(t *testing.T) {
+	// A responder answers every datagram.
+	open, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := open.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			open.WriteTo(buf[:n], addr) //nolint:errcheck
+		}
+	}()
+
+	// A silent socket reads and never replies.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	var probes atomic.Int32
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := silent.ReadFrom(buf); err != nil {
+				return
+			}
+			probes.Add(1)
+		}
+	}()
+
+	// A port bound and released is closed: the kernel answers with
+	// ICMP port unreachable.
+	gone, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := gone.LocalAddr().(*net.UDPAddr).Port
+	gone.Close()
+
+	dialFn := func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+	ports := []int{
+		open.LocalAddr().(*net.UDPAddr).Port,
+		silent.LocalAddr().(*net.UDPAddr).Port,
+		closedPort,
+	}
+	results := ScanUDPPorts(context.Background(), "127.0.0.1", ports, 200*time.Millisecond, 1, dialFn)
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].State != PortOpen || !results[0].Open {
+		t.Errorf("responder = %v (%v), want open", results[0].State, results[0].Err)
+	}
+	if results[1].State != PortOpenFiltered {
+		t.Errorf("silent port = %v (%v), want open|filtered", results[1].State, results[1].Err)
+	}
+	if got := probes.Load(); got != 2 {
+		t.Errorf("silent port got %d probes, want 2 with one retry", got)
+	}
+	if runtime.GOOS != "windows" && results[2].State != PortClosed {
+		t.Errorf("released port = %v (%v), want closed", results[2].State, results[2].Err)
+	}
+}
+
+func TestUDPProbes(t *testing.T) {
+	// Root NS query: header, empty name, type 2, class IN.
+	want := []byte{0x67, 0x6f, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 1}
+	if got := udpProbes[53]; !bytes.Equal(got, want) {
+		t.Errorf("DNS probe = % x, want % x", got, want)
+	}
+	mdns := udpProbes[5353]
+	if !bytes.Contains(mdns, []byte("\x09_services\x07_dns-sd\x04_udp\x05local\x00")) {
+		t.Errorf("mDNS probe = % x", mdns)
+	}
+	if n := len(udpProbes[123]); n != 48 {
+		t.Errorf("NTP probe is %d bytes, want 48", n)
+	}
+	if n := len(udpProbes[137]); n != 50 {
+		t.Errorf("NetBIOS probe is %d bytes, want 50", n)
+	}
+	if p := udpProbes[161]; len(p) != int(p[1])+2 {
+		t.Errorf("SNMP probe length %d does not match its header %d", len(p), p[1])
+	}
+}
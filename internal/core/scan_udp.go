@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"gonc/util"
+)
+
+// ScanUDPPorts probes every UDP port concurrently and returns results
+// in the same order as the input slice.  Each port gets its
+// udpProbes payload over a connected socket, resent up to retries
+// times while nothing comes back within timeout:
+//
+//   - any reply means open;
+//   - an ICMP port unreachable, which a connected socket surfaces as
+//     ECONNREFUSED, means closed;
+//   - silence means open|filtered.
+//
+// Windows does not report ICMP errors on UDP sockets, so there a port
+// is open or open|filtered, never closed.
+func ScanUDPPorts(ctx context.Context, host string, ports []int, timeout time.Duration, retries int, dial DialFunc) []ScanResult {
+	return scanAll(ports, func(p int) ScanResult {
+		state, err := probeUDP(ctx, util.FormatAddr(host, p), udpProbes[p], timeout, retries, dial)
+		return ScanResult{Port: p, Open: state == PortOpen, State: state, Err: err}
+	})
+}
+
+// probeUDP sends payload to addr until it is answered or refused, or
+// retries run out.
+func probeUDP(ctx context.Context, addr string, payload []byte, timeout time.Duration, retries int, dial DialFunc) (PortState, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	conn, err := dial(dialCtx, "udp", addr)
+	cancel()
+	if err != nil {
+		return PortClosed, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if _, err := conn.Write(payload); err != nil {
+			return udpFailure(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout)) //nolint:errcheck
+		if _, err := conn.Read(buf); err == nil {
+			return PortOpen, nil
+		} else if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return udpFailure(err)
+		}
+	}
+	return PortOpenFiltered, nil
+}
+
+// udpFailure classifies a failed probe read or write.  A refusal is
+// the ICMP port unreachable of an earlier probe.
+func udpFailure(err error) (PortState, error) {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PortClosed, err
+	}
+	return PortOpenFiltered, err
+}
+
+// udpProbes are minimal, harmless requests for well-known UDP
+// services.  Other ports get an empty datagram.
+var udpProbes = map[int][]byte{
+	// DNS: standard query for the root NS records.
+	53: dnsQuery("", 2),
+	// TFTP: read request for a file that should not exist.
+	69: []byte("\x00\x01gonc-probe\x00octet\x00"),
+	// ONC RPC portmapper: NULL call, program 100000 version 2.
+	111: {
+		0x67, 0x6f, 0x6e, 0x63, // xid
+		0, 0, 0, 0, // call
+		0, 0, 0, 2, // RPC version 2
+		0, 1, 0x86, 0xa0, // program 100000
+		0, 0, 0, 2, // version 2
+		0, 0, 0, 0, // procedure 0 (NULL)
+		0, 0, 0, 0, 0, 0, 0, 0, // AUTH_NULL credentials
+		0, 0, 0, 0, 0, 0, 0, 0, // AUTH_NULL verifier
+	},
+	// NTP: version 4 client request.
+	123: append([]byte{0x23}, make([]byte, 47)...),
+	// NetBIOS name service: node status request for "*".
+	137: []byte("gn\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00" +
+		" CK" + strings.Repeat("A", 30) + "\x00\x00\x21\x00\x01"),
+	// SNMP: v1 GetRequest for sysDescr.0 with community "public".
+	161: {
+		0x30, 0x26, 0x02, 0x01, 0x00, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x19, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	},
+	// SSDP: discovery request.
+	1900: []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"),
+	// SIP: OPTIONS ping.
+	5060: []byte("OPTIONS sip:gonc SIP/2.0\r\nVia: SIP/2.0/UDP gonc;branch=z9hG4bK-gonc\r\n" +
+		"From: <sip:gonc@gonc>;tag=gonc\r\nTo: <sip:gonc@gonc>\r\nCall-ID: gonc-probe\r\n" +
+		"CSeq: 1 OPTIONS\r\nMax-Forwards: 70\r\nContent-Length: 0\r\n\r\n"),
+	// mDNS: service enumeration query.
+	5353: dnsQuery("_services._dns-sd._udp.local", 12),
+	// memcached: UDP frame header and "version".
+	11211: []byte("\x00\x00\x00\x00\x00\x01\x00\x00version\r\n"),
+}
+
+// dnsQuery builds a recursive DNS query for name (dot-separated, ""
+// for the root) and record type qtype, class IN.
+func dnsQuery(name string, qtype uint16) []byte {
+	q := []byte{0x67, 0x6f, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			q = append(q, byte(len(label)))
+			q = append(q, label...)
+		}
+	}
+	return append(q, 0, byte(qtype>>8), byte(qtype), 0, 1)
+}
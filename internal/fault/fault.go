@@ -0,0 +1,363 @@
+// Package fault injects network faults into proxied connections, for
+// gonc --proxy with --fault.
+//
+// An Injector holds one Faults set per direction: Up for data from the
+// client towards the upstream and Down for data coming back.  Wrap
+// applies them to a client connection; Read carries Up data and Write
+// carries Down data.  The sets can be replaced at any time with Set,
+// and connections already open pick up the change on their next chunk.
+// A nil *Injector is a valid no-op receiver.
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/internal/ratelimit"
+	"gonc/util"
+)
+
+// ErrInjectedReset is returned by a connection the injector reset.
+var ErrInjectedReset = errors.New("connection reset by fault injection")
+
+// Faults describes what happens to data flowing in one direction.
+// Probabilities are in [0, 1]; zero values disable a fault.
+type Faults struct {
+	Latency   time.Duration // hold every chunk this long
+	Jitter    time.Duration // plus or minus up to this much
+	Rate      int64         // bandwidth cap in bytes per second
+	Chunk     int           // split data into pieces of at most this many bytes
+	Reset     float64       // chance per chunk of resetting the connection
+	Stall     time.Duration // how long a stall lasts
+	StallProb float64       // chance per chunk of stalling
+	Corrupt   float64       // chance per byte of flipping one bit
+}
+
+// IsZero reports whether f injects nothing.
+func (f Faults) IsZero() bool { return f == Faults{} }
+
+// Validate checks that probabilities and sizes are in range.
+func (f Faults) Validate() error {
+	for name, p := range map[string]float64{"reset": f.Reset, "stall-prob": f.StallProb, "corrupt": f.Corrupt} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("%s must be between 0 and 1, got %g", name, p)
+		}
+	}
+	if f.Latency < 0 || f.Jitter < 0 || f.Stall < 0 || f.Rate < 0 || f.Chunk < 0 {
+		return fmt.Errorf("durations, rate and chunk must not be negative")
+	}
+	if (f.Stall > 0) != (f.StallProb > 0) {
+		return fmt.Errorf("stall and stall-prob must be set together")
+	}
+	return nil
+}
+
+// faultsJSON is the admin API form of Faults, with durations as
+// strings such as "150ms".
+type faultsJSON struct {
+	Latency   string  `json:"latency,omitempty"`
+	Jitter    string  `json:"jitter,omitempty"`
+	Rate      int64   `json:"rate,omitempty"`
+	Chunk     int     `json:"chunk,omitempty"`
+	Reset     float64 `json:"reset,omitempty"`
+	Stall     string  `json:"stall,omitempty"`
+	StallProb float64 `json:"stall_prob,omitempty"`
+	Corrupt   float64 `json:"corrupt,omitempty"`
+}
+
+// MarshalJSON encodes durations as Go duration strings.
+func (f Faults) MarshalJSON() ([]byte, error) {
+	dur := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return json.Marshal(faultsJSON{
+		Latency:   dur(f.Latency),
+		Jitter:    dur(f.Jitter),
+		Rate:      f.Rate,
+		Chunk:     f.Chunk,
+		Reset:     f.Reset,
+		Stall:     dur(f.Stall),
+		StallProb: f.StallProb,
+		Corrupt:   f.Corrupt,
+	})
+}
+
+// UnmarshalJSON accepts the form written by MarshalJSON.
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	var j faultsJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	dur := func(name, s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return d, nil
+	}
+	var err error
+	out := Faults{Rate: j.Rate, Chunk: j.Chunk, Reset: j.Reset, StallProb: j.StallProb, Corrupt: j.Corrupt}
+	if out.Latency, err = dur("latency", j.Latency); err != nil {
+		return err
+	}
+	if out.Jitter, err = dur("jitter", j.Jitter); err != nil {
+		return err
+	}
+	if out.Stall, err = dur("stall", j.Stall); err != nil {
+		return err
+	}
+	*f = out
+	return nil
+}
+
+// Settings is the fault set for both directions.
+type Settings struct {
+	Up   Faults `json:"up"`   // client → upstream
+	Down Faults `json:"down"` // upstream → client
+}
+
+// Validate checks both directions.
+func (s Settings) Validate() error {
+	if err := s.Up.Validate(); err != nil {
+		return fmt.Errorf("up: %w", err)
+	}
+	if err := s.Down.Validate(); err != nil {
+		return fmt.Errorf("down: %w", err)
+	}
+	return nil
+}
+
+// ── Injector ─────────────────────────────────────────────────────────
+
+// Injector applies the current Settings to wrapped connections.
+type Injector struct {
+	settings atomic.Pointer[Settings]
+
+	mu  sync.Mutex // guards rng
+	rng *rand.Rand
+}
+
+// New returns an Injector with the given settings.  A non-zero seed
+// makes the random faults reproducible.
+func New(s Settings, seed uint64) *Injector {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	inj := &Injector{rng: rand.New(rand.NewPCG(seed, seed>>1|1))}
+	inj.settings.Store(&s)
+	return inj
+}
+
+// Settings returns the faults currently applied.
+func (inj *Injector) Settings() Settings {
+	if inj == nil {
+		return Settings{}
+	}
+	return *inj.settings.Load()
+}
+
+// Set replaces the faults applied to new and open connections.
+func (inj *Injector) Set(s Settings) error {
+	if inj == nil {
+		return errors.New("fault injection is not enabled")
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	inj.settings.Store(&s)
+	return nil
+}
+
+// chance reports true with probability p.
+func (inj *Injector) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	return inj.rng.Float64() < p
+}
+
+// jitter returns a random offset in [-j, j].
+func (inj *Injector) jitter(j time.Duration) time.Duration {
+	if j <= 0 {
+		return 0
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	return time.Duration(inj.rng.Int64N(int64(2*j)+1)) - j
+}
+
+// corrupt flips one random bit in each byte of b with probability p.
+func (inj *Injector) corrupt(b []byte, p float64) {
+	if p <= 0 {
+		return
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	for i := range b {
+		if inj.rng.Float64() < p {
+			b[i] ^= 1 << inj.rng.IntN(8)
+		}
+	}
+}
+
+// Wrap returns conn with the injector's faults applied.  With a nil
+// Injector conn is returned unchanged.  Wrap the raw accepted
+// connection so an injected reset can send a TCP RST.
+func (inj *Injector) Wrap(conn net.Conn) net.Conn {
+	if inj == nil {
+		return conn
+	}
+	return &Conn{Conn: conn, inj: inj, done: make(chan struct{})}
+}
+
+// Conn is a connection with faults injected.
+type Conn struct {
+	net.Conn
+	inj      *Injector
+	up, down shaper
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wasReset  atomic.Bool
+}
+
+// WasReset reports whether conn, as returned by Wrap, was closed by
+// an injected reset.
+func WasReset(conn net.Conn) bool {
+	c, ok := conn.(*Conn)
+	return ok && c.wasReset.Load()
+}
+
+// shaper holds a direction's bandwidth bucket, rebuilt when the
+// configured rate changes.
+type shaper struct {
+	mu     sync.Mutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+func (s *shaper) take(rate int64, n int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	if s.rate != rate || s.bucket == nil {
+		s.rate, s.bucket = rate, ratelimit.NewBucket(rate)
+	}
+	b := s.bucket
+	s.mu.Unlock()
+	return b.Take(n)
+}
+
+// Read carries Up data: client → upstream.  The settings are looked
+// up again once data arrives, so a Read that was already waiting sees
+// changes made in the meantime.
+func (c *Conn) Read(p []byte) (int, error) {
+	if chunk := c.inj.settings.Load().Up.Chunk; chunk > 0 {
+		p = p[:min(len(p), chunk)]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if ferr := c.apply(c.inj.settings.Load().Up, &c.up, p[:n]); ferr != nil {
+			return 0, ferr
+		}
+	}
+	return n, err
+}
+
+// Write carries Down data: upstream → client.  Data is copied before
+// corruption so the caller's buffer is never modified.
+func (c *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		f := c.inj.settings.Load().Down
+		n := len(p)
+		if f.Chunk > 0 {
+			n = min(n, f.Chunk)
+		}
+		chunk := p[:n]
+		if f.Corrupt > 0 {
+			chunk = append([]byte(nil), chunk...)
+		}
+		if err := c.apply(f, &c.down, chunk); err != nil {
+			return written, err
+		}
+		m, err := c.Conn.Write(chunk)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// apply runs f's faults for one chunk: maybe reset, maybe stall, wait
+// out latency and bandwidth, then corrupt.
+func (c *Conn) apply(f Faults, s *shaper, b []byte) error {
+	if c.inj.chance(f.Reset) {
+		c.reset()
+		return ErrInjectedReset
+	}
+	var delay time.Duration
+	if c.inj.chance(f.StallProb) {
+		delay += f.Stall
+	}
+	if f.Latency > 0 || f.Jitter > 0 {
+		delay += max(0, f.Latency+c.inj.jitter(f.Jitter))
+	}
+	delay += s.take(f.Rate, len(b))
+	if err := c.sleep(delay); err != nil {
+		return err
+	}
+	c.inj.corrupt(b, f.Corrupt)
+	return nil
+}
+
+// sleep waits for d, returning early if the connection closes.
+func (c *Conn) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+// reset closes the connection abortively: TCP connections send a RST
+// instead of a FIN.
+func (c *Conn) reset() {
+	c.wasReset.Store(true)
+	if l, ok := c.Conn.(interface{ SetLinger(int) error }); ok {
+		l.SetLinger(0) //nolint:errcheck
+	}
+	c.Close()
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// Close closes the connection and wakes any injected delay.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,199 @@
+package fault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFaultsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		f       Faults
+		wantErr bool
+	}{
+		{"zero", Faults{}, false},
+		{"all set", Faults{Latency: time.Second, Jitter: time.Millisecond, Rate: 1024, Chunk: 10,
+			Reset: 0.1, Stall: time.Second, StallProb: 0.5, Corrupt: 1}, false},
+		{"probability above one", Faults{Reset: 1.5}, true},
+		{"negative probability", Faults{Corrupt: -0.1}, true},
+		{"negative latency", Faults{Latency: -time.Second}, true},
+		{"stall without probability", Faults{Stall: time.Second}, true},
+		{"probability without stall", Faults{StallProb: 0.1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.f.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSettingsJSON(t *testing.T) {
+	in := Settings{
+		Up:   Faults{Latency: 150 * time.Millisecond, Jitter: 20 * time.Millisecond, Chunk: 512},
+		Down: Faults{Rate: 1 << 20, Stall: 2 * time.Second, StallProb: 0.05, Corrupt: 0.001},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"latency":"150ms"`)) {
+		t.Errorf("durations should be strings: %s", data)
+	}
+	var out Settings
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+	if err := json.Unmarshal([]byte(`{"up":{"latency":"soon"}}`), &out); err == nil {
+		t.Error("bad duration should fail")
+	}
+}
+
+func TestNilInjector(t *testing.T) {
+	var inj *Injector
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if inj.Wrap(a) != a {
+		t.Error("nil injector should return the connection unchanged")
+	}
+	if inj.Set(Settings{}) == nil {
+		t.Error("Set on a nil injector should fail")
+	}
+}
+
+// pipe returns a wrapped client connection and the far end.
+func pipe(t *testing.T, s Settings) (net.Conn, net.Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	conn := New(s, 1).Wrap(a)
+	t.Cleanup(func() { conn.Close(); b.Close() })
+	return conn, b
+}
+
+func TestConnLatency(t *testing.T) {
+	conn, peer := pipe(t, Settings{Down: Faults{Latency: 100 * time.Millisecond}})
+	go io.Copy(io.Discard, peer) //nolint:errcheck
+
+	start := time.Now()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("write with 100ms latency took %v", elapsed)
+	}
+}
+
+func TestConnChunking(t *testing.T) {
+	conn, peer := pipe(t, Settings{Up: Faults{Chunk: 3}, Down: Faults{Chunk: 2}})
+
+	go peer.Write([]byte("abcdefgh")) //nolint:errcheck
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || n != 3 {
+		t.Errorf("Read = %d, %v; want 3 bytes", n, err)
+	}
+
+	got := make(chan []int, 1)
+	go func() {
+		var sizes []int
+		buf := make([]byte, 64)
+		for len(sizes) < 3 {
+			n, err := peer.Read(buf)
+			if err != nil {
+				break
+			}
+			sizes = append(sizes, n)
+		}
+		got <- sizes
+	}()
+	if n, err := conn.Write([]byte("12345")); n != 5 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if sizes := <-got; len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 {
+		t.Errorf("peer saw writes of %v, want [2 2 1]", sizes)
+	}
+}
+
+func TestConnCorrupt(t *testing.T) {
+	conn, peer := pipe(t, Settings{Down: Faults{Corrupt: 1}})
+
+	sent := []byte("payload")
+	orig := append([]byte(nil), sent...)
+	go conn.Write(sent) //nolint:errcheck
+
+	buf := make([]byte, len(sent))
+	if _, err := io.ReadFull(peer, buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := range buf {
+		if diff := buf[i] ^ orig[i]; diff == 0 || diff&(diff-1) != 0 {
+			t.Errorf("byte %d: %08b vs %08b, want exactly one flipped bit", i, buf[i], orig[i])
+		}
+	}
+	if !bytes.Equal(sent, orig) {
+		t.Error("caller's buffer was modified")
+	}
+}
+
+func TestConnReset(t *testing.T) {
+	conn, peer := pipe(t, Settings{Up: Faults{Reset: 1}})
+
+	go peer.Write([]byte("x")) //nolint:errcheck
+	if _, err := conn.Read(make([]byte, 8)); !errors.Is(err, ErrInjectedReset) {
+		t.Fatalf("Read = %v, want ErrInjectedReset", err)
+	}
+	if !WasReset(conn) || WasReset(peer) {
+		t.Error("WasReset should report only the reset connection")
+	}
+	if _, err := peer.Read(make([]byte, 8)); err == nil {
+		t.Error("peer should see the connection closed")
+	}
+}
+
+func TestSetAppliesToOpenConns(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	inj := New(Settings{}, 1)
+	conn := inj.Wrap(a)
+	defer conn.Close()
+	go io.Copy(io.Discard, b) //nolint:errcheck
+
+	if err := inj.Set(Settings{Down: Faults{Reset: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("x")); !errors.Is(err, ErrInjectedReset) {
+		t.Errorf("Write after Set = %v, want ErrInjectedReset", err)
+	}
+	if err := inj.Set(Settings{Up: Faults{Reset: 3}}); err == nil {
+		t.Error("Set should reject invalid settings")
+	}
+}
+
+func TestCloseWakesStall(t *testing.T) {
+	conn, peer := pipe(t, Settings{Down: Faults{Stall: time.Hour, StallProb: 1}})
+	go io.Copy(io.Discard, peer) //nolint:errcheck
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("x"))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("stalled write should fail after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not wake the stalled write")
+	}
+}
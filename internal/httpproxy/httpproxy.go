@@ -0,0 +1,162 @@
+// Package httpproxy holds the protocol pieces of the --http-proxy
+// forward proxy: proxy Basic authentication, the destination a request
+// names, the allowed-destination Policy, hop-by-hop header removal and
+// the proxy's own error responses.  capability.HTTPProxy drives them.
+//
+// Two request forms are served: CONNECT host:port, which becomes a
+// raw tunnel, and plain http:// requests in absolute-URI form, which
+// are forwarded one at a time.
+package httpproxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotAllowed is returned by [Policy.Allow] for a refused
+	// destination.
+	ErrNotAllowed = errors.New("httpproxy: destination not allowed")
+	// ErrBadTarget is returned by [Target] for requests that name no
+	// usable destination.
+	ErrBadTarget = errors.New("httpproxy: bad request target")
+	// ErrUnsupportedScheme is returned by [Target] for absolute URIs
+	// other than http://; clients tunnel https:// with CONNECT.
+	ErrUnsupportedScheme = errors.New("httpproxy: unsupported scheme")
+)
+
+// Realm is announced in Proxy-Authenticate challenges.
+const Realm = "gonc"
+
+// ── Requests ─────────────────────────────────────────────────────────
+
+// Target returns the host:port a proxy request is for: the authority
+// of a CONNECT, or the host of an absolute http:// URI with port 80
+// when none is given.
+func Target(r *http.Request) (string, error) {
+	if r.Method == http.MethodConnect {
+		host, port, err := net.SplitHostPort(r.RequestURI)
+		if err != nil || host == "" || !validPort(port) {
+			return "", fmt.Errorf("%w: CONNECT %q", ErrBadTarget, r.RequestURI)
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+	if !r.URL.IsAbs() {
+		return "", fmt.Errorf("%w: %q is not an absolute URI", ErrBadTarget, r.RequestURI)
+	}
+	if r.URL.Scheme != "http" {
+		return "", fmt.Errorf("%w %q", ErrUnsupportedScheme, r.URL.Scheme)
+	}
+	host, port := r.URL.Hostname(), r.URL.Port()
+	if port == "" {
+		port = "80"
+	}
+	if host == "" || !validPort(port) {
+		return "", fmt.Errorf("%w: %q", ErrBadTarget, r.RequestURI)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// Authenticate checks the request's Proxy-Authorization against users
+// and returns the user name.  With no users every request passes.
+func Authenticate(r *http.Request, users map[string]string) (string, bool) {
+	if len(users) == 0 {
+		return "", true
+	}
+	user, pass, ok := parseBasic(r.Header.Get("Proxy-Authorization"))
+	if !ok {
+		return "", false
+	}
+	want, known := users[user]
+	// Compare even for unknown users so timing does not reveal them.
+	match := subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1
+	return user, known && match
+}
+
+// parseBasic decodes a Basic credential the way net/http does for
+// Authorization, by borrowing Request.BasicAuth.
+func parseBasic(v string) (user, pass string, ok bool) {
+	r := &http.Request{Header: http.Header{"Authorization": {v}}}
+	return r.BasicAuth()
+}
+
+// hopHeaders are meaningful only for a single connection and are never
+// forwarded (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders deletes hop-by-hop headers from h, including any
+// named by its Connection header.
+func RemoveHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// ── Responses ────────────────────────────────────────────────────────
+
+// Established is the reply to a CONNECT once the upstream is open.
+const Established = "HTTP/1.1 200 Connection established\r\n\r\n"
+
+// WriteError answers with status and a one-line text body.  A 407
+// carries the Basic challenge.  With close set the response asks the
+// client to close the connection.
+func WriteError(w io.Writer, status int, msg string, close bool) error {
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		ContentLength: int64(len(msg) + 1),
+		Body:          io.NopCloser(strings.NewReader(msg + "\n")),
+		Close:         close,
+	}
+	if status == http.StatusProxyAuthRequired {
+		resp.Header.Set("Proxy-Authenticate", `Basic realm="`+Realm+`"`)
+	}
+	return resp.Write(w)
+}
+
+// ErrorStatus maps a failure to serve a request to the status the
+// client is sent.
+func ErrorStatus(err error) int {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnsupportedScheme):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrBadTarget):
+		return http.StatusBadRequest
+	case errors.As(err, &ne) && ne.Timeout():
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,191 @@
+package httpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func readRequest(t *testing.T, raw string) *http.Request {
+	t.Helper()
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("ReadRequest(%q): %v", raw, err)
+	}
+	return r
+}
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    string
+		wantErr error
+	}{
+		{"CONNECT example.com:443 HTTP/1.1", "example.com:443", nil},
+		{"CONNECT [::1]:8443 HTTP/1.1", "[::1]:8443", nil},
+		{"CONNECT example.com HTTP/1.1", "", ErrBadTarget},
+		{"CONNECT example.com:0 HTTP/1.1", "", ErrBadTarget},
+		{"GET http://example.com/a?b HTTP/1.1", "example.com:80", nil},
+		{"GET http://example.com:8080/ HTTP/1.1", "example.com:8080", nil},
+		{"GET /local HTTP/1.1", "", ErrBadTarget},
+		{"GET ftp://example.com/ HTTP/1.1", "", ErrUnsupportedScheme},
+		{"GET https://example.com/ HTTP/1.1", "", ErrUnsupportedScheme},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			r := readRequest(t, tt.line+"\r\nHost: example.com\r\n\r\n")
+			got, err := Target(r)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Target = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	users := map[string]string{"alice": "s3cret"}
+	basic := func(user, pass string) string {
+		r := &http.Request{Header: http.Header{}}
+		r.SetBasicAuth(user, pass)
+		return r.Header.Get("Authorization")
+	}
+	tests := []struct {
+		name     string
+		users    map[string]string
+		header   string
+		wantUser string
+		wantOK   bool
+	}{
+		{"no users", nil, "", "", true},
+		{"valid", users, basic("alice", "s3cret"), "alice", true},
+		{"wrong password", users, basic("alice", "guess"), "alice", false},
+		{"unknown user", users, basic("bob", "s3cret"), "bob", false},
+		{"missing", users, "", "", false},
+		{"not basic", users, "Bearer abc", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}}
+			if tt.header != "" {
+				r.Header.Set("Proxy-Authorization", tt.header)
+			}
+			user, ok := Authenticate(r, tt.users)
+			if user != tt.wantUser || ok != tt.wantOK {
+				t.Errorf("Authenticate = %q, %v; want %q, %v", user, ok, tt.wantUser, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	h := http.Header{
+		"Connection":          {"close, X-Hop"},
+		"X-Hop":               {"1"},
+		"Proxy-Authorization": {"Basic xyz"},
+		"Keep-Alive":          {"timeout=5"},
+		"Content-Type":        {"text/plain"},
+	}
+	RemoveHopHeaders(h)
+	if len(h) != 1 || h.Get("Content-Type") != "text/plain" {
+		t.Errorf("headers after RemoveHopHeaders = %v, want only Content-Type", h)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteError(&buf, http.StatusProxyAuthRequired, "login", true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired || !resp.Close {
+		t.Errorf("status = %d close = %v", resp.StatusCode, resp.Close)
+	}
+	if got := resp.Header.Get("Proxy-Authenticate"); got != `Basic realm="gonc"` {
+		t.Errorf("Proxy-Authenticate = %q", got)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: x", ErrNotAllowed), http.StatusForbidden},
+		{fmt.Errorf("%w: x", ErrUnsupportedScheme), http.StatusNotImplemented},
+		{fmt.Errorf("%w: x", ErrBadTarget), http.StatusBadRequest},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errors.New("connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if got := ErrorStatus(tt.err); got != tt.want {
+			t.Errorf("ErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"example.com", false},
+		{"*.example.com", false},
+		{"10.0.0.0/8", false},
+		{"::1", false},
+		{"", true},
+		{"10.0.0.0/40", true},
+		{"*.*.example.com", true},
+		{"ex*ample.com", true},
+		{"example.com:443", true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseHost(tt.pattern); (err != nil) != tt.wantErr {
+			t.Errorf("ParseHost(%q) = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPolicyAllow(t *testing.T) {
+	p := &Policy{Ports: []int{80, 443}}
+	for _, pattern := range []string{"example.com", "*.corp.internal", "10.0.0.0/8"} {
+		r, err := ParseHost(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Hosts = append(p.Hosts, r)
+	}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"example.com:443", true},
+		{"EXAMPLE.com.:80", true},
+		{"www.example.com:443", false},
+		{"git.corp.internal:443", true},
+		{"corp.internal:443", false},
+		{"10.1.2.3:80", true},
+		{"11.1.2.3:80", false},
+		{"example.com:22", false},
+	}
+	for _, tt := range tests {
+		err := p.Allow(tt.target)
+		if (err == nil) != tt.want {
+			t.Errorf("Allow(%q) = %v, want allowed %v", tt.target, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("Allow(%q) error %v does not wrap ErrNotAllowed", tt.target, err)
+		}
+	}
+	var nilPolicy *Policy
+	if err := nilPolicy.Allow("anything:1"); err != nil {
+		t.Errorf("nil Policy refused: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package httpproxy
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+
+	"gonc/internal/socks5"
+)
+
+// Policy limits the destinations the proxy dials.  An empty Ports or
+// Hosts list allows any port or host.  A nil *Policy allows
+// everything.
+//
+// Hosts are --socks-allow rules without a port.  Unlike SOCKS, names
+// are matched as the client sent them and never resolved, so an IP or
+// CIDR rule only admits requests for IP literals.
+type Policy struct {
+	Ports []int
+	Hosts []socks5.Rule
+}
+
+// ParseHost parses a --http-proxy-hosts pattern: a host name,
+// "*.example.com", an IP or a CIDR.
+func ParseHost(pattern string) (socks5.Rule, error) {
+	r, err := socks5.ParseRule(pattern)
+	if err != nil {
+		return socks5.Rule{}, err
+	}
+	if r.Port != 0 {
+		return socks5.Rule{}, fmt.Errorf("host pattern %q: ports go in --http-proxy-ports", pattern)
+	}
+	return r, nil
+}
+
+// Allow reports whether host:port may be dialled, with an error
+// wrapping ErrNotAllowed when not.
+func (p *Policy) Allow(target string) error {
+	if p == nil {
+		return nil
+	}
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotAllowed, target, err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	if len(p.Ports) > 0 && !slices.Contains(p.Ports, port) {
+		return fmt.Errorf("%w: port %d of %s is not in the allowed ports", ErrNotAllowed, port, target)
+	}
+	if len(p.Hosts) > 0 && !slices.ContainsFunc(p.Hosts, func(r socks5.Rule) bool { return r.Match(host, port) }) {
+		return fmt.Errorf("%w: host %s is not in the allowed hosts", ErrNotAllowed, host)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net"
+	"sync"
+
+	"gonc/util"
+)
+
+// TrackConn wraps conn so that it counts as an active connection until
+// closed and its reads and writes feed BytesReceived and BytesSent.
+// With a nil collector conn is returned unchanged.
+func TrackConn(conn net.Conn, c *Collector) net.Conn {
+	if c == nil {
+		return conn
+	}
+	c.ConnectionOpened()
+	return &trackedConn{Conn: conn, c: c}
+}
+
+type trackedConn struct {
+	net.Conn
+	c    *Collector
+	once sync.Once
+}
+
+func (t *trackedConn) Read(p []byte) (int, error) {
+	n, err := t.Conn.Read(p)
+	t.c.BytesReceived(int64(n))
+	return n, err
+}
+
+func (t *trackedConn) Write(p []byte) (int, error) {
+	n, err := t.Conn.Write(p)
+	t.c.BytesSent(int64(n))
+	return n, err
+}
+
+// Close closes the connection and, the first time, marks it finished.
+func (t *trackedConn) Close() error {
+	t.once.Do(t.c.ConnectionClosed)
+	return t.Conn.Close()
+}
+
+// CloseWrite half-closes the connection when supported.
+func (t *trackedConn) CloseWrite() error { return util.CloseWrite(t.Conn) }
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Bucket upper bounds, in seconds.  Latencies (dials, handshakes,
+// keepalive round trips) are short; connections can last for hours.
+var (
+	latencyBuckets  = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	durationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600, 14400}
+)
+
+// Histogram counts observed durations in fixed buckets.  Like the rest
+// of the collector it is lock-free; a snapshot taken during an Observe
+// may be off by that one observation.
+type Histogram struct {
+	bounds []float64      // upper bounds in seconds, ascending
+	counts []atomic.Int64 // per bucket (not cumulative); last is +Inf
+	count  atomic.Int64
+	sumNs  atomic.Int64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// Observe records one duration.
+func (h *Histogram) Observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+	s := d.Seconds()
+	i := 0
+	for i < len(h.bounds) && s > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+// BucketCount is the cumulative number of observations at or below LE
+// seconds.
+type BucketCount struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// HistogramSnapshot is a point-in-time view of a Histogram.  The
+// quantiles are estimated by linear interpolation within buckets.
+type HistogramSnapshot struct {
+	Count   int64         `json:"count"`
+	Sum     float64       `json:"sum_seconds"`
+	P50     float64       `json:"p50_seconds"`
+	P90     float64       `json:"p90_seconds"`
+	P99     float64       `json:"p99_seconds"`
+	Buckets []BucketCount `json:"buckets"` // finite bounds only; Count covers +Inf
+}
+
+// Snapshot returns the current bucket counts and quantile estimates.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	if h == nil {
+		return HistogramSnapshot{}
+	}
+	s := HistogramSnapshot{
+		Sum:     time.Duration(h.sumNs.Load()).Seconds(),
+		Buckets: make([]BucketCount, len(h.bounds)),
+	}
+	var cum int64
+	for i, b := range h.bounds {
+		cum += h.counts[i].Load()
+		s.Buckets[i] = BucketCount{LE: b, Count: cum}
+	}
+	s.Count = cum + h.counts[len(h.bounds)].Load()
+	s.P50 = s.quantile(0.50)
+	s.P90 = s.quantile(0.90)
+	s.P99 = s.quantile(0.99)
+	return s
+}
+
+// quantile estimates the q-th quantile from the cumulative buckets.
+// Observations beyond the last bound are reported as that bound.
+func (s HistogramSnapshot) quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	lower, below := 0.0, int64(0)
+	for _, b := range s.Buckets {
+		if float64(b.Count) >= rank {
+			in := b.Count - below
+			if in == 0 {
+				return b.LE
+			}
+			return lower + (b.LE-lower)*(rank-float64(below))/float64(in)
+		}
+		lower, below = b.LE, b.Count
+	}
+	return s.Buckets[len(s.Buckets)-1].LE
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the collector over HTTP:
+//
+//	GET /metrics  Prometheus text exposition
+//	GET /healthz  200 while healthy, 503 while the tunnel is down
+func Handler(c *Collector) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.WritePrometheus(w) //nolint:errcheck
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		status := struct {
+			Status string `json:"status"`
+			Tunnel string `json:"tunnel,omitempty"`
+			Uptime string `json:"uptime"`
+		}{Status: "ok"}
+
+		snap := c.Snapshot()
+		status.Tunnel, status.Uptime = snap.TunnelState, snap.Uptime
+		code := http.StatusOK
+		if up, known := c.TunnelUp(); known && !up {
+			status.Status, code = "unavailable", http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status) //nolint:errcheck
+	})
+	return mux
+}
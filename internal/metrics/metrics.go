@@ -7,6 +7,7 @@ package metrics
 
 import (
 	"encoding/json"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,17 +22,32 @@ type Collector struct {
 	bytesOut          atomic.Int64
 	tunnelReconnects  atomic.Int64
 	errorsTotal       atomic.Int64
+	tunnelState       atomic.Int32    // tunnelUnknown, tunnelUp or tunnelDown
+	httpRequests      [6]atomic.Int64 // --http-proxy requests by status class, 1xx–5xx
+
+	connDuration *Histogram
+	dialLatency  *Histogram
+	handshake    *Histogram
+	keepaliveRTT *Histogram
 
 	mu              sync.RWMutex
 	startTime       time.Time
 	lastHealthCheck time.Time
 	lastError       time.Time
 	lastErrorMsg    string
+	records         []ConnRecord // ring of recent connections
+	recordNext      int          // ring slot written next
 }
 
 // New creates a metrics collector with the start time set to now.
 func New() *Collector {
-	return &Collector{startTime: time.Now()}
+	return &Collector{
+		startTime:    time.Now(),
+		connDuration: newHistogram(durationBuckets),
+		dialLatency:  newHistogram(latencyBuckets),
+		handshake:    newHistogram(latencyBuckets),
+		keepaliveRTT: newHistogram(latencyBuckets),
+	}
 }
 
 // ── Connection metrics ───────────────────────────────────────────────
@@ -113,6 +129,41 @@ func (c *Collector) TunnelReconnect() {
 	c.tunnelReconnects.Add(1)
 }
 
+// Tunnel states reported by SetTunnelUp.
+const (
+	tunnelUnknown int32 = iota // no tunnel in this mode
+	tunnelUp
+	tunnelDown
+)
+
+// SetTunnelUp records whether the SSH tunnel is currently connected.
+// Modes without a tunnel never call it, and report no tunnel state.
+func (c *Collector) SetTunnelUp(up bool) {
+	if c == nil {
+		return
+	}
+	if up {
+		c.tunnelState.Store(tunnelUp)
+	} else {
+		c.tunnelState.Store(tunnelDown)
+	}
+}
+
+// TunnelUp reports the last recorded tunnel state.  known is false
+// when no tunnel has reported yet.
+func (c *Collector) TunnelUp() (up, known bool) {
+	if c == nil {
+		return false, false
+	}
+	switch c.tunnelState.Load() {
+	case tunnelUp:
+		return true, true
+	case tunnelDown:
+		return false, true
+	}
+	return false, false
+}
+
 // TunnelReconnects returns the total tunnel reconnection count.
 func (c *Collector) TunnelReconnects() int64 {
 	if c == nil {
@@ -121,6 +172,48 @@ func (c *Collector) TunnelReconnects() int64 {
 	return c.tunnelReconnects.Load()
 }
 
+// ── Latency metrics ──────────────────────────────────────────────────
+
+// ObserveDialLatency records how long dialing the local service took.
+func (c *Collector) ObserveDialLatency(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.dialLatency.Observe(d)
+}
+
+// ObserveHandshake records the time from TCP dial to a completed SSH
+// handshake with the gateway.
+func (c *Collector) ObserveHandshake(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.handshake.Observe(d)
+}
+
+// ObserveKeepalive records the round-trip time of an SSH keepalive.
+func (c *Collector) ObserveKeepalive(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.keepaliveRTT.Observe(d)
+}
+
+// Histograms returns snapshots of the latency and duration histograms
+// keyed by name: connection_duration, local_dial_latency,
+// ssh_handshake and keepalive_rtt.
+func (c *Collector) Histograms() map[string]HistogramSnapshot {
+	if c == nil {
+		return nil
+	}
+	return map[string]HistogramSnapshot{
+		"connection_duration": c.connDuration.Snapshot(),
+		"local_dial_latency":  c.dialLatency.Snapshot(),
+		"ssh_handshake":       c.handshake.Snapshot(),
+		"keepalive_rtt":       c.keepaliveRTT.Snapshot(),
+	}
+}
+
 // ── Error metrics ────────────────────────────────────────────────────
 
 // RecordError increments the error counter and stores the message.
@@ -143,6 +236,35 @@ func (c *Collector) ErrorCount() int64 {
 	return c.errorsTotal.Load()
 }
 
+// ── HTTP proxy ───────────────────────────────────────────────────────
+
+// RecordHTTPRequest counts one --http-proxy request by the class of the
+// status it was answered with.
+func (c *Collector) RecordHTTPRequest(status int) {
+	if c == nil || status < 100 || status > 599 {
+		return
+	}
+	c.httpRequests[status/100].Add(1)
+}
+
+// HTTPRequests returns the --http-proxy request counts keyed by status
+// class, e.g. "2xx".  Classes with no requests are omitted.
+func (c *Collector) HTTPRequests() map[string]int64 {
+	if c == nil {
+		return nil
+	}
+	var counts map[string]int64
+	for class := 1; class < len(c.httpRequests); class++ {
+		if n := c.httpRequests[class].Load(); n > 0 {
+			if counts == nil {
+				counts = make(map[string]int64)
+			}
+			counts[strconv.Itoa(class)+"xx"] = n
+		}
+	}
+	return counts
+}
+
 // ── Health ───────────────────────────────────────────────────────────
 
 // RecordHealthCheck updates the last health check timestamp.
@@ -166,9 +288,17 @@ type Snapshot struct {
 	BytesOut          int64  `json:"bytes_out"`
 	TunnelReconnects  int64  `json:"tunnel_reconnects"`
 	ErrorsTotal       int64  `json:"errors_total"`
+	TunnelState       string `json:"tunnel_state,omitempty"` // "up", "down", or empty without a tunnel
 	LastHealthCheck   string `json:"last_health_check,omitempty"`
 	LastError         string `json:"last_error,omitempty"`
 	LastErrorMessage  string `json:"last_error_message,omitempty"`
+
+	// HTTPRequests counts --http-proxy requests by status class.
+	HTTPRequests map[string]int64 `json:"http_requests,omitempty"`
+
+	// Histograms holds only the histograms with observations.
+	Histograms        map[string]HistogramSnapshot `json:"histograms,omitempty"`
+	RecentConnections []ConnRecord                 `json:"recent_connections,omitempty"`
 }
 
 // Snapshot returns a copy of all current metrics.
@@ -187,6 +317,13 @@ func (c *Collector) Snapshot() Snapshot {
 		BytesOut:          c.bytesOut.Load(),
 		TunnelReconnects:  c.tunnelReconnects.Load(),
 		ErrorsTotal:       c.errorsTotal.Load(),
+		HTTPRequests:      c.HTTPRequests(),
+	}
+	if up, known := c.TunnelUp(); known {
+		s.TunnelState = "down"
+		if up {
+			s.TunnelState = "up"
+		}
 	}
 	if !c.lastHealthCheck.IsZero() {
 		s.LastHealthCheck = c.lastHealthCheck.Format(time.RFC3339)
@@ -195,6 +332,16 @@ func (c *Collector) Snapshot() Snapshot {
 		s.LastError = c.lastError.Format(time.RFC3339)
 		s.LastErrorMessage = c.lastErrorMsg
 	}
+	for name, h := range c.Histograms() {
+		if h.Count == 0 {
+			continue
+		}
+		if s.Histograms == nil {
+			s.Histograms = make(map[string]HistogramSnapshot)
+		}
+		s.Histograms[name] = h
+	}
+	s.RecentConnections = c.recentLocked()
 	return s
 }
 
@@ -2,7 +2,13 @@ package metrics
 
 import (
 	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCollector_Connections(t *testing.T) {
@@ -125,6 +131,23 @@ func TestNilCollector_NoOps(t *testing.T) {
 	c.TunnelReconnect()
 	c.RecordError("test")
 	c.RecordHealthCheck()
+	c.SetTunnelUp(true)
+
+	if _, known := c.TunnelUp(); known {
+		t.Error("nil collector should report no tunnel state")
+	}
+	if c.WritePrometheus(io.Discard) != nil {
+		t.Error("nil collector should still write metrics")
+	}
+	c.ObserveDialLatency(time.Millisecond)
+	c.RecordConnection(ConnRecord{Peer: "x"})
+	c.RecordHTTPRequest(200)
+	if c.RecentConnections() != nil || c.Histograms() != nil || c.HTTPRequests() != nil {
+		t.Error("nil collector should have no records or histograms")
+	}
+	if conn := TrackConn(nil, c); conn != nil {
+		t.Error("TrackConn with a nil collector should return conn unchanged")
+	}
 
 	if c.ActiveConnections() != 0 {
 		t.Error("nil collector should return 0")
@@ -146,3 +169,228 @@ func TestNilCollector_NoOps(t *testing.T) {
 		t.Error("nil JSON should return valid JSON")
 	}
 }
+
+func TestCollector_TunnelState(t *testing.T) {
+	c := New()
+	if _, known := c.TunnelUp(); known {
+		t.Error("fresh collector should have no tunnel state")
+	}
+	if c.Snapshot().TunnelState != "" {
+		t.Error("snapshot should omit tunnel state without a tunnel")
+	}
+
+	c.SetTunnelUp(true)
+	if up, known := c.TunnelUp(); !up || !known {
+		t.Errorf("TunnelUp = %v, %v; want true, true", up, known)
+	}
+	c.SetTunnelUp(false)
+	if got := c.Snapshot().TunnelState; got != "down" {
+		t.Errorf("tunnel state = %q, want down", got)
+	}
+}
+
+func TestCollector_WritePrometheus(t *testing.T) {
+	c := New()
+	c.ConnectionOpened()
+	c.BytesReceived(1500)
+	c.RecordError("boom")
+
+	var b strings.Builder
+	if err := c.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE gonc_connections_active gauge\ngonc_connections_active 1\n",
+		"# TYPE gonc_bytes_received_total counter\ngonc_bytes_received_total 1500\n",
+		"gonc_errors_total 1\n",
+		"gonc_uptime_seconds ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "gonc_tunnel_up") {
+		t.Error("gonc_tunnel_up should be absent without a tunnel")
+	}
+
+	if strings.Contains(out, "gonc_http_proxy_requests_total") {
+		t.Error("gonc_http_proxy_requests_total should be absent without requests")
+	}
+
+	c.SetTunnelUp(true)
+	c.RecordHTTPRequest(200)
+	c.RecordHTTPRequest(204)
+	c.RecordHTTPRequest(407)
+	c.RecordHTTPRequest(42) // not a status; ignored
+	b.Reset()
+	c.WritePrometheus(&b) //nolint:errcheck
+	for _, want := range []string{
+		"gonc_tunnel_up 1\n",
+		"# TYPE gonc_http_proxy_requests_total counter\n" +
+			`gonc_http_proxy_requests_total{code="2xx"} 2` + "\n" +
+			`gonc_http_proxy_requests_total{code="4xx"} 1` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := New()
+	srv := httptest.NewServer(Handler(c))
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/metrics"); code != 200 || !strings.Contains(body, "gonc_connections_total") {
+		t.Errorf("/metrics = %d %q", code, body)
+	}
+	if code, _ := get("/healthz"); code != 200 {
+		t.Errorf("/healthz without tunnel = %d, want 200", code)
+	}
+
+	c.SetTunnelUp(false)
+	if code, body := get("/healthz"); code != 503 || !strings.Contains(body, `"tunnel":"down"`) {
+		t.Errorf("/healthz with tunnel down = %d %q", code, body)
+	}
+	c.SetTunnelUp(true)
+	if code, _ := get("/healthz"); code != 200 {
+		t.Errorf("/healthz with tunnel up = %d, want 200", code)
+	}
+}
+
+func TestTrackConn(t *testing.T) {
+	c := New()
+	a, b := net.Pipe()
+	defer b.Close()
+
+	conn := TrackConn(a, c)
+	if c.ActiveConnections() != 1 {
+		t.Fatalf("active = %d, want 1", c.ActiveConnections())
+	}
+
+	go b.Write([]byte("hello")) //nolint:errcheck
+	buf := make([]byte, 5)
+	io.ReadFull(conn, buf)             //nolint:errcheck
+	go io.ReadFull(b, make([]byte, 3)) //nolint:errcheck
+	conn.Write([]byte("abc"))          //nolint:errcheck
+
+	conn.Close()
+	conn.Close() // idempotent
+	if c.TotalBytesIn() != 5 || c.TotalBytesOut() != 3 {
+		t.Errorf("bytes in/out = %d/%d, want 5/3", c.TotalBytesIn(), c.TotalBytesOut())
+	}
+	if c.ActiveConnections() != 0 {
+		t.Errorf("active after close = %d, want 0", c.ActiveConnections())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{0.01, 0.1, 1})
+	for _, d := range []time.Duration{
+		5 * time.Millisecond, 5 * time.Millisecond,
+		50 * time.Millisecond, 50 * time.Millisecond,
+		500 * time.Millisecond, 5 * time.Second,
+	} {
+		h.Observe(d)
+	}
+
+	s := h.Snapshot()
+	if s.Count != 6 {
+		t.Errorf("count = %d, want 6", s.Count)
+	}
+	if s.Sum < 5.6 || s.Sum > 5.62 {
+		t.Errorf("sum = %v, want 5.61", s.Sum)
+	}
+	wantCum := []int64{2, 4, 5}
+	for i, b := range s.Buckets {
+		if b.Count != wantCum[i] {
+			t.Errorf("bucket le=%v count = %d, want %d", b.LE, b.Count, wantCum[i])
+		}
+	}
+	// The 3rd of 6 observations falls halfway into the (0.01, 0.1] bucket.
+	if s.P50 < 0.05 || s.P50 > 0.06 {
+		t.Errorf("p50 = %v, want ~0.055", s.P50)
+	}
+	// Overflow observations report the last bound.
+	if s.P99 != 1 {
+		t.Errorf("p99 = %v, want 1", s.P99)
+	}
+
+	if empty := newHistogram(latencyBuckets).Snapshot(); empty.Count != 0 || empty.P50 != 0 {
+		t.Errorf("empty snapshot = %+v", empty)
+	}
+}
+
+func TestCollector_RecentConnections(t *testing.T) {
+	c := New()
+	if c.Snapshot().RecentConnections != nil {
+		t.Error("fresh collector should have no records")
+	}
+
+	n := connRecordLimit + 5
+	for i := 0; i < n; i++ {
+		c.RecordConnection(ConnRecord{BytesIn: int64(i), Duration: time.Second, CloseReason: "eof"})
+	}
+
+	recs := c.RecentConnections()
+	if len(recs) != connRecordLimit {
+		t.Fatalf("kept %d records, want %d", len(recs), connRecordLimit)
+	}
+	if recs[0].BytesIn != 5 || recs[len(recs)-1].BytesIn != int64(n-1) {
+		t.Errorf("ring order = %d..%d, want 5..%d", recs[0].BytesIn, recs[len(recs)-1].BytesIn, n-1)
+	}
+
+	snap := c.Snapshot()
+	if h := snap.Histograms["connection_duration"]; h.Count != int64(n) {
+		t.Errorf("connection_duration count = %d, want %d", h.Count, n)
+	}
+	if _, ok := snap.Histograms["ssh_handshake"]; ok {
+		t.Error("snapshot should omit histograms without observations")
+	}
+
+	data, err := json.Marshal(recs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"duration":"1s"`) || !strings.Contains(string(data), `"close_reason":"eof"`) {
+		t.Errorf("record JSON = %s", data)
+	}
+}
+
+func TestCollector_WritePrometheusHistograms(t *testing.T) {
+	c := New()
+	c.ObserveKeepalive(30 * time.Millisecond)
+	c.ObserveHandshake(2 * time.Second)
+
+	var b strings.Builder
+	if err := c.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE gonc_keepalive_rtt_seconds histogram\n",
+		`gonc_keepalive_rtt_seconds_bucket{le="0.025"} 0` + "\n",
+		`gonc_keepalive_rtt_seconds_bucket{le="0.05"} 1` + "\n",
+		`gonc_keepalive_rtt_seconds_bucket{le="+Inf"} 1` + "\n",
+		"gonc_keepalive_rtt_seconds_sum 0.03\n",
+		"gonc_ssh_handshake_seconds_count 1\n",
+		"gonc_local_dial_seconds_count 0\n",
+		"gonc_connection_duration_seconds_count 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WritePrometheus writes all metrics in the Prometheus text exposition
+// format (version 0.0.4).  Metric names carry the "gonc_" prefix.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	metric := func(name, typ, help string, value float64) {
+		bw.WriteString("# HELP " + name + " " + help + "\n")
+		bw.WriteString("# TYPE " + name + " " + typ + "\n")
+		bw.WriteString(name + " " + formatFloat(value) + "\n")
+	}
+
+	metric("gonc_connections_active", "gauge",
+		"Connections currently open.", float64(c.ActiveConnections()))
+	metric("gonc_connections_total", "counter",
+		"Connections opened since start.", float64(c.TotalConnections()))
+	metric("gonc_bytes_received_total", "counter",
+		"Bytes read from the network.", float64(c.TotalBytesIn()))
+	metric("gonc_bytes_sent_total", "counter",
+		"Bytes written to the network.", float64(c.TotalBytesOut()))
+	metric("gonc_tunnel_reconnects_total", "counter",
+		"SSH tunnel reconnections.", float64(c.TunnelReconnects()))
+	metric("gonc_errors_total", "counter",
+		"Errors recorded.", float64(c.ErrorCount()))
+
+	if c != nil {
+		c.mu.RLock()
+		start, lastHealth := c.startTime, c.lastHealthCheck
+		c.mu.RUnlock()
+
+		metric("gonc_uptime_seconds", "gauge",
+			"Seconds since gonc started.", time.Since(start).Seconds())
+		if !lastHealth.IsZero() {
+			metric("gonc_last_health_check_timestamp_seconds", "gauge",
+				"Unix time of the last successful tunnel health check.",
+				float64(lastHealth.UnixNano())/1e9)
+		}
+	}
+	if up, known := c.TunnelUp(); known {
+		v := 0.0
+		if up {
+			v = 1
+		}
+		metric("gonc_tunnel_up", "gauge",
+			"Whether the SSH tunnel is connected (1) or down (0).", v)
+	}
+
+	if reqs := c.HTTPRequests(); len(reqs) > 0 {
+		name := "gonc_http_proxy_requests_total"
+		bw.WriteString("# HELP " + name + " HTTP proxy requests by response status class.\n")
+		bw.WriteString("# TYPE " + name + " counter\n")
+		for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx"} {
+			if n, ok := reqs[class]; ok {
+				bw.WriteString(name + `{code="` + class + `"} ` + strconv.FormatInt(n, 10) + "\n")
+			}
+		}
+	}
+
+	if c != nil {
+		for _, h := range []struct {
+			name, help string
+			h          *Histogram
+		}{
+			{"gonc_connection_duration_seconds", "Duration of bridged connections.", c.connDuration},
+			{"gonc_local_dial_seconds", "Latency of dials to the local service.", c.dialLatency},
+			{"gonc_ssh_handshake_seconds", "Time from TCP dial to completed SSH handshake.", c.handshake},
+			{"gonc_keepalive_rtt_seconds", "Round-trip time of SSH keepalive requests.", c.keepaliveRTT},
+		} {
+			writeHistogram(bw, h.name, h.help, h.h.Snapshot())
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeHistogram emits s as a Prometheus histogram: cumulative
+// _bucket series ending in +Inf, then _sum and _count.
+func writeHistogram(bw *bufio.Writer, name, help string, s HistogramSnapshot) {
+	bw.WriteString("# HELP " + name + " " + help + "\n")
+	bw.WriteString("# TYPE " + name + " histogram\n")
+	for _, b := range s.Buckets {
+		bw.WriteString(name + `_bucket{le="` + formatFloat(b.LE) + `"} ` + strconv.FormatInt(b.Count, 10) + "\n")
+	}
+	bw.WriteString(name + `_bucket{le="+Inf"} ` + strconv.FormatInt(s.Count, 10) + "\n")
+	bw.WriteString(name + "_sum " + formatFloat(s.Sum) + "\n")
+	bw.WriteString(name + "_count " + strconv.FormatInt(s.Count, 10) + "\n")
+}
+
+// formatFloat renders v the way Prometheus clients do: integers without
+// a decimal point, everything else in the shortest exact form.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
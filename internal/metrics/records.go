@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// connRecordLimit bounds the ring of recent connection records.
+const connRecordLimit = 64
+
+// ConnRecord describes one finished connection.
+type ConnRecord struct {
+	Peer        string        // remote address
+	Target      string        // local address it was bridged to, if any
+	Start       time.Time     // when it was accepted
+	Duration    time.Duration // accept to close
+	BytesIn     int64         // bytes received from Peer
+	BytesOut    int64         // bytes sent to Peer
+	CloseReason string        // e.g. "eof", "idle", "local dial failed"
+}
+
+// MarshalJSON renders times and durations the way Snapshot does.
+func (r ConnRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Peer        string `json:"peer"`
+		Target      string `json:"target,omitempty"`
+		Start       string `json:"start"`
+		Duration    string `json:"duration"`
+		BytesIn     int64  `json:"bytes_in"`
+		BytesOut    int64  `json:"bytes_out"`
+		CloseReason string `json:"close_reason"`
+	}{
+		Peer:        r.Peer,
+		Target:      r.Target,
+		Start:       r.Start.Format(time.RFC3339),
+		Duration:    r.Duration.Truncate(time.Millisecond).String(),
+		BytesIn:     r.BytesIn,
+		BytesOut:    r.BytesOut,
+		CloseReason: r.CloseReason,
+	})
+}
+
+// RecordConnection appends r to the ring of recent connections and
+// observes its duration, evicting the oldest record once the ring is
+// full.
+func (c *Collector) RecordConnection(r ConnRecord) {
+	if c == nil {
+		return
+	}
+	c.connDuration.Observe(r.Duration)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.records) < connRecordLimit {
+		c.records = append(c.records, r)
+	} else {
+		c.records[c.recordNext] = r
+	}
+	c.recordNext = (c.recordNext + 1) % connRecordLimit
+}
+
+// RecentConnections returns the retained records, oldest first.
+func (c *Collector) RecentConnections() []ConnRecord {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.recentLocked()
+}
+
+func (c *Collector) recentLocked() []ConnRecord {
+	if len(c.records) == 0 {
+		return nil
+	}
+	out := make([]ConnRecord, 0, len(c.records))
+	if len(c.records) == connRecordLimit {
+		out = append(out, c.records[c.recordNext:]...)
+		return append(out, c.records[:c.recordNext]...)
+	}
+	return append(out, c.records...)
+}
@@ -0,0 +1,234 @@
+// Package mirror copies the client → server half of a session to a
+// shadow target, so a new service version can be tried with real
+// traffic.  The shadow's responses are read and discarded.
+//
+// Mirroring never slows the primary path: bytes are queued for the
+// shadow up to a fixed budget, and a shadow that falls that far behind,
+// or cannot be reached, is dropped for the rest of the session while
+// the primary carries on.
+package mirror
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/util"
+)
+
+// queueLen bounds the number of pending chunks, in addition to the
+// byte budget, so many tiny reads cannot grow the queue unchecked.
+const queueLen = 1024
+
+// drainTimeout bounds how long a shadow may take to accept what is
+// still queued once the session has closed.  After that the shadow is
+// dropped, since nothing else would ever unblock its writes.
+const drainTimeout = 5 * time.Second
+
+// DialFunc opens the connection to the shadow target.
+// transport.Dialer.Dial has this signature.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Mirror shadows sessions to one target.
+type Mirror struct {
+	address string
+	dial    DialFunc
+	buffer  int64
+	drain   time.Duration // drainTimeout; shortened by tests
+	logger  *util.Logger
+
+	dropped atomic.Int64 // sessions whose shadow was dropped
+}
+
+// New returns a Mirror sending to address, dialled with dial.  Up to
+// buffer bytes may wait for a slow shadow before it is dropped.
+func New(address string, dial DialFunc, buffer int64, logger *util.Logger) *Mirror {
+	if logger == nil {
+		logger = util.NewLogger(0)
+	}
+	return &Mirror{address: address, dial: dial, buffer: buffer, drain: drainTimeout, logger: logger}
+}
+
+// Address returns the shadow target.
+func (m *Mirror) Address() string {
+	if m == nil {
+		return ""
+	}
+	return m.address
+}
+
+// Dropped returns how many sessions lost their shadow to a failed dial,
+// a write error or a full buffer.
+func (m *Mirror) Dropped() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.dropped.Load()
+}
+
+// Wrap returns conn with every byte read from it also sent to a new
+// shadow connection.  The shadow is dialled in the background and
+// closed, after its queue drains, when conn is closed or ctx ends.
+// A nil Mirror returns conn unchanged.
+func (m *Mirror) Wrap(ctx context.Context, conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	s := &shadow{
+		m:      m,
+		queue:  make(chan []byte, queueLen),
+		closed: make(chan struct{}),
+		log:    m.logger.With("mirror", m.address, "peer", conn.RemoteAddr().String()),
+	}
+	go s.run(ctx)
+	return &Conn{Conn: conn, s: s}
+}
+
+// ── shadow ───────────────────────────────────────────────────────────
+
+// shadow is one session's copy to the mirror target.
+type shadow struct {
+	m       *Mirror
+	queue   chan []byte
+	pending atomic.Int64 // bytes queued but not yet written
+	dropped atomic.Bool
+	log     *util.Logger
+
+	mu     sync.Mutex
+	conn   net.Conn // set once dialled
+	closed chan struct{}
+	once   sync.Once
+}
+
+// send queues a copy of p, or drops the shadow if it is too far behind.
+func (s *shadow) send(p []byte) {
+	if len(p) == 0 || s.dropped.Load() {
+		return
+	}
+	if s.pending.Add(int64(len(p))) > s.m.buffer {
+		s.drop("buffer full")
+		return
+	}
+	select {
+	case s.queue <- append([]byte(nil), p...):
+	default:
+		s.drop("buffer full")
+	}
+}
+
+// drop stops mirroring this session and closes the shadow conn.
+func (s *shadow) drop(reason string) {
+	if s.dropped.Swap(true) {
+		return
+	}
+	s.m.dropped.Add(1)
+	s.log.With("reason", reason).Warn("mirror %s: dropped (%s)", s.m.address, reason)
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+}
+
+// close ends the session: queued bytes are still delivered, within
+// drainTimeout.
+func (s *shadow) close() {
+	s.once.Do(func() {
+		close(s.closed)
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.SetWriteDeadline(time.Now().Add(s.m.drain)) //nolint:errcheck
+		}
+		s.mu.Unlock()
+	})
+}
+
+// run dials the shadow and feeds it the queue until the session closes.
+func (s *shadow) run(ctx context.Context) {
+	conn, err := s.m.dial(ctx, "tcp", s.m.address)
+	if err != nil {
+		s.drop("dial: " + err.Error())
+		return
+	}
+	defer conn.Close()
+	s.mu.Lock()
+	s.conn = conn
+	select {
+	case <-s.closed: // the session ended while we dialled
+		conn.SetWriteDeadline(time.Now().Add(s.m.drain)) //nolint:errcheck
+	default:
+	}
+	s.mu.Unlock()
+	if s.dropped.Load() {
+		return
+	}
+	go io.Copy(io.Discard, conn) //nolint:errcheck // responses are discarded
+
+	for {
+		select {
+		case p := <-s.queue:
+			if !s.write(conn, p) {
+				return
+			}
+		case <-s.closed:
+			// Deliver what is already queued, then half-close so the
+			// shadow sees the end of the request stream.
+			for {
+				select {
+				case p := <-s.queue:
+					if !s.write(conn, p) {
+						return
+					}
+				default:
+					util.CloseWrite(conn) //nolint:errcheck
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *shadow) write(conn net.Conn, p []byte) bool {
+	if s.dropped.Load() {
+		return false
+	}
+	_, err := conn.Write(p)
+	s.pending.Add(-int64(len(p)))
+	if err != nil {
+		s.drop("write: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// ── Conn ─────────────────────────────────────────────────────────────
+
+// Conn copies everything read from the client to the shadow.
+type Conn struct {
+	net.Conn
+	s *shadow
+}
+
+// Read reads from the client and queues the bytes for the shadow.
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.s.send(p[:n])
+	if err != nil {
+		c.s.close()
+	}
+	return n, err
+}
+
+// Close closes the client conn and lets the shadow finish.
+func (c *Conn) Close() error {
+	c.s.close()
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
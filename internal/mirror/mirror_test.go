@@ -0,0 +1,237 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gonc/util"
+)
+
+var dialer = &net.Dialer{Timeout: time.Second}
+
+// shadowServer accepts one connection and sends everything it reads
+// to the returned channel once the client half-closes.
+func shadowServer(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("shadow reply")) //nolint:errcheck
+		data, _ := io.ReadAll(c)
+		got <- data
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestNilMirror(t *testing.T) {
+	var m *Mirror
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if m.Wrap(context.Background(), a) != a {
+		t.Error("nil mirror should return the connection unchanged")
+	}
+	if m.Dropped() != 0 || m.Address() != "" {
+		t.Error("nil mirror accessors should be zero")
+	}
+}
+
+func TestMirrorCopiesClientStream(t *testing.T) {
+	addr, got := shadowServer(t)
+	m := New(addr, dialer.DialContext, 1<<20, util.NewLogger(0))
+
+	client, server := net.Pipe()
+	conn := m.Wrap(context.Background(), server)
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\n")) //nolint:errcheck
+		client.Write([]byte("\r\n"))               //nolint:errcheck
+		client.Close()
+	}()
+
+	primary, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	select {
+	case shadowed := <-got:
+		if !bytes.Equal(shadowed, primary) || len(primary) == 0 {
+			t.Errorf("shadow saw %q, primary %q", shadowed, primary)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow did not receive the stream")
+	}
+	if m.Dropped() != 0 {
+		t.Errorf("Dropped = %d, want 0", m.Dropped())
+	}
+}
+
+func TestSlowMirrorIsDropped(t *testing.T) {
+	// A shadow that never reads: writes to it stall once the socket
+	// buffers fill.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	stalled := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			stalled <- c
+		}
+	}()
+	defer func() {
+		select {
+		case c := <-stalled:
+			c.Close()
+		default:
+		}
+	}()
+
+	m := New(ln.Addr().String(), dialer.DialContext, 64<<10, util.NewLogger(0))
+	client, server := net.Pipe()
+	conn := m.Wrap(context.Background(), server)
+	defer conn.Close()
+
+	// The primary keeps moving at full speed.
+	chunk := make([]byte, 32<<10)
+	go func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for m.Dropped() == 0 && time.Now().Before(deadline) {
+			if _, err := client.Write(chunk); err != nil {
+				return
+			}
+		}
+		client.Close()
+	}()
+	buf := make([]byte, len(chunk))
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	if m.Dropped() != 1 {
+		t.Errorf("Dropped = %d, want 1 for a shadow that never reads", m.Dropped())
+	}
+}
+
+// closeNotifyConn reports when the mirror closes its shadow conn,
+// which it does as its run goroutine returns.
+type closeNotifyConn struct {
+	net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+func TestStalledMirrorEndsAfterSession(t *testing.T) {
+	// A shadow that accepts and never reads.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+
+	shadowConn := make(chan *closeNotifyConn, 1)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		nc := &closeNotifyConn{Conn: c, closed: make(chan struct{})}
+		shadowConn <- nc
+		return nc, nil
+	}
+
+	// The budget and queue are larger than the stream, so only the end
+	// of the session can drop the shadow.
+	m := New(ln.Addr().String(), dial, 64<<20, util.NewLogger(0))
+	m.drain = 100 * time.Millisecond
+	client, server := net.Pipe()
+	conn := m.Wrap(context.Background(), server)
+	go func() {
+		chunk := make([]byte, 32<<10)
+		for i := 0; i < 768; i++ { // 24 MiB: more than the socket buffers hold
+			if _, err := client.Write(chunk); err != nil {
+				return
+			}
+		}
+		client.Close()
+	}()
+	// Read in whole chunks so the queue holds the stream in 768 entries.
+	buf := make([]byte, 32<<10)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	conn.Close()
+
+	var sc *closeNotifyConn
+	select {
+	case sc = <-shadowConn:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow was never dialled")
+	}
+	select {
+	case <-sc.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow goroutine still blocked after the session closed")
+	}
+	if m.Dropped() != 1 {
+		t.Errorf("Dropped = %d, want 1 for a shadow that stopped reading", m.Dropped())
+	}
+}
+
+func TestUnreachableMirror(t *testing.T) {
+	fail := func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	m := New("shadow:80", fail, 1<<20, util.NewLogger(0))
+
+	client, server := net.Pipe()
+	conn := m.Wrap(context.Background(), server)
+	go func() {
+		client.Write([]byte("hello")) //nolint:errcheck
+		client.Close()
+	}()
+	if data, err := io.ReadAll(conn); err != nil || string(data) != "hello" {
+		t.Errorf("primary read %q, %v", data, err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Dropped() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m.Dropped() != 1 {
+		t.Errorf("Dropped = %d, want 1", m.Dropped())
+	}
+}
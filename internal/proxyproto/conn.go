@@ -0,0 +1,97 @@
+package proxyproto
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+
+	"gonc/util"
+)
+
+// Conn is an accepted connection whose PROXY header has been stripped.
+// RemoteAddr and LocalAddr report the addresses from the header when
+// it carried them, so downstream logging sees the original client.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	header *Header
+}
+
+// Accept reads and strips a PROXY header from c, waiting at most
+// timeout for it to arrive.  Connections without a valid header are
+// rejected with an error; the caller should close them.
+func Accept(c net.Conn, timeout time.Duration) (*Conn, error) {
+	if timeout > 0 {
+		c.SetReadDeadline(time.Now().Add(timeout)) //nolint:errcheck
+		defer c.SetReadDeadline(time.Time{})       //nolint:errcheck
+	}
+	r := bufio.NewReader(c)
+	h, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c, r: r, header: h}, nil
+}
+
+// Header returns the parsed PROXY header.
+func (c *Conn) Header() *Header { return c.header }
+
+// Read returns any bytes buffered past the header, then reads from the
+// connection.
+func (c *Conn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// RemoteAddr returns the original client address from the header, or
+// the proxy's address for LOCAL / UNKNOWN headers.
+func (c *Conn) RemoteAddr() net.Addr {
+	if !c.header.IsLocal() {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the original destination address from the header.
+func (c *Conn) LocalAddr() net.Addr {
+	if !c.header.IsLocal() {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyAddr returns the address of the proxy that sent the header.
+func (c *Conn) ProxyAddr() net.Addr { return c.Conn.RemoteAddr() }
+
+// CloseWrite half-closes the underlying connection when supported.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// ── Outbound source address ──────────────────────────────────────────
+
+type sourceKey struct{}
+
+// WithSource returns a context carrying the original client address
+// that an outbound PROXY header should report.  Dialers that emit
+// headers fall back to the connection's own local address when the
+// context carries none.
+func WithSource(ctx context.Context, src net.Addr) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// SourceFromContext returns the address stored by [WithSource].
+func SourceFromContext(ctx context.Context) (net.Addr, bool) {
+	src, ok := ctx.Value(sourceKey{}).(net.Addr)
+	return src, ok && src != nil
+}
+
+type tlvKey struct{}
+
+// WithTLVs returns a context carrying TLVs that an outbound v2 header
+// should include, such as the TLS details of a terminated connection.
+func WithTLVs(ctx context.Context, tlvs ...TLV) context.Context {
+	return context.WithValue(ctx, tlvKey{}, tlvs)
+}
+
+// TLVsFromContext returns the TLVs stored by [WithTLVs].
+func TLVsFromContext(ctx context.Context) []TLV {
+	tlvs, _ := ctx.Value(tlvKey{}).([]TLV)
+	return tlvs
+}
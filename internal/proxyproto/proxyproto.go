@@ -0,0 +1,390 @@
+// Package proxyproto implements the HAProxy PROXY protocol, versions 1
+// (text) and 2 (binary), which lets a relay tell its backend the
+// original client and destination addresses of a connection.
+//
+// Specification: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// v2Signature is the fixed 12-byte preamble of every v2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1Prefix starts every v1 header.
+const v1Prefix = "PROXY "
+
+// v1MaxLen is the longest legal v1 header including CRLF.
+const v1MaxLen = 107
+
+// v2 command and family/protocol bytes.
+const (
+	cmdLocal = 0x20
+	cmdProxy = 0x21
+
+	famUnspec = 0x00
+	famTCP4   = 0x11
+	famUDP4   = 0x12
+	famTCP6   = 0x21
+	famUDP6   = 0x22
+)
+
+// ErrNoHeader is returned by [Read] when the stream does not begin with
+// a PROXY protocol header.
+var ErrNoHeader = errors.New("proxyproto: no PROXY header")
+
+// TLV is a type-length-value extension carried in a v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Well-known TLV types (spec §2.2.1 - §2.2.7).
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+
+	SubtypeSSLVersion byte = 0x21
+	SubtypeSSLCN      byte = 0x22
+	SubtypeSSLCipher  byte = 0x23
+)
+
+// Client flags of a [TypeSSL] TLV (spec §2.2.5).
+const (
+	ClientSSL      byte = 0x01 // the client connected over TLS
+	ClientCertConn byte = 0x02 // it presented a certificate on this connection
+	ClientCertSess byte = 0x04 // it presented one at some point in the session
+)
+
+// Header describes a PROXY protocol header.  Source and Destination
+// are nil for LOCAL / UNKNOWN headers (health checks, or when the
+// original addresses could not be determined).
+type Header struct {
+	Version     int // 1 or 2
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV // v2 only
+}
+
+// NewHeader builds a header for the given addresses.  Addresses that
+// are not TCP/UDP IP addresses yield an UNKNOWN (v1) or LOCAL (v2)
+// header so the backend falls back to the real peer address.
+func NewHeader(version int, src, dst net.Addr) *Header {
+	h := &Header{Version: version}
+	if srcIP, _, ok := addrIPPort(src); ok {
+		if dstIP, _, ok := addrIPPort(dst); ok && srcIP != nil && dstIP != nil {
+			h.Source, h.Destination = src, dst
+		}
+	}
+	return h
+}
+
+// IsLocal reports whether the header carries no address information.
+func (h *Header) IsLocal() bool { return h.Source == nil || h.Destination == nil }
+
+// Format encodes the header in its wire form.
+func (h *Header) Format() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.formatV1(), nil
+	case 2:
+		return h.formatV2()
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported version %d", h.Version)
+	}
+}
+
+// WriteTo writes the encoded header to w.
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.Format()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func (h *Header) formatV1() []byte {
+	if h.IsLocal() {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	srcIP, srcPort, _ := addrIPPort(h.Source)
+	dstIP, dstPort, _ := addrIPPort(h.Destination)
+	srcIP, dstIP, v6 := sameFamily(srcIP, dstIP)
+	proto := "TCP4"
+	if v6 {
+		proto = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+		proto, srcIP, dstIP, srcPort, dstPort))
+}
+
+func (h *Header) formatV2() ([]byte, error) {
+	var addrs []byte
+	cmd, fam := byte(cmdLocal), byte(famUnspec)
+
+	if !h.IsLocal() {
+		srcIP, srcPort, _ := addrIPPort(h.Source)
+		dstIP, dstPort, _ := addrIPPort(h.Destination)
+		srcIP, dstIP, v6 := sameFamily(srcIP, dstIP)
+		_, udp := h.Source.(*net.UDPAddr)
+
+		cmd = cmdProxy
+		switch {
+		case v6 && udp:
+			fam = famUDP6
+		case v6:
+			fam = famTCP6
+		case udp:
+			fam = famUDP4
+		default:
+			fam = famTCP4
+		}
+		addrs = append(addrs, srcIP...)
+		addrs = append(addrs, dstIP...)
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(srcPort))
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(dstPort))
+	}
+
+	for _, tlv := range h.TLVs {
+		if len(tlv.Value) > 0xffff {
+			return nil, fmt.Errorf("proxyproto: TLV %#x too long", tlv.Type)
+		}
+		addrs = append(addrs, tlv.Type)
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(len(tlv.Value)))
+		addrs = append(addrs, tlv.Value...)
+	}
+	if len(addrs) > 0xffff {
+		return nil, errors.New("proxyproto: header too long")
+	}
+
+	out := make([]byte, 0, 16+len(addrs))
+	out = append(out, v2Signature...)
+	out = append(out, cmd, fam)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(addrs)))
+	return append(out, addrs...), nil
+}
+
+// SSL describes a TLS connection for a [TypeSSL] TLV.
+type SSL struct {
+	Client   byte   // ClientSSL | ClientCertConn | ClientCertSess
+	Verified bool   // the client certificate was verified
+	Version  string // e.g. "TLSv1.3"
+	CN       string // client certificate common name
+	Cipher   string // cipher suite name
+}
+
+// TLV encodes s as a [TypeSSL] TLV with version, CN and cipher
+// sub-TLVs for those fields that are set.
+func (s SSL) TLV() TLV {
+	v := []byte{s.Client}
+	verify := uint32(1) // non-zero: not verified
+	if s.Verified {
+		verify = 0
+	}
+	v = binary.BigEndian.AppendUint32(v, verify)
+	for _, sub := range []TLV{
+		{SubtypeSSLVersion, []byte(s.Version)},
+		{SubtypeSSLCN, []byte(s.CN)},
+		{SubtypeSSLCipher, []byte(s.Cipher)},
+	} {
+		if len(sub.Value) == 0 {
+			continue
+		}
+		v = append(v, sub.Type)
+		v = binary.BigEndian.AppendUint16(v, uint16(len(sub.Value)))
+		v = append(v, sub.Value...)
+	}
+	return TLV{Type: TypeSSL, Value: v}
+}
+
+// ParseSSL decodes the value of a [TypeSSL] TLV.
+func ParseSSL(v []byte) (SSL, error) {
+	if len(v) < 5 {
+		return SSL{}, errors.New("proxyproto: truncated SSL TLV")
+	}
+	s := SSL{Client: v[0], Verified: binary.BigEndian.Uint32(v[1:5]) == 0}
+	for rest := v[5:]; len(rest) > 0; {
+		if len(rest) < 3 {
+			return SSL{}, errors.New("proxyproto: truncated SSL sub-TLV")
+		}
+		n := int(binary.BigEndian.Uint16(rest[1:3]))
+		if len(rest) < 3+n {
+			return SSL{}, errors.New("proxyproto: truncated SSL sub-TLV")
+		}
+		val := string(rest[3 : 3+n])
+		switch rest[0] {
+		case SubtypeSSLVersion:
+			s.Version = val
+		case SubtypeSSLCN:
+			s.CN = val
+		case SubtypeSSLCipher:
+			s.Cipher = val
+		}
+		rest = rest[3+n:]
+	}
+	return s, nil
+}
+
+// TLV returns the value of the first TLV of the given type.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, t := range h.TLVs {
+		if t.Type == typ {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ── Parsing ──────────────────────────────────────────────────────────
+
+// Read consumes a v1 or v2 header from r.  It returns [ErrNoHeader]
+// without consuming anything if the stream starts with other data.
+func Read(r *bufio.Reader) (*Header, error) {
+	peek, err := r.Peek(len(v2Signature))
+	if err != nil && len(peek) == 0 {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(peek, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(peek, []byte(v1Prefix)):
+		return readV1(r)
+	case bytes.HasPrefix(v2Signature, peek) || strings.HasPrefix(v1Prefix, string(peek)):
+		return nil, err // stream ended or timed out mid-signature
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxyproto: v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxyproto: v1 header not terminated by CRLF")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	h := &Header{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxyproto: malformed v1 header %q", line)
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("proxyproto: malformed v1 header %q", line)
+	}
+	h.Source = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	h.Destination = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return h, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, fmt.Errorf("proxyproto: v2 header: %w", err)
+	}
+	verCmd, fam := fixed[12], fixed[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("proxyproto: unsupported v2 version %d", verCmd>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("proxyproto: v2 body: %w", err)
+	}
+
+	h := &Header{Version: 2}
+	var addrLen int
+	switch fam {
+	case famTCP4, famUDP4:
+		addrLen = 12
+	case famTCP6, famUDP6:
+		addrLen = 36
+	}
+	if len(body) < addrLen {
+		return nil, errors.New("proxyproto: v2 address block truncated")
+	}
+
+	if verCmd&0x0f == cmdProxy&0x0f && addrLen > 0 {
+		ipLen := (addrLen - 4) / 2
+		src := net.IP(append([]byte(nil), body[:ipLen]...))
+		dst := net.IP(append([]byte(nil), body[ipLen:2*ipLen]...))
+		sp := int(binary.BigEndian.Uint16(body[2*ipLen:]))
+		dp := int(binary.BigEndian.Uint16(body[2*ipLen+2:]))
+		if fam == famUDP4 || fam == famUDP6 {
+			h.Source = &net.UDPAddr{IP: src, Port: sp}
+			h.Destination = &net.UDPAddr{IP: dst, Port: dp}
+		} else {
+			h.Source = &net.TCPAddr{IP: src, Port: sp}
+			h.Destination = &net.TCPAddr{IP: dst, Port: dp}
+		}
+	}
+
+	tlvs := body[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, errors.New("proxyproto: truncated TLV")
+		}
+		n := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return nil, errors.New("proxyproto: truncated TLV")
+		}
+		h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: append([]byte(nil), tlvs[3:3+n]...)})
+		tlvs = tlvs[3+n:]
+	}
+	return h, nil
+}
+
+// ── helpers ──────────────────────────────────────────────────────────
+
+// addrIPPort extracts the IP and port of a TCP or UDP address.
+func addrIPPort(a net.Addr) (net.IP, int, bool) {
+	switch v := a.(type) {
+	case *net.TCPAddr:
+		if v == nil {
+			return nil, 0, false
+		}
+		return v.IP, v.Port, true
+	case *net.UDPAddr:
+		if v == nil {
+			return nil, 0, false
+		}
+		return v.IP, v.Port, true
+	}
+	return nil, 0, false
+}
+
+// sameFamily returns both IPs in a common family: 4-byte form when both
+// are IPv4, otherwise 16-byte form (IPv4 addresses become v4-mapped).
+func sameFamily(a, b net.IP) (net.IP, net.IP, bool) {
+	a4, b4 := a.To4(), b.To4()
+	if a4 != nil && b4 != nil {
+		return a4, b4, false
+	}
+	return a.To16(), b.To16(), true
+}
@@ -0,0 +1,215 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tcp(ip string, port int) *net.TCPAddr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestHeader_V1Format(t *testing.T) {
+	tests := []struct {
+		src, dst net.Addr
+		want     string
+	}{
+		{tcp("192.0.2.1", 56324), tcp("198.51.100.7", 443), "PROXY TCP4 192.0.2.1 198.51.100.7 56324 443\r\n"},
+		{tcp("2001:db8::1", 1000), tcp("2001:db8::2", 80), "PROXY TCP6 2001:db8::1 2001:db8::2 1000 80\r\n"},
+		{&net.TCPAddr{}, tcp("198.51.100.7", 443), "PROXY UNKNOWN\r\n"},
+		{nil, nil, "PROXY UNKNOWN\r\n"},
+	}
+	for _, tt := range tests {
+		b, err := NewHeader(1, tt.src, tt.dst).Format()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("got %q, want %q", b, tt.want)
+		}
+	}
+}
+
+func TestHeader_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  int
+		src, dst net.Addr
+	}{
+		{"v1 tcp4", 1, tcp("10.0.0.1", 1234), tcp("10.0.0.2", 80)},
+		{"v1 tcp6", 1, tcp("::1", 1234), tcp("::2", 80)},
+		{"v2 tcp4", 2, tcp("10.0.0.1", 1234), tcp("10.0.0.2", 80)},
+		{"v2 tcp6", 2, tcp("fe80::1", 1234), tcp("fe80::2", 80)},
+		{"v2 udp4", 2, &net.UDPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 53}, &net.UDPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 5353}},
+		{"v2 mixed", 2, tcp("10.0.0.1", 1), tcp("::2", 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := NewHeader(tt.version, tt.src, tt.dst).WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			buf.WriteString("payload")
+
+			r := bufio.NewReader(&buf)
+			h, err := Read(r)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if h.Version != tt.version {
+				t.Errorf("version = %d, want %d", h.Version, tt.version)
+			}
+			if h.IsLocal() {
+				t.Fatal("header unexpectedly LOCAL")
+			}
+			wantIP, _, _ := addrIPPort(tt.src)
+			gotIP, gotPort, _ := addrIPPort(h.Source)
+			_, wantPort, _ := addrIPPort(tt.src)
+			if !gotIP.Equal(wantIP) || gotPort != wantPort {
+				t.Errorf("source = %v, want %v", h.Source, tt.src)
+			}
+
+			rest, _ := io.ReadAll(r)
+			if string(rest) != "payload" {
+				t.Errorf("remaining = %q, want %q", rest, "payload")
+			}
+		})
+	}
+}
+
+func TestHeader_V2TLVs(t *testing.T) {
+	h := NewHeader(2, tcp("10.0.0.1", 1), tcp("10.0.0.2", 2))
+	h.TLVs = []TLV{{Type: TypeAuthority, Value: []byte("api.example")}}
+
+	b, err := h.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := got.TLV(TypeAuthority)
+	if !ok || string(v) != "api.example" {
+		t.Errorf("authority TLV = %q, %v", v, ok)
+	}
+}
+
+func TestSSL_RoundTrip(t *testing.T) {
+	tests := []SSL{
+		{Client: ClientSSL, Version: "TLSv1.3", Cipher: "TLS_AES_128_GCM_SHA256"},
+		{Client: ClientSSL | ClientCertConn | ClientCertSess, Verified: true, Version: "TLSv1.2", CN: "alice", Cipher: "ECDHE-RSA-AES128-GCM-SHA256"},
+	}
+	for _, want := range tests {
+		tlv := want.TLV()
+		if tlv.Type != TypeSSL {
+			t.Fatalf("type = %#x", tlv.Type)
+		}
+		got, err := ParseSSL(tlv.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+	if _, err := ParseSSL([]byte{ClientSSL, 0, 0, 0, 0, SubtypeSSLCN, 0, 9, 'x'}); err == nil {
+		t.Error("truncated sub-TLV should fail")
+	}
+}
+
+func TestHeader_V2Local(t *testing.T) {
+	b, err := NewHeader(2, nil, nil).Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 16 || b[12] != cmdLocal {
+		t.Fatalf("unexpected LOCAL header %x", b)
+	}
+	h, err := Read(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsLocal() {
+		t.Error("expected LOCAL header")
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	tests := map[string]string{
+		"no header":  "GET / HTTP/1.1\r\n\r\n",
+		"bad v1":     "PROXY TCP4 nope\r\n",
+		"no crlf":    "PROXY TCP4 1.1.1.1 2.2.2.2 1 2" + strings.Repeat("x", 100),
+		"v2 version": string(v2Signature) + "\x11\x11\x00\x00",
+		"v2 short":   string(v2Signature) + "\x21\x11\x00\x04\x00\x00\x00\x00",
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Read(bufio.NewReader(strings.NewReader(in))); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if _, err := Read(bufio.NewReader(strings.NewReader("hello"))); err != ErrNoHeader {
+		t.Errorf("err = %v, want ErrNoHeader", err)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		NewHeader(1, tcp("203.0.113.9", 4000), tcp("10.0.0.1", 80)).WriteTo(client) //nolint:errcheck
+		client.Write([]byte("hello"))                                               //nolint:errcheck
+	}()
+
+	pc, err := Accept(server, time.Second)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if got := pc.RemoteAddr().String(); got != "203.0.113.9:4000" {
+		t.Errorf("RemoteAddr = %s", got)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(pc, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("read %q, %v", buf, err)
+	}
+}
+
+func TestAccept_Missing(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go client.Write([]byte("no header here\r\n")) //nolint:errcheck
+
+	if _, err := Accept(server, time.Second); err == nil {
+		t.Fatal("expected error for missing header")
+	}
+}
+
+func TestSourceFromContext(t *testing.T) {
+	if _, ok := SourceFromContext(context.Background()); ok {
+		t.Error("empty context should carry no source")
+	}
+	ctx := WithSource(context.Background(), tcp("1.2.3.4", 5))
+	src, ok := SourceFromContext(ctx)
+	if !ok || src.String() != "1.2.3.4:5" {
+		t.Errorf("source = %v, %v", src, ok)
+	}
+}
+
+func TestTLVsFromContext(t *testing.T) {
+	if TLVsFromContext(context.Background()) != nil {
+		t.Error("empty context should carry no TLVs")
+	}
+	ctx := WithTLVs(context.Background(), TLV{Type: TypeAuthority, Value: []byte("a")})
+	if tlvs := TLVsFromContext(ctx); len(tlvs) != 1 || tlvs[0].Type != TypeAuthority {
+		t.Errorf("TLVs = %v", tlvs)
+	}
+}
@@ -0,0 +1,484 @@
+// Package qrcode is a minimal QR Code (ISO/IEC 18004) encoder used to
+// show tunnel URLs in the terminal.  It supports byte mode at error
+// correction level M for versions 1-10, which covers payloads of up
+// to 213 bytes - far more than any forwarding URL needs.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLong is returned when the payload does not fit in version 10.
+var ErrTooLong = errors.New("qrcode: payload too long")
+
+// ecLevelM is the two-bit format code for error correction level M.
+const ecLevelM = 0
+
+// blockSpec describes the error-correction block layout of a version.
+type blockSpec struct {
+	ecPerBlock int
+	g1Blocks   int
+	g1Data     int
+	g2Blocks   int
+	g2Data     int
+}
+
+func (b blockSpec) dataCodewords() int { return b.g1Blocks*b.g1Data + b.g2Blocks*b.g2Data }
+
+// levelM lists the level-M block structure for versions 1-10.
+var levelM = [...]blockSpec{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+}
+
+// alignment lists the alignment pattern centre coordinates per version.
+var alignment = [...][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+const maxVersion = len(levelM) - 1
+
+// Code is an encoded QR symbol.
+type Code struct {
+	Version int
+	Size    int // modules per side
+
+	modules  [][]bool // true = dark
+	function [][]bool // true = function pattern (not data)
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Encode returns the smallest level-M symbol holding data in byte mode.
+func Encode(data []byte) (*Code, error) { return encode(data, -1) }
+
+// encode builds the symbol with the given mask pattern, or with the
+// one of lowest penalty when mask is negative.
+func encode(data []byte, mask int) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if capacityBits(v) >= payloadBits(v, len(data)) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrTooLong, len(data), maxBytes())
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(interleave(version, encodeData(version, data)))
+
+	if mask < 0 {
+		mask = c.bestMask()
+	}
+	c.applyMask(mask)
+	c.drawFormat(mask)
+	return c, nil
+}
+
+// bestMask returns the mask pattern giving the lowest penalty.
+func (c *Code) bestMask() int {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // XOR again to undo
+	}
+	return best
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size}
+	c.modules = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	return c
+}
+
+// ── Data encoding ────────────────────────────────────────────────────
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func capacityBits(version int) int { return levelM[version].dataCodewords() * 8 }
+
+func payloadBits(version, n int) int { return 4 + countBits(version) + 8*n }
+
+func maxBytes() int {
+	return (capacityBits(maxVersion) - 4 - countBits(maxVersion)) / 8
+}
+
+// bitBuffer accumulates bits most-significant first.
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+func (b *bitBuffer) append(val uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if val>>uint(i)&1 != 0 {
+			b.bytes[b.n/8] |= 0x80 >> uint(b.n%8)
+		}
+		b.n++
+	}
+}
+
+// encodeData builds the padded data codewords for a byte-mode segment.
+func encodeData(version int, data []byte) []byte {
+	capBits := capacityBits(version)
+
+	var bb bitBuffer
+	bb.append(0b0100, 4) // byte mode
+	bb.append(uint32(len(data)), countBits(version))
+	for _, b := range data {
+		bb.append(uint32(b), 8)
+	}
+	bb.append(0, min(4, capBits-bb.n)) // terminator
+	if r := bb.n % 8; r != 0 {
+		bb.append(0, 8-r)
+	}
+	for pad := byte(0xEC); bb.n < capBits; pad ^= 0xEC ^ 0x11 {
+		bb.append(uint32(pad), 8)
+	}
+	return bb.bytes
+}
+
+// interleave splits data into blocks, appends Reed-Solomon error
+// correction to each, and interleaves the result.
+func interleave(version int, data []byte) []byte {
+	spec := levelM[version]
+	divisor := rsDivisor(spec.ecPerBlock)
+
+	var blocks, ecs [][]byte
+	off := 0
+	for i := 0; i < spec.g1Blocks+spec.g2Blocks; i++ {
+		n := spec.g1Data
+		if i >= spec.g1Blocks {
+			n = spec.g2Data
+		}
+		blk := data[off : off+n]
+		off += n
+		blocks = append(blocks, blk)
+		ecs = append(ecs, rsRemainder(blk, divisor))
+	}
+
+	out := make([]byte, 0, len(data)+len(blocks)*spec.ecPerBlock)
+	for i := 0; i < max(spec.g1Data, spec.g2Data); i++ {
+		for _, blk := range blocks {
+			if i < len(blk) {
+				out = append(out, blk[i])
+			}
+		}
+	}
+	for i := 0; i < spec.ecPerBlock; i++ {
+		for _, ec := range ecs {
+			out = append(out, ec[i])
+		}
+	}
+	return out
+}
+
+// ── Module placement ─────────────────────────────────────────────────
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	pos := alignment[c.Version]
+	last := len(pos) - 1
+	for i, cy := range pos {
+		for j, cx := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // overlaps a finder pattern
+			}
+			c.drawAlignment(cx, cy)
+		}
+	}
+
+	c.drawFormat(0) // reserve the format areas; rewritten per mask
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centred on (cx, cy).
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.setFunction(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the 15-bit BCH-protected format word for mask.
+func formatBits(mask int) uint32 {
+	data := uint32(ecLevelM<<3 | mask)
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormat(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>uint(i)&1 != 0 }
+
+	// Copy around the top-left finder.
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	// Copy split between the other two finders.
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true) // always-dark module
+}
+
+// versionBits returns the 18-bit BCH-protected version word.
+func versionBits(version int) uint32 {
+	rem := uint32(version)
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return uint32(version)<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := bits>>uint(i)&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places data in the two-column zigzag from the
+// bottom-right corner, skipping function modules.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = data[i/8]>>uint(7-i%8)&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// ── Masking ──────────────────────────────────────────────────────────
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && maskBit(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol using the four rules of ISO/IEC 18004
+// §7.8.3; the mask with the lowest score is chosen.
+func (c *Code) penalty() int {
+	n := c.Size
+	total := 0
+
+	line := make([]bool, n)
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < n; a++ {
+			for b := 0; b < n; b++ {
+				if vertical {
+					line[b] = c.modules[b][a]
+				} else {
+					line[b] = c.modules[a][b]
+				}
+			}
+			total += runPenalty(line) + finderLikePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					total += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (n * n)
+	total += abs(percent-50) / 5 * 10
+	return total
+}
+
+// runPenalty scores runs of five or more same-coloured modules.
+func runPenalty(line []bool) int {
+	p, run := 0, 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			p += 3 + run - 5
+		}
+		run = 1
+	}
+	return p
+}
+
+// finderLikePenalty scores 1:1:3:1:1 patterns flanked by four light
+// modules, which scanners could mistake for a finder.
+func finderLikePenalty(line []bool) int {
+	pattern := []bool{true, false, true, true, true, false, true}
+	p := 0
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		match := true
+		for j, v := range pattern {
+			if line[i+j] != v {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if lightRun(line, i-4, i) || lightRun(line, i+len(pattern), i+len(pattern)+4) {
+			p += 40
+		}
+	}
+	return p
+}
+
+// lightRun reports whether line[from:to] is light, treating positions
+// outside the symbol as light quiet zone.
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
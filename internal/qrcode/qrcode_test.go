@@ -0,0 +1,257 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRSRemainder checks the worked 1-M "HELLO WORLD" example from the
+// QR specification tutorials.
+func TestRSRemainder(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := rsRemainder(data, rsDivisor(10))
+	if !bytes.Equal(got, want) {
+		t.Errorf("EC codewords = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got := formatBits(0); got != 0b101010000010010 {
+		t.Errorf("formatBits(M, 0) = %015b", got)
+	}
+	for mask := 0; mask < 8; mask++ {
+		// Unmasked, every format word is a multiple of the generator.
+		if r := polyMod(formatBits(mask)^0x5412, 0x537); r != 0 {
+			t.Errorf("mask %d: format word not a codeword (rem %b)", mask, r)
+		}
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("versionBits(7) = %018b", got)
+	}
+}
+
+// polyMod returns v mod g over GF(2).
+func polyMod(v, g uint32) uint32 {
+	gl := bitLen(g)
+	for bitLen(v) >= gl {
+		v ^= g << uint(bitLen(v)-gl)
+	}
+	return v
+}
+
+func bitLen(v uint32) int {
+	n := 0
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+func TestEncodeVersions(t *testing.T) {
+	tests := []struct {
+		n       int
+		version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{42, 3},
+		{43, 4},
+		{180, 9},
+		{213, 10},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.n))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", tt.n, err)
+		}
+		if c.Version != tt.version || c.Size != tt.version*4+17 {
+			t.Errorf("Encode(%d bytes) = version %d size %d, want version %d",
+				tt.n, c.Version, c.Size, tt.version)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("err = %v, want ErrTooLong", err)
+	}
+}
+
+// TestEncodeRoundTrip reads the codewords back out of the symbol and
+// compares them with what was placed, which exercises masking, format
+// information and the zigzag placement together.
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, payload := range []string{
+		"https://abc123.lhr.life",
+		"https://0123456789abcdef.serveo.net/some/longer/path?query=1",
+		strings.Repeat("x", 150), // version 8: two block groups + version info
+	} {
+		c, err := Encode([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Recover the mask from the top-left format copy.
+		var fmtWord uint32
+		for i := 0; i <= 5; i++ {
+			fmtWord |= b2u(c.modules[i][8]) << uint(i)
+		}
+		fmtWord |= b2u(c.modules[7][8])<<6 | b2u(c.modules[8][8])<<7 | b2u(c.modules[8][7])<<8
+		for i := 9; i < 15; i++ {
+			fmtWord |= b2u(c.modules[8][14-i]) << uint(i)
+		}
+		mask := -1
+		for m := 0; m < 8; m++ {
+			if formatBits(m) == fmtWord {
+				mask = m
+			}
+		}
+		if mask < 0 {
+			t.Fatalf("%q: format word %015b matches no mask", payload, fmtWord)
+		}
+
+		c.applyMask(mask)
+		got := readCodewords(c)
+		want := interleave(c.Version, encodeData(c.Version, []byte(payload)))
+		if !bytes.Equal(got[:len(want)], want) {
+			t.Errorf("%q: codewords read back differ from those placed", payload)
+		}
+	}
+}
+
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readCodewords walks the zigzag like drawCodewords, collecting bits.
+func readCodewords(c *Code) []byte {
+	var out []byte
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] {
+					continue
+				}
+				if i%8 == 0 {
+					out = append(out, 0)
+				}
+				if c.modules[y][x] {
+					out[i/8] |= 0x80 >> uint(i%8)
+				}
+				i++
+			}
+		}
+	}
+	return out
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	c, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Finder centres and corners are dark, separators light.
+	for _, p := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}, {0, 0}, {6, 6}} {
+		if !c.Dark(p[0], p[1]) {
+			t.Errorf("module %v should be dark", p)
+		}
+	}
+	for _, p := range [][2]int{{7, 0}, {0, 7}, {c.Size - 8, 0}} {
+		if c.Dark(p[0], p[1]) {
+			t.Errorf("separator %v should be light", p)
+		}
+	}
+	if !c.Dark(8, c.Size-8) {
+		t.Error("dark module missing")
+	}
+}
+
+// TestEncodeGolden compares whole symbols against ones produced by an
+// independent encoder (github.com/skip2/go-qrcode, level Medium) and
+// kept in testdata as rows of '#' (dark) and '.' (light).  Encoders
+// may score masks differently, so each case pins the mask the
+// reference chose.
+func TestEncodeGolden(t *testing.T) {
+	tests := []struct {
+		file    string
+		payload string
+		version int
+		mask    int
+	}{
+		{"v3-serveo.txt", "https://gonc-demo.serveo.net", 3, 4},
+		{"v8-long-path.txt", "https://gonc-demo.serveo.net/" + strings.Repeat("tunnel/", 14) + "index.html", 8, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Fields(string(golden))
+
+			c, err := encode([]byte(tt.payload), tt.mask)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version != tt.version || len(want) != c.Size {
+				t.Fatalf("version %d (%d modules), want %d (%d rows in %s)", c.Version, c.Size, tt.version, len(want), tt.file)
+			}
+			for y, row := range want {
+				var got strings.Builder
+				for x := 0; x < c.Size; x++ {
+					if c.Dark(x, y) {
+						got.WriteByte('#')
+					} else {
+						got.WriteByte('.')
+					}
+				}
+				if got.String() != row {
+					t.Errorf("row %2d = %s\n       want %s", y, got.String(), row)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteHalfBlocks(t *testing.T) {
+	c, err := Encode([]byte("https://example.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.WriteHalfBlocks(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	rows := c.Size + 2*quietZone
+	if len(lines) != (rows+1)/2 {
+		t.Errorf("got %d lines, want %d", len(lines), (rows+1)/2)
+	}
+	for i, l := range lines {
+		if n := len([]rune(l)); n != rows {
+			t.Fatalf("line %d has %d columns, want %d", i, n, rows)
+		}
+	}
+	// The first line is pure quiet zone.
+	if strings.Trim(lines[0], "█") != "" {
+		t.Errorf("first line %q is not all light", lines[0])
+	}
+}
@@ -0,0 +1,41 @@
+package qrcode
+
+import (
+	"bufio"
+	"io"
+)
+
+// quietZone is the light border, in modules, drawn around the symbol.
+// The standard asks for four; two is what terminal renderers commonly
+// use and scans reliably.
+const quietZone = 2
+
+// WriteHalfBlocks renders the symbol with Unicode half-block characters,
+// two module rows per text line.  Light modules are drawn as filled
+// blocks, so the output suits terminals with a light foreground on a
+// dark background.
+func (c *Code) WriteHalfBlocks(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	light := func(x, y int) bool { return !c.Dark(x, y) }
+
+	for y := -quietZone; y < c.Size+quietZone; y += 2 {
+		for x := -quietZone; x < c.Size+quietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			if y+1 >= c.Size+quietZone {
+				bottom = false // past the last row
+			}
+			switch {
+			case top && bottom:
+				bw.WriteString("█")
+			case top:
+				bw.WriteString("▀")
+			case bottom:
+				bw.WriteString("▄")
+			default:
+				bw.WriteByte(' ')
+			}
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
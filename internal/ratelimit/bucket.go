@@ -0,0 +1,57 @@
+// Package ratelimit shapes session traffic for --rate-limit,
+// --global-rate-limit and --max-bytes.
+//
+// A Limiter wraps each session's connection.  Every read and write
+// draws tokens from a per-session bucket for its direction and from a
+// global bucket shared by all sessions, and counts against the
+// session's byte quota.  Because the wrapper sits on the connection,
+// util.BidirectionalCopy and the reverse tunnel's bridge are shaped
+// without knowing about it.  A nil *Limiter is a valid no-op receiver.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket holding up to an eighth of a second of
+// tokens at its rate.  Callers may take more tokens than the bucket
+// holds; the balance goes negative and later callers wait it off, so
+// large writes are shaped rather than refused.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens (bytes) per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time // overridden in tests
+}
+
+// NewBucket returns a full bucket filling at rate bytes per second.
+func NewBucket(rate int64) *Bucket {
+	burst := max(float64(rate)/8, 1)
+	return &Bucket{rate: float64(rate), burst: burst, tokens: burst, now: time.Now}
+}
+
+// Burst returns the bucket's capacity in bytes.
+func (b *Bucket) Burst() int {
+	return int(b.burst)
+}
+
+// Take removes n tokens and returns how long the caller must wait
+// before using them.
+func (b *Bucket) Take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
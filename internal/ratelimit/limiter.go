@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonc/util"
+)
+
+// ErrQuotaExceeded is returned by a limited connection once the
+// session has moved its --max-bytes.
+var ErrQuotaExceeded = errors.New("session byte quota exceeded")
+
+// Limiter holds the shaping settings and the global buckets.
+type Limiter struct {
+	rate      int64 // per session, per direction; 0 = unlimited
+	maxBytes  int64 // per session, both directions; 0 = unlimited
+	globalIn  *Bucket
+	globalOut *Bucket
+}
+
+// New returns a Limiter, or nil when every limit is 0.  rate and
+// globalRate are bytes per second in each direction.
+func New(rate, globalRate, maxBytes int64) *Limiter {
+	if rate == 0 && globalRate == 0 && maxBytes == 0 {
+		return nil
+	}
+	l := &Limiter{rate: rate, maxBytes: maxBytes}
+	if globalRate > 0 {
+		l.globalIn, l.globalOut = NewBucket(globalRate), NewBucket(globalRate)
+	}
+	return l
+}
+
+// Wrap returns conn shaped by the limiter.  With a nil Limiter conn is
+// returned unchanged.
+func (l *Limiter) Wrap(conn net.Conn) net.Conn {
+	if l == nil {
+		return conn
+	}
+	c := &Conn{Conn: conn, l: l, done: make(chan struct{})}
+	_, c.packet = conn.(net.PacketConn)
+	c.in.global, c.out.global = l.globalIn, l.globalOut
+	if l.rate > 0 {
+		c.in.session, c.out.session = NewBucket(l.rate), NewBucket(l.rate)
+	}
+	return c
+}
+
+// Exceeded reports whether conn is a limited connection whose byte
+// quota ran out.
+func Exceeded(conn net.Conn) bool {
+	c, ok := conn.(*Conn)
+	return ok && c.exceeded.Load()
+}
+
+// direction holds the buckets one direction draws from.
+type direction struct {
+	session *Bucket
+	global  *Bucket
+}
+
+// chunk is the largest read or write that is shaped as one unit, so a
+// slow rate sends small steady pieces rather than one big burst.
+func (d direction) chunk() int {
+	n := 32 * 1024
+	for _, b := range []*Bucket{d.session, d.global} {
+		if b != nil {
+			n = min(n, max(b.Burst(), 512))
+		}
+	}
+	return n
+}
+
+// Conn is a rate-limited connection.
+type Conn struct {
+	net.Conn
+	l       *Limiter
+	in, out direction
+	packet  bool // datagrams must not be split or truncated
+
+	used      atomic.Int64
+	exceeded  atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if !c.packet {
+		p = p[:min(len(p), c.in.chunk())]
+	}
+	if c.l.maxBytes > 0 {
+		left := c.l.maxBytes - c.used.Load()
+		if left <= 0 {
+			c.exceeded.Store(true)
+			return 0, ErrQuotaExceeded
+		}
+		if !c.packet {
+			p = p[:min(int64(len(p)), left)]
+		}
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.used.Add(int64(n))
+		if werr := c.wait(c.in, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if !c.packet {
+			n = min(n, c.out.chunk())
+		}
+		if c.l.maxBytes > 0 {
+			left := c.l.maxBytes - c.used.Load()
+			if left < int64(n) && (c.packet || left <= 0) {
+				c.exceeded.Store(true)
+				return written, ErrQuotaExceeded
+			}
+			n = int(min(int64(n), left))
+		}
+		if err := c.wait(c.out, n); err != nil {
+			return written, err
+		}
+
+		m, err := c.Conn.Write(p[:n])
+		written += m
+		c.used.Add(int64(m))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait takes n tokens from each of d's buckets and sleeps for the
+// longest resulting delay, returning early if the connection closes.
+func (c *Conn) wait(d direction, n int) error {
+	var delay time.Duration
+	for _, b := range []*Bucket{d.session, d.global} {
+		if b != nil {
+			delay = max(delay, b.Take(n))
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// Close closes the connection and wakes any shaped read or write.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
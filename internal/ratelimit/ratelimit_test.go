@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBucket(8000) // burst 1000
+	b.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		take    int
+		want    time.Duration
+	}{
+		{"within burst", 0, 1000, 0},
+		{"empty bucket", 0, 800, 100 * time.Millisecond},
+		{"refilled debt", 100 * time.Millisecond, 0, 0},
+		{"capped at burst", time.Hour, 1000, 0},
+		{"large take", 0, 8000, time.Second},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		if got := b.Take(tt.take); got != tt.want {
+			t.Errorf("%s: Take(%d) = %v, want %v", tt.name, tt.take, got, tt.want)
+		}
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	if l := New(0, 0, 0); l != nil {
+		t.Fatalf("New(0, 0, 0) = %v, want nil", l)
+	}
+	var l *Limiter
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if l.Wrap(a) != a {
+		t.Error("nil limiter should return the connection unchanged")
+	}
+	if Exceeded(a) {
+		t.Error("plain connection reported as over quota")
+	}
+}
+
+func TestConnRateLimit(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go io.Copy(io.Discard, b) //nolint:errcheck
+
+	conn := New(8192, 0, 0).Wrap(a) // burst 1024
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	// 3072 bytes beyond the burst at 8192 B/s take 375ms.
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("4096 bytes at 8KiB/s took %v, want at least ~375ms", elapsed)
+	}
+}
+
+func TestConnGlobalRateShared(t *testing.T) {
+	l := New(0, 8192, 0)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		a, b := net.Pipe()
+		go io.Copy(io.Discard, b) //nolint:errcheck
+		conn := l.Wrap(a)
+		if _, err := conn.Write(make([]byte, 2048)); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		b.Close()
+	}
+	// Two sessions share one bucket: 3072 bytes beyond the burst.
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("two sessions under a shared 8KiB/s limit took %v", elapsed)
+	}
+}
+
+func TestConnQuota(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go func() {
+		b.Write([]byte("0123456789")) //nolint:errcheck
+		io.Copy(io.Discard, b)        //nolint:errcheck
+	}()
+
+	conn := New(0, 0, 16).Wrap(a)
+	defer conn.Close()
+
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Write(make([]byte, 10))
+	if n != 6 || !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write = %d, %v; want 6, ErrQuotaExceeded", n, err)
+	}
+	if _, err := conn.Read(buf); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Read after quota = %v, want ErrQuotaExceeded", err)
+	}
+	if !Exceeded(conn) {
+		t.Error("Exceeded = false after the quota ran out")
+	}
+}
+
+func TestCloseWakesShapedWrite(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go io.Copy(io.Discard, b) //nolint:errcheck
+
+	conn := New(1024, 0, 0).Wrap(a)
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(make([]byte, 64*1024)) // about a minute at 1KiB/s
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Write succeeded after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not wake the shaped Write")
+	}
+}
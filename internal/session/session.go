@@ -9,6 +9,7 @@ package session
 import (
 	"io"
 	"net"
+	"sync/atomic"
 
 	"gonc/util"
 )
@@ -17,18 +18,44 @@ import (
 // Capabilities operate on sessions rather than raw connections,
 // enabling clean testing and I/O abstraction.
 type Session struct {
+	ID     uint64 // unique within the process, for correlating logs
 	Conn   net.Conn
 	Stdin  io.Reader
 	Stdout io.Writer
 	Logger *util.Logger
+
+	// Origin is the original client address reported by a PROXY
+	// protocol header, or nil when the peer connected directly.
+	Origin net.Addr
+
+	// Target is set by forwarding capabilities to the upstream they
+	// reached, for audit records.
+	Target string
+
+	// User is the name the client authenticated as, e.g. with
+	// --socks-auth, for audit records.
+	User string
 }
 
+var nextID atomic.Uint64
+
+// NextID returns a new process-wide session ID.  Modes that bridge
+// connections without a Session use it to label their log lines.
+func NextID() uint64 { return nextID.Add(1) }
+
 // New creates a Session bound to the given connection and I/O pair.
+// Its Logger carries the session ID and peer address as attributes.
 func New(conn net.Conn, stdin io.Reader, stdout io.Writer, logger *util.Logger) *Session {
+	id := NextID()
+	attrs := []any{"session", id}
+	if peer := conn.RemoteAddr(); peer != nil { // nil for unconnected UDP
+		attrs = append(attrs, "peer", peer.String())
+	}
 	return &Session{
+		ID:     id,
 		Conn:   conn,
 		Stdin:  stdin,
 		Stdout: stdout,
-		Logger: logger,
+		Logger: logger.With(attrs...),
 	}
 }
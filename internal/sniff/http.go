@@ -0,0 +1,73 @@
+package sniff
+
+import (
+	"bytes"
+	"strings"
+)
+
+// httpMethods are the request methods recognised when deciding
+// whether a stream is plaintext HTTP.
+var httpMethods = []string{
+	"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "OPTIONS ",
+	"PATCH ", "CONNECT ", "TRACE ",
+}
+
+// looksLikeHTTP reports whether b could be the start of an HTTP/1.x
+// request line.  Only the first byte is required, so the check is
+// permissive; httpHost does the real parsing.
+func looksLikeHTTP(b []byte) bool {
+	for _, m := range httpMethods {
+		n := min(len(b), len(m))
+		if string(b[:n]) == m[:n] {
+			return true
+		}
+	}
+	return false
+}
+
+// httpHost buffers the request head and returns the value of its
+// Host header.
+func (c *Conn) httpHost() (string, error) {
+	n := 1
+	for {
+		buf, err := c.peekAtLeast(n)
+		if host, done := parseHTTPHost(buf); done {
+			return host, nil
+		}
+		if err != nil {
+			// Give up quietly on a timeout or short stream; whatever
+			// was buffered is still delivered to the backend.
+			return "", nil
+		}
+		if len(buf) >= maxPeek {
+			return "", nil
+		}
+		n = len(buf) + 1
+	}
+}
+
+// parseHTTPHost scans a (possibly partial) request head for the Host
+// header.  done is true once the header was found or the head is
+// known to be complete without one.
+func parseHTTPHost(buf []byte) (host string, done bool) {
+	lines := bytes.Split(buf, []byte("\n"))
+	// The last element is an incomplete line unless buf ends in \n.
+	complete := lines[:len(lines)-1]
+	for i, line := range complete {
+		line = bytes.TrimRight(line, "\r")
+		if i == 0 {
+			if !looksLikeHTTP(line) {
+				return "", true
+			}
+			continue
+		}
+		if len(line) == 0 {
+			return "", true // end of head, no Host header
+		}
+		name, value, ok := strings.Cut(string(line), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "host") {
+			return NormalizeHost(value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+// Package sniff inspects the first bytes of a connection to discover
+// which virtual host the client is asking for — the HTTP Host header
+// for plaintext requests or the SNI extension of a TLS ClientHello —
+// without consuming those bytes, so the connection can still be
+// forwarded verbatim to whichever backend is chosen.
+package sniff
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+
+	"gonc/util"
+)
+
+// maxPeek bounds how much of the stream is buffered while sniffing.
+// A TLS record is at most 16 KiB plus its 5-byte header; HTTP request
+// heads larger than this are not worth routing.
+const maxPeek = 16*1024 + 5
+
+// Protocol identifies what was found at the start of a stream.
+type Protocol int
+
+const (
+	// Unknown means neither HTTP nor TLS was recognised.
+	Unknown Protocol = iota
+	// HTTP is a plaintext HTTP/1.x request.
+	HTTP
+	// TLS is a TLS handshake beginning with a ClientHello.
+	TLS
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case HTTP:
+		return "http"
+	case TLS:
+		return "tls"
+	default:
+		return "unknown"
+	}
+}
+
+// Conn is a [net.Conn] whose leading bytes are buffered so they can be
+// inspected with Peek and still be returned by Read.
+type Conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewConn wraps c for peeking.
+func NewConn(c net.Conn) *Conn {
+	return &Conn{Conn: c, r: bufio.NewReaderSize(c, maxPeek)}
+}
+
+// Read returns buffered bytes first, then reads from the connection.
+func (c *Conn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// CloseWrite half-closes the underlying connection when supported.
+func (c *Conn) CloseWrite() error { return util.CloseWrite(c.Conn) }
+
+// peekAtLeast returns at least n buffered bytes (more if already
+// available) without consuming them.
+func (c *Conn) peekAtLeast(n int) ([]byte, error) {
+	if b := c.r.Buffered(); b > n {
+		n = b
+	}
+	return c.r.Peek(n)
+}
+
+// ServerName sniffs the requested host name from the start of the
+// stream.  It waits at most timeout for the client to send enough
+// data; an empty name with a nil error means the stream carried no
+// recognisable host (e.g. a non-HTTP protocol or a ClientHello
+// without SNI).  No bytes are consumed.
+func ServerName(c *Conn, timeout time.Duration) (string, Protocol, error) {
+	if timeout > 0 {
+		c.SetReadDeadline(time.Now().Add(timeout)) //nolint:errcheck
+		defer c.SetReadDeadline(time.Time{})       //nolint:errcheck
+	}
+
+	first, err := c.peekAtLeast(1)
+	if err != nil {
+		return "", Unknown, err
+	}
+
+	if first[0] == recordTypeHandshake {
+		name, err := c.tlsServerName()
+		return name, TLS, err
+	}
+	if looksLikeHTTP(first) {
+		name, err := c.httpHost()
+		return name, HTTP, err
+	}
+	return "", Unknown, nil
+}
+
+// NormalizeHost lower-cases a host name and strips any port and
+// trailing dot so it can be compared against route patterns.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
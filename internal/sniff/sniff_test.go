@@ -0,0 +1,180 @@
+package sniff
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServerName_HTTP verifies the Host header is found without
+// consuming the request.
+func TestServerName_HTTP(t *testing.T) {
+	req := "GET / HTTP/1.1\r\nUser-Agent: test\r\nHost: API.Example.com:8080\r\n\r\n"
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		client.Write([]byte(req)) //nolint:errcheck
+	}()
+
+	sc := NewConn(server)
+	host, proto, err := ServerName(sc, time.Second)
+	if err != nil {
+		t.Fatalf("ServerName: %v", err)
+	}
+	if proto != HTTP {
+		t.Errorf("proto = %v, want http", proto)
+	}
+	if host != "api.example.com" {
+		t.Errorf("host = %q, want %q", host, "api.example.com")
+	}
+
+	got := make([]byte, len(req))
+	if _, err := io.ReadFull(sc, got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(got) != req {
+		t.Errorf("replayed bytes = %q, want %q", got, req)
+	}
+}
+
+// TestServerName_TLS verifies SNI is extracted from a real ClientHello.
+func TestServerName_TLS(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		c := tls.Client(client, &tls.Config{ServerName: "web.example", InsecureSkipVerify: true}) //nolint:gosec
+		c.Handshake()                                                                             //nolint:errcheck
+	}()
+
+	sc := NewConn(server)
+	host, proto, err := ServerName(sc, 2*time.Second)
+	if err != nil {
+		t.Fatalf("ServerName: %v", err)
+	}
+	if proto != TLS {
+		t.Errorf("proto = %v, want tls", proto)
+	}
+	if host != "web.example" {
+		t.Errorf("host = %q, want %q", host, "web.example")
+	}
+
+	// The first byte must still be the TLS record type.
+	b := make([]byte, 1)
+	if _, err := sc.Read(b); err != nil || b[0] != recordTypeHandshake {
+		t.Errorf("first byte = %#x (%v), want 0x16", b[0], err)
+	}
+	client.Close()
+}
+
+// TestServerName_Unknown verifies non-HTTP, non-TLS data is left alone.
+func TestServerName_Unknown(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		client.Write([]byte("SSH-2.0-OpenSSH_9.0\r\n")) //nolint:errcheck
+	}()
+
+	host, proto, err := ServerName(NewConn(server), time.Second)
+	if err != nil {
+		t.Fatalf("ServerName: %v", err)
+	}
+	if host != "" || proto != Unknown {
+		t.Errorf("got (%q, %v), want (\"\", unknown)", host, proto)
+	}
+}
+
+// TestServerName_Timeout verifies a silent client doesn't block
+// routing beyond the timeout.
+func TestServerName_Timeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\n")) //nolint:errcheck
+	}()
+
+	start := time.Now()
+	host, _, _ := ServerName(NewConn(server), 200*time.Millisecond)
+	if host != "" {
+		t.Errorf("host = %q, want empty", host)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ServerName took %v", elapsed)
+	}
+}
+
+func TestParseHTTPHost(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantHost string
+		wantDone bool
+	}{
+		{"GET / HTTP/1.1\r\nHost: a.example\r\n\r\n", "a.example", true},
+		{"POST /x HTTP/1.1\nhost:b.example\n\n", "b.example", true},
+		{"GET / HTTP/1.0\r\n\r\n", "", true},
+		{"GET / HTTP/1.1\r\nHo", "", false},
+		{"GET / HTTP/1.1\r\nHost: [::1]:80\r\n", "::1", true},
+	}
+	for _, tt := range tests {
+		host, done := parseHTTPHost([]byte(tt.in))
+		if host != tt.wantHost || done != tt.wantDone {
+			t.Errorf("parseHTTPHost(%q) = (%q, %v), want (%q, %v)",
+				tt.in, host, done, tt.wantHost, tt.wantDone)
+		}
+	}
+}
+
+func TestTable_Lookup(t *testing.T) {
+	table := NewTable("127.0.0.1:3000")
+	for pattern, target := range map[string]string{
+		"api.example":       "127.0.0.1:8080",
+		"*.example":         "127.0.0.1:9000",
+		"*.dev.example":     "127.0.0.1:9100",
+		"exact.dev.example": "127.0.0.1:9200",
+	} {
+		if err := table.Add(pattern, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		host        string
+		wantTarget  string
+		wantMatched bool
+	}{
+		{"api.example", "127.0.0.1:8080", true},
+		{"API.EXAMPLE:443", "127.0.0.1:8080", true},
+		{"web.example", "127.0.0.1:9000", true},
+		{"x.dev.example", "127.0.0.1:9100", true},
+		{"exact.dev.example", "127.0.0.1:9200", true},
+		{"example", "127.0.0.1:3000", false},
+		{"other.test", "127.0.0.1:3000", false},
+		{"", "127.0.0.1:3000", false},
+	}
+	for _, tt := range tests {
+		target, matched := table.Lookup(tt.host)
+		if target != tt.wantTarget || matched != tt.wantMatched {
+			t.Errorf("Lookup(%q) = (%q, %v), want (%q, %v)",
+				tt.host, target, matched, tt.wantTarget, tt.wantMatched)
+		}
+	}
+}
+
+func TestTable_AddInvalid(t *testing.T) {
+	table := NewTable("")
+	if err := table.Add("a.*.example", "127.0.0.1:1"); err == nil {
+		t.Error("expected error for mid-pattern wildcard")
+	}
+	if err := table.Add("a.example", ""); err == nil {
+		t.Error("expected error for empty target")
+	}
+	if err := table.Add("*", "127.0.0.1:2"); err != nil {
+		t.Fatal(err)
+	}
+	if table.Default() != "127.0.0.1:2" {
+		t.Errorf("default = %q", table.Default())
+	}
+}
@@ -0,0 +1,81 @@
+package sniff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table maps host names to backend addresses.  Patterns are either an
+// exact host ("api.example.com") or a leading wildcard
+// ("*.example.com") that matches any subdomain.  Exact matches win,
+// then the longest wildcard; unmatched names go to the default.
+type Table struct {
+	exact     map[string]string
+	wildcards []wildcardRoute // sorted longest suffix first
+	def       string
+}
+
+type wildcardRoute struct {
+	suffix string // ".example.com"
+	target string
+}
+
+// NewTable returns an empty table whose unmatched lookups resolve to
+// def (which may be empty to signal "no route").
+func NewTable(def string) *Table {
+	return &Table{exact: make(map[string]string), def: def}
+}
+
+// Add registers a route.  Adding the same pattern twice replaces the
+// earlier target.
+func (t *Table) Add(pattern, target string) error {
+	if target == "" {
+		return fmt.Errorf("route %q: empty target", pattern)
+	}
+	p := NormalizeHost(pattern)
+	switch {
+	case p == "" || p == "*":
+		t.def = target
+	case strings.HasPrefix(p, "*."):
+		suffix := p[1:]
+		for i, w := range t.wildcards {
+			if w.suffix == suffix {
+				t.wildcards[i].target = target
+				return nil
+			}
+		}
+		t.wildcards = append(t.wildcards, wildcardRoute{suffix: suffix, target: target})
+		// Keep the most specific wildcard first.
+		for i := len(t.wildcards) - 1; i > 0 && len(t.wildcards[i].suffix) > len(t.wildcards[i-1].suffix); i-- {
+			t.wildcards[i], t.wildcards[i-1] = t.wildcards[i-1], t.wildcards[i]
+		}
+	case strings.Contains(p, "*"):
+		return fmt.Errorf("route %q: wildcard must be a leading \"*.\"", pattern)
+	default:
+		t.exact[p] = target
+	}
+	return nil
+}
+
+// Default returns the fallback target.
+func (t *Table) Default() string { return t.def }
+
+// Len returns the number of non-default routes.
+func (t *Table) Len() int { return len(t.exact) + len(t.wildcards) }
+
+// Lookup resolves host to a target.  matched is false when the
+// default was used.
+func (t *Table) Lookup(host string) (target string, matched bool) {
+	host = NormalizeHost(host)
+	if host != "" {
+		if target, ok := t.exact[host]; ok {
+			return target, true
+		}
+		for _, w := range t.wildcards {
+			if strings.HasSuffix(host, w.suffix) {
+				return w.target, true
+			}
+		}
+	}
+	return t.def, false
+}
@@ -0,0 +1,139 @@
+package sniff
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// TLS wire constants (RFC 8446 §5.1, §4, and RFC 6066 §3).
+const (
+	recordTypeHandshake  = 0x16
+	handshakeClientHello = 0x01
+	extensionServerName  = 0x0000
+	serverNameTypeHost   = 0x00
+	recordHeaderLen      = 5
+)
+
+var errMalformedHello = errors.New("malformed TLS ClientHello")
+
+// tlsServerName buffers the first TLS record and extracts the SNI
+// host name from the ClientHello it carries.
+func (c *Conn) tlsServerName() (string, error) {
+	hdr, err := c.peekAtLeast(recordHeaderLen)
+	if err != nil {
+		return "", nil
+	}
+	recLen := int(binary.BigEndian.Uint16(hdr[3:5]))
+	rec, err := c.peekAtLeast(recordHeaderLen + recLen)
+	if err != nil {
+		return "", nil
+	}
+	return parseClientHelloSNI(rec[recordHeaderLen : recordHeaderLen+recLen])
+}
+
+// parseClientHelloSNI walks a handshake message and returns the
+// host_name entry of its server_name extension, or "" when absent.
+func parseClientHelloSNI(msg []byte) (string, error) {
+	r := reader(msg)
+
+	typ, ok := r.u8()
+	if !ok || typ != handshakeClientHello {
+		return "", errMalformedHello
+	}
+	body, ok := r.vec(3)
+	if !ok {
+		// The hello is split across records; we only inspect the first.
+		return "", nil
+	}
+
+	r = reader(body)
+	if !r.skip(2 + 32) { // legacy_version + random
+		return "", errMalformedHello
+	}
+	for _, lenBytes := range []int{1, 2, 1} { // session_id, cipher_suites, compression
+		if _, ok := r.vec(lenBytes); !ok {
+			return "", errMalformedHello
+		}
+	}
+	if len(r) == 0 {
+		return "", nil // no extensions
+	}
+	exts, ok := r.vec(2)
+	if !ok {
+		return "", errMalformedHello
+	}
+
+	for len(exts) > 0 {
+		typ, ok1 := exts.u16()
+		data, ok2 := exts.vec(2)
+		if !ok1 || !ok2 {
+			return "", errMalformedHello
+		}
+		if typ != extensionServerName {
+			continue
+		}
+		list, ok := data.vec(2)
+		if !ok {
+			return "", errMalformedHello
+		}
+		for len(list) > 0 {
+			nameType, ok1 := list.u8()
+			name, ok2 := list.vec(2)
+			if !ok1 || !ok2 {
+				return "", errMalformedHello
+			}
+			if nameType == serverNameTypeHost {
+				return NormalizeHost(string(name)), nil
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// reader is a minimal cursor over big-endian length-prefixed data.
+type reader []byte
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) u8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+// vec reads a vector prefixed by an lenBytes-wide big-endian length.
+func (r *reader) vec(lenBytes int) (reader, bool) {
+	if len(*r) < lenBytes {
+		return nil, false
+	}
+	n := 0
+	for _, b := range (*r)[:lenBytes] {
+		n = n<<8 | int(b)
+	}
+	*r = (*r)[lenBytes:]
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
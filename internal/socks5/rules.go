@@ -0,0 +1,241 @@
+package socks5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAllowed is returned by [Rules.Check] for a destination the
+// rules refuse.
+var ErrNotAllowed = errors.New("socks5: destination not allowed")
+
+// Rule matches destinations by address and, optionally, port.
+type Rule struct {
+	Net  *net.IPNet // CIDR or single IP; nil for name rules
+	Host string     // exact name, "*.suffix", or "*" for any; "" for address rules
+	Port int        // 0 = any port
+}
+
+// ParseRule parses a --socks-allow / --socks-deny rule: a CIDR, an IP,
+// a host name, "*.example.com" or "*", with an optional ":port".
+// IPv6 addresses take a port only in brackets, e.g. "[::1]:22".
+func ParseRule(s string) (Rule, error) {
+	target, port := s, ""
+	if strings.HasPrefix(s, "[") {
+		host, p, err := net.SplitHostPort(s)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+		}
+		target, port = host, p
+	} else if strings.Count(s, ":") == 1 {
+		target, port, _ = strings.Cut(s, ":")
+	}
+
+	var r Rule
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Rule{}, fmt.Errorf("rule %q: invalid port %q", s, port)
+		}
+		r.Port = n
+	}
+
+	switch {
+	case target == "":
+		return Rule{}, fmt.Errorf("rule %q: empty address", s)
+	case strings.Contains(target, "/"):
+		_, ipnet, err := net.ParseCIDR(target)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+		}
+		r.Net = ipnet
+	case net.ParseIP(target) != nil:
+		ip := net.ParseIP(target)
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		r.Net = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	case target == "*", strings.HasPrefix(target, "*.") && !strings.Contains(target[2:], "*"):
+		r.Host = strings.ToLower(target)
+	case strings.Contains(target, "*"):
+		return Rule{}, fmt.Errorf("rule %q: wildcard must be a single leading \"*.\"", s)
+	default:
+		r.Host = strings.ToLower(strings.TrimSuffix(target, "."))
+	}
+	return r, nil
+}
+
+// String formats r the way ParseRule accepts it.
+func (r Rule) String() string {
+	target := r.Host
+	if r.Net != nil {
+		target = r.Net.String()
+		if ones, bits := r.Net.Mask.Size(); ones == bits {
+			target = r.Net.IP.String()
+		}
+	}
+	if r.Port == 0 {
+		return target
+	}
+	return net.JoinHostPort(target, strconv.Itoa(r.Port))
+}
+
+// Match reports whether r admits host, an IP literal or a name, on
+// port.  Names are taken as given and not resolved, so address rules
+// only match IP literals.
+func (r Rule) Match(host string, port int) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return r.matchIP(ip, port)
+	}
+	return r.matchName(host, port)
+}
+
+func (r Rule) portMatch(port int) bool { return r.Port == 0 || r.Port == port }
+
+// matchName reports whether a name rule matches host.
+func (r Rule) matchName(host string, port int) bool {
+	if r.Net != nil || !r.portMatch(port) {
+		return false
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	switch {
+	case r.Host == "*":
+		return true
+	case strings.HasPrefix(r.Host, "*."):
+		return strings.HasSuffix(host, r.Host[1:])
+	}
+	return host == r.Host
+}
+
+// matchIP reports whether an address rule matches ip.  "*" matches
+// every address too.
+func (r Rule) matchIP(ip net.IP, port int) bool {
+	if !r.portMatch(port) {
+		return false
+	}
+	if r.Net == nil {
+		return r.Host == "*"
+	}
+	return r.Net.Contains(ip)
+}
+
+// ── Rules ────────────────────────────────────────────────────────────
+
+// Rules decides which destinations the server dials.  Deny rules win
+// over allow rules; with any allow rules, a destination must match
+// one of them.  A nil *Rules allows everything.
+//
+// Name rules match the name the client asked for.  Address rules
+// match the IPs it resolves to: a name is then resolved here, every
+// address must pass, and the server dials the first one, so a second
+// lookup cannot answer differently.
+//
+// With RemoteNames, names are resolved on the far side of the dialer,
+// e.g. by the SSH gateway of -T, where a local lookup may fail or
+// answer differently.  A name that only address rules can decide is
+// then refused without a lookup.
+type Rules struct {
+	Allow       []Rule
+	Deny        []Rule
+	Resolver    *net.Resolver // defaults to net.DefaultResolver
+	RemoteNames bool          // the dialer resolves names elsewhere (-T)
+}
+
+// Check vets host:port and returns the address to dial: host:port
+// itself, or a resolved IP when address rules needed one.  Refused
+// destinations return an error wrapping ErrNotAllowed.
+func (r *Rules) Check(ctx context.Context, host string, port int) (string, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if r == nil || len(r.Allow)+len(r.Deny) == 0 {
+		return addr, nil
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		for _, rule := range r.Deny {
+			if rule.matchName(host, port) {
+				return "", fmt.Errorf("%w: %s (deny %s)", ErrNotAllowed, addr, rule)
+			}
+		}
+		if !r.needsAddress(host, port) {
+			if err := r.allowName(host, port); err != nil {
+				return "", err
+			}
+			return addr, nil
+		}
+		if r.RemoteNames {
+			return "", fmt.Errorf("%w: %s: address rules cannot check a name the tunnel resolves; ask by IP or add a host rule", ErrNotAllowed, addr)
+		}
+		var err error
+		if ips, err = r.lookup(ctx, host); err != nil {
+			// Address rules cannot be checked, so refuse.
+			return "", fmt.Errorf("%w: %s: address rules need a lookup: %v", ErrNotAllowed, addr, err)
+		}
+	}
+
+	for _, ip := range ips {
+		for _, rule := range r.Deny {
+			if rule.matchIP(ip, port) {
+				return "", fmt.Errorf("%w: %s (%s, deny %s)", ErrNotAllowed, addr, ip, rule)
+			}
+		}
+	}
+	if len(r.Allow) > 0 && !slices.ContainsFunc(r.Allow, func(rule Rule) bool { return rule.matchName(host, port) }) {
+		for _, ip := range ips {
+			if !slices.ContainsFunc(r.Allow, func(rule Rule) bool { return rule.matchIP(ip, port) }) {
+				return "", fmt.Errorf("%w: %s (%s matches no allow rule)", ErrNotAllowed, addr, ip)
+			}
+		}
+	}
+	return net.JoinHostPort(ips[0].String(), strconv.Itoa(port)), nil
+}
+
+// needsAddress reports whether a name must be resolved to decide:
+// there are address deny rules, or address allow rules and no name
+// rule allows it outright.
+func (r *Rules) needsAddress(host string, port int) bool {
+	for _, rule := range r.Deny {
+		if rule.Net != nil && rule.portMatch(port) {
+			return true
+		}
+	}
+	if slices.ContainsFunc(r.Allow, func(rule Rule) bool { return rule.matchName(host, port) }) {
+		return false
+	}
+	return slices.ContainsFunc(r.Allow, func(rule Rule) bool { return rule.Net != nil && rule.portMatch(port) })
+}
+
+// allowName checks a name against the allow rules alone.
+func (r *Rules) allowName(host string, port int) error {
+	if len(r.Allow) == 0 || slices.ContainsFunc(r.Allow, func(rule Rule) bool { return rule.matchName(host, port) }) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s matches no allow rule", ErrNotAllowed, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func (r *Rules) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	res := r.Resolver
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	addrs, err := res.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
@@ -0,0 +1,281 @@
+// Package socks5 implements the server side of SOCKS5 (RFC 1928)
+// with username/password authentication (RFC 1929), for --socks.
+//
+// Handshake negotiates authentication and reads the client's request;
+// the caller then checks it against Rules, dials, and answers with
+// Reply.  UDP ASSOCIATE is served by a UDPRelay.  BIND is not
+// supported.
+package socks5
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+// Version is the SOCKS protocol version byte.
+const Version = 5
+
+// Request commands.
+const (
+	CmdConnect      byte = 1
+	CmdBind         byte = 2
+	CmdUDPAssociate byte = 3
+)
+
+// Reply codes.
+const (
+	ReplySucceeded          byte = 0
+	ReplyFailure            byte = 1
+	ReplyNotAllowed         byte = 2
+	ReplyNetworkUnreachable byte = 3
+	ReplyHostUnreachable    byte = 4
+	ReplyConnectionRefused  byte = 5
+	ReplyTTLExpired         byte = 6
+	ReplyCommandUnsupported byte = 7
+	ReplyAddressUnsupported byte = 8
+)
+
+// Address types.
+const (
+	atypIPv4   byte = 1
+	atypDomain byte = 3
+	atypIPv6   byte = 4
+)
+
+// Authentication methods.
+const (
+	methodNoAuth       byte = 0
+	methodUserPass     byte = 2
+	methodNoAcceptable byte = 0xff
+
+	userPassVersion byte = 1
+)
+
+var (
+	// ErrAuth is returned by Handshake when the client offers no
+	// acceptable method or wrong credentials.
+	ErrAuth = errors.New("socks5: authentication failed")
+	// ErrUnsupportedAddress is returned for an unknown address type.
+	ErrUnsupportedAddress = errors.New("socks5: unsupported address type")
+)
+
+// Request is a client's command and destination.
+type Request struct {
+	Command byte
+	Host    string // IP literal or domain name
+	Port    int
+	User    string // authenticated user; "" without authentication
+}
+
+// Address returns the destination as host:port.
+func (r *Request) Address() string {
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+}
+
+// ── Server handshake ─────────────────────────────────────────────────
+
+// Handshake negotiates authentication on rw and reads the request.
+// With users set, the client must log in with one of them; otherwise
+// no authentication is asked for.  Failures that have a protocol
+// answer are answered before Handshake returns.
+func Handshake(rw io.ReadWriter, users map[string]string) (*Request, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+		return nil, fmt.Errorf("socks5: read greeting: %w", err)
+	}
+	if hdr[0] != Version {
+		return nil, fmt.Errorf("socks5: unsupported version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(rw, methods); err != nil {
+		return nil, fmt.Errorf("socks5: read methods: %w", err)
+	}
+
+	want := methodNoAuth
+	if len(users) > 0 {
+		want = methodUserPass
+	}
+	if !slices.Contains(methods, want) {
+		rw.Write([]byte{Version, methodNoAcceptable}) //nolint:errcheck
+		return nil, ErrAuth
+	}
+	if _, err := rw.Write([]byte{Version, want}); err != nil {
+		return nil, err
+	}
+
+	var user string
+	if want == methodUserPass {
+		var err error
+		if user, err = login(rw, users); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := readRequest(rw)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedAddress) {
+			Reply(rw, ReplyAddressUnsupported, nil) //nolint:errcheck
+		}
+		return nil, err
+	}
+	req.User = user
+	return req, nil
+}
+
+// login runs the RFC 1929 sub-negotiation.
+func login(rw io.ReadWriter, users map[string]string) (string, error) {
+	var ver [1]byte
+	if _, err := io.ReadFull(rw, ver[:]); err != nil {
+		return "", fmt.Errorf("socks5: read login: %w", err)
+	}
+	if ver[0] != userPassVersion {
+		return "", fmt.Errorf("socks5: unsupported login version %d", ver[0])
+	}
+	user, err := readString(rw)
+	if err != nil {
+		return "", err
+	}
+	pass, err := readString(rw)
+	if err != nil {
+		return "", err
+	}
+	want, ok := users[user]
+	// Compare even for unknown users so timing does not reveal them.
+	match := subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1
+	if !ok || !match {
+		rw.Write([]byte{userPassVersion, 1}) //nolint:errcheck
+		return "", fmt.Errorf("%w for user %q", ErrAuth, user)
+	}
+	if _, err := rw.Write([]byte{userPassVersion, 0}); err != nil {
+		return "", err
+	}
+	return user, nil
+}
+
+func readRequest(r io.Reader) (*Request, error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("socks5: read request: %w", err)
+	}
+	if hdr[0] != Version {
+		return nil, fmt.Errorf("socks5: unsupported version %d", hdr[0])
+	}
+	host, port, err := readAddr(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{Command: hdr[1], Host: host, Port: port}, nil
+}
+
+// readAddr reads ATYP, address and port.
+func readAddr(r io.Reader) (string, int, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return "", 0, err
+	}
+	var host string
+	switch atyp[0] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, 4)
+		if atyp[0] == atypIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case atypDomain:
+		name, err := readString(r)
+		if err != nil {
+			return "", 0, err
+		}
+		host = name
+	default:
+		return "", 0, ErrUnsupportedAddress
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(port[:])), nil
+}
+
+// readString reads a length-prefixed string.
+func readString(r io.Reader) (string, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", err
+	}
+	b := make([]byte, n[0])
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ── Replies ──────────────────────────────────────────────────────────
+
+// Reply answers a request with code and the bound address, which
+// defaults to 0.0.0.0:0.
+func Reply(w io.Writer, code byte, bound net.Addr) error {
+	b := []byte{Version, code, 0}
+	b = appendAddr(b, bound)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReplyCode maps a dial error to the closest reply code.
+func ReplyCode(err error) byte {
+	switch {
+	case err == nil:
+		return ReplySucceeded
+	case errors.Is(err, ErrNotAllowed):
+		return ReplyNotAllowed
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReplyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return ReplyNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return ReplyHostUnreachable
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ReplyHostUnreachable
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ReplyTTLExpired
+	}
+	return ReplyFailure
+}
+
+// appendAddr appends ATYP, address and port for addr.  Addresses other
+// than TCP/UDP IPs are written as 0.0.0.0:0.
+func appendAddr(b []byte, addr net.Addr) []byte {
+	var ip net.IP
+	var port int
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	}
+	switch {
+	case ip.To4() != nil:
+		b = append(b, atypIPv4)
+		b = append(b, ip.To4()...)
+	case ip != nil:
+		b = append(b, atypIPv6)
+		b = append(b, ip.To16()...)
+	default:
+		b = append(b, atypIPv4, 0, 0, 0, 0)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port))
+}
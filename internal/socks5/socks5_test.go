@@ -0,0 +1,369 @@
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// ── Handshake ────────────────────────────────────────────────────────
+
+// clientHandshake writes a client's greeting, optional login and
+// request to a buffer.
+func clientHandshake(user, pass string, cmd byte, atyp byte, addr []byte, port uint16) []byte {
+	var b []byte
+	if user != "" {
+		b = append(b, Version, 1, methodUserPass, userPassVersion, byte(len(user)))
+		b = append(b, user...)
+		b = append(b, byte(len(pass)))
+		b = append(b, pass...)
+	} else {
+		b = append(b, Version, 1, methodNoAuth)
+	}
+	b = append(b, Version, cmd, 0, atyp)
+	b = append(b, addr...)
+	return append(b, byte(port>>8), byte(port))
+}
+
+// rw reads a scripted client and records the server's answers.
+type rw struct {
+	in  io.Reader
+	out bytes.Buffer
+}
+
+func (c *rw) Read(p []byte) (int, error)  { return c.in.Read(p) }
+func (c *rw) Write(p []byte) (int, error) { return c.out.Write(p) }
+
+func TestHandshake(t *testing.T) {
+	users := map[string]string{"alice": "s3cret"}
+	domain := append([]byte{11}, "example.com"...)
+
+	tests := []struct {
+		name    string
+		users   map[string]string
+		in      []byte
+		want    Request
+		wantErr error
+		reply   []byte
+	}{
+		{
+			name:  "no auth, domain",
+			in:    clientHandshake("", "", CmdConnect, atypDomain, domain, 443),
+			want:  Request{Command: CmdConnect, Host: "example.com", Port: 443},
+			reply: []byte{Version, methodNoAuth},
+		},
+		{
+			name:  "no auth, IPv6",
+			in:    clientHandshake("", "", CmdUDPAssociate, atypIPv6, net.ParseIP("::1"), 53),
+			want:  Request{Command: CmdUDPAssociate, Host: "::1", Port: 53},
+			reply: []byte{Version, methodNoAuth},
+		},
+		{
+			name:  "login",
+			users: users,
+			in:    clientHandshake("alice", "s3cret", CmdConnect, atypIPv4, []byte{10, 0, 0, 1}, 22),
+			want:  Request{Command: CmdConnect, Host: "10.0.0.1", Port: 22, User: "alice"},
+			reply: []byte{Version, methodUserPass, userPassVersion, 0},
+		},
+		{
+			name:    "wrong password",
+			users:   users,
+			in:      clientHandshake("alice", "guess", CmdConnect, atypIPv4, []byte{10, 0, 0, 1}, 22),
+			wantErr: ErrAuth,
+			reply:   []byte{Version, methodUserPass, userPassVersion, 1},
+		},
+		{
+			name:    "unknown user",
+			users:   users,
+			in:      clientHandshake("mallory", "s3cret", CmdConnect, atypIPv4, []byte{10, 0, 0, 1}, 22),
+			wantErr: ErrAuth,
+			reply:   []byte{Version, methodUserPass, userPassVersion, 1},
+		},
+		{
+			name:    "no acceptable method",
+			users:   users,
+			in:      clientHandshake("", "", CmdConnect, atypIPv4, []byte{10, 0, 0, 1}, 22),
+			wantErr: ErrAuth,
+			reply:   []byte{Version, methodNoAcceptable},
+		},
+		{
+			name:    "bad address type",
+			in:      clientHandshake("", "", CmdConnect, 9, nil, 0),
+			wantErr: ErrUnsupportedAddress,
+			reply:   []byte{Version, methodNoAuth, Version, ReplyAddressUnsupported, 0, atypIPv4, 0, 0, 0, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &rw{in: bytes.NewReader(tt.in)}
+			req, err := Handshake(conn, tt.users)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && *req != tt.want {
+				t.Errorf("request = %+v, want %+v", *req, tt.want)
+			}
+			if !bytes.Equal(conn.out.Bytes(), tt.reply) {
+				t.Errorf("replies = %v, want %v", conn.out.Bytes(), tt.reply)
+			}
+		})
+	}
+}
+
+func TestReply(t *testing.T) {
+	var buf bytes.Buffer
+	Reply(&buf, ReplySucceeded, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1080}) //nolint:errcheck
+	want := []byte{Version, 0, 0, atypIPv4, 192, 0, 2, 1, 0x04, 0x38}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("reply = %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestReplyCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want byte
+	}{
+		{nil, ReplySucceeded},
+		{ErrNotAllowed, ReplyNotAllowed},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ReplyConnectionRefused},
+		{&net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}, ReplyHostUnreachable},
+		{errors.New("boom"), ReplyFailure},
+	}
+	for _, tt := range tests {
+		if got := ReplyCode(tt.err); got != tt.want {
+			t.Errorf("ReplyCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// ── Rules ────────────────────────────────────────────────────────────
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{in: "10.1.2.3", want: "10.1.2.3"},
+		{in: "10.1.2.3:22", want: "10.1.2.3:22"},
+		{in: "2001:db8::/32", want: "2001:db8::/32"},
+		{in: "::1", want: "::1"},
+		{in: "[::1]:22", want: "[::1]:22"},
+		{in: "Example.COM.", want: "example.com"},
+		{in: "*.corp.example:443", want: "*.corp.example:443"},
+		{in: "*", want: "*"},
+		{in: "*:25", want: "*:25"},
+		{in: "", wantErr: true},
+		{in: "host:0", wantErr: true},
+		{in: "host:http", wantErr: true},
+		{in: "api.*.example", wantErr: true},
+		{in: "*.*.example", wantErr: true},
+		{in: "10.0.0.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRule(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && r.String() != tt.want {
+			t.Errorf("ParseRule(%q) = %s, want %s", tt.in, r, tt.want)
+		}
+	}
+}
+
+func rules(t *testing.T, allow, deny []string) *Rules {
+	t.Helper()
+	r := &Rules{}
+	for _, s := range allow {
+		rule, err := ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Allow = append(r.Allow, rule)
+	}
+	for _, s := range deny {
+		rule, err := ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Deny = append(r.Deny, rule)
+	}
+	return r
+}
+
+func TestRulesCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny []string
+		host        string
+		port        int
+		want        string // "" = refused
+	}{
+		{name: "no rules", host: "example.com", port: 80, want: "example.com:80"},
+		{name: "deny CIDR", deny: []string{"169.254.0.0/16"}, host: "169.254.169.254", port: 80},
+		{name: "deny port", deny: []string{"*:25"}, host: "192.0.2.1", port: 25},
+		{name: "other port", deny: []string{"*:25"}, host: "192.0.2.1", port: 587, want: "192.0.2.1:587"},
+		{name: "allow CIDR", allow: []string{"10.0.0.0/8"}, host: "10.1.2.3", port: 22, want: "10.1.2.3:22"},
+		{name: "outside allow", allow: []string{"10.0.0.0/8"}, host: "192.0.2.1", port: 22},
+		{name: "allow name", allow: []string{"*.corp.example"}, host: "db.corp.example", port: 5432, want: "db.corp.example:5432"},
+		{name: "name outside allow", allow: []string{"*.corp.example"}, host: "example.com", port: 443},
+		{name: "deny name wins", allow: []string{"*"}, deny: []string{"secret.corp.example"}, host: "SECRET.corp.example", port: 22},
+		{name: "deny resolved name", deny: []string{"127.0.0.0/8", "::1"}, host: "localhost", port: 22},
+		{name: "unresolvable name", deny: []string{"127.0.0.0/8"}, host: "no-such-host.invalid", port: 22},
+		{name: "name allow skips lookup", allow: []string{"no-such-host.invalid"}, host: "no-such-host.invalid", port: 22, want: "no-such-host.invalid:22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rules(t, tt.allow, tt.deny).Check(context.Background(), tt.host, tt.port)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNotAllowed) {
+					t.Errorf("Check = %q, %v; want ErrNotAllowed", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Check = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	var nilRules *Rules
+	if got, err := nilRules.Check(context.Background(), "example.com", 80); err != nil || got != "example.com:80" {
+		t.Errorf("nil Rules: Check = %q, %v", got, err)
+	}
+}
+
+func TestRulesCheck_DialsResolvedAddress(t *testing.T) {
+	r := rules(t, nil, []string{"192.0.2.0/24"})
+	got, err := r.Check(context.Background(), "localhost", 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _, _ := net.SplitHostPort(got); net.ParseIP(host) == nil || !net.ParseIP(host).IsLoopback() {
+		t.Errorf("Check = %q, want a resolved loopback address", got)
+	}
+}
+
+func TestRulesCheck_RemoteNames(t *testing.T) {
+	r := rules(t, []string{"*.corp.example"}, []string{"169.254.0.0/16"})
+	r.RemoteNames = true
+	// The deny CIDR needs a lookup for any name; addresses match no
+	// allow rule.
+	for _, host := range []string{"db.corp.example", "localhost", "169.254.169.254", "10.1.2.3"} {
+		if got, err := r.Check(context.Background(), host, 22); !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("Check(%s) = %q, %v; want ErrNotAllowed", host, got, err)
+		}
+	}
+	_, err := r.Check(context.Background(), "db.corp.example", 22)
+	if err == nil || !strings.Contains(err.Error(), "tunnel resolves") {
+		t.Errorf("Check error %v does not explain the refusal", err)
+	}
+
+	// Host rules alone never need a lookup.
+	r = rules(t, []string{"*.corp.example"}, []string{"secret.corp.example"})
+	r.RemoteNames = true
+	if got, err := r.Check(context.Background(), "db.corp.example", 22); err != nil || got != "db.corp.example:22" {
+		t.Errorf("Check = %q, %v; want the name passed through", got, err)
+	}
+}
+
+// ── UDP ──────────────────────────────────────────────────────────────
+
+func TestDatagram_RoundTrip(t *testing.T) {
+	for _, host := range []string{"192.0.2.1", "2001:db8::1", "dns.example"} {
+		b := AppendDatagram(nil, host, 53, []byte("query"))
+		gotHost, port, payload, err := ParseDatagram(b)
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		if gotHost != host || port != 53 || string(payload) != "query" {
+			t.Errorf("%s: got %s:%d %q", host, gotHost, port, payload)
+		}
+	}
+
+	frag := AppendDatagram(nil, "192.0.2.1", 53, nil)
+	frag[2] = 1
+	if _, _, _, err := ParseDatagram(frag); !errors.Is(err, ErrFragment) {
+		t.Errorf("fragment: err = %v, want ErrFragment", err)
+	}
+	if _, _, _, err := ParseDatagram([]byte{0, 0, 0, atypIPv4, 1}); err == nil {
+		t.Error("truncated datagram should fail")
+	}
+}
+
+func TestUDPRelay(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(bytes.ToUpper(buf[:n]), from) //nolint:errcheck
+		}
+	}()
+
+	relayConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d net.Dialer
+	relay := &UDPRelay{
+		Conn:   relayConn,
+		Client: net.IPv4(127, 0, 0, 1),
+		Dial:   d.DialContext,
+		Rules:  rules(t, nil, []string{"192.0.2.0/24"}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Serve(ctx) }()
+
+	client, err := net.DialUDP("udp", nil, relayConn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A denied destination is dropped; the allowed one is relayed.
+	target := echo.LocalAddr().(*net.UDPAddr)
+	client.Write(AppendDatagram(nil, "192.0.2.1", 53, []byte("dropped")))            //nolint:errcheck
+	client.Write(AppendDatagram(nil, target.IP.String(), target.Port, []byte("hi"))) //nolint:errcheck
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	buf := make([]byte, 1500)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, payload, err := ParseDatagram(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "127.0.0.1" || port != target.Port || string(payload) != "HI" {
+		t.Errorf("reply = %s:%d %q", host, port, payload)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+}
@@ -0,0 +1,205 @@
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"gonc/util"
+)
+
+const (
+	// maxDatagram is the largest UDP payload.
+	maxDatagram = 64 * 1024
+	// maxUpstreams caps the destinations one association may reach,
+	// each of which holds a socket open.
+	maxUpstreams = 256
+)
+
+// ErrFragment is returned by ParseDatagram for fragmented datagrams,
+// which are not supported.
+var ErrFragment = errors.New("socks5: fragmented datagram")
+
+// ParseDatagram splits a client's UDP ASSOCIATE datagram into its
+// destination and payload.
+func ParseDatagram(b []byte) (host string, port int, payload []byte, err error) {
+	if len(b) < 4 {
+		return "", 0, nil, errors.New("socks5: short datagram")
+	}
+	if b[2] != 0 {
+		return "", 0, nil, ErrFragment
+	}
+	r := &sliceReader{b: b[3:]}
+	if host, port, err = readAddr(r); err != nil {
+		return "", 0, nil, fmt.Errorf("socks5: datagram header: %w", err)
+	}
+	return host, port, r.b, nil
+}
+
+// AppendDatagram appends a datagram header for host:port, then
+// payload, to b.
+func AppendDatagram(b []byte, host string, port int, payload []byte) []byte {
+	b = append(b, 0, 0, 0)
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		b = append(b, atypIPv4)
+		b = append(b, ip.To4()...)
+	case ip != nil:
+		b = append(b, atypIPv6)
+		b = append(b, ip.To16()...)
+	default:
+		b = append(b, atypDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(port))
+	return append(b, payload...)
+}
+
+type sliceReader struct{ b []byte }
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, errors.New("short datagram")
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+// ── Relay ────────────────────────────────────────────────────────────
+
+// DialFunc opens an upstream connection, e.g. transport.Dialer.Dial.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// UDPRelay serves one UDP ASSOCIATE: datagrams from the client are
+// unwrapped and sent on from a socket per destination, and replies
+// are wrapped and returned.  Only datagrams from the client's IP are
+// accepted; the first one fixes its port.
+type UDPRelay struct {
+	Conn   *net.UDPConn // the relay socket announced to the client
+	Client net.IP
+	Dial   DialFunc
+	Rules  *Rules // optional; checked once per destination
+	Logger *util.Logger
+
+	mu        sync.Mutex
+	client    *net.UDPAddr
+	upstreams map[string]net.Conn // by host:port as the client named it
+	wg        sync.WaitGroup
+}
+
+// Serve relays until ctx is cancelled or Conn is closed, then closes
+// every upstream socket.
+func (r *UDPRelay) Serve(ctx context.Context) error {
+	if r.Logger == nil {
+		r.Logger = util.NewLogger(0)
+	}
+	r.upstreams = make(map[string]net.Conn)
+	stop := context.AfterFunc(ctx, func() { r.Conn.Close() })
+	defer stop()
+	defer func() {
+		r.mu.Lock()
+		for _, c := range r.upstreams {
+			c.Close()
+		}
+		r.mu.Unlock()
+		r.wg.Wait()
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := r.Conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !from.IP.Equal(r.Client) {
+			continue
+		}
+		r.mu.Lock()
+		if r.client == nil {
+			r.client = from
+		}
+		same := r.client.Port == from.Port
+		r.mu.Unlock()
+		if !same {
+			continue
+		}
+
+		host, port, payload, err := ParseDatagram(buf[:n])
+		if err != nil {
+			r.Logger.Debug("udp relay: %v", err)
+			continue
+		}
+		up, err := r.upstream(ctx, host, port)
+		if err != nil {
+			r.Logger.With("target", net.JoinHostPort(host, strconv.Itoa(port))).Verbose("udp relay: %v", err)
+			continue
+		}
+		up.Write(payload) //nolint:errcheck
+	}
+}
+
+// upstream returns the socket for host:port, dialling it on first use.
+func (r *UDPRelay) upstream(ctx context.Context, host string, port int) (net.Conn, error) {
+	key := net.JoinHostPort(host, strconv.Itoa(port))
+	r.mu.Lock()
+	up, ok := r.upstreams[key]
+	full := len(r.upstreams) >= maxUpstreams
+	r.mu.Unlock()
+	if ok {
+		return up, nil
+	}
+	if full {
+		return nil, fmt.Errorf("%s: too many destinations", key)
+	}
+
+	addr, err := r.Rules.Check(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+	if up, err = r.Dial(ctx, "udp", addr); err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	r.mu.Lock()
+	r.upstreams[key] = up
+	r.mu.Unlock()
+	r.Logger.With("target", key).Verbose("udp relay: %s → %s", r.client, key)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.replies(up, host, port)
+		// Redial on the next datagram, e.g. after ICMP unreachable.
+		r.mu.Lock()
+		if r.upstreams[key] == up {
+			delete(r.upstreams, key)
+		}
+		r.mu.Unlock()
+		up.Close()
+	}()
+	return up, nil
+}
+
+// replies returns datagrams from up to the client, labelled with the
+// destination the client named.
+func (r *UDPRelay) replies(up net.Conn, host string, port int) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := up.Read(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		client := r.client
+		r.mu.Unlock()
+		r.Conn.WriteToUDP(AppendDatagram(nil, host, port, buf[:n]), client) //nolint:errcheck
+	}
+}
@@ -0,0 +1,134 @@
+package tlsconf
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"gonc/internal/proxyproto"
+	"gonc/util"
+)
+
+// How a terminated client's identity reaches the upstream
+// (--tls-client-info).
+const (
+	InfoProxy   = "proxy"   // PROXY v2 SSL TLV, see [ClientTLV]
+	InfoHeaders = "headers" // HTTP request headers, see [ClientHeaders]
+)
+
+// HeaderPrefix starts every header set by [ClientHeaders].  Incoming
+// headers with this prefix are stripped by [InjectHeaders] so clients
+// cannot forge an identity.
+const HeaderPrefix = "X-Client-Cert-"
+
+// ── PROXY v2 ─────────────────────────────────────────────────────────
+
+// ClientTLV describes a terminated connection as a PROXY v2 SSL TLV:
+// the TLS version and cipher, and the client certificate's common
+// name when one was presented.
+func ClientTLV(cs tls.ConnectionState) proxyproto.TLV {
+	ssl := proxyproto.SSL{
+		Client:  proxyproto.ClientSSL,
+		Version: versionName(cs.Version),
+		Cipher:  tls.CipherSuiteName(cs.CipherSuite),
+	}
+	if len(cs.PeerCertificates) > 0 {
+		ssl.Client |= proxyproto.ClientCertConn | proxyproto.ClientCertSess
+		ssl.CN = cs.PeerCertificates[0].Subject.CommonName
+		ssl.Verified = len(cs.VerifiedChains) > 0
+	}
+	return ssl.TLV()
+}
+
+// versionName formats v the way PROXY v2 peers expect, e.g. "TLSv1.3".
+func versionName(v uint16) string {
+	return strings.Replace(tls.VersionName(v), "TLS ", "TLSv", 1)
+}
+
+// ── HTTP headers ─────────────────────────────────────────────────────
+
+// ClientHeaders returns the X-Client-Cert-* headers describing the
+// client certificate, or an empty header when none was presented.
+func ClientHeaders(cs tls.ConnectionState) http.Header {
+	h := http.Header{}
+	if len(cs.PeerCertificates) == 0 {
+		return h
+	}
+	cert := cs.PeerCertificates[0]
+	sum := sha256.Sum256(cert.Raw)
+	h.Set(HeaderPrefix+"Subject", cert.Subject.String())
+	h.Set(HeaderPrefix+"Issuer", cert.Issuer.String())
+	h.Set(HeaderPrefix+"Serial", cert.SerialNumber.Text(16))
+	h.Set(HeaderPrefix+"Fingerprint", hex.EncodeToString(sum[:]))
+	return h
+}
+
+// InjectHeaders returns conn with every HTTP/1 request read from it
+// rewritten to carry h, after removing any X-Client-Cert-* headers the
+// client sent.  After a CONNECT or an Upgrade request the rest of the
+// stream passes through untouched.  A stream that is not HTTP fails
+// the read with the parse error.
+func InjectHeaders(conn net.Conn, h http.Header) net.Conn {
+	pr, pw := io.Pipe()
+	go rewrite(bufio.NewReader(conn), h, pw)
+	return &headerConn{Conn: conn, r: pr}
+}
+
+// rewrite parses requests from br and writes them, amended, to pw.
+func rewrite(br *bufio.Reader, h http.Header, pw *io.PipeWriter) {
+	for {
+		req, err := http.ReadRequest(br)
+		if errors.Is(err, io.EOF) {
+			pw.Close()
+			return
+		}
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for k := range req.Header {
+			if strings.HasPrefix(k, HeaderPrefix) {
+				delete(req.Header, k)
+			}
+		}
+		for k, v := range h {
+			req.Header[k] = v
+		}
+		if _, ok := req.Header["User-Agent"]; !ok {
+			// An empty value stops Request.Write adding Go's default.
+			req.Header["User-Agent"] = []string{""}
+		}
+		raw := req.Method == http.MethodConnect || req.Header.Get("Upgrade") != ""
+		if err := req.Write(pw); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if raw {
+			_, err := io.Copy(pw, br)
+			pw.CloseWithError(err)
+			return
+		}
+	}
+}
+
+// headerConn reads the rewritten request stream.
+type headerConn struct {
+	net.Conn
+	r *io.PipeReader
+}
+
+func (c *headerConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *headerConn) Close() error {
+	c.r.Close()
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the connection when supported.
+func (c *headerConn) CloseWrite() error { return util.CloseWrite(c.Conn) }
@@ -0,0 +1,165 @@
+// Package tlsconf builds the TLS configurations gonc uses to terminate
+// TLS on accepted connections and to originate it on outbound ones.
+//
+// A Server holds the listening certificate behind an atomic pointer so
+// Reload can swap in a renewed certificate without dropping
+// connections: handshakes already in progress finish with the old one
+// and every later handshake uses the new.  WatchReload reloads on
+// SIGHUP.
+//
+// When client certificates are requested, the verified identity can be
+// passed to the upstream as PROXY v2 TLVs ([ClientTLV]) or as HTTP
+// request headers ([ClientHeaders] with [InjectHeaders]).
+package tlsconf
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gonc/util"
+)
+
+// ── Server ───────────────────────────────────────────────────────────
+
+// Server terminates TLS with a certificate that can be reloaded.
+type Server struct {
+	certFile string
+	keyFile  string
+	caFile   string // client CA; "" accepts clients without certificates
+	logger   *util.Logger
+
+	cfg atomic.Pointer[tls.Config]
+}
+
+// NewServer loads the certificate and key, and the client CA bundle
+// when caFile is set.  With a client CA every client must present a
+// certificate signed by it.
+func NewServer(certFile, keyFile, caFile string, logger *util.Logger) (*Server, error) {
+	if logger == nil {
+		logger = util.NewLogger(0)
+	}
+	s := &Server{certFile: certFile, keyFile: keyFile, caFile: caFile, logger: logger}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the certificate, key and client CA.  On error the
+// previous configuration stays in use.
+func (s *Server) Reload() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.caFile != "" {
+		pool, err := loadPool(s.caFile)
+		if err != nil {
+			return fmt.Errorf("load client CA: %w", err)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	s.cfg.Store(cfg)
+	return nil
+}
+
+// Config returns a listener configuration that picks up reloads.
+func (s *Server) Config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.cfg.Load(), nil
+		},
+	}
+}
+
+// Handshake runs the server side of a TLS handshake on conn, giving up
+// after timeout (0 = no limit).  On error conn is left open for the
+// caller to close.
+func (s *Server) Handshake(ctx context.Context, conn net.Conn, timeout time.Duration) (*tls.Conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tc := tls.Server(conn, s.Config())
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	return tc, nil
+}
+
+// WatchReload calls Reload on every SIGHUP until ctx is cancelled.  A
+// nil Server returns at once.
+func (s *Server) WatchReload(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			if err := s.Reload(); err != nil {
+				s.logger.Error("TLS reload: %v (keeping the previous certificate)", err)
+				continue
+			}
+			s.logger.Info("TLS certificate reloaded from %s", s.certFile)
+		}
+	}
+}
+
+// ── Client ───────────────────────────────────────────────────────────
+
+// ClientConfig returns a configuration for originating TLS.  caFile
+// replaces the system roots when set; certFile and keyFile give a
+// client certificate for mTLS upstreams; serverName overrides the name
+// verified against the upstream certificate (by default the dialled
+// host).
+func ClientConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// loadPool reads a PEM bundle of CA certificates.
+func loadPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New(file + ": no PEM certificates found")
+	}
+	return pool, nil
+}
@@ -0,0 +1,310 @@
+package tlsconf
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gonc/internal/proxyproto"
+)
+
+// ── test PKI ─────────────────────────────────────────────────────────
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // PEM bundle
+}
+
+func newCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a leaf certificate for cn, valid for localhost, and
+// returns its cert and key files.
+func (ca *testCA) issue(t *testing.T, dir, cn string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, cn+".crt")
+	keyFile = filepath.Join(dir, cn+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client with cfg to srv over a pipe and returns
+// both sides' connection states.
+func handshake(t *testing.T, srv *Server, cfg *tls.Config) (server, client tls.ConnectionState, err error) {
+	t.Helper()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan error, 1)
+	var tc *tls.Conn
+	go func() {
+		var err error
+		tc, err = srv.Handshake(context.Background(), a, 2*time.Second)
+		if err != nil {
+			a.Close()
+		}
+		done <- err
+	}()
+	cc := tls.Client(b, cfg)
+	cerr := cc.Handshake()
+	if cerr == nil {
+		// TLS 1.3 reports a rejected client certificate on first read.
+		cc.SetReadDeadline(time.Now().Add(50 * time.Millisecond)) //nolint:errcheck
+		if _, rerr := cc.Read(make([]byte, 1)); rerr != nil && !isTimeout(rerr) {
+			cerr = rerr
+		}
+	}
+	if serr := <-done; serr != nil {
+		return server, client, serr
+	}
+	if cerr != nil {
+		return server, client, cerr
+	}
+	return tc.ConnectionState(), cc.ConnectionState(), nil
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// ── Server ───────────────────────────────────────────────────────────
+
+func TestServerReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", 2)
+	srv, err := NewServer(certFile, keyFile, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ClientConfig(ca.file, "", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cs, err := handshake(t, srv, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.PeerCertificates[0].SerialNumber.Int64(); got != 2 {
+		t.Fatalf("serial = %d, want 2", got)
+	}
+
+	// Renew in place, as certbot would, then reload.
+	renewed, renewedKey := ca.issue(t, t.TempDir(), "server", 3)
+	for src, dst := range map[string]string{renewed: certFile, renewedKey: keyFile} {
+		b, _ := os.ReadFile(src)
+		os.WriteFile(dst, b, 0o600) //nolint:errcheck
+	}
+	if err := srv.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, cs, err = handshake(t, srv, client); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.PeerCertificates[0].SerialNumber.Int64(); got != 3 {
+		t.Errorf("serial after reload = %d, want 3", got)
+	}
+
+	// A broken file keeps the previous certificate in service.
+	os.WriteFile(keyFile, []byte("not a key"), 0o600) //nolint:errcheck
+	if err := srv.Reload(); err == nil {
+		t.Error("Reload with a bad key should fail")
+	}
+	if _, _, err := handshake(t, srv, client); err != nil {
+		t.Errorf("handshake after failed reload: %v", err)
+	}
+}
+
+func TestServerClientCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", 2)
+	aliceCert, aliceKey := ca.issue(t, dir, "alice", 4)
+	srv, err := NewServer(certFile, keyFile, ca.file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anon, _ := ClientConfig(ca.file, "", "", "localhost")
+	if _, _, err := handshake(t, srv, anon); err == nil {
+		t.Error("handshake without a client certificate should fail")
+	}
+
+	alice, err := ClientConfig(ca.file, aliceCert, aliceKey, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _, err := handshake(t, srv, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlv := ClientTLV(ss)
+	ssl, err := proxyproto.ParseSSL(tlv.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ssl.CN != "alice" || !ssl.Verified || ssl.Version != "TLSv1.3" || ssl.Cipher == "" {
+		t.Errorf("SSL TLV = %+v", ssl)
+	}
+	if ssl.Client != proxyproto.ClientSSL|proxyproto.ClientCertConn|proxyproto.ClientCertSess {
+		t.Errorf("client flags = %#x", ssl.Client)
+	}
+
+	h := ClientHeaders(ss)
+	if got := h.Get("X-Client-Cert-Subject"); got != "CN=alice" {
+		t.Errorf("subject header = %q", got)
+	}
+	if got := h.Get("X-Client-Cert-Serial"); got != "4" {
+		t.Errorf("serial header = %q", got)
+	}
+	if len(h.Get("X-Client-Cert-Fingerprint")) != 64 {
+		t.Errorf("fingerprint header = %q", h.Get("X-Client-Cert-Fingerprint"))
+	}
+}
+
+func TestNewServerErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", 2)
+	if _, err := NewServer(filepath.Join(dir, "missing.crt"), keyFile, "", nil); err == nil {
+		t.Error("missing certificate should fail")
+	}
+	if _, err := NewServer(certFile, keyFile, keyFile, nil); err == nil {
+		t.Error("a client CA without certificates should fail")
+	}
+	if _, err := ClientConfig(filepath.Join(dir, "missing.pem"), "", "", ""); err == nil {
+		t.Error("missing CA should fail")
+	}
+}
+
+// ── InjectHeaders ────────────────────────────────────────────────────
+
+func TestInjectHeaders(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	h := http.Header{"X-Client-Cert-Subject": {"CN=alice"}}
+	conn := InjectHeaders(server, h)
+	defer conn.Close()
+
+	go func() {
+		io.WriteString(client, "POST /a HTTP/1.1\r\nHost: app\r\nX-Client-Cert-Subject: CN=mallory\r\nX-Client-Cert-Verified: yes\r\nContent-Length: 5\r\n\r\nhello") //nolint:errcheck
+		io.WriteString(client, "GET /ws HTTP/1.1\r\nHost: app\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")                                                  //nolint:errcheck
+		io.WriteString(client, "raw frames GET / HTTP/1.1\r\n")                                                                                                       //nolint:errcheck
+		client.Close()
+	}()
+
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if got := req.Header.Values("X-Client-Cert-Subject"); len(got) != 1 || got[0] != "CN=alice" {
+		t.Errorf("subject = %q, want only the injected value", got)
+	}
+	if req.Header.Get("X-Client-Cert-Verified") != "" {
+		t.Error("forged X-Client-Cert-* header was not stripped")
+	}
+	if req.Header.Get("User-Agent") != "" {
+		t.Errorf("unexpected User-Agent %q", req.Header.Get("User-Agent"))
+	}
+	if string(body) != "hello" || req.URL.Path != "/a" {
+		t.Errorf("request = %s %q", req.URL.Path, body)
+	}
+
+	req, err = http.ReadRequest(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Upgrade") != "websocket" || req.Header.Get("X-Client-Cert-Subject") != "CN=alice" {
+		t.Errorf("upgrade request headers = %v", req.Header)
+	}
+	rest, _ := io.ReadAll(br)
+	if string(rest) != "raw frames GET / HTTP/1.1\r\n" {
+		t.Errorf("after upgrade = %q, want the raw stream", rest)
+	}
+}
+
+func TestInjectHeaders_NotHTTP(t *testing.T) {
+	client, server := net.Pipe()
+	conn := InjectHeaders(server, http.Header{})
+	defer conn.Close()
+	go func() {
+		io.WriteString(client, "\x16\x03\x01 binary\r\n\r\n") //nolint:errcheck
+		client.Close()
+	}()
+	if _, err := io.ReadAll(conn); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("ReadAll = %v, want a parse error", err)
+	}
+}
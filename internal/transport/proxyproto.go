@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"gonc/internal/proxyproto"
+)
+
+// ProxyProtoDialer wraps another Dialer and prepends a PROXY protocol
+// header to every connection it opens, so the backend sees the
+// original client address instead of gonc's.
+type ProxyProtoDialer struct {
+	Inner   Dialer
+	Version int // 1 or 2
+}
+
+// Dial connects through Inner and writes the PROXY header.  The source
+// address comes from [proxyproto.WithSource] when the context carries
+// one, otherwise from the connection's local address.  v2 headers also
+// carry any TLVs from [proxyproto.WithTLVs].
+func (d *ProxyProtoDialer) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Inner.Dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	src, ok := proxyproto.SourceFromContext(ctx)
+	if !ok {
+		src = conn.LocalAddr()
+	}
+	hdr := proxyproto.NewHeader(d.Version, src, conn.RemoteAddr())
+	if d.Version == 2 {
+		hdr.TLVs = proxyproto.TLVsFromContext(ctx)
+	}
+	if _, err := hdr.WriteTo(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write PROXY header to %s: %w", address, err)
+	}
+	return conn, nil
+}
+
+// Close closes the inner dialer.
+func (d *ProxyProtoDialer) Close() error { return d.Inner.Close() }
@@ -6,6 +6,7 @@ import (
 	"net"
 	"sync"
 
+	"gonc/internal/metrics"
 	"gonc/tunnel"
 	"gonc/util"
 )
@@ -21,10 +22,11 @@ type SSHDialer struct {
 }
 
 // NewSSHDialer creates a dialer that forwards connections through an
-// SSH tunnel.  The tunnel is not connected until the first Dial.
-func NewSSHDialer(cfg *tunnel.SSHConfig, logger *util.Logger) *SSHDialer {
+// SSH tunnel.  The tunnel is not connected until the first Dial.  The
+// metrics collector is optional (nil-safe).
+func NewSSHDialer(cfg *tunnel.SSHConfig, logger *util.Logger, m *metrics.Collector) *SSHDialer {
 	return &SSHDialer{
-		tunnel: tunnel.NewSSHTunnel(cfg, logger),
+		tunnel: tunnel.NewSSHTunnel(cfg, logger, m),
 		config: cfg,
 		logger: logger,
 	}
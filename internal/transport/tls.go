@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TLSDialer wraps another Dialer and runs a TLS client handshake on
+// every connection it opens, so plaintext tools can reach TLS-only or
+// mTLS-only services.  Wrap it outside a ProxyProtoDialer: the PROXY
+// header has to precede the handshake.
+type TLSDialer struct {
+	Inner  Dialer
+	Config *tls.Config
+	// Timeout bounds the handshake (0 = only the context applies).
+	Timeout time.Duration
+}
+
+// Dial connects through Inner and completes the handshake.  Without a
+// ServerName in Config the certificate is verified against the
+// dialled host.
+func (d *TLSDialer) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Inner.Dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := d.Config.Clone()
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			cfg.ServerName = host
+		}
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s: %w", address, err)
+	}
+	return tc, nil
+}
+
+// Close closes the inner dialer.
+func (d *TLSDialer) Close() error { return d.Inner.Close() }
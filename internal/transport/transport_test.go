@@ -1,11 +1,17 @@
 package transport
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"gonc/internal/proxyproto"
 )
 
 // TestTCPDialer_Connect verifies that TCPDialer can reach a local
@@ -92,3 +98,91 @@ func TestUDPDialer_Connect(t *testing.T) {
 		t.Fatalf("write: %v", err)
 	}
 }
+
+// TestProxyProtoDialer verifies a PROXY header precedes the payload and
+// carries the source address from the context.
+func TestProxyProtoDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan *proxyproto.Header, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		h, _ := proxyproto.Read(bufio.NewReader(conn))
+		got <- h
+	}()
+
+	d := &ProxyProtoDialer{Inner: &TCPDialer{Timeout: 2 * time.Second}, Version: 2}
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	ctx := proxyproto.WithSource(context.Background(), src)
+	ctx = proxyproto.WithTLVs(ctx, proxyproto.SSL{Client: proxyproto.ClientSSL, Version: "TLSv1.3"}.TLV())
+
+	conn, err := d.Dial(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case h := <-got:
+		if h == nil || h.Source.String() != src.String() {
+			t.Fatalf("header source = %v, want %v", h, src)
+		}
+		if _, ok := h.TLV(proxyproto.TypeSSL); !ok {
+			t.Error("header is missing the SSL TLV from the context")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for header")
+	}
+}
+
+// TestTLSDialer verifies the handshake against a custom CA, with the
+// server name taken from --tls-server-name or the dialled host.
+func TestTLSDialer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "over tls") //nolint:errcheck
+	}))
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	addr := srv.Listener.Addr().String()
+
+	// httptest's certificate covers example.com and 127.0.0.1.
+	d := &TLSDialer{Inner: &TCPDialer{Timeout: 2 * time.Second}, Config: &tls.Config{RootCAs: roots}, Timeout: 2 * time.Second}
+	conn, err := d.Dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	io.WriteString(conn, "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n") //nolint:errcheck
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	conn.Close()
+	if string(body) != "over tls" {
+		t.Errorf("body = %q", body)
+	}
+
+	d.Config = &tls.Config{RootCAs: roots, ServerName: "example.com"}
+	if conn, err := d.Dial(context.Background(), "tcp", addr); err != nil {
+		t.Errorf("dial with server name: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	d.Config = &tls.Config{RootCAs: roots, ServerName: "other.example"}
+	if _, err := d.Dial(context.Background(), "tcp", addr); err == nil {
+		t.Error("dial should fail when the name does not match")
+	}
+	d.Config = &tls.Config{}
+	if _, err := d.Dial(context.Background(), "tcp", addr); err == nil {
+		t.Error("dial should fail without the test CA")
+	}
+}
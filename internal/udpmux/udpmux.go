@@ -0,0 +1,326 @@
+// Package udpmux splits an unconnected UDP socket into one net.Conn
+// per remote address, so datagram clients can be served the way TCP
+// connections are: Accept returns a Conn for each new peer, reads on
+// it return that peer's datagrams, and writes go back to the peer.
+//
+// Peers that send nothing and receive nothing for the idle timeout are
+// expired: their Conn reads io.EOF and a later datagram from the same
+// address starts a new one.
+//
+// A pinned Listener takes no new peers, which gives the first-client
+// lock of nc -u -l without connecting the socket.
+package udpmux
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxDatagram is the largest UDP payload.
+	maxDatagram = 64 * 1024
+	// queueLen is how many datagrams a peer may have waiting before
+	// more are dropped, as a kernel buffer would.
+	queueLen = 64
+	// backlog is how many new peers may wait for Accept.
+	backlog = 16
+)
+
+// Listener demultiplexes a packet socket by source address.
+type Listener struct {
+	pc   net.PacketConn
+	idle time.Duration
+
+	mu     sync.Mutex
+	conns  map[string]*Conn
+	pinned bool
+
+	accept    chan *Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error // read error that stopped the listener
+}
+
+// New starts demultiplexing pc.  idle of 0 keeps peers until they are
+// closed.  The Listener owns pc and closes it on Close.
+func New(pc net.PacketConn, idle time.Duration) *Listener {
+	l := &Listener{
+		pc:     pc,
+		idle:   idle,
+		conns:  make(map[string]*Conn),
+		accept: make(chan *Conn, backlog),
+		done:   make(chan struct{}),
+	}
+	go l.readLoop()
+	if idle > 0 {
+		go l.expireLoop()
+	}
+	return l
+}
+
+// Accept waits for a datagram from a new peer and returns its Conn.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		l.mu.Lock()
+		c.accepted = true
+		l.mu.Unlock()
+		return c, nil
+	case <-l.done:
+		if l.err != nil {
+			return nil, l.err
+		}
+		return nil, net.ErrClosed
+	}
+}
+
+// Addr returns the socket's local address.
+func (l *Listener) Addr() net.Addr { return l.pc.LocalAddr() }
+
+// Len returns the number of live peer sessions.
+func (l *Listener) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// Pin stops the listener taking new peers: datagrams from addresses
+// without a session are dropped, as a connected UDP socket drops them.
+// Every peer Accept has not returned is closed, including one the read
+// loop is about to queue.
+func (l *Listener) Pin() {
+	l.mu.Lock()
+	l.pinned = true
+	var waiting []*Conn
+	for _, c := range l.conns {
+		if !c.accepted {
+			waiting = append(waiting, c)
+		}
+	}
+	l.mu.Unlock()
+	for _, c := range waiting {
+		c.Close()
+	}
+	for {
+		select {
+		case c := <-l.accept:
+			c.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Close stops the listener, closes the socket and ends every peer.
+func (l *Listener) Close() error {
+	return l.shutdown(nil)
+}
+
+func (l *Listener) shutdown(cause error) error {
+	var err error
+	l.closeOnce.Do(func() {
+		l.err = cause
+		close(l.done)
+		err = l.pc.Close()
+
+		l.mu.Lock()
+		conns := make([]*Conn, 0, len(l.conns))
+		for _, c := range l.conns {
+			conns = append(conns, c)
+		}
+		l.mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	return err
+}
+
+// readLoop hands every datagram to its peer's Conn, creating one for
+// new addresses.
+func (l *Listener) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.done:
+			default:
+				l.shutdown(err) //nolint:errcheck
+			}
+			return
+		}
+
+		c, isNew := l.peer(addr)
+		if c == nil {
+			continue // pinned; not a known peer
+		}
+		if isNew {
+			select {
+			case l.accept <- c:
+			case <-l.done:
+				return
+			}
+		}
+		c.deliver(append([]byte(nil), buf[:n]...))
+	}
+}
+
+// peer returns the Conn for addr, creating it if needed, or nil for
+// a new address once the listener is pinned.
+func (l *Listener) peer(addr net.Addr) (*Conn, bool) {
+	key := addr.String()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c := l.conns[key]; c != nil {
+		return c, false
+	}
+	if l.pinned {
+		return nil, false
+	}
+	c := &Conn{
+		l:      l,
+		key:    key,
+		remote: addr,
+		in:     make(chan []byte, queueLen),
+		closed: make(chan struct{}),
+	}
+	c.touch()
+	l.conns[key] = c
+	return c, true
+}
+
+// expireLoop closes peers idle for longer than l.idle.
+func (l *Listener) expireLoop() {
+	tick := time.NewTicker(max(l.idle/4, 10*time.Millisecond))
+	defer tick.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-tick.C:
+			l.mu.Lock()
+			var idle []*Conn
+			for _, c := range l.conns {
+				if now.Sub(time.Unix(0, c.last.Load())) >= l.idle {
+					idle = append(idle, c)
+				}
+			}
+			l.mu.Unlock()
+			for _, c := range idle {
+				c.Close()
+			}
+		}
+	}
+}
+
+func (l *Listener) remove(c *Conn) {
+	l.mu.Lock()
+	if l.conns[c.key] == c {
+		delete(l.conns, c.key)
+	}
+	l.mu.Unlock()
+}
+
+// ── Conn ─────────────────────────────────────────────────────────────
+
+// Conn is one peer's datagram session.  Each Read returns one
+// datagram, truncated to the buffer like a UDP socket read.
+type Conn struct {
+	l      *Listener
+	key    string
+	remote net.Addr
+	in     chan []byte
+	last   atomic.Int64 // UnixNano of the last datagram either way
+
+	accepted bool // returned by Accept, guarded by l.mu
+
+	mu           sync.Mutex
+	readDeadline time.Time
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *Conn) touch() { c.last.Store(time.Now().UnixNano()) }
+
+// deliver queues a datagram, dropping it if the peer is not keeping up.
+func (c *Conn) deliver(p []byte) {
+	c.touch()
+	select {
+	case c.in <- p:
+	default:
+	}
+}
+
+// Read returns the next datagram from the peer, or io.EOF once the
+// session has expired or been closed.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case d := <-c.in:
+		return copy(p, d), nil
+	case <-c.closed:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Write sends p to the peer as one datagram.
+func (c *Conn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.touch()
+	return c.l.pc.WriteTo(p, c.remote)
+}
+
+// Close ends the session.  The shared socket stays open.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.l.remove(c)
+	})
+	return nil
+}
+
+// LocalAddr returns the shared socket's address.
+func (c *Conn) LocalAddr() net.Addr { return c.l.pc.LocalAddr() }
+
+// RemoteAddr returns the peer's address.
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline sets the read deadline; writes never block.
+func (c *Conn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// SetWriteDeadline is a no-op: datagram writes do not block.
+func (c *Conn) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,205 @@
+package udpmux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T, idle time.Duration) *Listener {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(pc, idle)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func dial(t *testing.T, l *Listener) net.Conn {
+	t.Helper()
+	c, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	return c
+}
+
+func accept(t *testing.T, l *Listener) net.Conn {
+	t.Helper()
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		c, err := l.Accept()
+		ch <- result{c, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		return r.c
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept timed out")
+		return nil
+	}
+}
+
+func TestPerPeerSessions(t *testing.T) {
+	l := listen(t, 0)
+	a, b := dial(t, l), dial(t, l)
+
+	a.Write([]byte("from a")) //nolint:errcheck
+	sa := accept(t, l)
+	b.Write([]byte("from b")) //nolint:errcheck
+	sb := accept(t, l)
+	a.Write([]byte("a again")) //nolint:errcheck
+
+	buf := make([]byte, 64)
+	for _, tt := range []struct {
+		conn net.Conn
+		want string
+	}{{sa, "from a"}, {sb, "from b"}, {sa, "a again"}} {
+		tt.conn.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		n, err := tt.conn.Read(buf)
+		if err != nil || string(buf[:n]) != tt.want {
+			t.Errorf("Read = %q, %v; want %q", buf[:n], err, tt.want)
+		}
+	}
+	if sa.RemoteAddr().String() != a.LocalAddr().String() {
+		t.Errorf("session remote %v, want %v", sa.RemoteAddr(), a.LocalAddr())
+	}
+	if l.Len() != 2 {
+		t.Errorf("Len = %d, want 2", l.Len())
+	}
+
+	// Replies go back to the right client.
+	sb.Write([]byte("to b")) //nolint:errcheck
+	n, err := b.Read(buf)
+	if err != nil || string(buf[:n]) != "to b" {
+		t.Errorf("client b read %q, %v", buf[:n], err)
+	}
+}
+
+func TestIdleExpiry(t *testing.T) {
+	l := listen(t, 50*time.Millisecond)
+	c := dial(t, l)
+
+	c.Write([]byte("hello")) //nolint:errcheck
+	s := accept(t, l)
+	buf := make([]byte, 64)
+	if _, err := s.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Read(buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read after expiry = %v, want EOF", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle session was not expired")
+	}
+	if l.Len() != 0 {
+		t.Errorf("Len = %d after expiry, want 0", l.Len())
+	}
+
+	// The same client starts a fresh session.
+	c.Write([]byte("back")) //nolint:errcheck
+	if s2 := accept(t, l); s2 == s {
+		t.Error("expired session was reused")
+	}
+}
+
+func TestPin(t *testing.T) {
+	l := listen(t, 0)
+	a, b := dial(t, l), dial(t, l)
+
+	a.Write([]byte("first")) //nolint:errcheck
+	sa := accept(t, l)
+	l.Pin()
+	b.Write([]byte("intruder")) //nolint:errcheck
+	a.Write([]byte("second"))   //nolint:errcheck
+
+	buf := make([]byte, 64)
+	for _, want := range []string{"first", "second"} {
+		sa.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		n, err := sa.Read(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Errorf("Read = %q, %v; want %q", buf[:n], err, want)
+		}
+	}
+	if l.Len() != 1 {
+		t.Errorf("Len = %d after a new peer wrote to a pinned listener, want 1", l.Len())
+	}
+}
+
+// TestPinClosesQueuedPeer covers a peer the read loop created just
+// before Pin and has yet to queue for Accept.
+func TestPinClosesQueuedPeer(t *testing.T) {
+	l := listen(t, 0)
+	a := dial(t, l)
+	a.Write([]byte("first")) //nolint:errcheck
+	sa := accept(t, l)
+
+	late, isNew := l.peer(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+	if !isNew {
+		t.Fatal("peer did not create a session")
+	}
+	l.Pin()
+	select {
+	case <-late.closed:
+	default:
+		t.Error("Pin left an unaccepted peer open")
+	}
+	if l.Len() != 1 {
+		t.Errorf("Len = %d after Pin, want only the accepted peer", l.Len())
+	}
+	sa.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	if n, err := sa.Read(make([]byte, 64)); err != nil || n != len("first") {
+		t.Errorf("accepted peer Read = %d, %v", n, err)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	l := listen(t, 0)
+	c := dial(t, l)
+	c.Write([]byte("x")) //nolint:errcheck
+	s := accept(t, l)
+	s.Read(make([]byte, 8)) //nolint:errcheck
+
+	s.SetReadDeadline(time.Now().Add(20 * time.Millisecond)) //nolint:errcheck
+	if _, err := s.Read(make([]byte, 8)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read = %v, want deadline exceeded", err)
+	}
+}
+
+func TestCloseEndsSessions(t *testing.T) {
+	l := listen(t, 0)
+	c := dial(t, l)
+	c.Write([]byte("x")) //nolint:errcheck
+	s := accept(t, l)
+	s.Read(make([]byte, 8)) //nolint:errcheck
+
+	l.Close()
+	if _, err := s.Read(make([]byte, 8)); err != io.EOF {
+		t.Errorf("session Read after Close = %v, want EOF", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+	}
+}
@@ -56,7 +56,7 @@ func BenchmarkBridgeConns(b *testing.B) {
 			left.(*net.TCPConn).CloseWrite()
 		}()
 
-		aToB, bToA := bridgeConns(ctx, left, right)
+		aToB, bToA, _ := bridgeConns(ctx, left, right, 0)
 		cancel()
 		_ = aToB
 		_ = bToA
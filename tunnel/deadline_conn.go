@@ -0,0 +1,293 @@
+package tunnel
+
+// deadline_conn.go - read/write deadlines for SSH channel connections.
+//
+// ssh.Channel has no notion of deadlines: the conns returned by
+// ssh.Client.Dial reject SetDeadline and our own chanConn ignores it.
+// Timeouts in the modes above (ListenMode.Timeout, bridge idle
+// timeouts, sniffing limits) would silently stop working over SSH.
+// deadlineConn moves the blocking channel I/O onto helper goroutines
+// so a pending Read or Write can be abandoned when a deadline fires,
+// returning os.ErrDeadlineExceeded just like a TCP socket.
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"gonc/util"
+)
+
+// deadlineConn wraps a connection whose deadline methods are no-ops.
+//
+// Reads are served by a single reader goroutine that keeps one chunk
+// in flight.  Writes are handed to a writer goroutine one at a time;
+// a Write that times out may still complete in the background, and
+// the next Write waits for it so byte order is preserved.
+type deadlineConn struct {
+	net.Conn
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	readOnce sync.Once
+	readCh   chan readResult
+	readMu   sync.Mutex // serialises Read
+	leftover []byte
+	readErr  error // sticky error from the reader goroutine
+
+	writeOnce sync.Once
+	writeReq  chan []byte
+	writeRes  chan writeResult
+	writeMu   sync.Mutex // serialises Write
+	inflight  bool       // a timed-out write has not yet reported back
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// newDeadlineConn wraps c so that its deadline methods work.
+func newDeadlineConn(c net.Conn) *deadlineConn {
+	return &deadlineConn{
+		Conn:          c,
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+		done:          make(chan struct{}),
+	}
+}
+
+// ── Read path ────────────────────────────────────────────────────────
+
+func (c *deadlineConn) startReader() {
+	c.readCh = make(chan readResult)
+	go func() {
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := c.Conn.Read(buf)
+			select {
+			case c.readCh <- readResult{buf[:n], err}:
+			case <-c.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Read returns buffered data, or waits for the reader goroutine until
+// the read deadline passes.
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.leftover) > 0 {
+		n := copy(p, c.leftover)
+		c.leftover = c.leftover[n:]
+		return n, nil
+	}
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+	if isClosed(c.done) {
+		return 0, net.ErrClosed
+	}
+	if isClosed(c.readDeadline.wait()) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	c.readOnce.Do(c.startReader)
+	select {
+	case r := <-c.readCh:
+		n := copy(p, r.data)
+		c.leftover = r.data[n:]
+		if r.err != nil {
+			c.readErr = r.err
+			if len(c.leftover) == 0 {
+				return n, r.err
+			}
+		}
+		return n, nil
+	case <-c.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+// ── Write path ───────────────────────────────────────────────────────
+
+func (c *deadlineConn) startWriter() {
+	c.writeReq = make(chan []byte)
+	c.writeRes = make(chan writeResult, 1)
+	go func() {
+		for {
+			select {
+			case b := <-c.writeReq:
+				n, err := c.Conn.Write(b)
+				c.writeRes <- writeResult{n, err}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Write hands a copy of p to the writer goroutine and waits for it to
+// finish or for the write deadline to pass.
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.writeOnce.Do(c.startWriter)
+	expired := c.writeDeadline.wait()
+
+	if c.inflight {
+		select {
+		case r := <-c.writeRes:
+			c.inflight = false
+			if r.err != nil {
+				return 0, r.err
+			}
+		case <-expired:
+			return 0, os.ErrDeadlineExceeded
+		case <-c.done:
+			return 0, net.ErrClosed
+		}
+	}
+	if isClosed(expired) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	buf := append([]byte(nil), p...)
+	select {
+	case c.writeReq <- buf:
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+
+	select {
+	case r := <-c.writeRes:
+		return r.n, r.err
+	case <-expired:
+		c.inflight = true
+		return 0, os.ErrDeadlineExceeded
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+// ── Deadlines and lifecycle ──────────────────────────────────────────
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// Close stops the helper goroutines and closes the channel, which
+// unblocks any read or write still pending on it.
+func (c *deadlineConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// CloseWrite sends EOF on the channel while reads continue.  Writes
+// still queued are allowed to finish first.
+func (c *deadlineConn) CloseWrite() error {
+	c.writeMu.Lock()
+	if c.inflight {
+		select {
+		case <-c.writeRes:
+			c.inflight = false
+		case <-c.done:
+		}
+	}
+	c.writeMu.Unlock()
+
+	return util.CloseWrite(c.Conn)
+}
+
+// deadline is a resettable timer that closes a channel when it fires,
+// in the style of net.Pipe.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline passes
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set arms the deadline for t; the zero time disarms it.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // the timer fired; wait for it to close cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline passes.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
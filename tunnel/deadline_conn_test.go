@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// noDeadlineConn mimics an SSH channel: deadlines are accepted but
+// have no effect.
+type noDeadlineConn struct{ net.Conn }
+
+func (noDeadlineConn) SetDeadline(time.Time) error      { return nil }
+func (noDeadlineConn) SetReadDeadline(time.Time) error  { return nil }
+func (noDeadlineConn) SetWriteDeadline(time.Time) error { return nil }
+
+func deadlinePipe() (*deadlineConn, net.Conn) {
+	a, b := net.Pipe()
+	return newDeadlineConn(noDeadlineConn{a}), b
+}
+
+func TestDeadlineConnReadDeadline(t *testing.T) {
+	c, peer := deadlinePipe()
+	defer c.Close()
+	defer peer.Close()
+
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond)) //nolint:errcheck
+	start := time.Now()
+	_, err := c.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read blocked for %v", elapsed)
+	}
+
+	// Clearing the deadline makes the conn usable again.
+	c.SetReadDeadline(time.Time{}) //nolint:errcheck
+	go peer.Write([]byte("hi"))    //nolint:errcheck
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "hi" {
+		t.Errorf("read after reset = %q, %v", buf, err)
+	}
+}
+
+func TestDeadlineConnPastDeadline(t *testing.T) {
+	c, peer := deadlinePipe()
+	defer c.Close()
+	defer peer.Close()
+
+	c.SetDeadline(time.Now().Add(-time.Second)) //nolint:errcheck
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read err = %v", err)
+	}
+	if _, err := c.Write([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write err = %v", err)
+	}
+}
+
+func TestDeadlineConnWriteDeadline(t *testing.T) {
+	c, peer := deadlinePipe()
+	defer c.Close()
+	defer peer.Close()
+
+	// Nobody reads from peer, so the pipe write blocks.
+	c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)) //nolint:errcheck
+	if _, err := c.Write([]byte("first")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrDeadlineExceeded", err)
+	}
+
+	// Once the peer drains, the abandoned write lands before the next.
+	c.SetWriteDeadline(time.Time{}) //nolint:errcheck
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 11)
+		io.ReadFull(peer, buf) //nolint:errcheck
+		got <- string(buf)
+	}()
+	if _, err := c.Write([]byte("second")); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+	if s := <-got; s != "firstsecond" {
+		t.Errorf("peer read %q, want %q", s, "firstsecond")
+	}
+}
+
+func TestDeadlineConnCloseUnblocksRead(t *testing.T) {
+	c, peer := deadlinePipe()
+	defer peer.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("expected an error after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read not unblocked by Close")
+	}
+}
+
+func TestDeadlineConnEOF(t *testing.T) {
+	c, peer := deadlinePipe()
+	defer c.Close()
+
+	go func() {
+		peer.Write([]byte("data")) //nolint:errcheck
+		peer.Close()
+	}()
+	got, err := io.ReadAll(c)
+	if err != nil || string(got) != "data" {
+		t.Errorf("ReadAll = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,186 @@
+package tunnel
+
+// reverse_control.go - runtime control of a running reverse tunnel:
+// extra remote forwards and on-demand reconnects, for the admin API.
+//
+// Extra forwards share the SSH connection and the forwarded-tcpip
+// handler of the primary (-R) forward.  A channel is matched to its
+// forward by the port the gateway reports it was bound to; anything
+// else goes to the primary target, as before.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"gonc/internal/control"
+)
+
+var _ control.Tunnel = (*ReverseTunnel)(nil)
+
+// Forwards lists the primary forward followed by any added at runtime.
+func (rt *ReverseTunnel) Forwards() []control.Forward {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	out := []control.Forward{{
+		RemoteAddr: rt.config.RemoteBindAddress,
+		RemotePort: rt.config.RemotePort,
+		Local:      rt.defaultLocalTarget(),
+		Primary:    true,
+	}}
+	extra := make([]control.Forward, 0, len(rt.forwards))
+	for _, f := range rt.forwards {
+		extra = append(extra, f)
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i].RemotePort < extra[j].RemotePort })
+	return append(out, extra...)
+}
+
+// AddForward asks the gateway for another remote port and bridges its
+// connections to f.Local.  A Local without a host uses the tunnel's
+// local address.
+func (rt *ReverseTunnel) AddForward(f control.Forward) error {
+	if f.RemotePort < 1 || f.RemotePort > 65535 {
+		return fmt.Errorf("remote port %d out of range", f.RemotePort)
+	}
+	if _, err := strconv.Atoi(f.Local); err == nil {
+		f.Local = net.JoinHostPort(rt.config.LocalAddress, f.Local)
+	}
+	host, port, err := net.SplitHostPort(f.Local)
+	if err != nil {
+		return fmt.Errorf("local %q: %w", f.Local, err)
+	}
+	if host == "" {
+		f.Local = net.JoinHostPort(rt.config.LocalAddress, port)
+	}
+	f.Primary = false
+
+	rt.mu.Lock()
+	if f.RemotePort == rt.config.RemotePort {
+		rt.mu.Unlock()
+		return fmt.Errorf("remote port %d is the primary forward", f.RemotePort)
+	}
+	if _, dup := rt.forwards[f.RemotePort]; dup {
+		rt.mu.Unlock()
+		return fmt.Errorf("remote port %d is already forwarded", f.RemotePort)
+	}
+	client := rt.client
+	rt.mu.Unlock()
+
+	if client == nil {
+		return errors.New("tunnel is not connected")
+	}
+	// The request is a round trip to the gateway; don't hold mu for it.
+	if err := requestForward(client, f.RemoteAddr, f.RemotePort); err != nil {
+		return fmt.Errorf("remote listen on %s: %w",
+			net.JoinHostPort(f.RemoteAddr, strconv.Itoa(f.RemotePort)), err)
+	}
+
+	rt.mu.Lock()
+	if rt.forwards == nil {
+		rt.forwards = make(map[int]control.Forward)
+	}
+	rt.forwards[f.RemotePort] = f
+	rt.mu.Unlock()
+
+	rt.logger.Info("reverse tunnel: added forward %s:%d (remote) → %s (local)",
+		f.RemoteAddr, f.RemotePort, f.Local)
+	return nil
+}
+
+// RemoveForward cancels a forward added with AddForward.  Connections
+// already bridged through it are left running.
+func (rt *ReverseTunnel) RemoveForward(remotePort int) error {
+	rt.mu.Lock()
+	if remotePort == rt.config.RemotePort {
+		rt.mu.Unlock()
+		return fmt.Errorf("remote port %d is the primary forward", remotePort)
+	}
+	f, ok := rt.forwards[remotePort]
+	delete(rt.forwards, remotePort)
+	client := rt.client
+	rt.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no forward on remote port %d", remotePort)
+	}
+	if client != nil {
+		cancelForward(client, f.RemoteAddr, f.RemotePort) //nolint:errcheck
+	}
+	rt.logger.Info("reverse tunnel: removed forward %s:%d", f.RemoteAddr, f.RemotePort)
+	return nil
+}
+
+// Reconnect drops the SSH connection; acceptLoop then re-establishes
+// it and every forward, whether or not --auto-reconnect is set.
+func (rt *ReverseTunnel) Reconnect() error {
+	rt.mu.Lock()
+	listener := rt.listener
+	running := !rt.closed && rt.ctx != nil && rt.ctx.Err() == nil && rt.endReason == ""
+	if running && listener != nil {
+		rt.reconnectRequested = true
+	}
+	rt.mu.Unlock()
+
+	if !running {
+		return errors.New("tunnel is not running")
+	}
+	if listener == nil {
+		return errors.New("tunnel is already reconnecting")
+	}
+	// Closing the listener unblocks Accept.  It stays set, so
+	// acceptLoop takes the reconnect path rather than exiting.
+	listener.Close()
+	return nil
+}
+
+// takeReconnectRequest reports and clears a pending Reconnect call.
+func (rt *ReverseTunnel) takeReconnectRequest() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	requested := rt.reconnectRequested
+	rt.reconnectRequested = false
+	return requested
+}
+
+// forwardTarget returns the local target of the runtime forward the
+// connection arrived on, if any.
+func (rt *ReverseTunnel) forwardTarget(conn net.Conn) (string, bool) {
+	addr, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return "", false
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	f, ok := rt.forwards[addr.Port]
+	if !ok || addr.Port == rt.config.RemotePort {
+		return "", false
+	}
+	return f.Local, true
+}
+
+// restoreForwards re-requests the runtime forwards on a new SSH
+// connection.  Forwards the gateway refuses are dropped.
+func (rt *ReverseTunnel) restoreForwards() {
+	rt.mu.Lock()
+	client := rt.client
+	forwards := make([]control.Forward, 0, len(rt.forwards))
+	for _, f := range rt.forwards {
+		forwards = append(forwards, f)
+	}
+	rt.mu.Unlock()
+
+	for _, f := range forwards {
+		if err := requestForward(client, f.RemoteAddr, f.RemotePort); err != nil {
+			rt.logger.With("remote_port", f.RemotePort).
+				Error("reverse tunnel: restoring forward %d: %v", f.RemotePort, err)
+			rt.metrics.RecordError(fmt.Sprintf("restore forward %d: %v", f.RemotePort, err))
+			rt.mu.Lock()
+			delete(rt.forwards, f.RemotePort)
+			rt.mu.Unlock()
+		}
+	}
+}
@@ -4,11 +4,13 @@ package tunnel
 // message draining for the reverse tunnel.
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -37,14 +39,16 @@ func (rt *ReverseTunnel) dialSSH(ctx context.Context) (*ssh.Client, error) {
 		// Capture the pre-auth banner that services like serveo.net
 		// and localhost.run use to display the public URL.
 		BannerCallback: func(message string) error {
-			rt.logger.Info("%s", message)
+			rt.scanMessage(message, "banner")
 			return nil
 		},
 	}
 
 	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	rt.logger.Debug("reverse tunnel: dialing SSH %s as %s", addr, cfg.User)
+	rt.logger.With("gateway", addr, "user", cfg.User).
+		Debug("reverse tunnel: dialing SSH %s as %s", addr, cfg.User)
 
+	start := time.Now()
 	var dialer net.Dialer
 	tcpConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
@@ -56,6 +60,7 @@ func (rt *ReverseTunnel) dialSSH(ctx context.Context) (*ssh.Client, error) {
 		tcpConn.Close()
 		return nil, fmt.Errorf("SSH handshake %s: %w", addr, err)
 	}
+	rt.metrics.ObserveHandshake(time.Since(start))
 
 	client := ssh.NewClient(sshConn, chans, reqs)
 
@@ -89,9 +94,10 @@ func (rt *ReverseTunnel) validateGatewayPorts() error {
 }
 
 // drainServerMessages opens an SSH session and copies its
-// stdout/stderr to the logger.  Public tunnel services (serveo.net,
-// localhost.run, etc.) use this channel to report the generated URL.
-// The goroutine exits silently if the server doesn't support sessions.
+// stdout/stderr to the logger line by line.  Public tunnel services
+// (serveo.net, localhost.run, etc.) use this channel to report the
+// generated URL, which scanMessage picks out.  The goroutine exits
+// silently if the server doesn't support sessions.
 func (rt *ReverseTunnel) drainServerMessages(client *ssh.Client) {
 	sess, err := client.NewSession()
 	if err != nil {
@@ -115,15 +121,10 @@ func (rt *ReverseTunnel) drainServerMessages(client *ssh.Client) {
 	var wg sync.WaitGroup
 	printStream := func(r io.Reader) {
 		defer wg.Done()
-		buf := make([]byte, 4096)
-		for {
-			n, readErr := r.Read(buf)
-			if n > 0 {
-				rt.logger.Info("%s", string(buf[:n]))
-			}
-			if readErr != nil {
-				return
-			}
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 4096), 64*1024)
+		for sc.Scan() {
+			rt.scanMessage(sc.Text(), "session")
 		}
 	}
 
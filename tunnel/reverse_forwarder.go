@@ -5,13 +5,19 @@ package tunnel
 import (
 	"context"
 	"fmt"
-	"io"
 	"net"
-	"sync"
 	"time"
+
+	"gonc/internal/audit"
+	"gonc/internal/metrics"
+	"gonc/internal/proxyproto"
+	"gonc/internal/ratelimit"
+	"gonc/internal/session"
+	"gonc/util"
 )
 
-// handleConnection bridges a single remote connection to the local service.
+// handleConnection bridges a single remote connection to the local
+// service and records it in the metrics connection log.
 func (rt *ReverseTunnel) handleConnection(remoteConn net.Conn) {
 	defer rt.wg.Done()
 	defer remoteConn.Close()
@@ -19,54 +25,102 @@ func (rt *ReverseTunnel) handleConnection(remoteConn net.Conn) {
 
 	start := time.Now()
 	remoteAddr := remoteConn.RemoteAddr().String()
+	log := rt.logger.With("session", session.NextID(), "peer", remoteAddr)
+	record := metrics.ConnRecord{Peer: remoteAddr, Start: start}
+	defer func() {
+		record.Duration = time.Since(start)
+		rt.metrics.RecordConnection(record)
+	}()
+
+	remoteConn, localTarget := rt.routeConnection(remoteConn)
+	record.Target = localTarget
+	log = log.With("target", localTarget)
 
-	localTarget := net.JoinHostPort(rt.config.LocalAddress, fmt.Sprintf("%d", rt.config.LocalPort))
-	localConn, err := net.DialTimeout("tcp", localTarget, 5*time.Second)
+	var auditErr error
+	remoteConn, entry := rt.config.Audit.Begin(remoteConn, audit.Record{
+		Mode:    "reverse",
+		Target:  localTarget,
+		Gateway: rt.gatewayAddr(),
+	})
+	defer func() { entry.Finish(auditErr) }() //nolint:errcheck
+
+	remoteConn, err := rt.config.Capture.Wrap(remoteConn, "reverse")
 	if err != nil {
-		rt.logger.Error("reverse tunnel: local dial %s failed: %v",
-			localTarget, err)
+		log.Error("reverse tunnel: capture: %v", err)
+		record.CloseReason = "capture failed"
+		auditErr = fmt.Errorf("capture: %w", err)
+		return
+	}
+	defer remoteConn.Close()
+	remoteConn = rt.config.Limiter.Wrap(remoteConn)
+	limited := remoteConn
+	remoteConn = rt.config.Mirror.Wrap(rt.ctx, remoteConn)
+	defer remoteConn.Close()
+
+	dialStart := time.Now()
+	localConn, backend, err := rt.dialLocal(localTarget)
+	rt.metrics.ObserveDialLatency(time.Since(dialStart))
+	if err != nil {
+		log.Error("reverse tunnel: local dial %s failed: %v", localTarget, err)
 		rt.metrics.RecordError(fmt.Sprintf("local dial %s: %v", localTarget, err))
+		record.CloseReason = "local dial failed"
+		auditErr = fmt.Errorf("local dial %s: %w", localTarget, err)
 		return
 	}
 	defer localConn.Close()
+	if backend != localTarget {
+		localTarget = backend
+		record.Target = backend
+		entry.SetTarget(backend)
+		log = log.With("backend", backend)
+	}
 
-	rt.logger.Info("reverse tunnel: bridging %s ↔ %s", remoteAddr, localTarget)
+	if rt.config.ProxyProtocol > 0 {
+		hdr := proxyproto.NewHeader(rt.config.ProxyProtocol, remoteConn.RemoteAddr(), remoteConn.LocalAddr())
+		if _, err := hdr.WriteTo(localConn); err != nil {
+			log.Error("reverse tunnel: PROXY header to %s: %v", localTarget, err)
+			rt.metrics.RecordError(fmt.Sprintf("proxy header %s: %v", localTarget, err))
+			record.CloseReason = "proxy header failed"
+			auditErr = fmt.Errorf("proxy header %s: %w", localTarget, err)
+			return
+		}
+	}
+
+	log.Info("reverse tunnel: bridging %s ↔ %s", remoteAddr, localTarget)
+	remoteConn = rt.config.Registry.Track(remoteConn, "reverse", localTarget)
 
-	in, out := bridgeConns(rt.ctx, remoteConn, localConn)
+	in, out, reason := bridgeConns(rt.ctx, remoteConn, localConn, rt.config.IdleTimeout)
+	if ratelimit.Exceeded(limited) {
+		reason = "quota"
+	}
 	rt.metrics.BytesReceived(in)
 	rt.metrics.BytesSent(out)
+	record.BytesIn, record.BytesOut, record.CloseReason = in, out, reason
+	switch reason {
+	case util.BridgeError:
+		auditErr = fmt.Errorf("bridge: %s", reason)
+	case "quota":
+		auditErr = ratelimit.ErrQuotaExceeded
+	}
 
-	rt.logger.Info("reverse tunnel: %s closed after %v (in=%d out=%d)",
-		remoteAddr, time.Since(start).Truncate(time.Millisecond), in, out)
+	elapsed := time.Since(start)
+	log.With("bytes_in", in, "bytes_out", out, "duration_ms", elapsed.Milliseconds(), "reason", reason).
+		Info("reverse tunnel: %s closed after %v (in=%d out=%d reason=%s)",
+			remoteAddr, elapsed.Truncate(time.Millisecond), in, out, reason)
 }
 
-// bridgeConns copies data bidirectionally between two connections
-// until one side closes or the context is cancelled.  It returns the
-// number of bytes transferred in each direction.
-func bridgeConns(ctx context.Context, a, b net.Conn) (aToB, bToA int64) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		n, _ := io.Copy(b, a)
-		aToB = n
-		cancel()
-	}()
-
-	go func() {
-		defer wg.Done()
-		n, _ := io.Copy(a, b)
-		bToA = n
-		cancel()
-	}()
+// gatewayAddr returns the SSH gateway as host:port for audit records.
+func (rt *ReverseTunnel) gatewayAddr() string {
+	if rt.config.SSHConfig == nil {
+		return ""
+	}
+	return util.FormatAddr(rt.config.SSHConfig.Host, rt.config.SSHConfig.Port)
+}
 
-	<-ctx.Done()
-	a.Close()
-	b.Close()
-	wg.Wait()
-	return aToB, bToA
+// bridgeConns copies data bidirectionally between two connections,
+// propagating half-closes, until both directions finish, the context
+// is cancelled, or no data moves for idle.  It returns the number of
+// bytes transferred in each direction and why the bridge ended.
+func bridgeConns(ctx context.Context, a, b net.Conn, idle time.Duration) (aToB, bToA int64, reason string) {
+	return util.BridgeReason(ctx, a, b, idle)
 }
@@ -9,10 +9,28 @@ import (
 	"time"
 )
 
+// startKeepalive runs a keepaliveLoop for the current client, first
+// stopping the loop of the previous connection, if any.
+func (rt *ReverseTunnel) startKeepalive() {
+	if rt.config.KeepAliveInterval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(rt.ctx)
+	rt.mu.Lock()
+	if rt.stopKeepalive != nil {
+		rt.stopKeepalive()
+	}
+	rt.stopKeepalive = cancel
+	rt.mu.Unlock()
+
+	rt.wg.Add(1)
+	go rt.keepaliveLoop(ctx)
+}
+
 // keepaliveLoop sends periodic SSH keep-alive requests and closes the
 // listener if the connection has died, letting acceptLoop handle
-// reconnection.
-func (rt *ReverseTunnel) keepaliveLoop() {
+// reconnection.  It runs until ctx, which covers one connection, ends.
+func (rt *ReverseTunnel) keepaliveLoop(ctx context.Context) {
 	defer rt.wg.Done()
 
 	ticker := time.NewTicker(rt.config.KeepAliveInterval)
@@ -20,7 +38,7 @@ func (rt *ReverseTunnel) keepaliveLoop() {
 
 	for {
 		select {
-		case <-rt.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			rt.mu.Lock()
@@ -31,10 +49,12 @@ func (rt *ReverseTunnel) keepaliveLoop() {
 				return
 			}
 
+			sent := time.Now()
 			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
 			if err != nil {
 				rt.logger.Error("SSH keepalive failed: %v", err)
 				rt.metrics.RecordError(fmt.Sprintf("keepalive: %v", err))
+				rt.metrics.SetTunnelUp(false)
 				// Close the listener to unblock Accept so the
 				// acceptLoop can handle reconnection.
 				rt.mu.Lock()
@@ -45,8 +65,12 @@ func (rt *ReverseTunnel) keepaliveLoop() {
 				rt.mu.Unlock()
 				return
 			}
+			rtt := time.Since(sent)
+			rt.metrics.ObserveKeepalive(rtt)
 			rt.metrics.RecordHealthCheck()
-			rt.logger.Debug("SSH keepalive OK")
+			rt.metrics.SetTunnelUp(true)
+			rt.logger.With("rtt_ms", float64(rtt.Microseconds())/1000).
+				Debug("SSH keepalive OK (rtt %v)", rtt.Truncate(time.Microsecond))
 		}
 	}
 }
@@ -59,6 +83,10 @@ func (rt *ReverseTunnel) reconnect() error {
 
 	// Tear down old resources.
 	rt.mu.Lock()
+	if rt.stopKeepalive != nil {
+		rt.stopKeepalive()
+		rt.stopKeepalive = nil
+	}
 	if rt.listener != nil {
 		rt.listener.Close()
 		rt.listener = nil
@@ -80,7 +108,8 @@ func (rt *ReverseTunnel) reconnect() error {
 
 		client, err := rt.dialSSH(rt.ctx)
 		if err != nil {
-			rt.logger.Error("reconnect %d/%d SSH: %v", attempt, maxAttempts, err)
+			rt.logger.With("attempt", attempt).
+				Error("reconnect %d/%d SSH: %v", attempt, maxAttempts, err)
 			rt.metrics.RecordError(fmt.Sprintf("reconnect SSH attempt %d: %v", attempt, err))
 			sleepCtx(rt.ctx, backoff)
 			backoff = min(backoff*2, maxBackoff)
@@ -89,7 +118,8 @@ func (rt *ReverseTunnel) reconnect() error {
 
 		listener, err := listenRemoteForward(client, rt.config.RemoteBindAddress, rt.config.RemotePort)
 		if err != nil {
-			rt.logger.Error("reconnect %d/%d listen: %v", attempt, maxAttempts, err)
+			rt.logger.With("attempt", attempt).
+				Error("reconnect %d/%d listen: %v", attempt, maxAttempts, err)
 			rt.metrics.RecordError(fmt.Sprintf("reconnect listen attempt %d: %v", attempt, err))
 			client.Close()
 			sleepCtx(rt.ctx, backoff)
@@ -101,14 +131,13 @@ func (rt *ReverseTunnel) reconnect() error {
 		rt.client = client
 		rt.listener = listener
 		rt.mu.Unlock()
+		rt.restoreForwards()
 
+		rt.metrics.SetTunnelUp(true)
 		rt.logger.Info("reverse tunnel: reconnected successfully")
 
 		// Restart keepalive with the new client.
-		if rt.config.KeepAliveInterval > 0 {
-			rt.wg.Add(1)
-			go rt.keepaliveLoop()
-		}
+		rt.startKeepalive()
 
 		return nil
 	}
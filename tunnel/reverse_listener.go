@@ -69,25 +69,38 @@ func (l *sshForwardListener) Accept() (net.Conn, error) {
 		}
 		go ssh.DiscardRequests(reqs)
 
-		var raddr net.Addr = &net.TCPAddr{}
+		var laddr, raddr net.Addr = &net.TCPAddr{}, &net.TCPAddr{}
 		var payload forwardedTCPPayload
 		if err := ssh.Unmarshal(newCh.ExtraData(), &payload); err == nil {
-			raddr = &net.TCPAddr{
-				IP:   net.ParseIP(payload.OriginAddr),
-				Port: int(payload.OriginPort),
-			}
+			laddr, raddr = payload.addrs()
 		}
-		return &chanConn{Channel: ch, raddr: raddr}, nil
+		return newDeadlineConn(&chanConn{Channel: ch, laddr: laddr, raddr: raddr}), nil
 	}
 }
 
+// addrs returns the bound and originator addresses of a forwarded
+// connection.  Gateways may report the bind address as requested ("",
+// "localhost" or a hostname) rather than as an IP; that becomes the
+// unspecified address of the originator's family, so a PROXY header
+// still carries the client address instead of falling back to LOCAL.
+func (p *forwardedTCPPayload) addrs() (laddr, raddr *net.TCPAddr) {
+	raddr = &net.TCPAddr{IP: net.ParseIP(p.OriginAddr), Port: int(p.OriginPort)}
+	ip := net.ParseIP(p.Addr)
+	if ip == nil {
+		ip = net.IPv6unspecified
+		if raddr.IP == nil || raddr.IP.To4() != nil {
+			ip = net.IPv4zero
+		}
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p.Port)}, raddr
+}
+
 // Close cancels the remote port forward and unblocks Accept.
 func (l *sshForwardListener) Close() error {
 	l.once.Do(func() {
 		close(l.done)
 		// Best-effort cancel; the connection may already be gone.
-		msg := channelForwardMsg{Addr: l.bindAddr, Port: l.bindPort}
-		l.client.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(&msg)) //nolint:errcheck
+		cancelForward(l.client, l.bindAddr, int(l.bindPort)) //nolint:errcheck
 	})
 	return nil
 }
@@ -99,13 +112,16 @@ func (l *sshForwardListener) Addr() net.Addr {
 
 // ── chanConn ─────────────────────────────────────────────────────────
 
-// chanConn wraps an [ssh.Channel] to satisfy [net.Conn].
+// chanConn wraps an [ssh.Channel] to satisfy [net.Conn].  laddr is the
+// gateway address the client connected to; raddr is the client itself.
+// Its deadline methods are no-ops; Accept wraps it in a deadlineConn.
 type chanConn struct {
 	ssh.Channel
+	laddr net.Addr
 	raddr net.Addr
 }
 
-func (c *chanConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *chanConn) LocalAddr() net.Addr                { return c.laddr }
 func (c *chanConn) RemoteAddr() net.Addr               { return c.raddr }
 func (c *chanConn) SetDeadline(_ time.Time) error      { return nil }
 func (c *chanConn) SetReadDeadline(_ time.Time) error  { return nil }
@@ -124,17 +140,9 @@ func listenRemoteForward(client *ssh.Client, bindAddr string, bindPort int) (net
 		return nil, fmt.Errorf("forwarded-tcpip handler already registered")
 	}
 
-	msg := channelForwardMsg{
-		Addr: bindAddr,
-		Port: uint32(bindPort),
-	}
-	ok, _, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(&msg))
-	if err != nil {
+	if err := requestForward(client, bindAddr, bindPort); err != nil {
 		return nil, err
 	}
-	if !ok {
-		return nil, fmt.Errorf("tcpip-forward request denied by peer")
-	}
 
 	return &sshForwardListener{
 		client:   client,
@@ -144,3 +152,25 @@ func listenRemoteForward(client *ssh.Client, bindAddr string, bindPort int) (net
 		done:     make(chan struct{}),
 	}, nil
 }
+
+// requestForward asks the gateway to listen on bindAddr:bindPort.
+// Channels for every forward arrive on the single handler registered
+// by listenRemoteForward, distinguished by their bound port.
+func requestForward(client *ssh.Client, bindAddr string, bindPort int) error {
+	msg := channelForwardMsg{Addr: bindAddr, Port: uint32(bindPort)}
+	ok, _, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(&msg))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("tcpip-forward request denied by peer")
+	}
+	return nil
+}
+
+// cancelForward asks the gateway to stop listening on bindAddr:bindPort.
+func cancelForward(client *ssh.Client, bindAddr string, bindPort int) error {
+	msg := channelForwardMsg{Addr: bindAddr, Port: uint32(bindPort)}
+	_, _, err := client.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(&msg))
+	return err
+}
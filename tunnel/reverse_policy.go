@@ -0,0 +1,139 @@
+package tunnel
+
+// reverse_policy.go - exposure limits for the reverse tunnel.  A
+// reverse tunnel publishes a local service to anyone who can reach the
+// gateway; the policy narrows who may connect (originator CIDR lists)
+// and for how long the forward stays up (TTL and connection quotas).
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ExposurePolicy restricts which originators are bridged to the local
+// service and bounds the lifetime of the remote forward.  The zero
+// value imposes no restrictions.
+type ExposurePolicy struct {
+	// Allow, when non-empty, admits only originators inside one of the
+	// networks.  Deny rejects originators inside any of its networks
+	// and takes precedence over Allow.
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+
+	// ExposeFor cancels the remote forward and closes every bridged
+	// connection once it has elapsed since Start (0 = no expiry).
+	ExposeFor time.Duration
+
+	// MaxConnections cancels the remote forward after this many
+	// connections have been admitted; those already bridged are allowed
+	// to finish (0 = unlimited).
+	MaxConnections int
+
+	// MaxConcurrent rejects new connections while this many are being
+	// bridged (0 = unlimited).
+	MaxConcurrent int
+}
+
+// permits reports whether the originator ip passes the CIDR lists.  An
+// originator whose address the gateway did not report is only admitted
+// when no allow list is configured.
+func (p *ExposurePolicy) permits(ip net.IP) bool {
+	for _, n := range p.Deny {
+		if ip != nil && n.Contains(ip) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, n := range p.Allow {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit applies the policy to a newly accepted connection.  On success
+// the connection is counted as active and must be released with
+// [ReverseTunnel.release]; otherwise the rejection reason is returned.
+func (rt *ReverseTunnel) admit(remoteConn net.Conn) (ok bool, reason string) {
+	p := &rt.config.Policy
+
+	var ip net.IP
+	if a, isTCP := remoteConn.RemoteAddr().(*net.TCPAddr); isTCP {
+		ip = a.IP
+	}
+	if !p.permits(ip) {
+		return false, "originator not permitted"
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if p.MaxConcurrent > 0 && rt.active >= p.MaxConcurrent {
+		return false, fmt.Sprintf("%d concurrent connections already active", rt.active)
+	}
+	rt.active++
+	rt.admitted++
+	return true, ""
+}
+
+// release marks an admitted connection as finished.
+func (rt *ReverseTunnel) release() {
+	rt.mu.Lock()
+	rt.active--
+	rt.mu.Unlock()
+}
+
+// quotaReached reports whether MaxConnections have been admitted.
+func (rt *ReverseTunnel) quotaReached() bool {
+	limit := rt.config.Policy.MaxConnections
+	if limit <= 0 {
+		return false
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.admitted >= limit
+}
+
+// endExposure records why the tunnel stopped accepting and closes the
+// remote listener, which sends cancel-tcpip-forward to the gateway.
+// acceptLoop sees the closed listener and, because a reason is set,
+// shuts down instead of reconnecting.
+func (rt *ReverseTunnel) endExposure(reason string) {
+	rt.mu.Lock()
+	if rt.endReason == "" {
+		rt.endReason = reason
+	}
+	listener := rt.listener
+	rt.listener = nil
+	rt.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+// exposureEnded returns the reason passed to endExposure, if any.
+func (rt *ReverseTunnel) exposureEnded() string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.endReason
+}
+
+// expiryTimer ends the exposure after ExposeFor and tears down every
+// bridged connection.
+func (rt *ReverseTunnel) expiryTimer() {
+	defer rt.wg.Done()
+
+	t := time.NewTimer(rt.config.Policy.ExposeFor)
+	defer t.Stop()
+
+	select {
+	case <-rt.ctx.Done():
+	case <-t.C:
+		rt.endExposure(fmt.Sprintf("exposure expired after %v", rt.config.Policy.ExposeFor))
+		rt.cancel()
+	}
+}
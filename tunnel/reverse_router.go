@@ -0,0 +1,73 @@
+package tunnel
+
+// reverse_router.go - per-connection local target selection for the
+// reverse tunnel.  Public gateways hand us a single remote port; when
+// a Router is configured we peek at each forwarded stream and pick
+// the local service from the HTTP Host header or TLS SNI.
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"gonc/internal/sniff"
+)
+
+// sniffTimeout bounds how long we wait for a client to send enough of
+// its request to be routed before falling back to the default target.
+const sniffTimeout = 5 * time.Second
+
+// localDialTimeout bounds each dial to a local target.
+const localDialTimeout = 5 * time.Second
+
+// defaultLocalTarget returns the configured LocalAddress:LocalPort.
+func (rt *ReverseTunnel) defaultLocalTarget() string {
+	return net.JoinHostPort(rt.config.LocalAddress, strconv.Itoa(rt.config.LocalPort))
+}
+
+// routeConnection chooses the local target for remoteConn.  It returns
+// the connection to bridge from, which wraps remoteConn when bytes were
+// buffered during sniffing.
+func (rt *ReverseTunnel) routeConnection(remoteConn net.Conn) (net.Conn, string) {
+	if target, ok := rt.forwardTarget(remoteConn); ok {
+		return remoteConn, target // runtime forwards bypass Host/SNI routing
+	}
+	def := rt.defaultLocalTarget()
+	if rt.config.Router == nil {
+		return remoteConn, def
+	}
+
+	log := rt.logger.With("peer", remoteConn.RemoteAddr().String())
+	sc := sniff.NewConn(remoteConn)
+	host, proto, err := sniff.ServerName(sc, sniffTimeout)
+	if err != nil {
+		log.Debug("reverse tunnel: sniff %s: %v", remoteConn.RemoteAddr(), err)
+	}
+
+	target, matched := rt.config.Router.Lookup(host)
+	if target == "" {
+		target = def
+	}
+	log = log.With("proto", proto, "host", host, "target", target)
+	if matched {
+		log.Verbose("reverse tunnel: %s host %q → %s", proto, host, target)
+	} else {
+		log.Debug("reverse tunnel: no route for %s host %q, using %s", proto, host, target)
+	}
+	return sc, target
+}
+
+// dialLocal connects to localTarget and returns the address reached.
+// Connections for the default target go to a backend chosen by the
+// Backends pool when one is configured.
+func (rt *ReverseTunnel) dialLocal(localTarget string) (net.Conn, string, error) {
+	if rt.config.Backends != nil && localTarget == rt.defaultLocalTarget() {
+		conn, backend, err := rt.config.Backends.Dial(rt.ctx)
+		if err != nil {
+			return nil, localTarget, err
+		}
+		return conn, backend, nil
+	}
+	conn, err := net.DialTimeout("tcp", localTarget, localDialTimeout)
+	return conn, localTarget, err
+}
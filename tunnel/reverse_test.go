@@ -1,12 +1,33 @@
 package tunnel
 
 import (
+	"bufio"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/ssh"
+
+	"gonc/internal/audit"
+	"gonc/internal/balance"
+	"gonc/internal/capture"
+	"gonc/internal/control"
+	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/proxyproto"
+	"gonc/internal/ratelimit"
+	"gonc/internal/sniff"
 	"gonc/util"
 )
 
@@ -21,7 +42,7 @@ func TestBridgeConnsForward(t *testing.T) {
 
 	done := make(chan struct{})
 	go func() {
-		bridgeConns(ctx, aServer, bServer)
+		bridgeConns(ctx, aServer, bServer, 0)
 		close(done)
 	}()
 
@@ -56,7 +77,7 @@ func TestBridgeConnsBidirectional(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	go bridgeConns(ctx, aServer, bServer)
+	go bridgeConns(ctx, aServer, bServer, 0)
 
 	// a → b
 	msgAB := []byte("from-A")
@@ -96,7 +117,7 @@ func TestBridgeConnsContextCancel(t *testing.T) {
 
 	done := make(chan struct{})
 	go func() {
-		bridgeConns(ctx, aServer, bServer)
+		bridgeConns(ctx, aServer, bServer, 0)
 		close(done)
 	}()
 
@@ -138,14 +159,16 @@ func TestHandleConnectionForwardsToLocal(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	m := metrics.New()
 	rt := &ReverseTunnel{
 		config: &ReverseTunnelConfig{
 			LocalAddress: "127.0.0.1",
 			LocalPort:    localPort,
 		},
-		logger: util.NewLogger(0),
-		ctx:    ctx,
-		cancel: cancel,
+		logger:  util.NewLogger(0),
+		metrics: m,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 
 	// Simulate a remote connection with a pipe.
@@ -170,6 +193,22 @@ func TestHandleConnectionForwardsToLocal(t *testing.T) {
 
 	remoteClient.Close()
 	rt.wg.Wait()
+
+	recs := m.RecentConnections()
+	if len(recs) != 1 {
+		t.Fatalf("got %d connection records, want 1", len(recs))
+	}
+	r := recs[0]
+	if r.Peer != "pipe" || r.Target != echoLn.Addr().String() {
+		t.Errorf("record peer/target = %q/%q", r.Peer, r.Target)
+	}
+	if r.BytesIn != int64(len(payload)) || r.BytesOut != int64(len(payload)) || r.CloseReason != util.BridgeEOF {
+		t.Errorf("record = %+v, want %d bytes each way closed by eof", r, len(payload))
+	}
+	if h := m.Histograms(); h["local_dial_latency"].Count != 1 || h["connection_duration"].Count != 1 {
+		t.Errorf("histogram counts = %d dial, %d duration; want 1 each",
+			h["local_dial_latency"].Count, h["connection_duration"].Count)
+	}
 }
 
 func TestHandleConnectionLocalRefused(t *testing.T) {
@@ -182,14 +221,16 @@ func TestHandleConnectionLocalRefused(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	m := metrics.New()
 	rt := &ReverseTunnel{
 		config: &ReverseTunnelConfig{
 			LocalAddress: "127.0.0.1",
 			LocalPort:    freePort,
 		},
-		logger: util.NewLogger(0),
-		ctx:    ctx,
-		cancel: cancel,
+		logger:  util.NewLogger(0),
+		metrics: m,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 
 	remoteServer, remoteClient := net.Pipe()
@@ -210,6 +251,606 @@ func TestHandleConnectionLocalRefused(t *testing.T) {
 	}
 
 	rt.wg.Wait()
+
+	if recs := m.RecentConnections(); len(recs) != 1 || recs[0].CloseReason != "local dial failed" {
+		t.Errorf("records = %+v, want one closed by local dial failure", recs)
+	}
+}
+
+func TestHandleConnectionRoutesByHost(t *testing.T) {
+	// Two local services that identify themselves.
+	serve := func(name string) int {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func(c net.Conn) {
+					defer c.Close()
+					buf := make([]byte, 512)
+					c.Read(buf)           //nolint:errcheck
+					c.Write([]byte(name)) //nolint:errcheck
+				}(conn)
+			}
+		}()
+		return ln.Addr().(*net.TCPAddr).Port
+	}
+	defPort := serve("default")
+	apiPort := serve("api")
+
+	router := sniff.NewTable(fmt.Sprintf("127.0.0.1:%d", defPort))
+	if err := router.Add("api.example", fmt.Sprintf("127.0.0.1:%d", apiPort)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    defPort,
+			Router:       router,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for host, want := range map[string]string{"api.example": "api", "other.example": "default"} {
+		remoteServer, remoteClient := net.Pipe()
+		rt.wg.Add(1)
+		go rt.handleConnection(remoteServer)
+
+		req := "GET / HTTP/1.1\r\nHost: " + host + "\r\n\r\n"
+		if _, err := remoteClient.Write([]byte(req)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		got, _ := io.ReadAll(remoteClient)
+		if string(got) != want {
+			t.Errorf("host %q routed to %q, want %q", host, got, want)
+		}
+		remoteClient.Close()
+	}
+	rt.wg.Wait()
+}
+
+func TestHandleConnectionBackends(t *testing.T) {
+	serve := func(name string) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(name)) //nolint:errcheck
+				conn.Close()
+			}
+		}()
+		return ln.Addr().String()
+	}
+	deadPort, err := util.FindFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := fmt.Sprintf("127.0.0.1:%d", deadPort)
+	a, b := serve("a"), serve("b")
+
+	pool := balance.New([]string{dead, a, b}, "tcp", (&net.Dialer{Timeout: time.Second}).DialContext, balance.Config{})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := metrics.New()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    deadPort,
+			Backends:     pool,
+		},
+		logger:  util.NewLogger(0),
+		metrics: m,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	// The dead default is skipped in favour of a live backend.
+	for range 2 {
+		remoteServer, remoteClient := net.Pipe()
+		rt.wg.Add(1)
+		go rt.handleConnection(remoteServer)
+		got, _ := io.ReadAll(remoteClient)
+		if string(got) != "a" && string(got) != "b" {
+			t.Errorf("got %q, want a reply from a backend", got)
+		}
+		remoteClient.Close()
+	}
+	rt.wg.Wait()
+
+	recs := m.RecentConnections()
+	if len(recs) != 2 || recs[0].Target == dead || recs[1].Target == dead {
+		t.Errorf("records = %+v, want the reached backends as targets", recs)
+	}
+}
+
+func TestHandleConnectionMirror(t *testing.T) {
+	echoLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echoLn.Close()
+	go func() {
+		c, err := echoLn.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c) //nolint:errcheck
+	}()
+
+	shadowLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shadowLn.Close()
+	shadowed := make(chan string, 1)
+	go func() {
+		c, err := shadowLn.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		data, _ := io.ReadAll(c)
+		shadowed <- string(data)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: time.Second}
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    echoLn.Addr().(*net.TCPAddr).Port,
+			Mirror:       mirror.New(shadowLn.Addr().String(), dialer.DialContext, 1<<20, util.NewLogger(0)),
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	remoteServer, remoteClient := net.Pipe()
+	rt.wg.Add(1)
+	go rt.handleConnection(remoteServer)
+
+	remoteClient.Write([]byte("request")) //nolint:errcheck
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(remoteClient, buf); err != nil || string(buf) != "request" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+	remoteClient.Close()
+	rt.wg.Wait()
+
+	select {
+	case got := <-shadowed:
+		if got != "request" {
+			t.Errorf("shadow received %q, want request", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow received nothing")
+	}
+}
+
+func TestHandleConnectionProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan *proxyproto.Header, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		h, _ := proxyproto.Read(bufio.NewReader(conn))
+		got <- h
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress:  "127.0.0.1",
+			LocalPort:     ln.Addr().(*net.TCPAddr).Port,
+			ProxyProtocol: 1,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	origin := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000}
+	remoteServer, remoteClient := net.Pipe()
+	defer remoteClient.Close()
+
+	rt.wg.Add(1)
+	go rt.handleConnection(&addrConn{Conn: remoteServer, raddr: origin,
+		laddr: &net.TCPAddr{IP: net.ParseIP("0.0.0.0"), Port: 80}})
+
+	select {
+	case h := <-got:
+		if h == nil || h.Source.String() != origin.String() {
+			t.Errorf("PROXY source = %v, want %v", h, origin)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no PROXY header received")
+	}
+	remoteClient.Close()
+	rt.wg.Wait()
+}
+
+// TestForwardedPayloadAddrs verifies a bind address that is not an IP
+// literal still yields a PROXY header with the client address.
+func TestForwardedPayloadAddrs(t *testing.T) {
+	tests := []struct {
+		addr, origin string
+		wantLocal    string
+		wantHeader   string
+	}{
+		{"0.0.0.0", "203.0.113.7", "0.0.0.0:80", "PROXY TCP4 203.0.113.7 0.0.0.0 51000 80\r\n"},
+		{"", "203.0.113.7", "0.0.0.0:80", "PROXY TCP4 203.0.113.7 0.0.0.0 51000 80\r\n"},
+		{"localhost", "203.0.113.7", "0.0.0.0:80", "PROXY TCP4 203.0.113.7 0.0.0.0 51000 80\r\n"},
+		{"tunnel.example.com", "203.0.113.7", "0.0.0.0:80", "PROXY TCP4 203.0.113.7 0.0.0.0 51000 80\r\n"},
+		{"localhost", "2001:db8::7", "[::]:80", "PROXY TCP6 2001:db8::7 :: 51000 80\r\n"},
+		{"192.0.2.1", "203.0.113.7", "192.0.2.1:80", "PROXY TCP4 203.0.113.7 192.0.2.1 51000 80\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr+"/"+tt.origin, func(t *testing.T) {
+			p := forwardedTCPPayload{Addr: tt.addr, Port: 80, OriginAddr: tt.origin, OriginPort: 51000}
+			laddr, raddr := p.addrs()
+			if laddr.String() != tt.wantLocal {
+				t.Errorf("local = %s, want %s", laddr, tt.wantLocal)
+			}
+			b, err := proxyproto.NewHeader(1, raddr, laddr).Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.wantHeader {
+				t.Errorf("header = %q, want %q", b, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// addrConn overrides the addresses of a net.Pipe end.
+type addrConn struct {
+	net.Conn
+	laddr, raddr net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *addrConn) RemoteAddr() net.Addr { return c.raddr }
+
+// TestHandleConnectionHalfClose verifies a request/response exchange
+// where the client half-closes after sending is not truncated.
+func TestHandleConnectionHalfClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		req, _ := io.ReadAll(c) // wait for the client's EOF
+		time.Sleep(50 * time.Millisecond)
+		c.Write(append([]byte("echo:"), req...)) //nolint:errcheck
+	}()
+
+	// The "remote" side is a TCP pair so it supports CloseWrite.
+	gw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+	client, err := net.Dial("tcp", gw.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	remote, err := gw.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	rt.wg.Add(1)
+	go rt.handleConnection(remote)
+
+	client.Write([]byte("ping"))       //nolint:errcheck
+	client.(*net.TCPConn).CloseWrite() //nolint:errcheck
+
+	got, err := io.ReadAll(client)
+	if err != nil || string(got) != "echo:ping" {
+		t.Errorf("response = %q, %v; want %q", got, err, "echo:ping")
+	}
+	rt.wg.Wait()
+}
+
+// ── Exposure policy ──────────────────────────────────────────────────
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestExposurePolicyPermits(t *testing.T) {
+	p := ExposurePolicy{
+		Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8"), mustCIDR(t, "2001:db8::/32")},
+		Deny:  []*net.IPNet{mustCIDR(t, "10.6.6.0/24")},
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"10.6.6.6", false},
+		{"192.0.2.1", false},
+		{"2001:db8::1", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.permits(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("permits(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	open := ExposurePolicy{Deny: []*net.IPNet{mustCIDR(t, "192.0.2.0/24")}}
+	if !open.permits(nil) || !open.permits(net.ParseIP("198.51.100.1")) {
+		t.Error("deny-only policy should admit unlisted originators")
+	}
+}
+
+// chanListener is a net.Listener fed from a channel.
+type chanListener struct {
+	conns  chan net.Conn
+	done   chan struct{}
+	closed chan struct{} // closed on the first Close, like cancel-tcpip-forward
+	once   sync.Once
+}
+
+func newChanListener() *chanListener {
+	return &chanListener{conns: make(chan net.Conn), done: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, io.EOF
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.once.Do(func() { close(l.done); close(l.closed) })
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+// originConn returns the gateway end of a pipe whose RemoteAddr is ip.
+func originConn(ip string) (net.Conn, net.Conn) {
+	server, client := net.Pipe()
+	return &addrConn{Conn: server, raddr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000},
+		laddr: &net.TCPAddr{}}, client
+}
+
+func TestAcceptLoopPolicy(t *testing.T) {
+	// Local echo service.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }() //nolint:errcheck
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fl := newChanListener()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+			Policy: ExposurePolicy{
+				Deny:           []*net.IPNet{mustCIDR(t, "192.0.2.0/24")},
+				MaxConnections: 2,
+				MaxConcurrent:  1,
+			},
+		},
+		listener: fl,
+		logger:   util.NewLogger(0),
+	}
+	rt.ctx, rt.cancel = context.WithCancel(ctx)
+	rt.wg.Add(1)
+	go rt.acceptLoop()
+
+	// expectClosed asserts the client end sees EOF without a bridge.
+	expectClosed := func(c net.Conn, why string) {
+		t.Helper()
+		c.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		if _, err := c.Read(make([]byte, 1)); err == nil {
+			t.Errorf("%s: connection was bridged", why)
+		}
+		c.Close()
+	}
+	// expectEcho asserts the client end is bridged to the echo service.
+	expectEcho := func(c net.Conn) {
+		t.Helper()
+		go c.Write([]byte("ping")) //nolint:errcheck
+		buf := make([]byte, 4)
+		c.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+		if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("echo = %q, %v", buf, err)
+		}
+	}
+
+	denied, deniedClient := originConn("192.0.2.10")
+	fl.conns <- denied
+	expectClosed(deniedClient, "denied originator")
+
+	first, firstClient := originConn("198.51.100.1")
+	fl.conns <- first
+	expectEcho(firstClient)
+
+	busy, busyClient := originConn("198.51.100.2")
+	fl.conns <- busy
+	expectClosed(busyClient, "over concurrency limit")
+
+	firstClient.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rt.mu.Lock()
+		active := rt.active
+		rt.mu.Unlock()
+		if active == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The second admitted connection exhausts the quota.
+	second, secondClient := originConn("198.51.100.3")
+	fl.conns <- second
+	expectEcho(secondClient)
+
+	select {
+	case <-fl.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote forward not cancelled after quota")
+	}
+
+	// The loop drains the in-flight connection before returning.
+	secondClient.Close()
+	done := make(chan struct{})
+	go func() { rt.wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("acceptLoop did not return after quota")
+	}
+	if got := rt.exposureEnded(); got == "" {
+		t.Error("expected an exposure end reason")
+	}
+}
+
+func TestExpiryTimerCancelsForward(t *testing.T) {
+	fl := newChanListener()
+	rt := &ReverseTunnel{
+		config:   &ReverseTunnelConfig{Policy: ExposurePolicy{ExposeFor: 50 * time.Millisecond}},
+		listener: fl,
+		logger:   util.NewLogger(0),
+	}
+	rt.ctx, rt.cancel = context.WithCancel(context.Background())
+	rt.wg.Add(1)
+	go rt.expiryTimer()
+
+	select {
+	case <-fl.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote forward not cancelled at expiry")
+	}
+	<-rt.ctx.Done()
+	rt.wg.Wait()
+}
+
+// ── Public URL capture ───────────────────────────────────────────────
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    string // "" = no URL expected
+		service string
+	}{
+		{"Forwarding HTTP traffic from https://a1b2c3.serveo.net", "https://a1b2c3.serveo.net", "serveo"},
+		{"\x1b[32mForwarding HTTP traffic from https://x.serveousercontent.com\x1b[0m", "https://x.serveousercontent.com", "serveo"},
+		{"7f3a.lhr.life tunneled with tls termination, https://7f3a.lhr.life", "https://7f3a.lhr.life", "localhost.run"},
+		{"To set up and manage custom domains go to https://admin.localhost.run/", "", ""},
+		{"More details at https://localhost.run/docs/custom-domains", "", ""},
+		{"Your tunnel is available at https://demo.tunnels.example.", "https://demo.tunnels.example", "generic"},
+		{"See https://docs.example for help", "", ""},
+		{"Forwarding http://plain.example", "", ""},
+	}
+	for _, tt := range tests {
+		got := extractURLs(tt.line, "session")
+		if tt.want == "" {
+			if len(got) != 0 {
+				t.Errorf("extractURLs(%q) = %v, want none", tt.line, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0].URL != tt.want || got[0].Service != tt.service {
+			t.Errorf("extractURLs(%q) = %v, want %s (%s)", tt.line, got, tt.want, tt.service)
+		}
+	}
+}
+
+func TestScanMessagePublishesOnce(t *testing.T) {
+	var got []PublicURL
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{OnURL: func(u PublicURL) { got = append(got, u) }},
+		logger: util.NewLogger(0),
+	}
+
+	msg := "Forwarding HTTP traffic from https://abc.serveo.net\r\n"
+	rt.scanMessage(msg, "banner")
+	rt.scanMessage(msg, "session") // repeated after a reconnect
+
+	if len(got) != 1 || got[0].URL != "https://abc.serveo.net" || got[0].Source != "banner" {
+		t.Errorf("published %v, want one serveo URL from the banner", got)
+	}
 }
 
 // ── sleepCtx ─────────────────────────────────────────────────────────
@@ -294,3 +935,380 @@ func TestReverseTunnelCloseIdempotent(t *testing.T) {
 		t.Errorf("second Close: %v", err)
 	}
 }
+
+// ── Runtime control ──────────────────────────────────────────────────
+
+func TestAddForwardValidation(t *testing.T) {
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{LocalAddress: "127.0.0.1", LocalPort: 3000, RemotePort: 80},
+		logger: util.NewLogger(0),
+	}
+	tests := []struct {
+		name string
+		f    control.Forward
+		want string
+	}{
+		{"port zero", control.Forward{Local: "3001"}, "out of range"},
+		{"primary port", control.Forward{RemotePort: 80, Local: "3001"}, "primary"},
+		{"bad local", control.Forward{RemotePort: 81, Local: "nope"}, "local"},
+		{"not connected", control.Forward{RemotePort: 81, Local: "3001"}, "not connected"},
+	}
+	for _, tt := range tests {
+		err := rt.AddForward(tt.f)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if err := rt.RemoveForward(80); err == nil {
+		t.Error("removing the primary forward should fail")
+	}
+	if err := rt.RemoveForward(81); err == nil {
+		t.Error("removing an unknown forward should fail")
+	}
+	if err := rt.Reconnect(); err == nil {
+		t.Error("Reconnect on a tunnel that never started should fail")
+	}
+}
+
+// sshGateway runs an SSH server that grants every tcpip-forward and
+// keepalive request and returns its port.
+func sshGateway(t *testing.T) int {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn, chans, reqs, err := ssh.NewServerConn(c, cfg)
+				if err != nil {
+					c.Close()
+					return
+				}
+				defer conn.Close()
+				go func() {
+					for ch := range chans {
+						ch.Reject(ssh.Prohibited, "no channels") //nolint:errcheck
+					}
+				}()
+				for req := range reqs {
+					var reply []byte
+					if req.Type == "tcpip-forward" {
+						reply = ssh.Marshal(struct{ Port uint32 }{9000})
+					}
+					req.Reply(req.WantReply, reply) //nolint:errcheck
+				}
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// keepaliveLoops counts the goroutines running keepaliveLoop.
+func keepaliveLoops() int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	return strings.Count(string(buf), ").keepaliveLoop(")
+}
+
+func TestReconnectRestartsKeepalive(t *testing.T) {
+	rt := NewReverseTunnel(&ReverseTunnelConfig{
+		SSHConfig: &SSHConfig{
+			Host: "127.0.0.1", Port: sshGateway(t), User: "u",
+			AllowKeyboardInteractive: true, ConnTimeout: time.Second,
+		},
+		RemotePort:        9000,
+		LocalPort:         8080,
+		KeepAliveInterval: 10 * time.Millisecond,
+	}, util.NewLogger(0), nil)
+	if err := rt.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for i := 0; i < 3; i++ {
+		rt.mu.Lock()
+		old := rt.listener
+		rt.mu.Unlock()
+		if err := rt.Reconnect(); err != nil {
+			t.Fatalf("Reconnect %d: %v", i+1, err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			rt.mu.Lock()
+			cur := rt.listener
+			rt.mu.Unlock()
+			if cur != nil && cur != old {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("tunnel did not reconnect after Reconnect %d", i+1)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for keepaliveLoops() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := keepaliveLoops(); n != 1 {
+		t.Errorf("%d keepalive loops after 3 reconnects, want 1", n)
+	}
+}
+
+// TestRouteConnectionRuntimeForward verifies channels bound to a
+// runtime forward's port go to its local target, and others to the
+// primary target.
+func TestRouteConnectionRuntimeForward(t *testing.T) {
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{LocalAddress: "127.0.0.1", LocalPort: 3000, RemotePort: 80},
+		logger: util.NewLogger(0),
+		forwards: map[int]control.Forward{
+			8081: {RemotePort: 8081, Local: "127.0.0.1:3001"},
+		},
+	}
+
+	for port, want := range map[int]string{8081: "127.0.0.1:3001", 80: "127.0.0.1:3000", 9999: "127.0.0.1:3000"} {
+		a, b := net.Pipe()
+		conn := &addrConn{Conn: a, laddr: &net.TCPAddr{Port: port}, raddr: &net.TCPAddr{}}
+		if _, got := rt.routeConnection(conn); got != want {
+			t.Errorf("bound port %d → %s, want %s", port, got, want)
+		}
+		a.Close()
+		b.Close()
+	}
+
+	fws := rt.Forwards()
+	if len(fws) != 2 || !fws[0].Primary || fws[0].Local != "127.0.0.1:3000" || fws[1].RemotePort != 8081 {
+		t.Errorf("Forwards() = %+v", fws)
+	}
+}
+
+// TestHandleConnectionRegistry verifies bridged connections are listed
+// in the control registry until they close.
+func TestHandleConnectionRegistry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			io.Copy(c, c) //nolint:errcheck
+			c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reg := control.NewRegistry()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+			Registry:     reg,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	remoteServer, remoteClient := net.Pipe()
+	rt.wg.Add(1)
+	go rt.handleConnection(remoteServer)
+
+	remoteClient.Write([]byte("ping"))         //nolint:errcheck
+	io.ReadFull(remoteClient, make([]byte, 4)) //nolint:errcheck
+
+	conns := reg.Connections()
+	if len(conns) != 1 || conns[0].Mode != "reverse" || conns[0].BytesIn != 4 {
+		t.Fatalf("registry = %+v, want one reverse conn with 4 bytes in", conns)
+	}
+
+	// Closing through the registry ends the bridge.
+	reg.CloseConnection(conns[0].ID) //nolint:errcheck
+	rt.wg.Wait()
+	remoteClient.Close()
+	if len(reg.Connections()) != 0 {
+		t.Error("connection still registered after close")
+	}
+}
+
+func TestHandleConnectionAudit(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			io.Copy(c, c) //nolint:errcheck
+			c.Close()
+		}
+	}()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	al, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			SSHConfig:    &SSHConfig{Host: "gateway.example", Port: 22},
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+			Audit:        al,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	remoteServer, remoteClient := net.Pipe()
+	rt.wg.Add(1)
+	go rt.handleConnection(remoteServer)
+
+	remoteClient.Write([]byte("ping"))         //nolint:errcheck
+	io.ReadFull(remoteClient, make([]byte, 4)) //nolint:errcheck
+	remoteClient.Close()
+	rt.wg.Wait()
+	al.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec audit.Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("audit line %q: %v", data, err)
+	}
+	if rec.Mode != "reverse" || rec.Gateway != "gateway.example:22" || rec.Target != ln.Addr().String() {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec.BytesIn != 4 || rec.BytesOut != 4 {
+		t.Errorf("bytes in/out = %d/%d, want 4/4", rec.BytesIn, rec.BytesOut)
+	}
+}
+
+func TestHandleConnectionCapture(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			io.Copy(c, c) //nolint:errcheck
+			c.Close()
+		}
+	}()
+
+	prefix := filepath.Join(t.TempDir(), "session")
+	cp, err := capture.Open(capture.Options{Tee: prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+			Capture:      cp,
+		},
+		logger: util.NewLogger(0),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	remoteServer, remoteClient := net.Pipe()
+	rt.wg.Add(1)
+	go rt.handleConnection(remoteServer)
+
+	remoteClient.Write([]byte("ping"))         //nolint:errcheck
+	io.ReadFull(remoteClient, make([]byte, 4)) //nolint:errcheck
+	remoteClient.Close()
+	rt.wg.Wait()
+	cp.Close()
+
+	for suffix, want := range map[string]string{".1.in": "ping", ".1.out": "ping"} {
+		got, err := os.ReadFile(prefix + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", suffix, got, want)
+		}
+	}
+}
+
+func TestHandleConnectionQuota(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			io.Copy(c, c) //nolint:errcheck
+			c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := metrics.New()
+	rt := &ReverseTunnel{
+		config: &ReverseTunnelConfig{
+			LocalAddress: "127.0.0.1",
+			LocalPort:    ln.Addr().(*net.TCPAddr).Port,
+			Limiter:      ratelimit.New(0, 0, 4),
+		},
+		logger:  util.NewLogger(0),
+		metrics: m,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	remoteServer, remoteClient := net.Pipe()
+	defer remoteClient.Close()
+	rt.wg.Add(1)
+	go rt.handleConnection(remoteServer)
+
+	// The 4-byte quota is spent on the request, so the echo cannot be
+	// delivered and the session ends.
+	remoteClient.Write([]byte("pingpong")) //nolint:errcheck
+	io.Copy(io.Discard, remoteClient)      //nolint:errcheck
+	rt.wg.Wait()
+
+	if recs := m.RecentConnections(); len(recs) != 1 || recs[0].CloseReason != "quota" {
+		t.Errorf("records = %+v, want one closed by quota", recs)
+	}
+}
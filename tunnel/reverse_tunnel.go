@@ -3,8 +3,12 @@
 // loop.  Supporting logic is split across sibling files:
 //
 //   - reverse_dial.go      - SSH dialling, gateway validation, message draining
+//   - reverse_urls.go      - public URL recognition in gateway messages
 //   - reverse_listener.go  - custom forwarded-tcpip listener
 //   - reverse_forwarder.go - connection bridging
+//   - reverse_router.go    - Host/SNI routing and local backend dialling
+//   - reverse_policy.go    - originator filtering, TTL and connection caps
+//   - reverse_control.go   - runtime forwards and reconnects (admin API)
 //   - reverse_health.go    - keepalive and reconnection
 package tunnel
 
@@ -17,7 +21,14 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"gonc/internal/audit"
+	"gonc/internal/balance"
+	"gonc/internal/capture"
+	"gonc/internal/control"
 	"gonc/internal/metrics"
+	"gonc/internal/mirror"
+	"gonc/internal/ratelimit"
+	"gonc/internal/sniff"
 	"gonc/util"
 )
 
@@ -35,27 +46,84 @@ type ReverseTunnelConfig struct {
 	LocalAddress string // local address (default "127.0.0.1")
 	LocalPort    int    // local port of the service
 
+	// Router, when non-nil, picks the local target per connection from
+	// the HTTP Host header or TLS SNI.  Unmatched connections go to the
+	// table's default, which should be LocalAddress:LocalPort.
+	Router *sniff.Table
+
+	// Backends, when non-nil, replaces LocalAddress:LocalPort: each
+	// connection for the default target goes to a local backend
+	// chosen by the pool.  Host/SNI routes and runtime forwards are
+	// unaffected.
+	Backends *balance.Pool
+
+	// ProxyProtocol, when 1 or 2, prepends a PROXY protocol header of
+	// that version to each local dial so the service sees the original
+	// client address reported by the gateway.
+	ProxyProtocol int
+
+	// Policy limits who may connect and how long the forward stays up.
+	Policy ExposurePolicy
+
+	// Registry, when non-nil, tracks bridged connections so the admin
+	// API can list and close them.
+	Registry *control.Registry
+
+	// Audit, when non-nil, receives one record per bridged connection.
+	Audit *audit.Log
+
+	// Capture, when non-nil, records the traffic of every bridged
+	// connection for -o / --tee.
+	Capture *capture.Capture
+
+	// Mirror, when non-nil, copies what each remote client sends to a
+	// shadow target and discards its replies.
+	Mirror *mirror.Mirror
+
+	// Limiter, when non-nil, shapes every bridged connection and
+	// enforces the per-session byte quota.
+	Limiter *ratelimit.Limiter
+
+	// OnURL, when non-nil, is called once for each public forwarding
+	// URL the gateway announces in its banner or session output.
+	OnURL func(PublicURL)
+
 	// Behaviour.
 	CheckGatewayPorts bool
 	KeepAliveInterval time.Duration // 0 disables keepalive
 	AutoReconnect     bool
+	IdleTimeout       time.Duration // close bridged connections idle this long (0 = never)
 }
 
 // ReverseTunnel forwards connections arriving on a remote SSH gateway
 // to a local TCP service.  This is the Go equivalent of ssh -R.
 type ReverseTunnel struct {
-	config  *ReverseTunnelConfig
-	client  *ssh.Client
+	config   *ReverseTunnelConfig
+	client   *ssh.Client
 	listener net.Listener
-	logger  *util.Logger
-	metrics *metrics.Collector
+	logger   *util.Logger
+	metrics  *metrics.Collector
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	wg     sync.WaitGroup
+	conns  sync.WaitGroup // bridged connections only
 	mu     sync.Mutex
 	closed bool
+
+	// Exposure policy state, guarded by mu.
+	active    int    // connections currently bridged
+	admitted  int    // connections admitted since Start
+	endReason string // set once the policy has ended the exposure
+
+	seenURLs map[string]bool // public URLs already reported, guarded by mu
+
+	stopKeepalive context.CancelFunc // ends the current keepaliveLoop, guarded by mu
+
+	// Admin API state, guarded by mu.
+	forwards           map[int]control.Forward // runtime forwards by remote port
+	reconnectRequested bool
 }
 
 // NewReverseTunnel creates a reverse tunnel ready to [Start].
@@ -109,8 +177,13 @@ func (rt *ReverseTunnel) Start(ctx context.Context) error {
 
 	remoteAddr := fmt.Sprintf("%s:%d", rt.config.RemoteBindAddress, rt.config.RemotePort)
 	localAddr := fmt.Sprintf("%s:%d", rt.config.LocalAddress, rt.config.LocalPort)
+	rt.metrics.SetTunnelUp(true)
 	rt.logger.Info("reverse tunnel established: %s (remote) → %s (local)",
 		remoteAddr, localAddr)
+	if ttl := rt.config.Policy.ExposeFor; ttl > 0 {
+		rt.logger.Info("reverse tunnel: exposure ends at %s",
+			time.Now().Add(ttl).Format("15:04:05"))
+	}
 
 	// Ensure the listener is closed when the context is cancelled so
 	// that a blocking Accept call is unblocked.
@@ -124,12 +197,15 @@ func (rt *ReverseTunnel) Start(ctx context.Context) error {
 	}()
 
 	// 4. Keepalive loop (optional).
-	if rt.config.KeepAliveInterval > 0 {
+	rt.startKeepalive()
+
+	// 5. Exposure expiry (optional).
+	if rt.config.Policy.ExposeFor > 0 {
 		rt.wg.Add(1)
-		go rt.keepaliveLoop()
+		go rt.expiryTimer()
 	}
 
-	// 5. Accept loop.
+	// 6. Accept loop.
 	rt.wg.Add(1)
 	go rt.acceptLoop()
 
@@ -206,18 +282,25 @@ func (rt *ReverseTunnel) acceptLoop() {
 		rt.mu.Unlock()
 
 		if listener == nil {
+			rt.drainIfEnded()
 			return
 		}
 
 		remoteConn, err := listener.Accept()
 		if err != nil {
-			if rt.ctx.Err() != nil {
-				return // clean shutdown
+			if rt.drainIfEnded() || rt.ctx.Err() != nil {
+				return // policy expiry or clean shutdown
+			}
+			requested := rt.takeReconnectRequest()
+			if requested {
+				rt.logger.Info("reverse tunnel: reconnect requested")
+			} else {
+				rt.logger.Error("reverse tunnel accept: %v", err)
+				rt.metrics.RecordError(fmt.Sprintf("accept: %v", err))
 			}
-			rt.logger.Error("reverse tunnel accept: %v", err)
-			rt.metrics.RecordError(fmt.Sprintf("accept: %v", err))
+			rt.metrics.SetTunnelUp(false)
 
-			if rt.config.AutoReconnect {
+			if rt.config.AutoReconnect || requested {
 				if reconnErr := rt.reconnect(); reconnErr != nil {
 					rt.logger.Error("reconnect failed, giving up: %v", reconnErr)
 					return
@@ -227,11 +310,42 @@ func (rt *ReverseTunnel) acceptLoop() {
 			return
 		}
 
-		rt.logger.Verbose("reverse tunnel: connection from %s",
-			remoteConn.RemoteAddr())
+		if ok, reason := rt.admit(remoteConn); !ok {
+			rt.logger.With("peer", remoteConn.RemoteAddr().String(), "reason", reason).
+				Verbose("reverse tunnel: rejected %s: %s", remoteConn.RemoteAddr(), reason)
+			rt.metrics.RecordError(fmt.Sprintf("rejected %s: %s", remoteConn.RemoteAddr(), reason))
+			remoteConn.Close()
+			continue
+		}
+
+		rt.logger.With("peer", remoteConn.RemoteAddr().String()).
+			Verbose("reverse tunnel: connection from %s", remoteConn.RemoteAddr())
 		rt.metrics.ConnectionOpened()
 
 		rt.wg.Add(1)
-		go rt.handleConnection(remoteConn)
+		rt.conns.Add(1)
+		go func() {
+			defer rt.conns.Done()
+			defer rt.release()
+			rt.handleConnection(remoteConn)
+		}()
+
+		if rt.quotaReached() {
+			rt.endExposure(fmt.Sprintf("connection limit of %d reached",
+				rt.config.Policy.MaxConnections))
+		}
+	}
+}
+
+// drainIfEnded reports whether the exposure policy ended the tunnel.
+// If so, it logs the reason and waits for bridged connections to
+// finish before acceptLoop returns and cancels the tunnel context.
+func (rt *ReverseTunnel) drainIfEnded() bool {
+	reason := rt.exposureEnded()
+	if reason == "" {
+		return false
 	}
+	rt.logger.Info("reverse tunnel: %s, remote forward cancelled", reason)
+	rt.conns.Wait()
+	return true
 }
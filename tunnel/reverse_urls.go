@@ -0,0 +1,130 @@
+package tunnel
+
+// reverse_urls.go - recognition of public forwarding URLs in the
+// banner and session output of tunnel services.  serveo.net and
+// localhost.run announce the generated hostname as free text; we pick
+// it out so callers can consume it without scraping stderr.
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PublicURL is a forwarding URL announced by the gateway.
+type PublicURL struct {
+	URL     string    // e.g. "https://abc123.lhr.life"
+	Service string    // "serveo", "localhost.run" or "generic"
+	Source  string    // "banner" or "session"
+	Time    time.Time // when it was seen
+}
+
+var (
+	urlPattern  = regexp.MustCompile(`https?://[^\s"'<>\x60]+`)
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+)
+
+// knownServices maps tunnel hostname suffixes to service names.  Any
+// subdomain of these is a forwarding hostname.
+var knownServices = []struct {
+	suffix  string
+	service string
+}{
+	{"serveo.net", "serveo"},
+	{"serveousercontent.com", "serveo"},
+	{"lhr.life", "localhost.run"},
+	{"lhr.rocks", "localhost.run"},
+}
+
+// isServiceSite reports whether host serves a tunnel provider's own
+// documentation or account pages, which their banners link to.
+func isServiceSite(host string) bool {
+	switch host {
+	case "serveo.net", "www.serveo.net", "console.serveo.net", "localhost.run":
+		return true
+	}
+	return strings.HasSuffix(host, ".localhost.run")
+}
+
+// genericHints are phrases that mark a line as announcing a tunnel URL
+// when the host is not a known service.
+var genericHints = []string{"forwarding", "tunnel", "available at", "public url", "your url"}
+
+// extractURLs returns the forwarding URLs announced in a single line
+// of gateway output.
+func extractURLs(line, source string) []PublicURL {
+	line = ansiPattern.ReplaceAllString(line, "")
+	lower := strings.ToLower(line)
+
+	var out []PublicURL
+	for _, raw := range urlPattern.FindAllString(line, -1) {
+		raw = strings.TrimRight(raw, ".,;:!?)]}")
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+
+		service := ""
+		for _, k := range knownServices {
+			if strings.HasSuffix(host, "."+k.suffix) && !isServiceSite(host) {
+				service = k.service
+				break
+			}
+		}
+		if service == "" {
+			if u.Scheme != "https" || isServiceSite(host) || !containsAny(lower, genericHints) {
+				continue
+			}
+			service = "generic"
+		}
+		out = append(out, PublicURL{URL: raw, Service: service, Source: source, Time: time.Now()})
+	}
+	return out
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanMessage logs each line of a gateway message and reports any
+// forwarding URLs it contains.
+func (rt *ReverseTunnel) scanMessage(text, source string) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rt.logger.Info("%s", line)
+		for _, u := range extractURLs(line, source) {
+			rt.publishURL(u)
+		}
+	}
+}
+
+// publishURL reports u once per tunnel lifetime; gateways repeat the
+// announcement after every reconnect.
+func (rt *ReverseTunnel) publishURL(u PublicURL) {
+	rt.mu.Lock()
+	if rt.seenURLs == nil {
+		rt.seenURLs = make(map[string]bool)
+	}
+	seen := rt.seenURLs[u.URL]
+	rt.seenURLs[u.URL] = true
+	rt.mu.Unlock()
+	if seen {
+		return
+	}
+
+	rt.logger.With("url", u.URL, "service", u.Service, "source", u.Source).
+		Info("public URL: %s (service=%s source=%s)", u.URL, u.Service, u.Source)
+	if rt.config.OnURL != nil {
+		rt.config.OnURL(u)
+	}
+}
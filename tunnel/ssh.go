@@ -10,6 +10,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	ncerr "gonc/internal/errors"
+	"gonc/internal/metrics"
 	"gonc/util"
 )
 
@@ -35,22 +36,25 @@ type SSHConfig struct {
 // SSHTunnel implements [Tunnel] by opening an SSH connection and
 // forwarding traffic with ssh.Client.Dial.
 type SSHTunnel struct {
-	config *SSHConfig
-	client *ssh.Client
-	logger *util.Logger
-	mu     sync.RWMutex
-	alive  bool
+	config  *SSHConfig
+	client  *ssh.Client
+	logger  *util.Logger
+	metrics *metrics.Collector
+	mu      sync.RWMutex
+	alive   bool
 }
 
 // NewSSHTunnel creates a tunnel that is ready to [Connect].
-func NewSSHTunnel(cfg *SSHConfig, logger *util.Logger) *SSHTunnel {
+// The metrics collector is optional (nil-safe); it is told whenever
+// the tunnel comes up or goes down.
+func NewSSHTunnel(cfg *SSHConfig, logger *util.Logger, m *metrics.Collector) *SSHTunnel {
 	if cfg.Port == 0 {
 		cfg.Port = 22
 	}
 	if cfg.ConnTimeout == 0 {
 		cfg.ConnTimeout = 30 * time.Second
 	}
-	return &SSHTunnel{config: cfg, logger: logger}
+	return &SSHTunnel{config: cfg, logger: logger, metrics: m}
 }
 
 // Connect dials the SSH gateway and completes the handshake.
@@ -76,6 +80,7 @@ func (t *SSHTunnel) Connect(ctx context.Context) error {
 	t.logger.Debug("SSH: dialing %s as %s", addr, t.config.User)
 
 	// Use a context-aware TCP dial so callers can cancel.
+	start := time.Now()
 	var dialer net.Dialer
 	tcpConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
@@ -87,6 +92,7 @@ func (t *SSHTunnel) Connect(ctx context.Context) error {
 		tcpConn.Close()
 		return ncerr.WrapSSH("handshake", t.config.Host, t.config.Port, err)
 	}
+	t.metrics.ObserveHandshake(time.Since(start))
 
 	client := ssh.NewClient(sshConn, chans, reqs)
 
@@ -94,6 +100,7 @@ func (t *SSHTunnel) Connect(ctx context.Context) error {
 	t.client = client
 	t.alive = true
 	t.mu.Unlock()
+	t.metrics.SetTunnelUp(true)
 
 	go t.monitor()
 
@@ -116,7 +123,8 @@ func (t *SSHTunnel) Dial(ctx context.Context, network, address string) (net.Conn
 	if err != nil {
 		return nil, fmt.Errorf("tunnel dial %s: %w", address, err)
 	}
-	return conn, nil
+	// SSH channels reject deadlines; emulate them so timeouts work.
+	return newDeadlineConn(conn), nil
 }
 
 // Close shuts down the SSH connection.
@@ -154,8 +162,10 @@ func (t *SSHTunnel) monitor() {
 	t.mu.Lock()
 	t.alive = false
 	t.mu.Unlock()
+	t.metrics.SetTunnelUp(false)
 
 	if err != nil {
+		t.metrics.RecordError(fmt.Sprintf("SSH tunnel closed: %v", err))
 		t.logger.Debug("SSH tunnel closed: %v", err)
 	} else {
 		t.logger.Debug("SSH tunnel closed")
@@ -6,6 +6,8 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DefaultBufSize is the standard buffer size for network I/O (32 KiB).
@@ -38,9 +40,8 @@ func BidirectionalCopy(ctx context.Context, conn net.Conn, r io.Reader, w io.Wri
 		// Half-close the write side so the remote knows we're done
 		// sending, but keep the read side open to drain any remaining
 		// data from the server (the writer goroutine handles that).
-		if tc, ok := conn.(*net.TCPConn); ok {
-			tc.CloseWrite() //nolint:errcheck
-		}
+		// Connections that cannot half-close, like UDP, stay open.
+		CloseWrite(conn) //nolint:errcheck
 		errCh <- err
 		// Only cancel on real errors; a normal EOF from the reader
 		// should NOT tear down the connection before the remote
@@ -63,6 +64,143 @@ func BidirectionalCopy(ctx context.Context, conn net.Conn, r io.Reader, w io.Wri
 	return nil
 }
 
+// closeWriter is implemented by connections that can shut down their
+// write side alone: *net.TCPConn, *net.UnixConn, ssh.Channel, and
+// wrappers that delegate to them.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// ErrHalfCloseUnsupported is returned by [CloseWrite] for a
+// connection that cannot shut down its write side alone, such as a
+// UDP socket.
+var ErrHalfCloseUnsupported = errors.New("half-close not supported")
+
+// CloseWrite half-closes conn so the peer reads EOF while data can
+// still arrive in the other direction.  A connection without half-close
+// support is left open and ErrHalfCloseUnsupported returned; callers
+// that must end the stream close it themselves.
+func CloseWrite(conn net.Conn) error {
+	if cw, ok := conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return ErrHalfCloseUnsupported
+}
+
+// Reasons reported by [BridgeReason] for ending a bridge.
+const (
+	BridgeEOF       = "eof"       // both directions reached EOF
+	BridgeError     = "error"     // a read or write failed
+	BridgeIdle      = "idle"      // no data moved for the idle timeout
+	BridgeCancelled = "cancelled" // the caller's context was cancelled
+)
+
+// Bridge copies data in both directions between a and b and returns
+// the bytes moved each way.  When one direction reaches EOF the
+// destination is half-closed with [CloseWrite], or closed if it cannot
+// be, and the other direction keeps flowing, so request/response protocols where the
+// client half-closes after sending still receive the full response.
+//
+// Both connections are closed once both directions have finished, on
+// the first copy error, when ctx is cancelled, or when no data has
+// moved in either direction for idle (0 disables the idle timeout).
+func Bridge(ctx context.Context, a, b net.Conn, idle time.Duration) (aToB, bToA int64) {
+	aToB, bToA, _ = BridgeReason(ctx, a, b, idle)
+	return aToB, bToA
+}
+
+// BridgeReason is [Bridge] that also reports why the bridge ended:
+// one of BridgeEOF, BridgeError, BridgeIdle or BridgeCancelled.
+func BridgeReason(parent context.Context, a, b net.Conn, idle time.Duration) (aToB, bToA int64, reason string) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	var failed atomic.Bool
+
+	var wg sync.WaitGroup
+	pump := func(dst, src net.Conn, n *int64) {
+		defer wg.Done()
+		w := &activityWriter{w: dst, last: &lastActive}
+		written, err := io.Copy(w, src)
+		*n = written
+		if err != nil {
+			// Reads from a conn the other pump had to close outright
+			// fail harmlessly; that is still an orderly end.
+			if !isHarmless(err) {
+				failed.Store(true)
+			}
+			cancel() // reset or write failure: tear down both sides
+			return
+		}
+		if errors.Is(CloseWrite(dst), ErrHalfCloseUnsupported) {
+			dst.Close() // the peer can only learn of the EOF this way
+		}
+	}
+
+	wg.Add(2)
+	go pump(b, a, &aToB)
+	go pump(a, b, &bToA)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var idleC <-chan time.Time
+	var idleTimer *time.Timer
+	if idle > 0 {
+		idleTimer = time.NewTimer(idle)
+		defer idleTimer.Stop()
+		idleC = idleTimer.C
+	}
+
+	reason = BridgeEOF
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				reason = BridgeCancelled
+			}
+			break wait
+		case <-idleC:
+			quiet := time.Since(time.Unix(0, lastActive.Load()))
+			if quiet >= idle {
+				reason = BridgeIdle
+				break wait
+			}
+			idleTimer.Reset(idle - quiet)
+		}
+	}
+
+	a.Close()
+	b.Close()
+	<-done
+	if reason == BridgeEOF && failed.Load() {
+		reason = BridgeError
+	}
+	return aToB, bToA, reason
+}
+
+// activityWriter records the time of every successful write.
+type activityWriter struct {
+	w    io.Writer
+	last *atomic.Int64
+}
+
+func (aw *activityWriter) Write(p []byte) (int, error) {
+	n, err := aw.w.Write(p)
+	if n > 0 {
+		aw.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
 // isHarmless returns true for errors that are expected during shutdown.
 func isHarmless(err error) bool {
 	if err == nil {
@@ -3,6 +3,7 @@ package util
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net"
 	"testing"
@@ -51,6 +52,171 @@ func TestBidirectionalCopy(t *testing.T) {
 	}
 }
 
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	if server == nil {
+		t.Fatal("accept failed")
+	}
+	return client, server
+}
+
+// TestBridge_HalfClose verifies a client that half-closes after its
+// request still receives the whole response.
+func TestBridge_HalfClose(t *testing.T) {
+	client, front := tcpPair(t)
+	back, service := tcpPair(t)
+	defer client.Close()
+
+	// The service reads the full request, then answers and closes.
+	response := bytes.Repeat([]byte("r"), 256*1024)
+	go func() {
+		defer service.Close()
+		req, _ := io.ReadAll(service)
+		if string(req) != "request" {
+			return
+		}
+		service.Write(response) //nolint:errcheck
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type result struct{ aToB, bToA int64 }
+	done := make(chan result, 1)
+	go func() {
+		a, b := Bridge(ctx, front, back, 0)
+		done <- result{a, b}
+	}()
+
+	client.Write([]byte("request"))    //nolint:errcheck
+	client.(*net.TCPConn).CloseWrite() //nolint:errcheck
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(got) != len(response) {
+		t.Errorf("got %d response bytes, want %d", len(got), len(response))
+	}
+
+	select {
+	case r := <-done:
+		if r.aToB != 7 || r.bToA != int64(len(response)) {
+			t.Errorf("counts = %d/%d, want 7/%d", r.aToB, r.bToA, len(response))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Bridge did not return after both directions finished")
+	}
+}
+
+// TestBridge_IdleTimeout verifies a silent connection is torn down.
+func TestBridge_IdleTimeout(t *testing.T) {
+	aServer, aClient := net.Pipe()
+	bServer, bClient := net.Pipe()
+	defer aClient.Close()
+	defer bClient.Close()
+
+	start := time.Now()
+	_, _, reason := BridgeReason(context.Background(), aServer, bServer, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Bridge returned after %v, want ~100ms", elapsed)
+	}
+	if reason != BridgeIdle {
+		t.Errorf("reason = %q, want %q", reason, BridgeIdle)
+	}
+}
+
+// TestBridgeReason covers the ways a bridge can end other than idling.
+func TestBridgeReason(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(aClient, bClient net.Conn, cancel context.CancelFunc)
+		want string
+	}{
+		{"both sides close", func(a, b net.Conn, _ context.CancelFunc) {
+			a.Close()
+			b.Close()
+		}, BridgeEOF},
+		{"context cancelled", func(_, _ net.Conn, cancel context.CancelFunc) {
+			cancel()
+		}, BridgeCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aServer, aClient := net.Pipe()
+			bServer, bClient := net.Pipe()
+			defer aClient.Close()
+			defer bClient.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			got := make(chan string, 1)
+			go func() {
+				_, _, reason := BridgeReason(ctx, aServer, bServer, 0)
+				got <- reason
+			}()
+			tt.end(aClient, bClient, cancel)
+
+			select {
+			case r := <-got:
+				if r != tt.want {
+					t.Errorf("reason = %q, want %q", r, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("BridgeReason did not return")
+			}
+		})
+	}
+}
+
+func TestCloseWrite(t *testing.T) {
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	if err := CloseWrite(client); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+	// Peer sees EOF, but can still write back.
+	if _, err := io.ReadAll(server); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	server.Write([]byte("ok")) //nolint:errcheck
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "ok" {
+		t.Errorf("read after CloseWrite = %q, %v", buf, err)
+	}
+
+	// Without half-close support the connection is left open.
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	if err := CloseWrite(p1); !errors.Is(err, ErrHalfCloseUnsupported) {
+		t.Fatalf("CloseWrite(pipe) = %v, want ErrHalfCloseUnsupported", err)
+	}
+	go p2.Read(make([]byte, 1)) //nolint:errcheck
+	if _, err := p1.Write([]byte("x")); err != nil {
+		t.Errorf("pipe should still be open: %v", err)
+	}
+}
+
 func TestIsHarmless(t *testing.T) {
 	if !isHarmless(nil) {
 		t.Error("nil should be harmless")
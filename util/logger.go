@@ -2,8 +2,11 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
@@ -19,13 +22,46 @@ const (
 	LogDebug   LogLevel = 3
 )
 
+// LogFormat selects how log lines are rendered.
+type LogFormat string
+
+const (
+	// LogFormatText is the human-readable "[INF] message" form.
+	// Attributes added with With are not shown.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON writes one slog JSON object per line.
+	LogFormatJSON LogFormat = "json"
+	// LogFormatLogfmt writes slog key=value lines.
+	LogFormatLogfmt LogFormat = "logfmt"
+)
+
+// ParseLogFormat validates a --log-format value.  The empty string
+// means text.
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch f := LogFormat(s); f {
+	case "":
+		return LogFormatText, nil
+	case LogFormatText, LogFormatJSON, LogFormatLogfmt:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", s)
+}
+
+// slogVerbose sits between slog's Debug and Info levels.
+const slogVerbose = slog.Level(-2)
+
 // Logger writes levelled messages to stderr with optional timestamps
-// and level prefixes.
+// and level prefixes, or as structured records through log/slog.
+// Loggers derived with With share their parent's output.
 type Logger struct {
 	level      LogLevel
 	output     io.Writer
-	mu         sync.Mutex
+	mu         *sync.Mutex
 	timestamps bool // if true, prepend RFC3339 timestamps
+
+	format  LogFormat
+	handler slog.Handler // nil for LogFormatText
+	attrs   []any        // key/value pairs added by With
 }
 
 // NewLogger returns a Logger that prints messages at or below the given
@@ -34,61 +70,136 @@ func NewLogger(verbosity int) *Logger {
 	return &Logger{
 		level:      LogLevel(verbosity),
 		output:     os.Stderr,
+		mu:         new(sync.Mutex),
 		timestamps: verbosity >= 3, // auto-enable timestamps in debug mode
+		format:     LogFormatText,
 	}
 }
 
-// SetTimestamps enables or disables timestamp prefixes.
+// SetTimestamps enables or disables timestamp prefixes.  Structured
+// formats always carry a timestamp.
 func (l *Logger) SetTimestamps(on bool) { l.timestamps = on }
 
 // SetOutput overrides the output writer (default: os.Stderr).
-func (l *Logger) SetOutput(w io.Writer) { l.output = w }
+func (l *Logger) SetOutput(w io.Writer) {
+	l.output = w
+	l.buildHandler()
+}
+
+// SetFormat switches between text, JSON and logfmt output.  Call it
+// before deriving loggers with With.
+func (l *Logger) SetFormat(f LogFormat) {
+	l.format = f
+	l.buildHandler()
+}
 
 // Level returns the current log level.
 func (l *Logger) Level() LogLevel { return l.level }
 
+// With returns a logger that adds the given key/value pairs to every
+// structured record, e.g. l.With("peer", addr, "session", id).
+func (l *Logger) With(args ...any) *Logger {
+	child := *l
+	child.attrs = append(append([]any(nil), l.attrs...), args...)
+	return &child
+}
+
+func (l *Logger) buildHandler() {
+	opts := &slog.HandlerOptions{
+		Level: slog.LevelDebug, // verbosity is filtered before records are built
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == slogVerbose {
+				a.Value = slog.StringValue("VERBOSE")
+			}
+			return a
+		},
+	}
+	switch l.format {
+	case LogFormatJSON:
+		l.handler = slog.NewJSONHandler(l.output, opts)
+	case LogFormatLogfmt:
+		l.handler = slog.NewTextHandler(l.output, opts)
+	default:
+		l.handler = nil
+	}
+}
+
 // Info prints when verbosity ≥ 1.  Prefixed with [INF].
 func (l *Logger) Info(format string, args ...interface{}) {
 	if l.level >= LogNormal {
-		l.write("INF", format, args...)
+		l.write("INF", slog.LevelInfo, format, args...)
 	}
 }
 
 // Warn prints when verbosity ≥ 1.  Prefixed with [WRN].
 func (l *Logger) Warn(format string, args ...interface{}) {
 	if l.level >= LogNormal {
-		l.write("WRN", format, args...)
+		l.write("WRN", slog.LevelWarn, format, args...)
 	}
 }
 
 // Verbose prints when verbosity ≥ 2.  Prefixed with [VRB].
 func (l *Logger) Verbose(format string, args ...interface{}) {
 	if l.level >= LogVerbose {
-		l.write("VRB", format, args...)
+		l.write("VRB", slogVerbose, format, args...)
 	}
 }
 
 // Debug prints when verbosity ≥ 3.  Prefixed with [DBG].
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if l.level >= LogDebug {
-		l.write("DBG", format, args...)
+		l.write("DBG", slog.LevelDebug, format, args...)
 	}
 }
 
 // Error always prints regardless of verbosity.  Prefixed with [ERR].
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.write("ERR", format, args...)
+	l.write("ERR", slog.LevelError, format, args...)
 }
 
-func (l *Logger) write(level, format string, args ...interface{}) {
+func (l *Logger) write(prefix string, level slog.Level, format string, args ...interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	msg := fmt.Sprintf(format, args...)
+	if l.handler != nil {
+		r := slog.NewRecord(time.Now(), level, msg, 0)
+		r.Add(l.attrs...)
+		r.Add(errorAttrs(args)...)
+		l.handler.Handle(context.Background(), r) //nolint:errcheck
+		return
+	}
+
 	if l.timestamps {
 		ts := time.Now().Format("15:04:05.000")
-		fmt.Fprintf(l.output, "%s [%s] %s\n", ts, level, msg)
+		fmt.Fprintf(l.output, "%s [%s] %s\n", ts, prefix, msg)
 	} else {
-		fmt.Fprintf(l.output, "[%s] %s\n", level, msg)
+		fmt.Fprintf(l.output, "[%s] %s\n", prefix, msg)
+	}
+}
+
+// errorAttrs returns "error" and "error_type" attributes for the first
+// error among a log call's format arguments, so structured consumers
+// can group failures without parsing messages.
+func errorAttrs(args []interface{}) []any {
+	for _, a := range args {
+		if err, ok := a.(error); ok && err != nil {
+			return []any{"error", err.Error(), "error_type", ErrorType(err)}
+		}
+	}
+	return nil
+}
+
+// ErrorType names the most specific type in err's wrap chain, skipping
+// the generic wrappers produced by fmt.Errorf and errors.New; for
+// example "*net.OpError" or "*errors.SSHError".
+func ErrorType(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch t := fmt.Sprintf("%T", e); t {
+		case "*fmt.wrapError", "*fmt.wrapErrors", "*errors.errorString":
+		default:
+			return t
+		}
 	}
+	return "error"
 }
@@ -2,6 +2,11 @@ package util
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -78,6 +83,148 @@ func TestLogger_WarnLevel(t *testing.T) {
 	}
 }
 
+func TestLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(2)
+	l.SetOutput(&buf)
+	l.SetFormat(LogFormatJSON)
+
+	conn := l.With("mode", "reverse").With("session", 7, "peer", "203.0.113.5:4242")
+	conn.Verbose("connection from %s", "203.0.113.5:4242")
+	dialErr := fmt.Errorf("local dial: %w", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded})
+	conn.Error("failed: %v", dialErr)
+	l.Debug("not shown at -vv")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d:\n%s", len(lines), buf.String())
+	}
+
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("line 1 is not JSON: %v", err)
+	}
+	want := map[string]any{
+		"level": "VERBOSE", "msg": "connection from 203.0.113.5:4242",
+		"mode": "reverse", "session": float64(7), "peer": "203.0.113.5:4242",
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, want %v", k, rec[k], v)
+		}
+	}
+	if _, ok := rec["time"]; !ok {
+		t.Error("record has no time")
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("line 2 is not JSON: %v", err)
+	}
+	if rec["level"] != "ERROR" || rec["error_type"] != "*net.OpError" || rec["error"] != dialErr.Error() {
+		t.Errorf("error record = %v", rec)
+	}
+
+	// With must not leak attributes into the parent.
+	buf.Reset()
+	l.Info("plain")
+	if strings.Contains(buf.String(), "session") {
+		t.Errorf("parent logger picked up child attributes: %s", buf.String())
+	}
+}
+
+func TestLogger_Logfmt(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(1)
+	l.SetOutput(&buf)
+	l.SetFormat(LogFormatLogfmt)
+
+	l.With("peer", "10.0.0.1:80", "bytes_in", 42).Info("closed")
+
+	out := buf.String()
+	for _, want := range []string{"level=INFO", "msg=closed", "peer=10.0.0.1:80", "bytes_in=42"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q missing %q", out, want)
+		}
+	}
+}
+
+// TestLogger_TextIgnoresAttrs verifies the default format is unchanged
+// by structured attributes.
+func TestLogger_TextIgnoresAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(1)
+	l.SetOutput(&buf)
+	l.SetTimestamps(false)
+
+	l.With("peer", "x").Info("hello %d", 1)
+	if got := buf.String(); got != "[INF] hello 1\n" {
+		t.Errorf("text output = %q", got)
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	for in, want := range map[string]LogFormat{"": LogFormatText, "text": LogFormatText, "json": LogFormatJSON, "logfmt": LogFormatLogfmt} {
+		if got, err := ParseLogFormat(in); err != nil || got != want {
+			t.Errorf("ParseLogFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Error("ParseLogFormat(xml) should fail")
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("plain"), "error"},
+		{fmt.Errorf("wrap: %w", &net.AddrError{Err: "bad"}), "*net.AddrError"},
+		{&net.OpError{Op: "read", Err: os.ErrClosed}, "*net.OpError"},
+	}
+	for _, tt := range tests {
+		if got := ErrorType(tt.err); got != tt.want {
+			t.Errorf("ErrorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gonc.log")
+	rf, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	// Each write of 6 bytes forces a rotation after the first.
+	for _, line := range []string{"aaaaa\n", "bbbbb\n", "ccccc\n", "ddddd\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return "<missing>"
+		}
+		return string(b)
+	}
+	if got := read(path); got != "ddddd\n" {
+		t.Errorf("current = %q", got)
+	}
+	if got := read(path + ".1"); got != "ccccc\n" {
+		t.Errorf("backup 1 = %q", got)
+	}
+	if got := read(path + ".2"); got != "bbbbb\n" {
+		t.Errorf("backup 2 = %q", got)
+	}
+	if got := read(path + ".3"); got != "<missing>" {
+		t.Errorf("backup 3 should not exist, got %q", got)
+	}
+}
+
 func TestBufPool_RoundTrip(t *testing.T) {
 	buf := GetBuf()
 	if buf == nil {